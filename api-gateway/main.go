@@ -13,7 +13,8 @@ import (
 )
 
 func main() {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
 	r.RedirectTrailingSlash = false // 关闭 301
 	r.Use(middleware.Cors())
 	r.Use(middleware.JWTMiddleware())
@@ -34,12 +35,16 @@ func main() {
 	r.Any("/api/v1/tags/*proxyPath", createProxyHandler(markServiceUrl))
 	r.Any("/api/v1/types/*proxyPath", createProxyHandler(markServiceUrl))
 	r.Any("/api/v1/pairs/*proxyPath", createProxyHandler(markServiceUrl))
+	r.Any("/api/v1/credentials/*proxyPath", createProxyHandler(markServiceUrl))
 
 	r.Any("/api/v1/mqtt/*proxyPath", createProxyHandler(mqttServiceUrl))
 
 	r.Any("/api/v1/station/*proxyPath", createProxyHandler(mapServiceUrl))
 	r.Any("/api/v1/custom-map/*proxyPath", createProxyHandler(mapServiceUrl))
 	r.Any("/api/v1/polygon-fence/*proxyPath", createProxyHandler(mapServiceUrl))
+	// bare /api/v1/site-node (create) + /api/v1/site-node/* (tree, detail)
+	r.Any("/api/v1/site-node", createProxyHandler(mapServiceUrl))
+	r.Any("/api/v1/site-node/*proxyPath", createProxyHandler(mapServiceUrl))
 	r.Any("/uploads/*proxyPath", createProxyHandler(mapServiceUrl))
 	// Gin？启动！
 	port := utils.GetEnv("PORT", "8000")
@@ -60,6 +65,7 @@ func createProxyHandler(raw string) gin.HandlerFunc {
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.FlushInterval = -1 // 立即刷新，SSE 实时事件流（/api/v1/mqtt/stream）不被缓冲
 
 	return func(c *gin.Context) {
 		// 透传网关解析出的用户信息
@@ -67,6 +73,7 @@ func createProxyHandler(raw string) gin.HandlerFunc {
 			c.Request.Header.Set("X-UserID", uid)
 			c.Request.Header.Set("X-UserName", c.GetHeader("X-UserName"))
 			c.Request.Header.Set("X-UserType", c.GetHeader("X-UserType"))
+			c.Request.Header.Set("X-Tenant", c.GetHeader("X-Tenant"))
 		}
 
 		proxy.ServeHTTP(c.Writer, c.Request)
@@ -24,6 +24,7 @@ type CustomClaims struct {
 	UserID   string          `json:"user_id"`
 	Username string          `json:"username"`
 	UserType models.UserType `json:"user_type"`
+	Tenant   string          `json:"tenant,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -33,6 +34,7 @@ func generateToken(u *models.User, expiresIn time.Duration, issuer string) (stri
 		UserID:   u.ID,
 		Username: u.Username,
 		UserType: u.UserType,
+		Tenant:   u.Tenant,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -101,6 +103,7 @@ func RefreshAccessToken(refreshToken string) (string, error) {
 		ID:       claims.UserID,
 		Username: claims.Username,
 		UserType: claims.UserType,
+		Tenant:   claims.Tenant,
 	}
 
 	return GenerateToken(user)
@@ -2,6 +2,7 @@
 import request from "@/utils/request";
 import type { ApiResponse } from "@/types/response";
 import type { CustomMapCreateReq, CustomMapUpdateReq, CustomMapResp } from "@/types/customMap";
+import type { SiteScope } from "@/types/siteNode";
 
 /* ----------------- 常量 ----------------- */
 const URLS = {
@@ -21,16 +22,18 @@ export async function createCustomMap(data: CustomMapCreateReq) {
 
 /**
  * 获取自制地图列表（不分页）
+ * @param scope 按层级节点（含下级节点）/ 租户过滤
  */
-export async function listCustomMaps() {
-  return request.get<ApiResponse<CustomMapResp[]>>(URLS.customMap);
+export async function listCustomMaps(scope?: SiteScope) {
+  return request.get<ApiResponse<CustomMapResp[]>>(URLS.customMap, { params: scope });
 }
 
 /**
  * 获取最新的自制地图
+ * @param scope 给出时获取该节点（含下级节点）/ 租户内最新的地图
  */
-export async function getLatestCustomMap() {
-  return request.get<ApiResponse<CustomMapResp>>(URLS.latest);
+export async function getLatestCustomMap(scope?: SiteScope) {
+  return request.get<ApiResponse<CustomMapResp>>(URLS.latest, { params: scope });
 }
 
 /**
@@ -24,5 +24,8 @@ export * as customMapApi from "./customMap";
 // 多边形围栏 API
 export * as polygonFenceApi from "./polygonFence";
 
+// 站点层级 API
+export * as siteNodeApi from "./siteNode";
+
 // 公共类型
 export type { ListParams, UserListParams } from "./types";
@@ -2,12 +2,15 @@
 import request from "@/utils/request";
 import type { ApiResponse } from "@/types/response";
 import type {
+  FenceOverlap,
+  FenceWriteResult,
   PolygonFenceCreateReq,
   PolygonFenceUpdateReq,
   PolygonFenceResp,
   PointCheckReq,
   PointCheckResp,
 } from "@/types/polygonFence";
+import type { SiteScope } from "@/types/siteNode";
 
 /* ----------------- 常量 ----------------- */
 const URLS = {
@@ -19,6 +22,7 @@ const URLS = {
   checkIndoorAny: "/api/v1/polygon-fence/check-indoor-any",
   checkOutdoorAll: "/api/v1/polygon-fence/check-outdoor-all",
   checkOutdoorAny: "/api/v1/polygon-fence/check-outdoor-any",
+  overlaps: "/api/v1/polygon-fence/overlaps",
 } as const;
 
 /* ----------------- API 方法 ----------------- */
@@ -28,7 +32,7 @@ const URLS = {
  * @param data 多边形围栏创建请求数据
  */
 export async function createPolygonFence(data: PolygonFenceCreateReq) {
-  return request.post<ApiResponse<null>>(`${URLS.polygonFence}/`, data);
+  return request.post<ApiResponse<FenceWriteResult | null>>(`${URLS.polygonFence}/`, data);
 }
 
 /**
@@ -43,10 +47,13 @@ export async function listPolygonFences(activeOnly: boolean = false) {
 /**
  * 获取室内围栏列表
  * @param activeOnly 是否只获取激活的围栏（默认false）
+ * @param mapId 自制地图 ID，给出时只获取该地图与全局围栏
  */
-export async function listIndoorFences(activeOnly: boolean = false) {
-  const url = activeOnly ? `${URLS.indoor}?active_only=true` : URLS.indoor;
-  return request.get<ApiResponse<PolygonFenceResp[]>>(url);
+export async function listIndoorFences(activeOnly: boolean = false, mapId?: string) {
+  const params: Record<string, string> = {};
+  if (activeOnly) params.active_only = "true";
+  if (mapId) params.map_id = mapId;
+  return request.get<ApiResponse<PolygonFenceResp[]>>(URLS.indoor, { params });
 }
 
 /**
@@ -72,7 +79,7 @@ export async function getPolygonFenceByID(id: string) {
  * @param data 多边形围栏更新请求数据
  */
 export async function updatePolygonFence(id: string, data: PolygonFenceUpdateReq) {
-  return request.put<ApiResponse<null>>(`${URLS.polygonFence}/${id}`, data);
+  return request.put<ApiResponse<FenceWriteResult | null>>(`${URLS.polygonFence}/${id}`, data);
 }
 
 /**
@@ -155,3 +162,22 @@ export async function checkPointInOutdoorFence(fenceId: string, point: PointChec
     point,
   );
 }
+
+/**
+ * 列出两两重叠的激活围栏
+ * @param mapId 自制地图 ID，给出时只比较该地图与全局围栏
+ * @param scope 层级过滤
+ */
+export async function listFenceOverlaps(mapId?: string, scope?: SiteScope) {
+  const params: Record<string, string> = { ...scope };
+  if (mapId) params.map_id = mapId;
+  return request.get<ApiResponse<FenceOverlap[]>>(URLS.overlaps, { params });
+}
+
+/**
+ * 获取与指定围栏重叠的激活围栏
+ * @param fenceId 围栏 ID
+ */
+export async function getFenceOverlaps(fenceId: string) {
+  return request.get<ApiResponse<FenceOverlap[]>>(`${URLS.polygonFence}/${fenceId}/overlaps`);
+}
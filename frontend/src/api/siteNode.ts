@@ -0,0 +1,53 @@
+// src/api/siteNode.ts
+import request from "@/utils/request";
+import type { ApiResponse } from "@/types/response";
+import type { SiteNodeCreateReq, SiteNodeUpdateReq, SiteNodeResp, SiteNodeTree } from "@/types/siteNode";
+
+/* ----------------- 常量 ----------------- */
+const URLS = {
+  siteNode: "/api/v1/site-node/",
+  tree: "/api/v1/site-node/tree",
+} as const;
+
+/* ----------------- API 方法 ----------------- */
+
+/**
+ * 创建层级节点
+ * @param data 层级节点创建请求数据
+ */
+export async function createSiteNode(data: SiteNodeCreateReq) {
+  return request.post<ApiResponse<SiteNodeResp>>(URLS.siteNode, data);
+}
+
+/**
+ * 获取层级树
+ * @param params root_id 指定子树根节点，tenant 按租户过滤（仅管理员，其他用户固定为自己的租户）
+ */
+export async function getSiteTree(params?: { root_id?: string; tenant?: string }) {
+  return request.get<ApiResponse<SiteNodeTree[]>>(URLS.tree, { params });
+}
+
+/**
+ * 根据 ID 获取单个层级节点（含从站点到该节点的路径）
+ * @param id 节点 ID
+ */
+export async function getSiteNodeByID(id: string) {
+  return request.get<ApiResponse<SiteNodeResp>>(`${URLS.siteNode}${id}`);
+}
+
+/**
+ * 更新层级节点
+ * @param id 节点 ID
+ * @param data 层级节点更新请求数据
+ */
+export async function updateSiteNode(id: string, data: SiteNodeUpdateReq) {
+  return request.put<ApiResponse<null>>(`${URLS.siteNode}${id}`, data);
+}
+
+/**
+ * 删除层级节点（无子节点和绑定资源时）
+ * @param id 节点 ID
+ */
+export async function deleteSiteNode(id: string) {
+  return request.delete<ApiResponse<null>>(`${URLS.siteNode}${id}`);
+}
@@ -20,9 +20,12 @@ export async function createStation(data: StationCreateReq) {
 
 /**
  * 获取基站列表（不分页）
+ * @param mapId 自制地图 ID，给出时只获取该地图与未指定地图的基站
  */
-export async function listStations() {
-  return request.get<ApiResponse<StationResp[]>>(URLS.station);
+export async function listStations(mapId?: string) {
+  return request.get<ApiResponse<StationResp[]>>(URLS.station, {
+    params: mapId ? { map_id: mapId } : undefined,
+  });
 }
 
 /**
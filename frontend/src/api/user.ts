@@ -35,16 +35,18 @@ export interface CreateRequest {
   username: string;
   password: string;
   user_type: UserType;
+  tenant?: string; // 所属租户，仅 admin / root 可设置
 }
 
 /* 更新用户（所有字段可选） */
-export type UpdateRequest = Partial<Pick<CreateRequest, "username" | "user_type">>;
+export type UpdateRequest = Partial<Pick<CreateRequest, "username" | "user_type" | "tenant">>;
 
 /* 用户信息（后端 User 表） */
 export interface User {
   id: string;
   username: string;
   user_type: UserType;
+  tenant: string; // 空串为未分配
   created_at: string;
   updated_at: string;
 }
@@ -12,6 +12,7 @@ export interface CustomMapCreateReq {
   center_x: number;
   center_y: number;
   scale_ratio?: number; // 底图缩放比例，默认 1.0
+  node_id?: string; // 所属站点层级节点（通常为楼层）
   description?: string;
 }
 
@@ -27,6 +28,7 @@ export interface CustomMapUpdateReq {
   center_x?: number;
   center_y?: number;
   scale_ratio?: number; // 底图缩放比例
+  node_id?: string; // 空字符串表示解除绑定
   description?: string;
 }
 
@@ -43,6 +45,7 @@ export interface CustomMapResp {
   center_x: number;
   center_y: number;
   scale_ratio: number; // 底图缩放比例，默认 1.0
+  node_id: string | null;
   description: string;
   created_at: string;
   updated_at: string;
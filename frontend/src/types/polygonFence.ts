@@ -11,7 +11,11 @@ export interface PolygonFenceCreateReq {
   is_indoor: boolean;
   fence_name: string;
   points: Point[];
+  map_id?: string; // 所属自制地图（仅室内围栏），缺省为全局
+  node_id?: string; // 所属站点层级节点
   description?: string;
+  repair?: boolean; // 多边形自相交等无效时自动修复，否则创建失败
+  block_overlap?: boolean; // 与其他激活围栏重叠时拒绝创建，默认只警告
 }
 
 /** 更新多边形围栏请求 */
@@ -19,8 +23,36 @@ export interface PolygonFenceUpdateReq {
   is_indoor?: boolean;
   fence_name?: string;
   points?: Point[];
+  map_id?: string; // 空字符串表示改为全局
+  node_id?: string; // 空字符串表示解除绑定
   description?: string;
   is_active?: boolean;
+  repair?: boolean; // 同创建，仅在形状变化时生效
+  block_overlap?: boolean; // 修改后与其他激活围栏重叠时拒绝修改，默认只警告
+}
+
+/** 几何校验发现的问题（自动修复时随创建 / 更新响应返回） */
+export interface GeometryIssue {
+  reason: string; // ST_IsValidReason 原文
+  message: string;
+  location?: Point;
+}
+
+/** 两个激活围栏的重叠 */
+export interface FenceOverlap {
+  fence_id?: string;
+  fence_name: string;
+  other_id: string;
+  other_name: string;
+  overlap_area: number; // 室外为平方米，室内为平面坐标单位的平方
+  fence_ratio: number; // 重叠面积占 fence 面积的比例
+  other_ratio: number; // 重叠面积占 other 面积的比例
+}
+
+/** 创建 / 更新围栏的附加信息 */
+export interface FenceWriteResult {
+  repaired?: GeometryIssue;
+  overlaps?: FenceOverlap[];
 }
 
 /** 多边形围栏响应 */
@@ -29,6 +61,8 @@ export interface PolygonFenceResp {
   is_indoor: boolean;
   fence_name: string;
   points: Point[];
+  map_id: string | null;
+  node_id: string | null;
   description: string;
   is_active: boolean;
   created_at: string;
@@ -39,6 +73,7 @@ export interface PolygonFenceResp {
 export interface PointCheckReq {
   x: number;
   y: number;
+  map_id?: string; // 点所在的自制地图
 }
 
 /** 检查点是否在围栏内的响应 */
@@ -0,0 +1,60 @@
+/* ========== 请求/响应 DTO ========== */
+
+/** 层级节点类型：site → building → floor，yard 为站点下的室外场地 */
+export type SiteNodeType = "site" | "building" | "floor" | "yard";
+
+/** 创建层级节点请求 */
+export interface SiteNodeCreateReq {
+  node_type: SiteNodeType;
+  name: string;
+  parent_id?: string; // 站点不填，其余必填
+  tenant?: string; // 仅站点可设置，下级节点继承
+  description?: string;
+}
+
+/** 更新层级节点请求 */
+export interface SiteNodeUpdateReq {
+  name?: string;
+  parent_id?: string; // 移动到新的父节点
+  tenant?: string; // 仅站点可设置
+  description?: string;
+}
+
+/** 路径项（从站点到当前节点） */
+export interface SiteNodePathItem {
+  id: string;
+  node_type: SiteNodeType;
+  name: string;
+}
+
+/** 层级节点响应 */
+export interface SiteNodeResp {
+  id: string;
+  parent_id: string | null;
+  node_type: SiteNodeType;
+  name: string;
+  tenant: string;
+  description: string;
+  path?: SiteNodePathItem[];
+  created_at: string;
+  updated_at: string;
+}
+
+/** 层级树节点，计数只统计直接挂在该节点上的资源 */
+export interface SiteNodeTree {
+  id: string;
+  node_type: SiteNodeType;
+  name: string;
+  tenant: string;
+  description: string;
+  map_count: number;
+  station_count: number;
+  fence_count: number;
+  children: SiteNodeTree[];
+}
+
+/** 列表接口的层级过滤参数 */
+export interface SiteScope {
+  node_id?: string; // 包含下级节点
+  tenant?: string; // 仅管理员可指定，其他用户固定为自己的租户
+}
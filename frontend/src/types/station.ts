@@ -3,12 +3,16 @@ export interface StationCreateReq {
   station_name: string;
   coordinate_x: number;
   coordinate_y: number;
+  map_id?: string;
+  node_id?: string;
 }
 
 export interface StationUpdateReq {
   station_name?: string;
   coordinate_x?: number;
   coordinate_y?: number;
+  map_id?: string; // 空字符串表示解除绑定
+  node_id?: string; // 空字符串表示解除绑定
 }
 
 export interface StationResp {
@@ -16,6 +20,8 @@ export interface StationResp {
   station_name: string;
   coordinate_x: number;
   coordinate_y: number;
+  map_id: string | null;
+  node_id: string | null;
   created_at: string;
   updated_at: string;
 }
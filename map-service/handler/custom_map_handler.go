@@ -96,7 +96,7 @@ func (h *CustomMapHandler) GetCustomMap(c *fiber.Ctx) error {
 func (h *CustomMapHandler) ListCustomMaps(c *fiber.Ctx) error {
 	baseURL := getBaseURL(c)
 
-	list, err := h.customMapService.GetAllCustomMaps(baseURL)
+	list, err := h.customMapService.GetAllCustomMaps(listScope(c), baseURL)
 	if err != nil {
 		return err
 	}
@@ -109,7 +109,7 @@ func (h *CustomMapHandler) ListCustomMaps(c *fiber.Ctx) error {
 func (h *CustomMapHandler) GetLatestCustomMap(c *fiber.Ctx) error {
 	baseURL := getBaseURL(c)
 
-	resp, err := h.customMapService.GetLatestCustomMap(baseURL)
+	resp, err := h.customMapService.GetLatestCustomMap(listScope(c), baseURL)
 	if err != nil {
 		return err
 	}
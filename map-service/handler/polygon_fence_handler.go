@@ -1,6 +1,12 @@
 package handler
 
 import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"IOT-Manage-System/map-service/middleware"
 	"IOT-Manage-System/map-service/model"
 	"IOT-Manage-System/map-service/service"
 	"IOT-Manage-System/map-service/utils"
@@ -29,11 +35,78 @@ func (h *PolygonFenceHandler) CreatePolygonFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	if err := h.polygonFenceService.CreatePolygonFence(req); err != nil {
+	res, err := h.polygonFenceService.CreatePolygonFence(req, c.Get("X-UserID"))
+	if err != nil {
+		return err
+	}
+
+	data, msg := writeResult(res, "多边形围栏创建成功")
+	return utils.SendCreatedResponse(c, data, msg)
+}
+
+// ImportFences 从 GeoJSON FeatureCollection / KML 批量导入围栏
+// 文件可用 multipart 字段 file 上传，也可直接作为请求体；?format=geojson|kml（缺省按内容判断），?on_conflict=error|skip|replace，
+// ?repair=true 时自动修复无效的多边形几何，?atomic=true 时任意要素失败都整体不导入；
+// ?map_id= / ?node_id= / ?map_mapping= / ?node_mapping= / ?drop_refs=true 把文件中源站点的地图、节点替换为本站点的
+func (h *PolygonFenceHandler) ImportFences(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format"))
+	data := c.Body()
+	if fh, err := c.FormFile("file"); err == nil {
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fh.Filename)), ".")
+			if format == "json" {
+				format = service.FenceFormatGeoJSON
+			}
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "读取上传文件失败")
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "读取上传文件失败")
+		}
+	}
+	if len(data) == 0 {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "缺少导入文件")
+	}
+
+	opts := model.FenceImportOptions{
+		OnConflict:  c.Query("on_conflict"),
+		Repair:      c.QueryBool("repair"),
+		Atomic:      c.QueryBool("atomic"),
+		DropRefs:    c.QueryBool("drop_refs"),
+		MapID:       c.Query("map_id"),
+		NodeID:      c.Query("node_id"),
+		MapMapping:  c.Query("map_mapping"),
+		NodeMapping: c.Query("node_mapping"),
+		Tenant:      middleware.OwnTenant(c),
+	}
+	resp, err := h.polygonFenceService.ImportFences(format, data, opts, c.Get("X-UserID"))
+	if err != nil {
 		return err
 	}
+	msg := "围栏导入成功"
+	if len(resp.Failed) > 0 {
+		msg = fmt.Sprintf("围栏导入完成，%d 个要素未导入", len(resp.Failed))
+	}
+	return utils.SendCreatedResponse(c, resp, msg)
+}
 
-	return utils.SendCreatedResponse(c, nil, "多边形围栏创建成功")
+// ExportFences 导出围栏为 GeoJSON / KML 文件（非统一响应格式）
+func (h *PolygonFenceHandler) ExportFences(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", service.FenceFormatGeoJSON))
+	out, contentType, err := h.polygonFenceService.ExportFences(format, c.QueryBool("active_only", false), listScope(c))
+	if err != nil {
+		return err
+	}
+	ext := ".geojson"
+	if format == service.FenceFormatKML {
+		ext = ".kml"
+	}
+	c.Attachment("polygon_fences" + ext)
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(out)
 }
 
 /* ---------- 2. 单条查询 ---------- */
@@ -56,7 +129,7 @@ func (h *PolygonFenceHandler) GetPolygonFence(c *fiber.Ctx) error {
 func (h *PolygonFenceHandler) ListPolygonFences(c *fiber.Ctx) error {
 	activeOnly := c.QueryBool("active_only", false)
 
-	list, err := h.polygonFenceService.ListPolygonFences(activeOnly)
+	list, err := h.polygonFenceService.ListPolygonFences(activeOnly, listScope(c))
 	if err != nil {
 		return err
 	}
@@ -68,7 +141,7 @@ func (h *PolygonFenceHandler) ListPolygonFences(c *fiber.Ctx) error {
 func (h *PolygonFenceHandler) ListIndoorFences(c *fiber.Ctx) error {
 	activeOnly := c.QueryBool("active_only", false)
 
-	list, err := h.polygonFenceService.ListIndoorFences(activeOnly)
+	list, err := h.polygonFenceService.ListIndoorFences(activeOnly, listScope(c))
 	if err != nil {
 		return err
 	}
@@ -80,7 +153,7 @@ func (h *PolygonFenceHandler) ListIndoorFences(c *fiber.Ctx) error {
 func (h *PolygonFenceHandler) ListOutdoorFences(c *fiber.Ctx) error {
 	activeOnly := c.QueryBool("active_only", false)
 
-	list, err := h.polygonFenceService.ListOutdoorFences(activeOnly)
+	list, err := h.polygonFenceService.ListOutdoorFences(activeOnly, listScope(c))
 	if err != nil {
 		return err
 	}
@@ -103,11 +176,27 @@ func (h *PolygonFenceHandler) UpdatePolygonFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	if err := h.polygonFenceService.UpdatePolygonFence(id, req); err != nil {
+	res, err := h.polygonFenceService.UpdatePolygonFence(id, req, c.Get("X-UserID"))
+	if err != nil {
 		return err
 	}
 
-	return utils.SendSuccessResponse(c, nil, "多边形围栏更新成功")
+	data, msg := writeResult(res, "多边形围栏更新成功")
+	return utils.SendSuccessResponse(c, data, msg)
+}
+
+// writeResult 创建 / 更新的响应：几何被修复或与其他围栏重叠时返回详情并在提示中说明，否则 data 为 null
+func writeResult(res *model.FenceWriteResult, msg string) (any, string) {
+	if res.Repaired == nil && len(res.Overlaps) == 0 {
+		return nil, msg
+	}
+	if res.Repaired != nil {
+		msg += "，几何已自动修复"
+	}
+	if len(res.Overlaps) > 0 {
+		msg += fmt.Sprintf("，但与 %d 个激活围栏重叠", len(res.Overlaps))
+	}
+	return res, msg
 }
 
 /* ---------- 5. 删除 ---------- */
@@ -116,7 +205,7 @@ func (h *PolygonFenceHandler) UpdatePolygonFence(c *fiber.Ctx) error {
 func (h *PolygonFenceHandler) DeletePolygonFence(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	if err := h.polygonFenceService.DeletePolygonFence(id); err != nil {
+	if err := h.polygonFenceService.DeletePolygonFence(id, c.Get("X-UserID")); err != nil {
 		return err
 	}
 
@@ -138,7 +227,8 @@ func (h *PolygonFenceHandler) CheckPointInFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	resp, err := h.polygonFenceService.CheckPointInFence(fenceID, req.X, req.Y)
+	x, y := req.Coords()
+	resp, err := h.polygonFenceService.CheckPointInFence(fenceID, x, y, req.MapID)
 	if err != nil {
 		return err
 	}
@@ -157,7 +247,8 @@ func (h *PolygonFenceHandler) CheckPointInAllFences(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	resp, err := h.polygonFenceService.CheckPointInAllFences(req.X, req.Y)
+	x, y := req.Coords()
+	resp, err := h.polygonFenceService.CheckPointInAllFences(x, y, req.MapID)
 	if err != nil {
 		return err
 	}
@@ -180,7 +271,8 @@ func (h *PolygonFenceHandler) CheckPointInIndoorFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	resp, err := h.polygonFenceService.CheckPointInIndoorFence(fenceID, req.X, req.Y)
+	x, y := req.Coords()
+	resp, err := h.polygonFenceService.CheckPointInIndoorFence(fenceID, x, y, req.MapID)
 	if err != nil {
 		return err
 	}
@@ -201,7 +293,8 @@ func (h *PolygonFenceHandler) CheckPointInOutdoorFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	resp, err := h.polygonFenceService.CheckPointInOutdoorFence(fenceID, req.X, req.Y)
+	x, y := req.Coords()
+	resp, err := h.polygonFenceService.CheckPointInOutdoorFence(fenceID, x, y)
 	if err != nil {
 		return err
 	}
@@ -220,7 +313,8 @@ func (h *PolygonFenceHandler) CheckPointInIndoorFences(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	resp, err := h.polygonFenceService.CheckPointInIndoorFences(req.X, req.Y)
+	x, y := req.Coords()
+	resp, err := h.polygonFenceService.CheckPointInIndoorFences(x, y, req.MapID)
 	if err != nil {
 		return err
 	}
@@ -239,7 +333,8 @@ func (h *PolygonFenceHandler) CheckPointInOutdoorFences(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	resp, err := h.polygonFenceService.CheckPointInOutdoorFences(req.X, req.Y)
+	x, y := req.Coords()
+	resp, err := h.polygonFenceService.CheckPointInOutdoorFences(x, y)
 	if err != nil {
 		return err
 	}
@@ -258,7 +353,8 @@ func (h *PolygonFenceHandler) IsPointInAnyIndoorFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	isInside, err := h.polygonFenceService.IsPointInAnyIndoorFence(req.X, req.Y)
+	x, y := req.Coords()
+	isInside, err := h.polygonFenceService.IsPointInAnyIndoorFence(x, y, req.MapID)
 	if err != nil {
 		return err
 	}
@@ -277,10 +373,105 @@ func (h *PolygonFenceHandler) IsPointInAnyOutdoorFence(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	isInside, err := h.polygonFenceService.IsPointInAnyOutdoorFence(req.X, req.Y)
+	x, y := req.Coords()
+	isInside, err := h.polygonFenceService.IsPointInAnyOutdoorFence(x, y)
 	if err != nil {
 		return err
 	}
 
 	return utils.SendSuccessResponse(c, map[string]bool{"is_inside": isInside})
 }
+
+/* ---------- 8. 批量检查 ---------- */
+
+// CheckPointsBatch 批量检查多个设备点所在的围栏
+func (h *PolygonFenceHandler) CheckPointsBatch(c *fiber.Ctx) error {
+	req := new(model.BatchCheckReq)
+	if err := c.BodyParser(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "请求参数解析失败")
+	}
+
+	if err := utils.ValidateStruct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	results, err := h.polygonFenceService.CheckPointsBatch(req.Points)
+	if err != nil {
+		return err
+	}
+
+	return utils.SendSuccessResponse(c, results)
+}
+
+/* ---------- 9. 修订历史 ---------- */
+
+// ListFenceRevisions 获取围栏的修订历史
+func (h *PolygonFenceHandler) ListFenceRevisions(c *fiber.Ctx) error {
+	resp, err := h.polygonFenceService.ListFenceRevisions(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return utils.SendSuccessResponse(c, resp)
+}
+
+// GetFenceRevision 获取围栏在指定版本时的状态
+func (h *PolygonFenceHandler) GetFenceRevision(c *fiber.Ctx) error {
+	version, err := c.ParamsInt("version")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "版本号必须为正整数")
+	}
+
+	resp, err := h.polygonFenceService.GetFenceRevision(c.Params("id"), version)
+	if err != nil {
+		return err
+	}
+
+	return utils.SendSuccessResponse(c, resp)
+}
+
+// RollbackPolygonFence 把围栏回滚到指定版本
+func (h *PolygonFenceHandler) RollbackPolygonFence(c *fiber.Ctx) error {
+	version, err := c.ParamsInt("version")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "版本号必须为正整数")
+	}
+
+	// 请求体可省略
+	req := new(model.FenceRollbackReq)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(req); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "请求参数解析失败")
+		}
+	}
+
+	resp, err := h.polygonFenceService.RollbackPolygonFence(c.Params("id"), version, req, c.Get("X-UserID"))
+	if err != nil {
+		return err
+	}
+
+	_, msg := writeResult(&resp.FenceWriteResult, "围栏已回滚")
+	return utils.SendSuccessResponse(c, resp, msg)
+}
+
+/* ---------- 10. 重叠检测 ---------- */
+
+// ListFenceOverlaps 列出两两重叠的激活围栏（支持 ?map_id=&node_id=&tenant=）
+func (h *PolygonFenceHandler) ListFenceOverlaps(c *fiber.Ctx) error {
+	list, err := h.polygonFenceService.ListFenceOverlaps(listScope(c))
+	if err != nil {
+		return err
+	}
+
+	return utils.SendSuccessResponse(c, list)
+}
+
+// GetFenceOverlaps 获取与指定围栏重叠的激活围栏
+func (h *PolygonFenceHandler) GetFenceOverlaps(c *fiber.Ctx) error {
+	list, err := h.polygonFenceService.GetFenceOverlaps(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return utils.SendSuccessResponse(c, list)
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/middleware"
+	"IOT-Manage-System/map-service/model"
+	"IOT-Manage-System/map-service/service"
+	"IOT-Manage-System/map-service/utils"
+)
+
+type SiteNodeHandler struct {
+	siteNodeService *service.SiteNodeService
+}
+
+// NewSiteNodeHandler 构造函数
+func NewSiteNodeHandler(svc *service.SiteNodeService) *SiteNodeHandler {
+	return &SiteNodeHandler{siteNodeService: svc}
+}
+
+// listScope 列表接口共用的过滤参数：?map_id= / ?node_id=，租户由调用方身份确定（管理员可用 ?tenant= 指定）
+func listScope(c *fiber.Ctx) model.ListScope {
+	return model.ListScope{
+		MapID:  c.Query("map_id"),
+		NodeID: c.Query("node_id"),
+		Tenant: middleware.TenantScope(c),
+	}
+}
+
+/* ---------- 1. 创建 ---------- */
+
+func (h *SiteNodeHandler) CreateSiteNode(c *fiber.Ctx) error {
+	req := new(model.SiteNodeCreateReq)
+	if err := c.BodyParser(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "参数解析失败")
+	}
+
+	// 验证参数
+	if err := utils.ValidateStruct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	// 非管理员创建的站点归属自己的租户
+	if own := middleware.OwnTenant(c); own != nil {
+		if req.Tenant != "" && req.Tenant != *own {
+			return errs.ErrForbidden.WithDetails("只有管理员可以为其他租户创建站点")
+		}
+		if req.NodeType == model.NodeTypeSite {
+			req.Tenant = *own
+		}
+	}
+
+	resp, err := h.siteNodeService.CreateSiteNode(req)
+	if err != nil {
+		return err
+	}
+	return utils.SendCreatedResponse(c, resp, "层级节点创建成功")
+}
+
+/* ---------- 2. 层级树 ---------- */
+
+// GetTree 获取层级树（支持 ?root_id= 指定子树；非管理员只能看到自己租户的站点，管理员可用 ?tenant= 过滤）
+func (h *SiteNodeHandler) GetTree(c *fiber.Ctx) error {
+	tree, err := h.siteNodeService.GetTree(c.Query("root_id"), middleware.TenantScope(c))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, tree)
+}
+
+/* ---------- 3. 单条查询 ---------- */
+
+func (h *SiteNodeHandler) GetSiteNode(c *fiber.Ctx) error {
+	resp, err := h.siteNodeService.GetSiteNode(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, resp)
+}
+
+/* ---------- 4. 更新 ---------- */
+
+func (h *SiteNodeHandler) UpdateSiteNode(c *fiber.Ctx) error {
+	req := new(model.SiteNodeUpdateReq)
+	if err := c.BodyParser(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "参数解析失败")
+	}
+
+	// 验证参数
+	if err := utils.ValidateStruct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	if own := middleware.OwnTenant(c); own != nil && req.Tenant != nil && *req.Tenant != *own {
+		return errs.ErrForbidden.WithDetails("只有管理员可以把站点转给其他租户")
+	}
+
+	if err := h.siteNodeService.UpdateSiteNode(c.Params("id"), req); err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, nil, "层级节点更新成功")
+}
+
+/* ---------- 5. 删除 ---------- */
+
+func (h *SiteNodeHandler) DeleteSiteNode(c *fiber.Ctx) error {
+	if err := h.siteNodeService.DeleteSiteNode(c.Params("id")); err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, nil, "层级节点删除成功")
+}
@@ -50,7 +50,7 @@ func (h *StationHandler) GetStation(c *fiber.Ctx) error {
 /* ---------- 3. 全量（不分页查询） ---------- */
 
 func (h *StationHandler) ListStation(c *fiber.Ctx) error { // 如果不需要分页，perPage <= 0 时内部会返回全量
-	list, err := h.stationService.GetALLStation()
+	list, err := h.stationService.GetALLStation(listScope(c))
 	if err != nil {
 		return err
 	}
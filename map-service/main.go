@@ -8,6 +8,7 @@ import (
 
 	"IOT-Manage-System/map-service/config"
 	"IOT-Manage-System/map-service/handler"
+	"IOT-Manage-System/map-service/middleware"
 	"IOT-Manage-System/map-service/repo"
 	"IOT-Manage-System/map-service/service"
 	"IOT-Manage-System/map-service/utils"
@@ -51,6 +52,10 @@ func main() {
 	polygonFenceService := service.NewPolygonFenceService(polygonFenceRepo)
 	polygonFenceHandler := handler.NewPolygonFenceHandler(polygonFenceService)
 
+	siteNodeRepo := repo.NewSiteNodeRepo(db)
+	siteNodeService := service.NewSiteNodeService(siteNodeRepo)
+	siteNodeHandler := handler.NewSiteNodeHandler(siteNodeService)
+
 	// 健康检查
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok", "service": app.Config().AppName})
@@ -62,30 +67,48 @@ func main() {
 	// 路由分组
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
+	v1.Use(middleware.Tenant()) // 按调用方身份限定列表查询的租户
+
+	// 非管理员只能按 id 访问、修改自己租户的资源，引用的节点 / 地图也须属于自己的租户
+	guard := middleware.NewTenantGuard(siteNodeRepo)
+	fenceOwner := guard.Owns(repo.ResourceFence)
 
 	// ==================== 基站管理 ====================
 	station := v1.Group("/station")
 	{
 		// CRUD 操作
-		station.Post("/", stationHandler.CreateStation)      // 创建基站
-		station.Get("/", stationHandler.ListStation)         // 获取基站列表
-		station.Get("/:id", stationHandler.GetStation)       // 获取单个基站
-		station.Put("/:id", stationHandler.UpdateStation)    // 更新基站
-		station.Delete("/:id", stationHandler.DeleteStation) // 删除基站
+		station.Post("/", guard.Refs(true), stationHandler.CreateStation)                                      // 创建基站
+		station.Get("/", stationHandler.ListStation)                                                           // 获取基站列表（支持 ?map_id=&node_id=&tenant=）
+		station.Get("/:id", guard.Owns(repo.ResourceStation), stationHandler.GetStation)                       // 获取单个基站
+		station.Put("/:id", guard.Owns(repo.ResourceStation), guard.Refs(false), stationHandler.UpdateStation) // 更新基站
+		station.Delete("/:id", guard.Owns(repo.ResourceStation), stationHandler.DeleteStation)                 // 删除基站
 	}
 
 	// ==================== 自定义地图管理 ====================
 	customMap := v1.Group("/custom-map")
 	{
 		// 特殊查询（放在参数路由之前）
-		customMap.Get("/latest", customMapHandler.GetLatestCustomMap) // 获取最新地图
+		customMap.Get("/latest", customMapHandler.GetLatestCustomMap) // 获取最新地图（支持 ?node_id=&tenant=）
 
 		// CRUD 操作
-		customMap.Post("/", customMapHandler.CreateCustomMap)      // 创建地图（上传图片 + 配置）
-		customMap.Get("/", customMapHandler.ListCustomMaps)        // 获取地图列表
-		customMap.Get("/:id", customMapHandler.GetCustomMap)       // 获取单个地图
-		customMap.Put("/:id", customMapHandler.UpdateCustomMap)    // 更新地图
-		customMap.Delete("/:id", customMapHandler.DeleteCustomMap) // 删除地图
+		customMap.Post("/", guard.Refs(true), customMapHandler.CreateCustomMap)                                  // 创建地图（上传图片 + 配置）
+		customMap.Get("/", customMapHandler.ListCustomMaps)                                                      // 获取地图列表（支持 ?node_id=&tenant=）
+		customMap.Get("/:id", guard.Owns(repo.ResourceMap), customMapHandler.GetCustomMap)                       // 获取单个地图
+		customMap.Put("/:id", guard.Owns(repo.ResourceMap), guard.Refs(false), customMapHandler.UpdateCustomMap) // 更新地图
+		customMap.Delete("/:id", guard.Owns(repo.ResourceMap), customMapHandler.DeleteCustomMap)                 // 删除地图
+	}
+
+	// ==================== 站点层级管理 ====================
+	siteNode := v1.Group("/site-node")
+	{
+		// 层级树（放在参数路由之前）
+		siteNode.Get("/tree", siteNodeHandler.GetTree) // 获取层级树（支持 ?root_id=&tenant=）
+
+		// CRUD 操作
+		siteNode.Post("/", guard.Refs(false), siteNodeHandler.CreateSiteNode)                                      // 创建节点（site / building / floor / yard）
+		siteNode.Get("/:id", guard.Owns(repo.ResourceSiteNode), siteNodeHandler.GetSiteNode)                       // 获取单个节点（含路径）
+		siteNode.Put("/:id", guard.Owns(repo.ResourceSiteNode), guard.Refs(false), siteNodeHandler.UpdateSiteNode) // 更新节点（改名、移动、设置租户）
+		siteNode.Delete("/:id", guard.Owns(repo.ResourceSiteNode), siteNodeHandler.DeleteSiteNode)                 // 删除节点（无子节点和绑定资源时）
 	}
 
 	// ==================== 多边形围栏管理 ====================
@@ -93,6 +116,7 @@ func main() {
 	{
 		// 通用查询（放在参数路由之前）
 		polygonFence.Post("/check-all", polygonFenceHandler.CheckPointInAllFences) // 检查点在哪些围栏内
+		polygonFence.Post("/check-batch", polygonFenceHandler.CheckPointsBatch)    // 批量检查多个设备点所在的围栏
 
 		// 室内围栏专用查询
 		polygonFence.Post("/check-indoor-all", polygonFenceHandler.CheckPointInIndoorFences) // 检查点在哪些室内围栏内
@@ -102,21 +126,36 @@ func main() {
 		polygonFence.Post("/check-outdoor-all", polygonFenceHandler.CheckPointInOutdoorFences) // 检查点在哪些室外围栏内
 		polygonFence.Post("/check-outdoor-any", polygonFenceHandler.IsPointInAnyOutdoorFence)  // 检查点是否在任意一个室外围栏内
 
+		// 导入导出（放在参数路由之前）
+		polygonFence.Post("/import", polygonFenceHandler.ImportFences) // 导入 GeoJSON / KML
+		polygonFence.Get("/export", polygonFenceHandler.ExportFences)  // 导出 GeoJSON / KML（支持 ?format=geojson|kml&active_only=true）
+
+		// 重叠检测（放在参数路由之前）
+		polygonFence.Get("/overlaps", polygonFenceHandler.ListFenceOverlaps) // 两两重叠的激活围栏（支持 ?map_id=&node_id=&tenant=）
+
 		// 围栏列表查询（放在参数路由之前）
 		polygonFence.Get("/indoor", polygonFenceHandler.ListIndoorFences)   // 获取室内围栏（支持 ?active_only=true）
 		polygonFence.Get("/outdoor", polygonFenceHandler.ListOutdoorFences) // 获取室外围栏（支持 ?active_only=true）
 
 		// CRUD 操作
-		polygonFence.Post("/", polygonFenceHandler.CreatePolygonFence)      // 创建围栏
-		polygonFence.Get("/", polygonFenceHandler.ListPolygonFences)        // 获取围栏列表（支持 ?active_only=true）
-		polygonFence.Get("/:id", polygonFenceHandler.GetPolygonFence)       // 获取单个围栏
-		polygonFence.Put("/:id", polygonFenceHandler.UpdatePolygonFence)    // 更新围栏
-		polygonFence.Delete("/:id", polygonFenceHandler.DeletePolygonFence) // 删除围栏
+		polygonFence.Post("/", guard.Refs(true), polygonFenceHandler.CreatePolygonFence)                // 创建围栏
+		polygonFence.Get("/", polygonFenceHandler.ListPolygonFences)                                    // 获取围栏列表（支持 ?active_only=true）
+		polygonFence.Get("/:id", fenceOwner, polygonFenceHandler.GetPolygonFence)                       // 获取单个围栏
+		polygonFence.Put("/:id", fenceOwner, guard.Refs(false), polygonFenceHandler.UpdatePolygonFence) // 更新围栏
+		polygonFence.Delete("/:id", fenceOwner, polygonFenceHandler.DeletePolygonFence)                 // 删除围栏
 
 		// 围栏特定操作（需要围栏ID）
-		polygonFence.Post("/:id/check", polygonFenceHandler.CheckPointInFence)                // 检查点是否在指定围栏内
-		polygonFence.Post("/:id/check-indoor", polygonFenceHandler.CheckPointInIndoorFence)   // 检查点是否在指定室内围栏内
-		polygonFence.Post("/:id/check-outdoor", polygonFenceHandler.CheckPointInOutdoorFence) // 检查点是否在指定室外围栏内
+		polygonFence.Post("/:id/check", fenceOwner, polygonFenceHandler.CheckPointInFence)                // 检查点是否在指定围栏内
+		polygonFence.Post("/:id/check-indoor", fenceOwner, polygonFenceHandler.CheckPointInIndoorFence)   // 检查点是否在指定室内围栏内
+		polygonFence.Post("/:id/check-outdoor", fenceOwner, polygonFenceHandler.CheckPointInOutdoorFence) // 检查点是否在指定室外围栏内
+
+		// 重叠检测
+		polygonFence.Get("/:id/overlaps", fenceOwner, polygonFenceHandler.GetFenceOverlaps) // 与指定围栏重叠的激活围栏
+
+		// 修订历史
+		polygonFence.Get("/:id/revisions", fenceOwner, polygonFenceHandler.ListFenceRevisions)                      // 修订列表
+		polygonFence.Get("/:id/revisions/:version", fenceOwner, polygonFenceHandler.GetFenceRevision)               // 查看指定版本
+		polygonFence.Post("/:id/revisions/:version/rollback", fenceOwner, polygonFenceHandler.RollbackPolygonFence) // 回滚到指定版本
 	}
 
 	// 启动服务器
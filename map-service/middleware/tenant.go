@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/repo"
+)
+
+const (
+	localScope = "tenant_scope" // 本次请求可见的租户
+	localOwn   = "tenant_own"   // 非管理员调用方所属的租户
+)
+
+// Tenant 由网关透传的身份（X-UserType / X-Tenant）确定本次请求可见的租户：
+// admin / root 可用 ?tenant= 指定租户，不指定时不限；其他调用方（含未登录）固定为自己的租户，
+// 未分配租户时为空串，只能看到未归属任何租户的资源；?tenant= 与自己的租户不同时返回 FORBIDDEN
+func Tenant() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requested := c.Query("tenant")
+		switch c.Get("X-UserType") {
+		case "admin", "root":
+			if requested != "" {
+				c.Locals(localScope, &requested)
+			}
+			return c.Next()
+		}
+
+		own := c.Get("X-Tenant")
+		if requested != "" && requested != own {
+			return errs.ErrForbidden.WithDetails("只能查询自己所属租户的数据")
+		}
+		c.Locals(localScope, &own)
+		c.Locals(localOwn, &own)
+		return c.Next()
+	}
+}
+
+// TenantScope 本次请求可见的租户，nil 表示不限
+func TenantScope(c *fiber.Ctx) *string {
+	t, _ := c.Locals(localScope).(*string)
+	return t
+}
+
+// OwnTenant 非管理员调用方所属的租户，管理员返回 nil
+func OwnTenant(c *fiber.Ctx) *string {
+	t, _ := c.Locals(localOwn).(*string)
+	return t
+}
+
+// TenantResolver 查询资源所属租户（由 repo.SiteNodeRepo 实现）
+type TenantResolver interface {
+	ResourceTenant(kind string, id uuid.UUID) (tenant string, found bool, err error)
+}
+
+// TenantGuard 非管理员按租户限制按 id 访问与写入的资源
+type TenantGuard struct {
+	resolver TenantResolver
+}
+
+// NewTenantGuard 构造函数
+func NewTenantGuard(resolver TenantResolver) *TenantGuard {
+	return &TenantGuard{resolver: resolver}
+}
+
+// Owns 路径参数 :id 指定的资源须属于调用方的租户；
+// id 无法解析或资源不存在时交给处理函数返回相应错误
+func (g *TenantGuard) Owns(kind string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		own := OwnTenant(c)
+		if own == nil {
+			return c.Next()
+		}
+		id, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Next()
+		}
+		if err := g.check(kind, id, *own); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// tenantRefs 请求体中引用的节点与地图
+type tenantRefs struct {
+	ParentID *string `json:"parent_id"`
+	NodeID   *string `json:"node_id"`
+	MapID    *string `json:"map_id"`
+}
+
+// Refs 请求体中引用的 parent_id / node_id / map_id 须属于调用方的租户。
+// 已分配租户的调用方不能解除节点绑定；requireRef 时（创建基站、地图、围栏）须通过 node_id 或 map_id
+// 归属到自己的租户，否则资源会落到未分配租户的公共空间
+func (g *TenantGuard) Refs(requireRef bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		own := OwnTenant(c)
+		if own == nil {
+			return c.Next()
+		}
+		var refs tenantRefs
+		if err := c.BodyParser(&refs); err != nil {
+			return c.Next() // 交给处理函数返回参数错误
+		}
+
+		for _, ref := range []struct {
+			kind string
+			id   *string
+		}{
+			{repo.ResourceSiteNode, refs.ParentID},
+			{repo.ResourceSiteNode, refs.NodeID},
+			{repo.ResourceMap, refs.MapID},
+		} {
+			if ref.id == nil || *ref.id == "" {
+				continue
+			}
+			id, err := uuid.Parse(*ref.id)
+			if err != nil {
+				return c.Next()
+			}
+			if err := g.check(ref.kind, id, *own); err != nil {
+				return err
+			}
+		}
+
+		if *own == "" {
+			return c.Next()
+		}
+		if refs.NodeID != nil && *refs.NodeID == "" {
+			return errs.ErrForbidden.WithDetails("已分配租户的用户不能解除节点绑定")
+		}
+		if requireRef && (refs.NodeID == nil || *refs.NodeID == "") && (refs.MapID == nil || *refs.MapID == "") {
+			return errs.ErrForbidden.WithDetails("须通过 node_id 或 map_id 归属到自己所属租户")
+		}
+		return c.Next()
+	}
+}
+
+// check 资源不存在时放行，属于其他租户时返回 FORBIDDEN
+func (g *TenantGuard) check(kind string, id uuid.UUID, own string) error {
+	tenant, found, err := g.resolver.ResourceTenant(kind, id)
+	if err != nil {
+		log.Printf("[ERROR] 查询资源租户失败 kind=%s id=%s: %v", kind, id, err)
+		return errs.ErrInternal.WithDetails("查询资源租户失败")
+	}
+	if found && tenant != own {
+		return errs.ErrForbidden.WithDetails("资源属于其他租户")
+	}
+	return nil
+}
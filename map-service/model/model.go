@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,12 +9,14 @@ import (
 
 // Station 对应表 base_stations
 type Station struct {
-	ID          uuid.UUID `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
-	StationName string    `gorm:"column:station_name;type:varchar(255);not null"`
-	CoordinateX float64   `gorm:"column:location_x;type:double precision;not null"` // X坐标（平面坐标系）
-	CoordinateY float64   `gorm:"column:location_y;type:double precision;not null"` // Y坐标（平面坐标系）
-	CreatedAt   time.Time `gorm:"column:created_at;not null;autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"column:updated_at;not null;autoUpdateTime"`
+	ID          uuid.UUID  `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
+	StationName string     `gorm:"column:station_name;type:varchar(255);not null"`
+	CoordinateX float64    `gorm:"column:location_x;type:double precision;not null"` // X坐标（平面坐标系）
+	CoordinateY float64    `gorm:"column:location_y;type:double precision;not null"` // Y坐标（平面坐标系）
+	MapID       *uuid.UUID `gorm:"column:map_id;type:uuid"`                          // 所属自制地图（楼层），nil 表示未指定
+	NodeID      *uuid.UUID `gorm:"column:node_id;type:uuid"`                         // 所属站点层级节点，nil 时取地图所在节点
+	CreatedAt   time.Time  `gorm:"column:created_at;not null;autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;not null;autoUpdateTime"`
 }
 
 func (Station) TableName() string {
@@ -22,14 +25,18 @@ func (Station) TableName() string {
 
 type StationCreateReq struct {
 	StationName string  `json:"station_name" validate:"required,min=1,max=255"`
-	CoordinateX float64 `json:"coordinate_x"` // X坐标（允许0值）
-	CoordinateY float64 `json:"coordinate_y"` // Y坐标（允许0值）
+	CoordinateX float64 `json:"coordinate_x"`                                // X坐标（允许0值）
+	CoordinateY float64 `json:"coordinate_y"`                                // Y坐标（允许0值）
+	MapID       string  `json:"map_id,omitempty" validate:"omitempty,uuid"`  // 所属自制地图（楼层）
+	NodeID      string  `json:"node_id,omitempty" validate:"omitempty,uuid"` // 所属站点层级节点
 }
 
 type StationUpdateReq struct {
 	StationName *string  `json:"station_name,omitempty" validate:"omitempty,min=1,max=255"`
 	CoordinateX *float64 `json:"coordinate_x,omitempty" validate:"omitempty"` // X坐标
 	CoordinateY *float64 `json:"coordinate_y,omitempty" validate:"omitempty"` // Y坐标
+	MapID       *string  `json:"map_id,omitempty"`                            // 所属自制地图，空字符串表示解除绑定
+	NodeID      *string  `json:"node_id,omitempty"`                           // 所属站点层级节点，空字符串表示解除绑定
 }
 
 type StationResp struct {
@@ -37,6 +44,8 @@ type StationResp struct {
 	StationName string    `json:"station_name"`
 	CoordinateX float64   `json:"coordinate_x"` // X坐标
 	CoordinateY float64   `json:"coordinate_y"` // Y坐标
+	MapID       *string   `json:"map_id"`       // 所属自制地图，null 表示未指定
+	NodeID      *string   `json:"node_id"`      // 所属站点层级节点，null 表示未指定
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -48,6 +57,8 @@ func StationToStationResp(station *Station) *StationResp {
 		StationName: station.StationName,
 		CoordinateX: station.CoordinateX,
 		CoordinateY: station.CoordinateY,
+		MapID:       MapIDString(station.MapID),
+		NodeID:      MapIDString(station.NodeID),
 		CreatedAt:   station.CreatedAt,
 		UpdatedAt:   station.UpdatedAt,
 	}
@@ -64,19 +75,20 @@ func StationCreateReqToStation(req *StationCreateReq) *Station {
 
 // CustomMap 对应表 custom_maps
 type CustomMap struct {
-	ID          uuid.UUID `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
-	MapName     string    `gorm:"column:map_name;type:varchar(255);not null"`
-	ImagePath   string    `gorm:"column:image_path;type:varchar(500)"` // 允许为空
-	XMin        float64   `gorm:"column:x_min;type:double precision;not null"`
-	XMax        float64   `gorm:"column:x_max;type:double precision;not null"`
-	YMin        float64   `gorm:"column:y_min;type:double precision;not null"`
-	YMax        float64   `gorm:"column:y_max;type:double precision;not null"`
-	CenterX     float64   `gorm:"column:center_x;type:double precision;not null"`
-	CenterY     float64   `gorm:"column:center_y;type:double precision;not null"`
-	ScaleRatio  float64   `gorm:"column:scale_ratio;type:double precision;not null;default:1.0"` // 底图缩放比例
-	Description string    `gorm:"column:description;type:text"`
-	CreatedAt   time.Time `gorm:"column:created_at;not null;autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"column:updated_at;not null;autoUpdateTime"`
+	ID          uuid.UUID  `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
+	MapName     string     `gorm:"column:map_name;type:varchar(255);not null"`
+	ImagePath   string     `gorm:"column:image_path;type:varchar(500)"` // 允许为空
+	XMin        float64    `gorm:"column:x_min;type:double precision;not null"`
+	XMax        float64    `gorm:"column:x_max;type:double precision;not null"`
+	YMin        float64    `gorm:"column:y_min;type:double precision;not null"`
+	YMax        float64    `gorm:"column:y_max;type:double precision;not null"`
+	CenterX     float64    `gorm:"column:center_x;type:double precision;not null"`
+	CenterY     float64    `gorm:"column:center_y;type:double precision;not null"`
+	ScaleRatio  float64    `gorm:"column:scale_ratio;type:double precision;not null;default:1.0"` // 底图缩放比例
+	NodeID      *uuid.UUID `gorm:"column:node_id;type:uuid"`                                      // 所属站点层级节点（通常为楼层）
+	Description string     `gorm:"column:description;type:text"`
+	CreatedAt   time.Time  `gorm:"column:created_at;not null;autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;not null;autoUpdateTime"`
 }
 
 func (CustomMap) TableName() string {
@@ -94,6 +106,7 @@ type CustomMapCreateReq struct {
 	CenterX     float64 `json:"center_x"`                                                                  // 允许0值
 	CenterY     float64 `json:"center_y"`                                                                  // 允许0值
 	ScaleRatio  float64 `json:"scale_ratio" validate:"omitempty,gt=0"`                                     // 底图缩放比例（默认1.0）
+	NodeID      string  `json:"node_id,omitempty" validate:"omitempty,uuid"`                               // 所属站点层级节点（通常为楼层）
 	Description string  `json:"description,omitempty" validate:"omitempty,max=1000"`
 }
 
@@ -108,6 +121,7 @@ type CustomMapUpdateReq struct {
 	CenterX     *float64 `json:"center_x,omitempty" validate:"omitempty"`
 	CenterY     *float64 `json:"center_y,omitempty" validate:"omitempty"`
 	ScaleRatio  *float64 `json:"scale_ratio,omitempty" validate:"omitempty,gt=0"` // 底图缩放比例
+	NodeID      *string  `json:"node_id,omitempty"`                               // 所属站点层级节点，空字符串表示解除绑定
 	Description *string  `json:"description,omitempty" validate:"omitempty,max=1000"`
 }
 
@@ -123,6 +137,7 @@ type CustomMapResp struct {
 	CenterX     float64   `json:"center_x"`
 	CenterY     float64   `json:"center_y"`
 	ScaleRatio  float64   `json:"scale_ratio"` // 底图缩放比例
+	NodeID      *string   `json:"node_id"`     // 所属站点层级节点，null 表示未归属
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -146,6 +161,7 @@ func CustomMapToCustomMapResp(customMap *CustomMap, baseURL string) *CustomMapRe
 		CenterX:     customMap.CenterX,
 		CenterY:     customMap.CenterY,
 		ScaleRatio:  customMap.ScaleRatio,
+		NodeID:      MapIDString(customMap.NodeID),
 		Description: customMap.Description,
 		CreatedAt:   customMap.CreatedAt,
 		UpdatedAt:   customMap.UpdatedAt,
@@ -154,49 +170,157 @@ func CustomMapToCustomMapResp(customMap *CustomMap, baseURL string) *CustomMapRe
 
 // PolygonFence 多边形电子围栏
 type PolygonFence struct {
-	ID          uuid.UUID `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
-	IsIndoor    bool      `gorm:"column:is_indoor;not null;default:true"` // FALSE=室外，TRUE=室内
-	FenceName   string    `gorm:"column:fence_name;type:varchar(255);not null;uniqueIndex"`
-	Geometry    string    `gorm:"column:geometry;type:geometry(POLYGON,0);not null"` // WKT格式
-	Description string    `gorm:"column:description;type:text"`
-	IsActive    bool      `gorm:"column:is_active;default:true"`
-	CreatedAt   time.Time `gorm:"column:created_at;not null;autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"column:updated_at;not null;autoUpdateTime"`
+	ID          uuid.UUID  `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
+	IsIndoor    bool       `gorm:"column:is_indoor;not null;default:true"` // FALSE=室外，TRUE=室内
+	FenceName   string     `gorm:"column:fence_name;type:varchar(255);not null;uniqueIndex"`
+	Shape       string     `gorm:"column:shape;type:varchar(20);not null;default:polygon"` // polygon / circle / corridor / multipolygon
+	Geometry    string     `gorm:"column:geometry;type:geometry(GEOMETRY);not null"`       // WKT格式（POLYGON 或 MULTIPOLYGON），室内 SRID 0，室外 SRID 4326
+	ShapeParams string     `gorm:"column:shape_params;type:jsonb"`                         // 原始形状参数（圆心半径、中心线宽度等），JSON
+	MapID       *uuid.UUID `gorm:"column:map_id;type:uuid"`                                // 所属自制地图（楼层），nil 表示全局；仅室内围栏可绑定
+	NodeID      *uuid.UUID `gorm:"column:node_id;type:uuid"`                               // 所属站点层级节点，nil 时取地图所在节点
+	Description string     `gorm:"column:description;type:text"`
+	IsActive    bool       `gorm:"column:is_active;default:true"`
+	CreatedAt   time.Time  `gorm:"column:created_at;not null;autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;not null;autoUpdateTime"`
+
+	Area      float64 `gorm:"column:area;->"`      // 面积（只读）：室外平方米，室内为平面坐标单位的平方
+	Perimeter float64 `gorm:"column:perimeter;->"` // 周长（只读）：室外米，室内为平面坐标单位
+
+	// Buffer 写入时 Geometry 为点 / 折线，按该距离用 ST_Buffer 缓冲为面；不落库
+	Buffer float64 `gorm:"-"`
 }
 
 func (PolygonFence) TableName() string {
 	return "polygon_fences"
 }
 
+// 围栏坐标系
+const (
+	SRIDPlane = 0    // 室内：UWB / 自制地图平面坐标
+	SRIDWGS84 = 4326 // 室外：WGS84 经纬度，x 为经度，y 为纬度
+)
+
+// SRID 室内围栏使用平面坐标，室外围栏使用 WGS84
+func (f *PolygonFence) SRID() int {
+	if f.IsIndoor {
+		return SRIDPlane
+	}
+	return SRIDWGS84
+}
+
+// MapIDString 地图 / 节点 ID 转为响应字段，nil 输出为 null
+func MapIDString(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
+
 // Point 坐标点
 type Point struct {
 	X float64 `json:"x"` // 允许0值
 	Y float64 `json:"y"` // 允许0值
 }
 
+// 围栏形状
+const (
+	FenceShapePolygon      = "polygon"      // 多边形，可带洞
+	FenceShapeCircle       = "circle"       // 圆形：圆心 + 半径
+	FenceShapeCorridor     = "corridor"     // 走廊：沿折线中心线两侧各 width/2
+	FenceShapeMultiPolygon = "multipolygon" // 多个多边形
+)
+
+// PolygonRings 一个多边形：外环 + 内环（洞）
+type PolygonRings struct {
+	Points []Point   `json:"points"`          // 外环顶点
+	Holes  [][]Point `json:"holes,omitempty"` // 内环顶点，每个内环至少3个点
+}
+
+// FenceShapeSpec 围栏形状参数，按 shape 取用对应字段
+type FenceShapeSpec struct {
+	Shape    string         `json:"shape,omitempty" validate:"omitempty,oneof=polygon circle corridor multipolygon"` // 缺省为 polygon
+	Points   []Point        `json:"points,omitempty"`                                                                // polygon 外环顶点
+	Holes    [][]Point      `json:"holes,omitempty"`                                                                 // polygon 内环（洞）
+	Center   *Point         `json:"center,omitempty"`                                                                // circle 圆心
+	Radius   float64        `json:"radius,omitempty" validate:"omitempty,gt=0"`                                      // circle 半径（室外围栏单位为米）
+	Path     []Point        `json:"path,omitempty"`                                                                  // corridor 中心线
+	Width    float64        `json:"width,omitempty" validate:"omitempty,gt=0"`                                       // corridor 总宽度（室外围栏单位为米）
+	Polygons []PolygonRings `json:"polygons,omitempty"`                                                              // multipolygon 各多边形
+}
+
 // PolygonFenceCreateReq 创建多边形围栏请求
 type PolygonFenceCreateReq struct {
-	IsIndoor    bool    `json:"is_indoor"` // FALSE=室外，TRUE=室内
-	FenceName   string  `json:"fence_name" validate:"required,min=1,max=255"`
-	Points      []Point `json:"points" validate:"required,min=3"` // 至少3个点才能构成多边形
-	Description string  `json:"description,omitempty" validate:"omitempty,max=1000"`
+	IsIndoor  bool   `json:"is_indoor"` // FALSE=室外，TRUE=室内
+	FenceName string `json:"fence_name" validate:"required,min=1,max=255"`
+	FenceShapeSpec
+	MapID       string `json:"map_id,omitempty" validate:"omitempty,uuid"`  // 所属自制地图（楼层），缺省为全局；仅室内围栏
+	NodeID      string `json:"node_id,omitempty" validate:"omitempty,uuid"` // 所属站点层级节点
+	Description string `json:"description,omitempty" validate:"omitempty,max=1000"`
+	Repair      bool   `json:"repair,omitempty"` // 多边形无效（自相交、重复顶点等）时用 ST_MakeValid 自动修复，否则拒绝
+	// 与其他激活围栏重叠时拒绝创建；默认只在响应的 overlaps 中警告
+	BlockOverlap bool `json:"block_overlap,omitempty"`
 }
 
 // PolygonFenceUpdateReq 更新多边形围栏请求
+// 形状字段未给出时保持原形状；只改 radius / width 等参数时沿用原形状的其余参数
 type PolygonFenceUpdateReq struct {
-	IsIndoor    *bool    `json:"is_indoor,omitempty"` // FALSE=室外，TRUE=室内
-	FenceName   *string  `json:"fence_name,omitempty" validate:"omitempty,min=1,max=255"`
-	Points      *[]Point `json:"points,omitempty" validate:"omitempty,min=3"`
-	Description *string  `json:"description,omitempty" validate:"omitempty,max=1000"`
-	IsActive    *bool    `json:"is_active,omitempty"`
+	IsIndoor  *bool   `json:"is_indoor,omitempty"` // FALSE=室外，TRUE=室内
+	FenceName *string `json:"fence_name,omitempty" validate:"omitempty,min=1,max=255"`
+	FenceShapeSpec
+	MapID       *string `json:"map_id,omitempty"`  // 所属自制地图，空字符串表示改为全局
+	NodeID      *string `json:"node_id,omitempty"` // 所属站点层级节点，空字符串表示解除绑定
+	Description *string `json:"description,omitempty" validate:"omitempty,max=1000"`
+	IsActive    *bool   `json:"is_active,omitempty"`
+	Repair      bool    `json:"repair,omitempty"` // 同创建，仅在形状变化时生效
+	// 修改后与其他激活围栏重叠时拒绝修改；默认只在响应的 overlaps 中警告
+	BlockOverlap bool `json:"block_overlap,omitempty"`
+}
+
+// GeometryIssue PostGIS 几何校验发现的问题
+type GeometryIssue struct {
+	Reason   string `json:"reason"`             // ST_IsValidReason 原文
+	Message  string `json:"message"`            // 问题说明
+	Location *Point `json:"location,omitempty"` // 问题所在的坐标
+}
+
+func (i GeometryIssue) String() string {
+	if i.Location != nil {
+		return fmt.Sprintf("%s（%s，位置 %g %g）", i.Message, i.Reason, i.Location.X, i.Location.Y)
+	}
+	return fmt.Sprintf("%s（%s）", i.Message, i.Reason)
+}
+
+// FenceOverlap 两个激活围栏的重叠；创建围栏时 fence_id 为空
+type FenceOverlap struct {
+	FenceID     string  `json:"fence_id,omitempty"`
+	FenceName   string  `json:"fence_name"`
+	OtherID     string  `json:"other_id"`
+	OtherName   string  `json:"other_name"`
+	OverlapArea float64 `json:"overlap_area"` // 重叠面积：室外为平方米，室内为平面坐标单位的平方
+	FenceRatio  float64 `json:"fence_ratio"`  // 重叠面积占 fence 面积的比例
+	OtherRatio  float64 `json:"other_ratio"`  // 重叠面积占 other 面积的比例
+}
+
+// FenceWriteResult 创建 / 更新围栏的附加信息
+type FenceWriteResult struct {
+	Repaired *GeometryIssue `json:"repaired,omitempty"` // 自动修复前发现的几何问题
+	Overlaps []FenceOverlap `json:"overlaps,omitempty"` // 与其他激活围栏的重叠（警告）
 }
 
 // PolygonFenceResp 多边形围栏响应
+// points 为围栏外轮廓（circle / corridor 为缓冲后的近似多边形，multipolygon 为第一个多边形），
+// 其余形状参数按 shape 返回
 type PolygonFenceResp struct {
-	ID          string    `json:"id"`
-	IsIndoor    bool      `json:"is_indoor"` // FALSE=室外，TRUE=室内
-	FenceName   string    `json:"fence_name"`
-	Points      []Point   `json:"points"` // 多边形顶点
+	ID        string `json:"id"`
+	IsIndoor  bool   `json:"is_indoor"` // FALSE=室外，TRUE=室内
+	FenceName string `json:"fence_name"`
+	FenceShapeSpec
+	SRID        int       `json:"srid"`      // 0=平面坐标（室内），4326=WGS84（室外）
+	Area        float64   `json:"area"`      // 面积：室外为平方米，室内为平面坐标单位的平方
+	Perimeter   float64   `json:"perimeter"` // 周长：室外为米，室内为平面坐标单位
+	MapID       *string   `json:"map_id"`    // 所属自制地图，null 表示全局
+	NodeID      *string   `json:"node_id"`   // 所属站点层级节点，null 表示未指定
 	Description string    `json:"description"`
 	IsActive    bool      `json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
@@ -204,9 +328,22 @@ type PolygonFenceResp struct {
 }
 
 // PointCheckReq 检查点是否在围栏内的请求
+// 室外围栏 x 为经度、y 为纬度；也可用 lon / lat 明确给出 RTK 坐标，优先于 x / y。
+// map_id 为点所在的自制地图：给出时只与该地图上的围栏及全局围栏比较，缺省时与所有围栏比较
 type PointCheckReq struct {
-	X float64 `json:"x"` // 允许0值
-	Y float64 `json:"y"` // 允许0值
+	X     float64  `json:"x"` // 允许0值
+	Y     float64  `json:"y"` // 允许0值
+	Lon   *float64 `json:"lon,omitempty" validate:"omitempty,gte=-180,lte=180"`
+	Lat   *float64 `json:"lat,omitempty" validate:"omitempty,gte=-90,lte=90"`
+	MapID string   `json:"map_id,omitempty" validate:"omitempty,uuid"`
+}
+
+// Coords 返回检查用的 x, y（给出 lon / lat 时为经度, 纬度）
+func (r *PointCheckReq) Coords() (float64, float64) {
+	if r.Lon != nil && r.Lat != nil {
+		return *r.Lon, *r.Lat
+	}
+	return r.X, r.Y
 }
 
 // PointCheckResp 检查点是否在围栏内的响应
@@ -216,3 +353,273 @@ type PointCheckResp struct {
 	FenceName  string   `json:"fence_name,omitempty"`
 	FenceNames []string `json:"fence_names,omitempty"` // 如果在多个围栏内
 }
+
+// BatchCheckPoint 批量检查中的一个点；室外点 x 为经度、y 为纬度
+type BatchCheckPoint struct {
+	DeviceID string  `json:"device_id" validate:"required,max=255"`
+	X        float64 `json:"x"` // 允许0值
+	Y        float64 `json:"y"` // 允许0值
+	Indoor   bool    `json:"indoor"`
+	MapID    string  `json:"map_id,omitempty" validate:"omitempty,uuid"` // 点所在的自制地图，仅室内点
+}
+
+// BatchCheckReq 批量检查点所在围栏的请求
+type BatchCheckReq struct {
+	Points []BatchCheckPoint `json:"points" validate:"required,min=1,dive"`
+}
+
+// BatchFenceHit 点命中的围栏
+type BatchFenceHit struct {
+	FenceID   string `json:"fence_id"`
+	FenceName string `json:"fence_name"`
+}
+
+// BatchCheckResult 单个点的检查结果，顺序与请求中的 points 一致
+type BatchCheckResult struct {
+	DeviceID string          `json:"device_id"`
+	IsInside bool            `json:"is_inside"`
+	Fences   []BatchFenceHit `json:"fences"`
+}
+
+// FenceImportOptions 围栏导入选项
+// 导出文件中的 map_id / node_id 属于源站点，导入到其他站点时用 MapID / NodeID 统一指定，
+// 或用 MapMapping / NodeMapping 逐个替换，DropRefs 则全部丢弃
+type FenceImportOptions struct {
+	OnConflict  string  // error / skip / replace
+	Repair      bool    // 自动修复无效的多边形几何
+	Atomic      bool    // 任意要素失败则整体不导入；默认跳过失败的要素并逐个报告
+	DropRefs    bool    // 丢弃文件中的 map_id / node_id
+	MapID       string  // 室内围栏统一导入到该地图，优先于文件中的 map_id
+	NodeID      string  // 围栏统一绑定到该层级节点，优先于文件中的 node_id
+	MapMapping  string  // 地图ID映射 "旧ID:新ID,..."，新ID为空表示解除绑定；未列出的保持不变
+	NodeMapping string  // 层级节点ID映射，格式同 MapMapping
+	Tenant      *string // 非管理员调用方所属的租户：只能覆盖、写入该租户的围栏；nil 表示不限
+}
+
+// FenceImportResp 围栏导入结果
+type FenceImportResp struct {
+	Created  int                `json:"created"`
+	Updated  int                `json:"updated"`          // on_conflict=replace 时覆盖的同名围栏
+	Skipped  int                `json:"skipped"`          // on_conflict=skip 时跳过的同名围栏
+	Repaired int                `json:"repaired"`         // repair=true 时自动修复了几何的围栏
+	Failed   []FenceImportError `json:"failed,omitempty"` // 未导入的要素及原因
+}
+
+// FenceImportError 导入校验失败的要素
+type FenceImportError struct {
+	Index int    `json:"index"` // 要素在文件中的序号（从0开始）
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// 围栏修订的变更类型
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionImport   = "import"
+	RevisionRollback = "rollback"
+	RevisionDelete   = "delete" // 删除前的快照
+)
+
+// PolygonFenceRevision 围栏修订：某次变更后的围栏完整快照
+type PolygonFenceRevision struct {
+	ID            int64      `gorm:"column:id;primaryKey"`
+	FenceID       uuid.UUID  `gorm:"column:fence_id;type:uuid;not null"`
+	Version       int        `gorm:"column:version;not null"`
+	Action        string     `gorm:"column:action;type:varchar(20);not null"`
+	Editor        string     `gorm:"column:editor;type:varchar(255);not null"` // 操作人用户 ID（X-UserID），空串表示未知
+	SourceVersion *int       `gorm:"column:source_version"`                    // rollback 时回滚到的版本
+	IsIndoor      bool       `gorm:"column:is_indoor"`
+	FenceName     string     `gorm:"column:fence_name"`
+	Shape         string     `gorm:"column:shape"`
+	Geometry      string     `gorm:"column:geometry"` // WKT
+	ShapeParams   string     `gorm:"column:shape_params"`
+	MapID         *uuid.UUID `gorm:"column:map_id;type:uuid"`
+	NodeID        *uuid.UUID `gorm:"column:node_id;type:uuid"`
+	Description   string     `gorm:"column:description"`
+	IsActive      bool       `gorm:"column:is_active"`
+	Diff          string     `gorm:"column:diff"` // 相对上一版本的变化（JSON），首个版本为空
+	CreatedAt     time.Time  `gorm:"column:created_at"`
+
+	Area      float64 `gorm:"column:area;->"`
+	Perimeter float64 `gorm:"column:perimeter;->"`
+}
+
+func (PolygonFenceRevision) TableName() string {
+	return "polygon_fence_revisions"
+}
+
+// Fence 快照还原为围栏
+func (r *PolygonFenceRevision) Fence() *PolygonFence {
+	return &PolygonFence{
+		ID:          r.FenceID,
+		IsIndoor:    r.IsIndoor,
+		FenceName:   r.FenceName,
+		Shape:       r.Shape,
+		Geometry:    r.Geometry,
+		ShapeParams: r.ShapeParams,
+		MapID:       r.MapID,
+		NodeID:      r.NodeID,
+		Description: r.Description,
+		IsActive:    r.IsActive,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.CreatedAt,
+		Area:        r.Area,
+		Perimeter:   r.Perimeter,
+	}
+}
+
+// FieldChange 修订中单个字段的变化
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// DiffFences 比较围栏变更前后的状态，返回变化的字段；几何按 WKT 比较
+func DiffFences(old, new *PolygonFence) map[string]FieldChange {
+	diff := make(map[string]FieldChange)
+	cmp := func(field string, o, n any) {
+		if o != n {
+			diff[field] = FieldChange{Old: o, New: n}
+		}
+	}
+	optID := func(id *uuid.UUID) any {
+		if id == nil {
+			return nil
+		}
+		return id.String()
+	}
+	cmp("is_indoor", old.IsIndoor, new.IsIndoor)
+	cmp("fence_name", old.FenceName, new.FenceName)
+	cmp("shape", old.Shape, new.Shape)
+	cmp("geometry", old.Geometry, new.Geometry)
+	cmp("shape_params", old.ShapeParams, new.ShapeParams)
+	cmp("map_id", optID(old.MapID), optID(new.MapID))
+	cmp("node_id", optID(old.NodeID), optID(new.NodeID))
+	cmp("description", old.Description, new.Description)
+	cmp("is_active", old.IsActive, new.IsActive)
+	return diff
+}
+
+// FenceRevisionSummary 修订列表项
+type FenceRevisionSummary struct {
+	Version       int                    `json:"version"`
+	Action        string                 `json:"action"`
+	Editor        string                 `json:"editor"`
+	SourceVersion *int                   `json:"source_version,omitempty"`
+	Diff          map[string]FieldChange `json:"diff"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+// FenceRollbackReq 回滚请求（可省略），校验规则同更新围栏
+type FenceRollbackReq struct {
+	Repair bool `json:"repair,omitempty"` // 快照几何无效时用 ST_MakeValid 自动修复，否则拒绝
+	// 回滚后与其他激活围栏重叠时拒绝回滚；默认只在响应的 overlaps 中警告
+	BlockOverlap bool `json:"block_overlap,omitempty"`
+}
+
+// FenceRollbackResp 回滚后的围栏及几何修复 / 重叠信息
+type FenceRollbackResp struct {
+	PolygonFenceResp
+	FenceWriteResult
+}
+
+// FenceRevisionResp 单个修订，fence 为该版本的围栏
+type FenceRevisionResp struct {
+	FenceRevisionSummary
+	Fence PolygonFenceResp `json:"fence"`
+}
+
+// 站点层级节点类型：site → building → floor，yard 为站点下的室外场地
+const (
+	NodeTypeSite     = "site"
+	NodeTypeBuilding = "building"
+	NodeTypeFloor    = "floor"
+	NodeTypeYard     = "yard"
+)
+
+// SiteNode 对应表 site_nodes
+type SiteNode struct {
+	ID          uuid.UUID  `gorm:"column:id;type:uuid;primaryKey;default:gen_random_uuid()"`
+	ParentID    *uuid.UUID `gorm:"column:parent_id;type:uuid"` // 站点为 nil
+	NodeType    string     `gorm:"column:node_type;type:varchar(20);not null"`
+	Name        string     `gorm:"column:name;type:varchar(255);not null"`
+	Tenant      string     `gorm:"column:tenant;type:varchar(64);not null"` // 由站点设置，子节点继承
+	Description string     `gorm:"column:description;type:text"`
+	CreatedAt   time.Time  `gorm:"column:created_at;not null;autoCreateTime"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;not null;autoUpdateTime"`
+}
+
+func (SiteNode) TableName() string {
+	return "site_nodes"
+}
+
+type SiteNodeCreateReq struct {
+	NodeType    string `json:"node_type" validate:"required,oneof=site building floor yard"`
+	Name        string `json:"name" validate:"required,min=1,max=255"`
+	ParentID    string `json:"parent_id,omitempty" validate:"omitempty,uuid"` // 站点不填，其余必填
+	Tenant      string `json:"tenant,omitempty" validate:"omitempty,max=64"`  // 仅站点可设置
+	Description string `json:"description,omitempty" validate:"omitempty,max=1000"`
+}
+
+type SiteNodeUpdateReq struct {
+	Name        *string `json:"name,omitempty" validate:"omitempty,min=1,max=255"`
+	ParentID    *string `json:"parent_id,omitempty" validate:"omitempty,uuid"` // 移动到新的父节点（类型须匹配）
+	Tenant      *string `json:"tenant,omitempty" validate:"omitempty,max=64"`  // 仅站点可设置，同步到全部子节点
+	Description *string `json:"description,omitempty" validate:"omitempty,max=1000"`
+}
+
+// SiteNodePathItem 节点路径（从站点到当前节点）
+type SiteNodePathItem struct {
+	ID       string `json:"id"`
+	NodeType string `json:"node_type"`
+	Name     string `json:"name"`
+}
+
+type SiteNodeResp struct {
+	ID          string             `json:"id"`
+	ParentID    *string            `json:"parent_id"`
+	NodeType    string             `json:"node_type"`
+	Name        string             `json:"name"`
+	Tenant      string             `json:"tenant"`
+	Description string             `json:"description"`
+	Path        []SiteNodePathItem `json:"path,omitempty"` // 单个查询时返回
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// SiteNodeTree 层级树节点，计数只统计直接挂在该节点上的资源
+type SiteNodeTree struct {
+	ID           string         `json:"id"`
+	NodeType     string         `json:"node_type"`
+	Name         string         `json:"name"`
+	Tenant       string         `json:"tenant"`
+	Description  string         `json:"description"`
+	MapCount     int64          `json:"map_count"`
+	StationCount int64          `json:"station_count"`
+	FenceCount   int64          `json:"fence_count"`
+	Children     []SiteNodeTree `json:"children"`
+}
+
+// SiteNodeToSiteNodeResp 将 SiteNode 转换为 SiteNodeResp
+func SiteNodeToSiteNodeResp(node *SiteNode) *SiteNodeResp {
+	return &SiteNodeResp{
+		ID:          node.ID.String(),
+		ParentID:    MapIDString(node.ParentID),
+		NodeType:    node.NodeType,
+		Name:        node.Name,
+		Tenant:      node.Tenant,
+		Description: node.Description,
+		CreatedAt:   node.CreatedAt,
+		UpdatedAt:   node.UpdatedAt,
+	}
+}
+
+// ListScope 列表查询的过滤条件（查询参数 map_id / node_id），均可选
+// node_id 包含该节点的全部下级节点；基站 / 围栏未指定节点时按其自制地图所在节点归属；
+// Tenant 由调用方身份确定（见 middleware.Tenant），nil 表示不限
+type ListScope struct {
+	MapID  string
+	NodeID string
+	Tenant *string
+}
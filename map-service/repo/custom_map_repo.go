@@ -43,17 +43,19 @@ func (r *CustomMapRepo) GetByName(name string) (*model.CustomMap, error) {
 	return &cm, err
 }
 
-// ListAll 获取全部记录（简单场景）
-func (r *CustomMapRepo) ListAll() ([]model.CustomMap, error) {
+// ListAll 获取全部记录（简单场景）；按 scope 过滤（节点 / 租户）
+func (r *CustomMapRepo) ListAll(scope Scope) ([]model.CustomMap, error) {
 	var list []model.CustomMap
-	err := r.db.Order("created_at DESC").Find(&list).Error
+	where, args := scope.where(mapNode, false)
+	err := r.db.Where(where, args...).Order("created_at DESC").Find(&list).Error
 	return list, err
 }
 
-// GetLatest 获取最新创建的一条记录
-func (r *CustomMapRepo) GetLatest() (*model.CustomMap, error) {
+// GetLatest 获取 scope 内最新创建的一条记录
+func (r *CustomMapRepo) GetLatest(scope Scope) (*model.CustomMap, error) {
 	var cm model.CustomMap
-	err := r.db.Order("created_at DESC").First(&cm).Error
+	where, args := scope.where(mapNode, false)
+	err := r.db.Where(where, args...).Order("created_at DESC").First(&cm).Error
 	return &cm, err
 }
 
@@ -63,7 +65,7 @@ func (r *CustomMapRepo) GetLatest() (*model.CustomMap, error) {
 
 // UpdateByID 全字段更新（零值也写库）
 func (r *CustomMapRepo) UpdateByID(id uuid.UUID, customMap *model.CustomMap) error {
-	return r.db.Model(&model.CustomMap{}).Where("id = ?", id).Updates(customMap).Error
+	return r.db.Model(&model.CustomMap{}).Where("id = ?", id).Select("*").Omit("id", "created_at").Updates(customMap).Error
 }
 
 // --------------------------------------------------
@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"errors"
+
+	"IOT-Manage-System/map-service/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// areaOf 几何面积表达式：室外按 geography 计算（平方米），室内为平面坐标单位的平方
+func areaOf(g string) string {
+	return `CASE WHEN ST_SRID(` + g + `) = 4326 THEN ST_Area((` + g + `)::geography) ELSE ST_Area(` + g + `) END`
+}
+
+// overlapPair 两个围栏内部相交的条件：只比较同一坐标系、同一地图（或任一方为全局）的围栏，仅边界接触不算重叠
+const overlapPair = `a.is_indoor = b.is_indoor
+		  AND (a.map_id IS NULL OR b.map_id IS NULL OR a.map_id = b.map_id)
+		  AND ST_Intersects(a.geometry, b.geometry) AND NOT ST_Touches(a.geometry, b.geometry)`
+
+// overlapLockKey 重叠检查的事务级 advisory lock 键
+const overlapLockKey = "polygon_fences.overlap"
+
+// OverlapCheck 在写入围栏的事务中执行的重叠检查，r 绑定该事务；返回错误时事务回滚、围栏不写入
+type OverlapCheck func(r *PolygonFenceRepo) error
+
+// --------------------------------------------------
+// 重叠检测
+// --------------------------------------------------
+
+// runOverlapCheck 取重叠检查锁后执行 check，锁持有到事务提交：检查与写入之间不会有其他带检查的写入，
+// 并发创建 / 修改的两个围栏不会因为看不到对方未提交的写入而同时通过 block_overlap。
+// id 非空时随后锁定该围栏行，比较用的已存几何在写入前不会被回滚等修改改动；
+// 回滚恢复已删除的围栏时行不存在，交由后续写入处理
+func (r *PolygonFenceRepo) runOverlapCheck(id *uuid.UUID, check OverlapCheck) error {
+	if check == nil {
+		return nil
+	}
+	if err := r.db.Exec(`SELECT pg_advisory_xact_lock(hashtext(?))`, overlapLockKey).Error; err != nil {
+		return err
+	}
+	if id != nil {
+		if _, err := r.lockForUpdate(*id); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return check(r)
+}
+
+// FindOverlaps 尚未写入的围栏与现有激活围栏的重叠，几何按写入时的表达式构造（含缓冲）；
+// exclude 为被修改的围栏自身，结果按重叠面积从大到小，fence_id / fence_name 由调用方填写
+func (r *PolygonFenceRepo) FindOverlaps(fence *model.PolygonFence, exclude *uuid.UUID) ([]model.FenceOverlap, error) {
+	geom, geomArgs := geometryExpr(fence)
+	return r.overlapsWith(geom, geomArgs, fence.IsIndoor, fence.MapID, exclude)
+}
+
+// FindOverlapsOf 已保存围栏与其他激活围栏的重叠；isIndoor / mapID 为比较时采用的坐标系与地图
+func (r *PolygonFenceRepo) FindOverlapsOf(id uuid.UUID, isIndoor bool, mapID *uuid.UUID) ([]model.FenceOverlap, error) {
+	return r.overlapsWith(`(SELECT geometry FROM polygon_fences WHERE id = ?)`, []any{id}, isIndoor, mapID, &id)
+}
+
+// overlapsWith geom 为待比较几何的表达式；几何无效的已有围栏跳过（ST_Intersection 会报拓扑错误）。
+// 待比较几何本身可能是早期写入的无效几何，先 ST_MakeValid 并只保留面，有效几何不受影响
+func (r *PolygonFenceRepo) overlapsWith(geom string, geomArgs []any, isIndoor bool, mapID, exclude *uuid.UUID) ([]model.FenceOverlap, error) {
+	args := append(geomArgs, isIndoor)
+	cond := "TRUE"
+	if mapID != nil {
+		cond = "(b.map_id = ? OR b.map_id IS NULL)"
+		args = append(args, *mapID)
+	}
+	if exclude != nil {
+		cond += " AND b.id <> ?"
+		args = append(args, *exclude)
+	}
+
+	var list []model.FenceOverlap
+	err := r.db.Raw(`
+		WITH a AS (
+			SELECT g AS geometry, `+areaOf("g")+` AS area
+			FROM (SELECT ST_CollectionExtract(ST_MakeValid(`+geom+`), 3) AS g) t
+		)
+		SELECT b.id::text AS other_id, b.fence_name AS other_name, o.overlap_area,
+		       COALESCE(o.overlap_area / NULLIF(a.area, 0), 0) AS fence_ratio,
+		       COALESCE(o.overlap_area / NULLIF(`+areaOf("b.geometry")+`, 0), 0) AS other_ratio
+		FROM a
+		JOIN polygon_fences b ON b.is_active = true AND b.is_indoor = ? AND `+cond+`
+		 AND ST_IsValid(b.geometry)
+		 AND ST_Intersects(a.geometry, b.geometry) AND NOT ST_Touches(a.geometry, b.geometry)
+		CROSS JOIN LATERAL (SELECT ST_Intersection(a.geometry, b.geometry) AS g) i
+		CROSS JOIN LATERAL (SELECT `+areaOf("i.g")+` AS overlap_area) o
+		ORDER BY o.overlap_area DESC
+	`, args...).Scan(&list).Error
+	return list, err
+}
+
+// ListOverlaps scope 内两两重叠的激活围栏，每对只返回一次，按重叠面积从大到小
+func (r *PolygonFenceRepo) ListOverlaps(scope Scope) ([]model.FenceOverlap, error) {
+	where, args := scope.where(fenceNode, true)
+
+	var list []model.FenceOverlap
+	err := r.db.Raw(`
+		WITH f AS (
+			SELECT id, fence_name, is_indoor, map_id, geometry, `+areaOf("geometry")+` AS area
+			FROM polygon_fences
+			WHERE is_active = true AND ST_IsValid(geometry) AND `+where+`
+		)
+		SELECT a.id::text AS fence_id, a.fence_name, b.id::text AS other_id, b.fence_name AS other_name, o.overlap_area,
+		       COALESCE(o.overlap_area / NULLIF(a.area, 0), 0) AS fence_ratio,
+		       COALESCE(o.overlap_area / NULLIF(b.area, 0), 0) AS other_ratio
+		FROM f a
+		JOIN f b ON a.id < b.id AND `+overlapPair+`
+		CROSS JOIN LATERAL (SELECT ST_Intersection(a.geometry, b.geometry) AS g) i
+		CROSS JOIN LATERAL (SELECT `+areaOf("i.g")+` AS overlap_area) o
+		ORDER BY o.overlap_area DESC
+	`, args...).Scan(&list).Error
+	return list, err
+}
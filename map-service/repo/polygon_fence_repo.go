@@ -1,12 +1,38 @@
 package repo
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"IOT-Manage-System/map-service/model"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// fenceColumns 围栏查询列：几何转为 WKT；面积 / 周长室外围栏按 geography 计算（平方米 / 米），
+// 室内围栏为平面坐标单位
+const fenceColumns = `id, is_indoor, fence_name, shape, ST_AsText(geometry) as geometry, COALESCE(shape_params::text, '') as shape_params,
+		       CASE WHEN ST_SRID(geometry) = 4326 THEN ST_Area(geometry::geography) ELSE ST_Area(geometry) END as area,
+		       CASE WHEN ST_SRID(geometry) = 4326 THEN ST_Perimeter(geometry::geography) ELSE ST_Perimeter(geometry) END as perimeter,
+		       map_id, node_id, description, is_active, created_at, updated_at`
+
+// containsPoint 不区分室内外的点包含判断：室内围栏按平面坐标、室外围栏按 lon, lat 构造点。
+// 两个分支中的点都是常量，geometry 上的 GiST 索引可用；按 ST_SRID(geometry) 构造的点随行变化，只能全表扫描
+func containsPoint(x, y float64) (string, []any) {
+	return `((is_indoor AND ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 0)))
+		 OR (NOT is_indoor AND ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 4326))))`, []any{x, y, x, y}
+}
+
+// mapScope 按自制地图过滤的条件：mapID 为空时不过滤，否则只取该地图与全局（未绑定地图）的围栏
+func mapScope(mapID *uuid.UUID) (string, []any) {
+	if mapID == nil {
+		return "TRUE", nil
+	}
+	return "(map_id = ? OR map_id IS NULL)", []any{*mapID}
+}
+
 type PolygonFenceRepo struct {
 	db *gorm.DB
 }
@@ -19,13 +45,46 @@ func NewPolygonFenceRepo(db *gorm.DB) *PolygonFenceRepo {
 // Create
 // --------------------------------------------------
 
-// Create 创建多边形围栏
-func (r *PolygonFenceRepo) Create(fence *model.PolygonFence) error {
-	// 使用原生 SQL，利用 ST_GeomFromText 函数
-	return r.db.Exec(`
-		INSERT INTO polygon_fences (is_indoor, fence_name, geometry, description, is_active)
-		VALUES (?, ?, ST_GeomFromText(?), ?, ?)
-	`, fence.IsIndoor, fence.FenceName, fence.Geometry, fence.Description, fence.IsActive).Error
+// Create 创建多边形围栏，并记录版本 1；editor 为操作人，check 非 nil 时在同一事务中先检查重叠
+func (r *PolygonFenceRepo) Create(fence *model.PolygonFence, editor string, check OverlapCheck) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &PolygonFenceRepo{db: tx}
+		if err := txRepo.runOverlapCheck(nil, check); err != nil {
+			return err
+		}
+		return txRepo.createTx(fence, model.RevisionCreate, editor)
+	})
+}
+
+// insert 写入围栏并回填 fence.ID；fence.ID 非空时沿用该 ID（恢复已删除的围栏）
+func (r *PolygonFenceRepo) insert(fence *model.PolygonFence) error {
+	// 使用原生 SQL，利用 ST_GeomFromText / ST_Buffer 函数
+	idExpr, args := "DEFAULT", []any{}
+	if fence.ID != uuid.Nil {
+		idExpr, args = "?", []any{fence.ID}
+	}
+	geom, geomArgs := geometryExpr(fence)
+	args = append(args, fence.IsIndoor, fence.FenceName, fence.Shape)
+	args = append(args, geomArgs...)
+	args = append(args, fence.ShapeParams, fence.MapID, fence.NodeID, fence.Description, fence.IsActive)
+	return r.db.Raw(`
+		INSERT INTO polygon_fences (id, is_indoor, fence_name, shape, geometry, shape_params, map_id, node_id, description, is_active)
+		VALUES (`+idExpr+`, ?, ?, ?, `+geom+`, NULLIF(?, '')::jsonb, ?, ?, ?, ?)
+		RETURNING id
+	`, args...).Scan(&fence.ID).Error
+}
+
+// geometryExpr 围栏几何的写入表达式：圆形 / 走廊由点 / 折线缓冲为面
+// 室外围栏（WGS84）转为 geography 缓冲，缓冲距离单位为米
+func geometryExpr(fence *model.PolygonFence) (string, []any) {
+	srid := fence.SRID()
+	switch {
+	case fence.Buffer > 0 && srid == model.SRIDWGS84:
+		return "ST_Buffer(ST_GeomFromText(?, ?)::geography, ?, 'quad_segs=16')::geometry", []any{fence.Geometry, srid, fence.Buffer}
+	case fence.Buffer > 0:
+		return "ST_Buffer(ST_GeomFromText(?, ?), ?, 'quad_segs=16')", []any{fence.Geometry, srid, fence.Buffer}
+	}
+	return "ST_GeomFromText(?, ?)", []any{fence.Geometry, srid}
 }
 
 // --------------------------------------------------
@@ -37,8 +96,7 @@ func (r *PolygonFenceRepo) GetByID(id uuid.UUID) (*model.PolygonFence, error) {
 	var fence model.PolygonFence
 	// 使用 ST_AsText 将几何数据转换为 WKT 格式
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
 		WHERE id = ?
 	`, id).Scan(&fence).Error
@@ -52,8 +110,7 @@ func (r *PolygonFenceRepo) GetByID(id uuid.UUID) (*model.PolygonFence, error) {
 func (r *PolygonFenceRepo) GetByName(name string) (*model.PolygonFence, error) {
 	var fence model.PolygonFence
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
 		WHERE fence_name = ?
 	`, name).Scan(&fence).Error
@@ -63,108 +120,253 @@ func (r *PolygonFenceRepo) GetByName(name string) (*model.PolygonFence, error) {
 	return &fence, nil
 }
 
-// ListAll 获取所有围栏
-func (r *PolygonFenceRepo) ListAll() ([]model.PolygonFence, error) {
+// ListAll 获取所有围栏，按 scope 过滤（地图 / 节点 / 租户）
+func (r *PolygonFenceRepo) ListAll(scope Scope) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	where, args := scope.where(fenceNode, true)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
+		WHERE `+where+`
 		ORDER BY created_at DESC
-	`).Scan(&fences).Error
+	`, args...).Scan(&fences).Error
 	return fences, err
 }
 
-// ListActive 获取所有激活的围栏
-func (r *PolygonFenceRepo) ListActive() ([]model.PolygonFence, error) {
+// ListActive 获取所有激活的围栏，按 scope 过滤（地图 / 节点 / 租户）
+func (r *PolygonFenceRepo) ListActive(scope Scope) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	where, args := scope.where(fenceNode, true)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
-		WHERE is_active = true
+		WHERE is_active = true AND `+where+`
 		ORDER BY created_at DESC
-	`).Scan(&fences).Error
+	`, args...).Scan(&fences).Error
 	return fences, err
 }
 
-// ListIndoor 获取所有室内围栏
-func (r *PolygonFenceRepo) ListIndoor() ([]model.PolygonFence, error) {
+// ListIndoor 获取所有室内围栏，按 scope 过滤（地图 / 节点 / 租户）
+func (r *PolygonFenceRepo) ListIndoor(scope Scope) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	where, args := scope.where(fenceNode, true)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry,
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
-		WHERE is_indoor = true
+		WHERE is_indoor = true AND `+where+`
 		ORDER BY created_at DESC
-	`).Scan(&fences).Error
+	`, args...).Scan(&fences).Error
 	return fences, err
 }
 
-// ListOutdoor 获取所有室外围栏
-func (r *PolygonFenceRepo) ListOutdoor() ([]model.PolygonFence, error) {
+// ListOutdoor 获取所有室外围栏，按 scope 过滤（节点 / 租户）
+func (r *PolygonFenceRepo) ListOutdoor(scope Scope) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	where, args := scope.where(fenceNode, true)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry,
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
-		WHERE is_indoor = false
+		WHERE is_indoor = false AND `+where+`
 		ORDER BY created_at DESC
-	`).Scan(&fences).Error
+	`, args...).Scan(&fences).Error
 	return fences, err
 }
 
-// ListActiveIndoor 获取所有激活的室内围栏
-func (r *PolygonFenceRepo) ListActiveIndoor() ([]model.PolygonFence, error) {
+// ListActiveIndoor 获取所有激活的室内围栏，按 scope 过滤（地图 / 节点 / 租户）
+func (r *PolygonFenceRepo) ListActiveIndoor(scope Scope) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	where, args := scope.where(fenceNode, true)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry,
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
-		WHERE is_active = true AND is_indoor = true
+		WHERE is_active = true AND is_indoor = true AND `+where+`
 		ORDER BY created_at DESC
-	`).Scan(&fences).Error
+	`, args...).Scan(&fences).Error
 	return fences, err
 }
 
-// ListActiveOutdoor 获取所有激活的室外围栏
-func (r *PolygonFenceRepo) ListActiveOutdoor() ([]model.PolygonFence, error) {
+// ListActiveOutdoor 获取所有激活的室外围栏，按 scope 过滤（节点 / 租户）
+func (r *PolygonFenceRepo) ListActiveOutdoor(scope Scope) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	where, args := scope.where(fenceNode, true)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry,
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
-		WHERE is_active = true AND is_indoor = false
+		WHERE is_active = true AND is_indoor = false AND `+where+`
 		ORDER BY created_at DESC
-	`).Scan(&fences).Error
+	`, args...).Scan(&fences).Error
 	return fences, err
 }
 
+// ExistingNames 返回 names 中已存在的围栏名称及其所属租户（未归属租户为空串）
+func (r *PolygonFenceRepo) ExistingNames(names []string) (map[string]string, error) {
+	var found []struct {
+		FenceName string
+		Tenant    string
+	}
+	err := r.db.Raw(`
+		SELECT fence_name, `+tenantOf(fenceNode)+` AS tenant FROM polygon_fences WHERE fence_name IN ?
+	`, names).Scan(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]string, len(found))
+	for _, f := range found {
+		existing[f.FenceName] = f.Tenant
+	}
+	return existing, nil
+}
+
 // --------------------------------------------------
 // Update
 // --------------------------------------------------
 
-// UpdateByID 更新围栏
-func (r *PolygonFenceRepo) UpdateByID(id uuid.UUID, fence *model.PolygonFence) error {
+// UpdateByID 更新围栏，并记录修订；editor 为操作人，check 非 nil 时在同一事务中先检查重叠
+func (r *PolygonFenceRepo) UpdateByID(id uuid.UUID, fence *model.PolygonFence, editor string, check OverlapCheck) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &PolygonFenceRepo{db: tx}
+		if err := txRepo.runOverlapCheck(&id, check); err != nil {
+			return err
+		}
+		return txRepo.updateTx(id, fence, model.RevisionUpdate, editor)
+	})
+}
+
+// update 覆盖围栏的全部可写字段
+func (r *PolygonFenceRepo) update(id uuid.UUID, fence *model.PolygonFence) error {
+	geom, geomArgs := geometryExpr(fence)
+	args := append([]any{fence.IsIndoor, fence.FenceName, fence.Shape}, geomArgs...)
+	args = append(args, fence.ShapeParams, fence.MapID, fence.NodeID, fence.Description, fence.IsActive, id)
 	return r.db.Exec(`
 		UPDATE polygon_fences
 		SET is_indoor = ?,
 		    fence_name = ?, 
-		    geometry = ST_GeomFromText(?), 
+		    shape = ?,
+		    geometry = `+geom+`, 
+		    shape_params = NULLIF(?, '')::jsonb,
+		    map_id = ?,
+		    node_id = ?,
 		    description = ?, 
 		    is_active = ?,
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
-	`, fence.IsIndoor, fence.FenceName, fence.Geometry, fence.Description, fence.IsActive, id).Error
+	`, args...).Error
+}
+
+// Import 在同一事务中写入导入的围栏：同名围栏覆盖，其余新建，任意一条失败全部回滚。
+// tenant 非 nil 时只能覆盖该租户的围栏，写入后的围栏也须归属该租户，否则返回 ErrForeignTenant
+func (r *PolygonFenceRepo) Import(fences []model.PolygonFence, editor string, tenant *string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &PolygonFenceRepo{db: tx}
+		for i := range fences {
+			if err := txRepo.importTx(&fences[i], editor, tenant); err != nil {
+				return fmt.Errorf("%s: %w", fences[i].FenceName, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ImportEach 逐个围栏在各自的事务中写入，返回与 fences 对应的错误（成功为 nil），失败的不影响其余围栏
+func (r *PolygonFenceRepo) ImportEach(fences []model.PolygonFence, editor string, tenant *string) []error {
+	errList := make([]error, len(fences))
+	for i := range fences {
+		errList[i] = r.db.Transaction(func(tx *gorm.DB) error {
+			return (&PolygonFenceRepo{db: tx}).importTx(&fences[i], editor, tenant)
+		})
+	}
+	return errList
+}
+
+// importTx 同名围栏覆盖，否则新建；tenant 非 nil 时校验覆盖前后的归属
+func (r *PolygonFenceRepo) importTx(fence *model.PolygonFence, editor string, tenant *string) error {
+	var rows []struct {
+		ID     uuid.UUID
+		Tenant string
+	}
+	err := r.db.Raw(`
+		SELECT id, `+tenantOf(fenceNode)+` AS tenant FROM polygon_fences WHERE fence_name = ? FOR UPDATE
+	`, fence.FenceName).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	id := uuid.Nil
+	if len(rows) > 0 {
+		if tenant != nil && rows[0].Tenant != *tenant {
+			return ErrForeignTenant
+		}
+		id = rows[0].ID
+		err = r.updateTx(id, fence, model.RevisionImport, editor)
+	} else {
+		err = r.createTx(fence, model.RevisionImport, editor)
+		id = fence.ID
+	}
+	if err != nil || tenant == nil {
+		return err
+	}
+
+	// 写入后的节点 / 地图须属于调用方的租户
+	var after string
+	if err := r.db.Raw(`SELECT `+tenantOf(fenceNode)+` FROM polygon_fences WHERE id = ?`, id).Scan(&after).Error; err != nil {
+		return err
+	}
+	if after != *tenant {
+		return ErrForeignTenant
+	}
+	return nil
 }
 
 // --------------------------------------------------
 // Delete
 // --------------------------------------------------
 
-// DeleteByID 删除围栏
-func (r *PolygonFenceRepo) DeleteByID(id uuid.UUID) error {
-	return r.db.Exec("DELETE FROM polygon_fences WHERE id = ?", id).Error
+// DeleteByID 删除围栏；删除前的状态记为 delete 修订，历史保留
+func (r *PolygonFenceRepo) DeleteByID(id uuid.UUID, editor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &PolygonFenceRepo{db: tx}
+		// 先加行锁，避免与并发的修改 / 回滚争抢同一个版本号
+		if _, err := txRepo.lockForUpdate(id); err != nil {
+			return err
+		}
+		if err := txRepo.addRevision(id, model.RevisionDelete, editor, nil, nil); err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM polygon_fences WHERE id = ?", id).Error
+	})
+}
+
+// --------------------------------------------------
+// 几何校验
+// --------------------------------------------------
+
+// GeometryValidity ST_IsValid 校验结果，Area 为平面面积
+type GeometryValidity struct {
+	Valid  bool
+	Reason string
+	Area   float64
+}
+
+// CheckGeometry 用 ST_IsValid / ST_IsValidReason 校验 WKT 几何
+func (r *PolygonFenceRepo) CheckGeometry(wkt string, srid int) (*GeometryValidity, error) {
+	var v GeometryValidity
+	err := r.db.Raw(`
+		SELECT ST_IsValid(g) AS valid, ST_IsValidReason(g) AS reason, ST_Area(g) AS area
+		FROM (SELECT ST_GeomFromText(?, ?) AS g) t
+	`, wkt, srid).Scan(&v).Error
+	return &v, err
+}
+
+// MakeValid 用 ST_MakeValid 修复几何并只保留面：修复后只剩一个面时返回 POLYGON，没有面积时返回空串
+func (r *PolygonFenceRepo) MakeValid(wkt string, srid int) (string, error) {
+	var out string
+	err := r.db.Raw(`
+		SELECT CASE WHEN ST_IsEmpty(m) OR ST_Area(m) = 0 THEN ''
+		            WHEN ST_NumGeometries(m) = 1 THEN ST_AsText(ST_GeometryN(m, 1))
+		            ELSE ST_AsText(m) END
+		FROM (SELECT ST_CollectionExtract(ST_MakeValid(ST_GeomFromText(?, ?)), 3) AS m) t
+	`, wkt, srid).Scan(&out).Error
+	return out, err
 }
 
 // --------------------------------------------------
@@ -174,37 +376,43 @@ func (r *PolygonFenceRepo) DeleteByID(id uuid.UUID) error {
 // IsPointInFence 检查点是否在指定围栏内
 func (r *PolygonFenceRepo) IsPointInFence(fenceID uuid.UUID, x, y float64) (bool, error) {
 	var isInside bool
+	contains, args := containsPoint(x, y)
 	err := r.db.Raw(`
-		SELECT ST_Contains(geometry, ST_Point(?, ?))
+		SELECT `+contains+`
 		FROM polygon_fences
 		WHERE id = ? AND is_active = true
-	`, x, y, fenceID).Scan(&isInside).Error
+	`, append(args, fenceID)...).Scan(&isInside).Error
 	return isInside, err
 }
 
-// FindFencesByPoint 查询某个点所在的所有激活围栏
-func (r *PolygonFenceRepo) FindFencesByPoint(x, y float64) ([]model.PolygonFence, error) {
+// FindFencesByPoint 查询某个点所在的所有激活围栏，mapID 为点所在地图（可为空）
+func (r *PolygonFenceRepo) FindFencesByPoint(x, y float64, mapID *uuid.UUID) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	scope, scopeArgs := mapScope(mapID)
+	contains, args := containsPoint(x, y)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
 		WHERE is_active = true
-		AND ST_Contains(geometry, ST_Point(?, ?))
+		AND `+contains+`
+		AND `+scope+`
 		ORDER BY created_at DESC
-	`, x, y).Scan(&fences).Error
+	`, append(args, scopeArgs...)...).Scan(&fences).Error
 	return fences, err
 }
 
-// IsPointInAnyFence 检查点是否在任意一个激活的围栏内
-func (r *PolygonFenceRepo) IsPointInAnyFence(x, y float64) (bool, error) {
+// IsPointInAnyFence 检查点是否在任意一个激活的围栏内，mapID 为点所在地图（可为空）
+func (r *PolygonFenceRepo) IsPointInAnyFence(x, y float64, mapID *uuid.UUID) (bool, error) {
 	var count int64
+	scope, scopeArgs := mapScope(mapID)
+	contains, args := containsPoint(x, y)
 	err := r.db.Raw(`
 		SELECT COUNT(*)
 		FROM polygon_fences
 		WHERE is_active = true
-		AND ST_Contains(geometry, ST_Point(?, ?))
-	`, x, y).Scan(&count).Error
+		AND `+contains+`
+		AND `+scope+`
+	`, append(args, scopeArgs...)...).Scan(&count).Error
 	if err != nil {
 		return false, err
 	}
@@ -219,7 +427,7 @@ func (r *PolygonFenceRepo) IsPointInAnyFence(x, y float64) (bool, error) {
 func (r *PolygonFenceRepo) IsPointInIndoorFence(fenceID uuid.UUID, x, y float64) (bool, error) {
 	var isInside bool
 	err := r.db.Raw(`
-		SELECT ST_Contains(geometry, ST_Point(?, ?))
+		SELECT ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 0))
 		FROM polygon_fences
 		WHERE id = ? AND is_active = true AND is_indoor = true
 	`, x, y, fenceID).Scan(&isInside).Error
@@ -230,24 +438,25 @@ func (r *PolygonFenceRepo) IsPointInIndoorFence(fenceID uuid.UUID, x, y float64)
 func (r *PolygonFenceRepo) IsPointInOutdoorFence(fenceID uuid.UUID, x, y float64) (bool, error) {
 	var isInside bool
 	err := r.db.Raw(`
-		SELECT ST_Contains(geometry, ST_Point(?, ?))
+		SELECT ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 4326))
 		FROM polygon_fences
 		WHERE id = ? AND is_active = true AND is_indoor = false
 	`, x, y, fenceID).Scan(&isInside).Error
 	return isInside, err
 }
 
-// FindIndoorFencesByPoint 查询某个点所在的所有激活室内围栏
-func (r *PolygonFenceRepo) FindIndoorFencesByPoint(x, y float64) ([]model.PolygonFence, error) {
+// FindIndoorFencesByPoint 查询某个点所在的所有激活室内围栏，mapID 为点所在地图（可为空）
+func (r *PolygonFenceRepo) FindIndoorFencesByPoint(x, y float64, mapID *uuid.UUID) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
+	scope, scopeArgs := mapScope(mapID)
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
 		WHERE is_active = true AND is_indoor = true
-		AND ST_Contains(geometry, ST_Point(?, ?))
+		AND ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 0))
+		AND `+scope+`
 		ORDER BY created_at DESC
-	`, x, y).Scan(&fences).Error
+	`, append([]any{x, y}, scopeArgs...)...).Scan(&fences).Error
 	return fences, err
 }
 
@@ -255,25 +464,26 @@ func (r *PolygonFenceRepo) FindIndoorFencesByPoint(x, y float64) ([]model.Polygo
 func (r *PolygonFenceRepo) FindOutdoorFencesByPoint(x, y float64) ([]model.PolygonFence, error) {
 	var fences []model.PolygonFence
 	err := r.db.Raw(`
-		SELECT id, is_indoor, fence_name, ST_AsText(geometry) as geometry, 
-		       description, is_active, created_at, updated_at
+		SELECT `+fenceColumns+`
 		FROM polygon_fences
 		WHERE is_active = true AND is_indoor = false
-		AND ST_Contains(geometry, ST_Point(?, ?))
+		AND ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 4326))
 		ORDER BY created_at DESC
 	`, x, y).Scan(&fences).Error
 	return fences, err
 }
 
-// IsPointInAnyIndoorFence 检查点是否在任意一个激活的室内围栏内
-func (r *PolygonFenceRepo) IsPointInAnyIndoorFence(x, y float64) (bool, error) {
+// IsPointInAnyIndoorFence 检查点是否在任意一个激活的室内围栏内，mapID 为点所在地图（可为空）
+func (r *PolygonFenceRepo) IsPointInAnyIndoorFence(x, y float64, mapID *uuid.UUID) (bool, error) {
 	var count int64
+	scope, scopeArgs := mapScope(mapID)
 	err := r.db.Raw(`
 		SELECT COUNT(*)
 		FROM polygon_fences
 		WHERE is_active = true AND is_indoor = true
-		AND ST_Contains(geometry, ST_Point(?, ?))
-	`, x, y).Scan(&count).Error
+		AND ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 0))
+		AND `+scope+`
+	`, append([]any{x, y}, scopeArgs...)...).Scan(&count).Error
 	if err != nil {
 		return false, err
 	}
@@ -287,7 +497,7 @@ func (r *PolygonFenceRepo) IsPointInAnyOutdoorFence(x, y float64) (bool, error)
 		SELECT COUNT(*)
 		FROM polygon_fences
 		WHERE is_active = true AND is_indoor = false
-		AND ST_Contains(geometry, ST_Point(?, ?))
+		AND ST_Contains(geometry, ST_SetSRID(ST_Point(?, ?), 4326))
 	`, x, y).Scan(&count).Error
 	if err != nil {
 		return false, err
@@ -295,6 +505,57 @@ func (r *PolygonFenceRepo) IsPointInAnyOutdoorFence(x, y float64) (bool, error)
 	return count > 0, nil
 }
 
+// BatchPoint 批量检查的点，MapID 为空表示不区分地图
+type BatchPoint struct {
+	X, Y   float64
+	Indoor bool
+	MapID  *uuid.UUID
+}
+
+// BatchHit 批量检查命中的 (点序号, 围栏)
+type BatchHit struct {
+	Idx       int
+	FenceID   uuid.UUID
+	FenceName string
+}
+
+// FindFencesByPoints 一次查询多个点所在的激活围栏：点数组经 unnest 展开后与围栏做 ST_Contains 连接，
+// 室内点只匹配室内围栏（平面坐标），室外点只匹配室外围栏（WGS84）；Idx 为点在 points 中的下标。
+// 点的 SRID 只由点自身决定，连接时可按每个点走 geometry 的 GiST 索引
+func (r *PolygonFenceRepo) FindFencesByPoints(points []BatchPoint) ([]BatchHit, error) {
+	xs := make([]string, len(points))
+	ys := make([]string, len(points))
+	indoor := make([]string, len(points))
+	maps := make([]string, len(points))
+	for i, p := range points {
+		xs[i] = strconv.FormatFloat(p.X, 'g', -1, 64)
+		ys[i] = strconv.FormatFloat(p.Y, 'g', -1, 64)
+		indoor[i] = strconv.FormatBool(p.Indoor)
+		maps[i] = "NULL"
+		if p.MapID != nil {
+			maps[i] = p.MapID.String()
+		}
+	}
+
+	var hits []BatchHit
+	err := r.db.Raw(`
+		SELECT p.idx - 1 AS idx, f.id AS fence_id, f.fence_name
+		FROM unnest(?::float8[], ?::float8[], ?::bool[], ?::uuid[]) WITH ORDINALITY AS p(x, y, indoor, map_id, idx)
+		JOIN polygon_fences f
+		  ON f.is_active = true
+		 AND f.is_indoor = p.indoor
+		 AND (p.map_id IS NULL OR f.map_id IS NULL OR f.map_id = p.map_id)
+		 AND ST_Contains(f.geometry, ST_SetSRID(ST_Point(p.x, p.y), CASE WHEN p.indoor THEN 0 ELSE 4326 END))
+		ORDER BY p.idx, f.created_at DESC
+	`, pgArray(xs), pgArray(ys), pgArray(indoor), pgArray(maps)).Scan(&hits).Error
+	return hits, err
+}
+
+// pgArray 拼成 PostgreSQL 数组字面量，按文本参数传入后在 SQL 中转换类型
+func pgArray(items []string) string {
+	return "{" + strings.Join(items, ",") + "}"
+}
+
 // GetBoundingBox 获取围栏的边界框
 func (r *PolygonFenceRepo) GetBoundingBox(id uuid.UUID) (xMin, yMin, xMax, yMax float64, err error) {
 	err = r.db.Raw(`
@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+
+	"IOT-Manage-System/map-service/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// revisionColumns 修订查询列，几何与面积 / 周长的处理同 fenceColumns
+const revisionColumns = `id, fence_id, version, action, editor, source_version,
+		       is_indoor, fence_name, shape, ST_AsText(geometry) as geometry, COALESCE(shape_params::text, '') as shape_params,
+		       CASE WHEN ST_SRID(geometry) = 4326 THEN ST_Area(geometry::geography) ELSE ST_Area(geometry) END as area,
+		       CASE WHEN ST_SRID(geometry) = 4326 THEN ST_Perimeter(geometry::geography) ELSE ST_Perimeter(geometry) END as perimeter,
+		       map_id, node_id, description, is_active, COALESCE(diff::text, '') as diff, created_at`
+
+// --------------------------------------------------
+// 修订写入（调用方负责事务）
+// --------------------------------------------------
+
+// createTx 写入新围栏并记录首个版本
+func (r *PolygonFenceRepo) createTx(fence *model.PolygonFence, action, editor string) error {
+	if err := r.insert(fence); err != nil {
+		return err
+	}
+	return r.addRevision(fence.ID, action, editor, nil, nil)
+}
+
+// updateTx 覆盖围栏并记录相对修改前的差异
+func (r *PolygonFenceRepo) updateTx(id uuid.UUID, fence *model.PolygonFence, action, editor string) error {
+	return r.revise(id, action, editor, nil, func() error {
+		return r.update(id, fence)
+	})
+}
+
+// revise 锁定围栏行后执行 write，再以写入后的状态记录修订；同一围栏的修改串行，版本号不冲突
+func (r *PolygonFenceRepo) revise(id uuid.UUID, action, editor string, source *int, write func() error) error {
+	old, err := r.lockForUpdate(id)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	cur, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+	return r.addRevision(id, action, editor, source, model.DiffFences(old, cur))
+}
+
+// lockForUpdate 加行锁并返回修改前的状态，围栏不存在时返回 gorm.ErrRecordNotFound
+func (r *PolygonFenceRepo) lockForUpdate(id uuid.UUID) (*model.PolygonFence, error) {
+	var ids []uuid.UUID
+	if err := r.db.Raw(`SELECT id FROM polygon_fences WHERE id = ? FOR UPDATE`, id).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.GetByID(id)
+}
+
+// addRevision 以围栏当前状态写入下一个版本，diff 为 nil 时不记录差异
+func (r *PolygonFenceRepo) addRevision(id uuid.UUID, action, editor string, source *int, diff map[string]model.FieldChange) error {
+	diffJSON := ""
+	if diff != nil {
+		b, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		diffJSON = string(b)
+	}
+	res := r.db.Exec(`
+		INSERT INTO polygon_fence_revisions (fence_id, version, action, editor, source_version, is_indoor, fence_name,
+		                                     shape, geometry, shape_params, map_id, node_id, description, is_active, diff)
+		SELECT id, COALESCE((SELECT MAX(version) FROM polygon_fence_revisions WHERE fence_id = ?), 0) + 1, ?, ?, ?,
+		       is_indoor, fence_name, shape, geometry, shape_params, map_id, node_id, description, is_active, NULLIF(?, '')::jsonb
+		FROM polygon_fences
+		WHERE id = ?
+	`, id, action, editor, source, diffJSON, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// --------------------------------------------------
+// 修订查询
+// --------------------------------------------------
+
+// ListRevisions 围栏的全部修订，新版本在前
+func (r *PolygonFenceRepo) ListRevisions(fenceID uuid.UUID) ([]model.PolygonFenceRevision, error) {
+	var list []model.PolygonFenceRevision
+	err := r.db.Raw(`
+		SELECT `+revisionColumns+`
+		FROM polygon_fence_revisions
+		WHERE fence_id = ?
+		ORDER BY version DESC
+	`, fenceID).Scan(&list).Error
+	return list, err
+}
+
+// GetRevision 围栏的指定版本，不存在时返回 gorm.ErrRecordNotFound
+func (r *PolygonFenceRepo) GetRevision(fenceID uuid.UUID, version int) (*model.PolygonFenceRevision, error) {
+	var rev model.PolygonFenceRevision
+	res := r.db.Raw(`
+		SELECT `+revisionColumns+`
+		FROM polygon_fence_revisions
+		WHERE fence_id = ? AND version = ?
+	`, fenceID, version).Scan(&rev)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &rev, nil
+}
+
+// --------------------------------------------------
+// 回滚
+// --------------------------------------------------
+
+// Rollback 把围栏恢复为 fence（由调用方从指定版本的快照生成并校验），并记为新的 rollback 修订；
+// 围栏已删除时以原 ID 重新写入；check 非 nil 时在同一事务中先检查重叠
+func (r *PolygonFenceRepo) Rollback(fence *model.PolygonFence, version int, editor string, check OverlapCheck) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &PolygonFenceRepo{db: tx}
+		if err := txRepo.runOverlapCheck(&fence.ID, check); err != nil {
+			return err
+		}
+		err := txRepo.revise(fence.ID, model.RevisionRollback, editor, &version, func() error {
+			return txRepo.update(fence.ID, fence)
+		})
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := txRepo.insert(fence); err != nil {
+			return err
+		}
+		return txRepo.addRevision(fence.ID, model.RevisionRollback, editor, &version, nil)
+	})
+}
@@ -0,0 +1,235 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+
+	"IOT-Manage-System/map-service/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// subtreeIDs 节点及其全部下级节点的 ID
+const subtreeIDs = `WITH RECURSIVE sub AS (
+		SELECT id FROM site_nodes WHERE id = ?
+		UNION ALL
+		SELECT n.id FROM site_nodes n JOIN sub ON n.parent_id = sub.id
+	) SELECT id FROM sub`
+
+// 资源归属节点：基站 / 围栏未指定节点时取其自制地图所在节点
+const (
+	mapNode     = `custom_maps.node_id`
+	stationNode = `COALESCE(base_stations.node_id, (SELECT cm.node_id FROM custom_maps cm WHERE cm.id = base_stations.map_id))`
+	fenceNode   = `COALESCE(polygon_fences.node_id, (SELECT cm.node_id FROM custom_maps cm WHERE cm.id = polygon_fences.map_id))`
+)
+
+// Scope 列表查询范围，字段为空时不过滤
+type Scope struct {
+	MapID  *uuid.UUID // 只取该地图与未绑定地图的资源
+	NodeID *uuid.UUID // 只取归属该节点及其下级节点的资源
+	Tenant *string    // 只取归属该租户的资源，未归属任何节点的资源视为租户 ""
+}
+
+// where 生成过滤条件，nodeExpr 为资源归属节点的表达式，withMap 表示资源表有 map_id 列
+func (s Scope) where(nodeExpr string, withMap bool) (string, []any) {
+	cond := "TRUE"
+	var args []any
+	if withMap && s.MapID != nil {
+		cond += " AND (map_id = ? OR map_id IS NULL)"
+		args = append(args, *s.MapID)
+	}
+	if s.NodeID != nil {
+		cond += " AND " + nodeExpr + " IN (" + subtreeIDs + ")"
+		args = append(args, *s.NodeID)
+	}
+	if s.Tenant != nil {
+		cond += " AND COALESCE((SELECT tenant FROM site_nodes WHERE id = " + nodeExpr + "), '') = ?"
+		args = append(args, *s.Tenant)
+	}
+	return cond, args
+}
+
+type SiteNodeRepo struct {
+	db *gorm.DB
+}
+
+// NewSiteNodeRepo 构造函数
+func NewSiteNodeRepo(db *gorm.DB) *SiteNodeRepo {
+	return &SiteNodeRepo{db: db}
+}
+
+// --------------------------------------------------
+// Create
+// --------------------------------------------------
+
+// Create 插入一条记录，成功返回 nil
+func (r *SiteNodeRepo) Create(node *model.SiteNode) error {
+	return r.db.Create(node).Error
+}
+
+// --------------------------------------------------
+// Read
+// --------------------------------------------------
+
+// GetByID 根据主键查询
+func (r *SiteNodeRepo) GetByID(id uuid.UUID) (*model.SiteNode, error) {
+	var n model.SiteNode
+	err := r.db.First(&n, "id = ?", id).Error
+	return &n, err
+}
+
+// List 获取节点（按名称排序）；rootID 非空时只取该节点及其下级节点，tenant 非 nil 时只取该租户的节点
+func (r *SiteNodeRepo) List(rootID *uuid.UUID, tenant *string) ([]model.SiteNode, error) {
+	var list []model.SiteNode
+	q := r.db.Order("name")
+	if rootID != nil {
+		q = q.Where("id IN ("+subtreeIDs+")", *rootID)
+	}
+	if tenant != nil {
+		q = q.Where("tenant = ?", *tenant)
+	}
+	err := q.Find(&list).Error
+	return list, err
+}
+
+// Ancestors 从站点到该节点的路径（含节点本身）
+func (r *SiteNodeRepo) Ancestors(id uuid.UUID) ([]model.SiteNode, error) {
+	var list []model.SiteNode
+	err := r.db.Raw(`
+		WITH RECURSIVE up AS (
+			SELECT n.*, 0 AS depth FROM site_nodes n WHERE n.id = ?
+			UNION ALL
+			SELECT p.*, up.depth + 1 FROM site_nodes p JOIN up ON p.id = up.parent_id
+		)
+		SELECT id, parent_id, node_type, name, tenant, description, created_at, updated_at
+		FROM up ORDER BY depth DESC
+	`, id).Scan(&list).Error
+	return list, err
+}
+
+// nodeCount 按节点聚合的资源数量
+type nodeCount struct {
+	NodeID uuid.UUID
+	Total  int64
+}
+
+// CountByNode 统计直接归属各节点的地图、基站、围栏数量
+func (r *SiteNodeRepo) CountByNode() (maps, stations, fences map[uuid.UUID]int64, err error) {
+	count := func(table, nodeExpr string) (map[uuid.UUID]int64, error) {
+		var rows []nodeCount
+		if err := r.db.Raw(`
+			SELECT node_id, COUNT(*) AS total
+			FROM (SELECT ` + nodeExpr + ` AS node_id FROM ` + table + `) t
+			WHERE node_id IS NOT NULL
+			GROUP BY node_id
+		`).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		m := make(map[uuid.UUID]int64, len(rows))
+		for _, row := range rows {
+			m[row.NodeID] = row.Total
+		}
+		return m, nil
+	}
+
+	if maps, err = count("custom_maps", mapNode); err != nil {
+		return
+	}
+	if stations, err = count("base_stations", stationNode); err != nil {
+		return
+	}
+	fences, err = count("polygon_fences", fenceNode)
+	return
+}
+
+// --------------------------------------------------
+// 租户归属
+// --------------------------------------------------
+
+// 按租户检查归属的资源类型
+const (
+	ResourceSiteNode = "site_node"
+	ResourceMap      = "custom_map"
+	ResourceStation  = "station"
+	ResourceFence    = "polygon_fence"
+)
+
+// ErrForeignTenant 资源属于其他租户
+var ErrForeignTenant = errors.New("resource belongs to another tenant")
+
+// tenantOf 节点所属租户的表达式，节点为空时为 ""
+func tenantOf(nodeExpr string) string {
+	return "COALESCE((SELECT tenant FROM site_nodes WHERE id = " + nodeExpr + "), '')"
+}
+
+// ResourceTenant 资源所属租户；资源不存在时 found 为 false。
+// 已删除的围栏按最后一个修订归属，修订历史与回滚同样受租户限制
+func (r *SiteNodeRepo) ResourceTenant(kind string, id uuid.UUID) (tenant string, found bool, err error) {
+	var query []string
+	switch kind {
+	case ResourceSiteNode:
+		query = []string{`SELECT tenant FROM site_nodes WHERE id = ?`}
+	case ResourceMap:
+		query = []string{`SELECT ` + tenantOf(mapNode) + ` FROM custom_maps WHERE id = ?`}
+	case ResourceStation:
+		query = []string{`SELECT ` + tenantOf(stationNode) + ` FROM base_stations WHERE id = ?`}
+	case ResourceFence:
+		query = []string{
+			`SELECT ` + tenantOf(fenceNode) + ` FROM polygon_fences WHERE id = ?`,
+			`SELECT ` + tenantOf(`COALESCE(r.node_id, (SELECT cm.node_id FROM custom_maps cm WHERE cm.id = r.map_id))`) + `
+			 FROM polygon_fence_revisions r WHERE r.fence_id = ? ORDER BY r.version DESC LIMIT 1`,
+		}
+	default:
+		return "", false, fmt.Errorf("unknown resource kind: %s", kind)
+	}
+	for _, q := range query {
+		var rows []string
+		if err := r.db.Raw(q, id).Scan(&rows).Error; err != nil {
+			return "", false, err
+		}
+		if len(rows) > 0 {
+			return rows[0], true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// RefTenant 被引用的节点或地图所属租户（地图取其所在节点）；不存在时 found 为 false
+func (r *SiteNodeRepo) RefTenant(kind string, id uuid.UUID) (string, bool, error) {
+	if kind != ResourceSiteNode && kind != ResourceMap {
+		return "", false, fmt.Errorf("unknown reference kind: %s", kind)
+	}
+	return r.ResourceTenant(kind, id)
+}
+
+// --------------------------------------------------
+// Update
+// --------------------------------------------------
+
+// UpdateByID 更新节点；租户变化时同步到全部下级节点
+func (r *SiteNodeRepo) UpdateByID(node *model.SiteNode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.SiteNode{}).Where("id = ?", node.ID).Updates(map[string]interface{}{
+			"parent_id":   node.ParentID,
+			"name":        node.Name,
+			"tenant":      node.Tenant,
+			"description": node.Description,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			UPDATE site_nodes SET tenant = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE tenant <> ? AND id IN (`+subtreeIDs+`)
+		`, node.Tenant, node.Tenant, node.ID).Error
+	})
+}
+
+// --------------------------------------------------
+// Delete
+// --------------------------------------------------
+
+// DeleteByID 硬删除；仍有下级节点或绑定的地图、基站、围栏时由外键拒绝
+func (r *SiteNodeRepo) DeleteByID(id uuid.UUID) error {
+	return r.db.Delete(&model.SiteNode{}, "id = ?", id).Error
+}
@@ -48,10 +48,11 @@ func (r *StationRepo) GetByName(name string) (*model.Station, error) {
 	return &s, err
 }
 
-// ListAll 获取全部记录（简单场景）
-func (r *StationRepo) ListAll() ([]model.Station, error) {
+// ListAll 获取全部记录（简单场景）；按 scope 过滤，地图过滤时包含未指定地图的基站
+func (r *StationRepo) ListAll(scope Scope) ([]model.Station, error) {
 	var list []model.Station
-	err := r.db.Find(&list).Error
+	where, args := scope.where(stationNode, true)
+	err := r.db.Where(where, args...).Find(&list).Error
 	return list, err
 }
 
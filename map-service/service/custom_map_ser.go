@@ -35,6 +35,10 @@ func (s *CustomMapService) CreateCustomMap(req *model.CustomMapCreateReq, imageP
 	if scaleRatio == 0 {
 		scaleRatio = 1.0
 	}
+	nodeID, err := parseNodeID(req.NodeID)
+	if err != nil {
+		return err
+	}
 
 	customMap := &model.CustomMap{
 		MapName:     req.MapName,
@@ -46,6 +50,7 @@ func (s *CustomMapService) CreateCustomMap(req *model.CustomMapCreateReq, imageP
 		CenterX:     req.CenterX,
 		CenterY:     req.CenterY,
 		ScaleRatio:  scaleRatio,
+		NodeID:      nodeID,
 		Description: req.Description,
 	}
 
@@ -72,8 +77,13 @@ func (s *CustomMapService) GetCustomMap(id string, baseURL string) (*model.Custo
 
 /* ---------- 全量 ---------- */
 
-func (s *CustomMapService) GetAllCustomMaps(baseURL string) ([]model.CustomMapResp, error) {
-	list, err := s.customMapRepo.ListAll()
+func (s *CustomMapService) GetAllCustomMaps(scope model.ListScope, baseURL string) ([]model.CustomMapResp, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.customMapRepo.ListAll(sc)
 	if err != nil {
 		return nil, s.translateRepoErr(err, "CustomMap")
 	}
@@ -91,8 +101,14 @@ func (s *CustomMapService) GetAllCustomMaps(baseURL string) ([]model.CustomMapRe
 
 /* ---------- 获取最新 ---------- */
 
-func (s *CustomMapService) GetLatestCustomMap(baseURL string) (*model.CustomMapResp, error) {
-	customMap, err := s.customMapRepo.GetLatest()
+// GetLatestCustomMap 获取 scope（节点 / 租户）内最新的地图，不指定时为全局最新
+func (s *CustomMapService) GetLatestCustomMap(scope model.ListScope, baseURL string) (*model.CustomMapResp, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	customMap, err := s.customMapRepo.GetLatest(sc)
 	if err != nil {
 		return nil, s.translateRepoErr(err, "CustomMap")
 	}
@@ -153,6 +169,11 @@ func (s *CustomMapService) UpdateCustomMap(id string, req *model.CustomMapUpdate
 	if req.Description != nil {
 		description = *req.Description
 	}
+	if req.NodeID != nil {
+		if data.NodeID, err = parseNodeID(*req.NodeID); err != nil {
+			return err
+		}
+	}
 
 	// 业务验证
 	validateReq := &model.CustomMapCreateReq{
@@ -212,8 +233,11 @@ func (s *CustomMapService) DeleteCustomMap(id string) error {
 		return s.translateRepoErr(err, "CustomMap")
 	}
 
-	// 删除数据库记录
+	// 删除数据库记录；仍有围栏或基站绑定该地图时拒绝删除
 	if err := s.customMapRepo.DeleteByID(uid); err != nil {
+		if isMapFKErr(err) {
+			return errs.ErrResourceConflict.WithDetails("地图上仍有绑定的围栏或基站，请先删除或解除绑定")
+		}
 		return s.translateRepoErr(err, "CustomMap")
 	}
 
@@ -232,6 +256,9 @@ func (s *CustomMapService) translateRepoErr(err error, resource string) error {
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return errs.NotFound(resource, fmt.Sprintf("%s 不存在", resource))
 	}
+	if isNodeFKErr(err) {
+		return errs.ErrValidationFailed.WithDetails("层级节点不存在")
+	}
 	return errs.ErrInternal.WithDetails(err.Error())
 }
 
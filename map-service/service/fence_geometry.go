@@ -0,0 +1,340 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/model"
+)
+
+// maxFenceVertices 单个围栏所有环 / 中心线的顶点总数上限
+const maxFenceVertices = 10000
+
+// circleParams / corridorParams 落库到 shape_params 的原始形状参数
+type circleParams struct {
+	Center model.Point `json:"center"`
+	Radius float64     `json:"radius"`
+}
+
+type corridorParams struct {
+	Path  []model.Point `json:"path"`
+	Width float64       `json:"width"`
+}
+
+// shapeGiven 请求中是否带有任何形状字段
+func shapeGiven(spec *model.FenceShapeSpec) bool {
+	return spec.Shape != "" || len(spec.Points) > 0 || len(spec.Holes) > 0 ||
+		spec.Center != nil || spec.Radius > 0 || len(spec.Path) > 0 || spec.Width > 0 ||
+		len(spec.Polygons) > 0
+}
+
+// mergeShape 把更新请求中的形状字段叠加到原形状上；shape 改变时不沿用原参数
+func mergeShape(base, req model.FenceShapeSpec) model.FenceShapeSpec {
+	if req.Shape != "" && req.Shape != base.Shape {
+		return req
+	}
+	if len(req.Points) > 0 {
+		// 外环变化后原来的洞不一定仍在环内，随外环一起替换
+		base.Points, base.Holes = req.Points, req.Holes
+	} else if len(req.Holes) > 0 {
+		base.Holes = req.Holes
+	}
+	if req.Center != nil {
+		base.Center = req.Center
+	}
+	if req.Radius > 0 {
+		base.Radius = req.Radius
+	}
+	if len(req.Path) > 0 {
+		base.Path = req.Path
+	}
+	if req.Width > 0 {
+		base.Width = req.Width
+	}
+	if len(req.Polygons) > 0 {
+		base.Polygons = req.Polygons
+	}
+	return base
+}
+
+// buildFenceGeometry 校验形状参数并生成写库用的几何（WKT + 缓冲距离）与 shape_params
+func buildFenceGeometry(spec model.FenceShapeSpec) (shape, wkt string, buffer float64, params string, err error) {
+	shape = spec.Shape
+	if shape == "" {
+		shape = model.FenceShapePolygon
+	}
+
+	switch shape {
+	case model.FenceShapePolygon:
+		rings := model.PolygonRings{Points: spec.Points, Holes: spec.Holes}
+		if err = validateRings(rings, 0); err != nil {
+			return
+		}
+		wkt = "POLYGON" + ringsToWKT(rings)
+
+	case model.FenceShapeMultiPolygon:
+		if len(spec.Polygons) == 0 {
+			err = errs.ErrValidationFailed.WithDetails("multipolygon 至少需要1个多边形")
+			return
+		}
+		total := 0
+		parts := make([]string, len(spec.Polygons))
+		for i, rings := range spec.Polygons {
+			if err = validateRings(rings, total); err != nil {
+				err = errs.ErrValidationFailed.WithDetails(fmt.Sprintf("第 %d 个多边形: %s", i+1, errDetails(err)))
+				return
+			}
+			total += countVertices(rings)
+			parts[i] = ringsToWKT(rings)
+		}
+		wkt = "MULTIPOLYGON(" + strings.Join(parts, ",") + ")"
+
+	case model.FenceShapeCircle:
+		if spec.Center == nil || spec.Radius <= 0 {
+			err = errs.ErrValidationFailed.WithDetails("circle 需要 center 和大于0的 radius")
+			return
+		}
+		wkt = fmt.Sprintf("POINT(%f %f)", spec.Center.X, spec.Center.Y)
+		buffer = spec.Radius
+		params, err = marshalParams(circleParams{Center: *spec.Center, Radius: spec.Radius})
+
+	case model.FenceShapeCorridor:
+		if len(spec.Path) < 2 || spec.Width <= 0 {
+			err = errs.ErrValidationFailed.WithDetails("corridor 需要至少2个点的 path 和大于0的 width")
+			return
+		}
+		if len(spec.Path) > maxFenceVertices {
+			err = errs.ErrValidationFailed.WithDetails(fmt.Sprintf("中心线顶点数量不能超过%d", maxFenceVertices))
+			return
+		}
+		if err = checkRepeated(spec.Path); err != nil {
+			return
+		}
+		wkt = "LINESTRING(" + coordsToWKT(spec.Path) + ")"
+		buffer = spec.Width / 2
+		params, err = marshalParams(corridorParams{Path: spec.Path, Width: spec.Width})
+
+	default:
+		err = errs.ErrValidationFailed.WithDetails(fmt.Sprintf("不支持的围栏形状: %s", shape))
+	}
+	return
+}
+
+// fenceShapeSpec 从库中的几何与 shape_params 还原形状参数
+func fenceShapeSpec(fence *model.PolygonFence) model.FenceShapeSpec {
+	shape := fence.Shape
+	if shape == "" {
+		shape = model.FenceShapePolygon
+	}
+	spec := model.FenceShapeSpec{Shape: shape}
+
+	polygons := wktToPolygons(fence.Geometry)
+	if len(polygons) > 0 {
+		spec.Points = polygons[0].Points
+	}
+
+	switch shape {
+	case model.FenceShapePolygon:
+		if len(polygons) > 0 {
+			spec.Holes = polygons[0].Holes
+		}
+	case model.FenceShapeMultiPolygon:
+		spec.Polygons = polygons
+	case model.FenceShapeCircle:
+		var p circleParams
+		if json.Unmarshal([]byte(fence.ShapeParams), &p) == nil {
+			spec.Center, spec.Radius = &p.Center, p.Radius
+		}
+	case model.FenceShapeCorridor:
+		var p corridorParams
+		if json.Unmarshal([]byte(fence.ShapeParams), &p) == nil {
+			spec.Path, spec.Width = p.Path, p.Width
+		}
+	}
+	return spec
+}
+
+// validateRings 校验一个多边形的外环和内环，used 为已计入的顶点数
+func validateRings(rings model.PolygonRings, used int) error {
+	if len(rings.Points) < 3 {
+		return errs.ErrValidationFailed.WithDetails("多边形至少需要3个顶点")
+	}
+	if err := checkRepeated(rings.Points); err != nil {
+		return err
+	}
+	for i, hole := range rings.Holes {
+		if len(hole) < 3 {
+			return errs.ErrValidationFailed.WithDetails(fmt.Sprintf("第 %d 个洞至少需要3个顶点", i+1))
+		}
+		if err := checkRepeated(hole); err != nil {
+			return err
+		}
+	}
+	if used+countVertices(rings) > maxFenceVertices {
+		return errs.ErrValidationFailed.WithDetails(fmt.Sprintf("多边形顶点数量不能超过%d", maxFenceVertices))
+	}
+	return nil
+}
+
+// checkRepeated 检查是否有重复的连续点
+func checkRepeated(points []model.Point) error {
+	for i := 0; i < len(points)-1; i++ {
+		if points[i].X == points[i+1].X && points[i].Y == points[i+1].Y {
+			return errs.ErrValidationFailed.WithDetails(fmt.Sprintf("存在重复的连续顶点: (%f, %f)", points[i].X, points[i].Y))
+		}
+	}
+	return nil
+}
+
+func countVertices(rings model.PolygonRings) int {
+	n := len(rings.Points)
+	for _, h := range rings.Holes {
+		n += len(h)
+	}
+	return n
+}
+
+// ringsToWKT 生成 ((外环),(内环)...)，每个环自动闭合
+func ringsToWKT(rings model.PolygonRings) string {
+	parts := make([]string, 0, 1+len(rings.Holes))
+	parts = append(parts, "("+closedCoordsToWKT(rings.Points)+")")
+	for _, h := range rings.Holes {
+		parts = append(parts, "("+closedCoordsToWKT(h)+")")
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+func closedCoordsToWKT(points []model.Point) string {
+	ring := points
+	if first, last := points[0], points[len(points)-1]; first != last {
+		ring = append(append([]model.Point{}, points...), first)
+	}
+	return coordsToWKT(ring)
+}
+
+func coordsToWKT(points []model.Point) string {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%f %f", p.X, p.Y)
+	}
+	return strings.Join(coords, ",")
+}
+
+// wktToPolygons 解析 POLYGON / MULTIPOLYGON 的 WKT，环去掉闭合点
+// 示例: POLYGON((0 0,10 0,10 10,0 10,0 0),(2 2,4 2,4 4,2 2))
+//
+//	MULTIPOLYGON(((0 0,1 0,1 1,0 0)),((5 5,6 5,6 6,5 5)))
+func wktToPolygons(wkt string) []model.PolygonRings {
+	wkt = strings.TrimSpace(wkt)
+	var body string
+	var multi bool
+	switch {
+	case strings.HasPrefix(wkt, "MULTIPOLYGON"):
+		body, multi = strings.TrimPrefix(wkt, "MULTIPOLYGON"), true
+	case strings.HasPrefix(wkt, "POLYGON"):
+		body = strings.TrimPrefix(wkt, "POLYGON")
+	default:
+		return []model.PolygonRings{}
+	}
+
+	// 按括号深度切分：多边形在深度 2（MULTIPOLYGON）或 1（POLYGON），环再深一层
+	polyDepth := 1
+	if multi {
+		polyDepth = 2
+	}
+	var polygons []model.PolygonRings
+	var cur *model.PolygonRings
+	depth, start := 0, 0
+	for i, ch := range body {
+		switch ch {
+		case '(':
+			depth++
+			if depth == polyDepth {
+				polygons = append(polygons, model.PolygonRings{})
+				cur = &polygons[len(polygons)-1]
+			}
+			if depth == polyDepth+1 {
+				start = i + 1
+			}
+		case ')':
+			if depth == polyDepth+1 && cur != nil {
+				ring := parseRing(body[start:i])
+				if cur.Points == nil {
+					cur.Points = ring
+				} else {
+					cur.Holes = append(cur.Holes, ring)
+				}
+			}
+			depth--
+		}
+	}
+	return polygons
+}
+
+func parseRing(s string) []model.Point {
+	pairs := strings.Split(s, ",")
+	points := make([]model.Point, 0, len(pairs))
+	for _, pair := range pairs {
+		coords := strings.Fields(pair)
+		if len(coords) < 2 {
+			continue
+		}
+		x, errX := strconv.ParseFloat(coords[0], 64)
+		y, errY := strconv.ParseFloat(coords[1], 64)
+		if errX == nil && errY == nil {
+			points = append(points, model.Point{X: x, Y: y})
+		}
+	}
+	// 去掉最后一个点（闭合点）
+	if n := len(points); n > 1 && points[0] == points[n-1] {
+		points = points[:n-1]
+	}
+	return points
+}
+
+func marshalParams(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errs.ErrInternal.WithDetails(err.Error())
+	}
+	return string(b), nil
+}
+
+// errDetails 取出 AppError 的详细信息，用于拼接上下文
+func errDetails(err error) string {
+	if appErr, ok := err.(*errs.AppError); ok && appErr.Details != nil {
+		return fmt.Sprint(appErr.Details)
+	}
+	return err.Error()
+}
+
+// checkWGS84 室外围栏的所有坐标须为 经度, 纬度
+func checkWGS84(spec model.FenceShapeSpec) error {
+	points := append([]model.Point{}, spec.Points...)
+	for _, h := range spec.Holes {
+		points = append(points, h...)
+	}
+	if spec.Center != nil {
+		points = append(points, *spec.Center)
+	}
+	points = append(points, spec.Path...)
+	for _, rings := range spec.Polygons {
+		points = append(points, rings.Points...)
+		for _, h := range rings.Holes {
+			points = append(points, h...)
+		}
+	}
+	for _, p := range points {
+		if !validLonLat(p.X, p.Y) {
+			return errs.ErrValidationFailed.WithDetails(fmt.Sprintf("室外围栏坐标应为 WGS84 经纬度（x=经度, y=纬度）: (%f, %f)", p.X, p.Y))
+		}
+	}
+	return nil
+}
+
+func validLonLat(lon, lat float64) bool {
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
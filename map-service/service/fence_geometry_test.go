@@ -0,0 +1,78 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"IOT-Manage-System/map-service/model"
+)
+
+func TestWKTToPolygons(t *testing.T) {
+	square := []model.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+	hole := []model.Point{{X: 2, Y: 2}, {X: 4, Y: 2}, {X: 4, Y: 4}}
+	cases := []struct {
+		name string
+		wkt  string
+		want []model.PolygonRings
+	}{
+		{
+			name: "polygon",
+			wkt:  "POLYGON((0 0,10 0,10 10,0 10,0 0))",
+			want: []model.PolygonRings{{Points: square}},
+		},
+		{
+			name: "polygon with hole",
+			wkt:  "POLYGON((0 0,10 0,10 10,0 10,0 0),(2 2,4 2,4 4,2 2))",
+			want: []model.PolygonRings{{Points: square, Holes: [][]model.Point{hole}}},
+		},
+		{
+			name: "multipolygon",
+			wkt:  "MULTIPOLYGON(((0 0,10 0,10 10,0 10,0 0)),((20 20,21 20,21 21,20 20)))",
+			want: []model.PolygonRings{
+				{Points: square},
+				{Points: []model.Point{{X: 20, Y: 20}, {X: 21, Y: 20}, {X: 21, Y: 21}}},
+			},
+		},
+		{
+			name: "multipolygon with hole in second polygon",
+			wkt:  "MULTIPOLYGON(((20 20,21 20,21 21,20 20)),((0 0,10 0,10 10,0 10,0 0),(2 2,4 2,4 4,2 2)))",
+			want: []model.PolygonRings{
+				{Points: []model.Point{{X: 20, Y: 20}, {X: 21, Y: 20}, {X: 21, Y: 21}}},
+				{Points: square, Holes: [][]model.Point{hole}},
+			},
+		},
+		{
+			// ST_AsText 输出的 WGS84 坐标与空白
+			name: "wgs84 with spaces",
+			wkt:  "  POLYGON ((121.5 31.2, 121.6 31.2, 121.6 31.3, 121.5 31.2))  ",
+			want: []model.PolygonRings{{Points: []model.Point{{X: 121.5, Y: 31.2}, {X: 121.6, Y: 31.2}, {X: 121.6, Y: 31.3}}}},
+		},
+		{
+			name: "unclosed ring keeps every point",
+			wkt:  "POLYGON((0 0,10 0,10 10,0 10))",
+			want: []model.PolygonRings{{Points: square}},
+		},
+		{
+			name: "z coordinates ignored",
+			wkt:  "POLYGON((0 0 1,10 0 1,10 10 1,0 10 1,0 0 1))",
+			want: []model.PolygonRings{{Points: square}},
+		},
+		{name: "empty polygon", wkt: "POLYGON EMPTY"},
+		{name: "point", wkt: "POINT(1 2)"},
+		{name: "empty string", wkt: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := wktToPolygons(tc.wkt)
+			if len(tc.want) == 0 {
+				if len(got) != 0 {
+					t.Fatalf("wktToPolygons(%q) = %v, want none", tc.wkt, got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("wktToPolygons(%q)\n got  %v\n want %v", tc.wkt, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"log"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/model"
+	"IOT-Manage-System/map-service/repo"
+
+	"github.com/google/uuid"
+)
+
+/* ---------- 重叠检测 ---------- */
+
+// ListFenceOverlaps scope 内两两重叠的激活围栏（地图过滤时包含全局围栏）
+func (s *PolygonFenceService) ListFenceOverlaps(scope model.ListScope) ([]model.FenceOverlap, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.polygonFenceRepo.ListOverlaps(sc)
+	if err != nil {
+		return nil, s.translateRepoErr(err, "PolygonFence")
+	}
+	if list == nil {
+		list = []model.FenceOverlap{}
+	}
+	return list, nil
+}
+
+// GetFenceOverlaps 指定围栏与其他激活围栏的重叠，围栏本身未激活时也可查询
+func (s *PolygonFenceService) GetFenceOverlaps(id string) ([]model.FenceOverlap, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errs.ErrInvalidID.WithDetails("无效的围栏ID")
+	}
+
+	fence, err := s.polygonFenceRepo.GetByID(uid)
+	if err != nil {
+		return nil, s.translateRepoErr(err, "PolygonFence")
+	}
+
+	list, err := s.polygonFenceRepo.FindOverlapsOf(uid, fence.IsIndoor, fence.MapID)
+	if err != nil {
+		return nil, s.translateRepoErr(err, "PolygonFence")
+	}
+	return fillOverlaps(list, fence), nil
+}
+
+// overlapCheck 生成在写入事务中执行的重叠检查，结果写入 *out；未激活的围栏不检查、返回 nil。
+// id 为被修改的围栏（创建时为 nil），stored 表示几何未变、直接用库中的几何比较；
+// block 为 true 且存在重叠时返回 RESOURCE_CONFLICT、写入回滚，否则重叠作为警告返回
+func (s *PolygonFenceService) overlapCheck(fence *model.PolygonFence, id *uuid.UUID, stored, block bool, out *[]model.FenceOverlap) repo.OverlapCheck {
+	if !fence.IsActive {
+		return nil
+	}
+	return func(r *repo.PolygonFenceRepo) error {
+		var list []model.FenceOverlap
+		var err error
+		if stored {
+			list, err = r.FindOverlapsOf(*id, fence.IsIndoor, fence.MapID)
+		} else {
+			list, err = r.FindOverlaps(fence, id)
+		}
+		if err != nil {
+			return s.translateRepoErr(err, "PolygonFence")
+		}
+		if len(list) == 0 {
+			return nil
+		}
+
+		list = fillOverlaps(list, fence)
+		if block {
+			return errs.ErrResourceConflict.WithDetails(list)
+		}
+		log.Printf("[WARN] 围栏与 %d 个激活围栏重叠  name=%s  largest=%s", len(list), fence.FenceName, list[0].OtherName)
+		*out = list
+		return nil
+	}
+}
+
+// fillOverlaps 填写被检查围栏的 ID 与名称
+func fillOverlaps(list []model.FenceOverlap, fence *model.PolygonFence) []model.FenceOverlap {
+	for i := range list {
+		if fence.ID != uuid.Nil {
+			list[i].FenceID = fence.ID.String()
+		}
+		list[i].FenceName = fence.FenceName
+	}
+	if list == nil {
+		list = []model.FenceOverlap{}
+	}
+	return list
+}
@@ -0,0 +1,944 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/model"
+
+	"github.com/google/uuid"
+)
+
+// 导入导出格式
+const (
+	FenceFormatGeoJSON = "geojson"
+	FenceFormatKML     = "kml"
+)
+
+// 导入时同名围栏的处理方式
+const (
+	ImportConflictError   = "error"   // 任意同名即整体失败
+	ImportConflictSkip    = "skip"    // 跳过同名
+	ImportConflictReplace = "replace" // 覆盖同名
+)
+
+// maxImportFences 单次导入的围栏数量上限
+const maxImportFences = 1000
+
+// fenceFeature GeoJSON Feature / KML Placemark 解析后的统一形式
+type fenceFeature struct {
+	Name        string
+	Description string
+	IsIndoor    *bool
+	IsActive    *bool
+	MapID       string // 所属自制地图，空为全局
+	NodeID      string // 所属站点层级节点
+
+	// 导出时写入的原始形状参数，导入时优先用于还原圆形 / 走廊
+	Shape  string
+	Center *model.Point
+	Radius float64
+	Path   []model.Point
+	Width  float64
+
+	// 要素自身的几何
+	GeomType  string // Point / LineString / Polygon / MultiPolygon
+	BadCoords bool   // 坐标无法解析
+	Point     *model.Point
+	Line      []model.Point
+	Polygons  []model.PolygonRings
+}
+
+/* ---------- 导入 ---------- */
+
+// ImportFences 解析 GeoJSON FeatureCollection 或 KML 并写入。
+// 默认逐个要素校验和写入，失败的要素在 failed 中报告、其余照常导入；opts.Atomic 时任意要素失败都整体不导入
+func (s *PolygonFenceService) ImportFences(format string, data []byte, opts model.FenceImportOptions, editor string) (*model.FenceImportResp, error) {
+	onConflict := opts.OnConflict
+	if onConflict == "" {
+		onConflict = ImportConflictError
+	}
+	if onConflict != ImportConflictError && onConflict != ImportConflictSkip && onConflict != ImportConflictReplace {
+		return nil, errs.ErrInvalidInput.WithDetails("on_conflict 只支持 error / skip / replace")
+	}
+	refs, err := parseImportRefs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = detectFenceFormat(data)
+	}
+	var features []fenceFeature
+	switch format {
+	case FenceFormatGeoJSON:
+		features, err = parseGeoJSONFences(data)
+	case FenceFormatKML:
+		features, err = parseKMLFences(data)
+	default:
+		return nil, errs.ErrUnsupportedFormat.WithDetails("format 只支持 geojson / kml")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return nil, errs.ErrValidationFailed.WithDetails("文件中没有可导入的围栏")
+	}
+	if len(features) > maxImportFences {
+		return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("单次最多导入 %d 个围栏", maxImportFences))
+	}
+
+	names := make([]string, 0, len(features))
+	for _, f := range features {
+		names = append(names, strings.TrimSpace(f.Name))
+	}
+	existing, err := s.polygonFenceRepo.ExistingNames(names)
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
+	}
+
+	// 先校验全部要素，写入的只有校验通过的
+	resp := &model.FenceImportResp{}
+	seen := make(map[string]bool, len(features))
+	fences := make([]model.PolygonFence, 0, len(features))
+	var pending []importItem
+	for i, f := range features {
+		name := names[i]
+		refs.apply(&f)
+		fence, err := featureToFence(f, name, opts.Repair)
+		var repaired *model.GeometryIssue
+		if err == nil {
+			repaired, err = s.checkFenceGeometry(fence, opts.Repair)
+		}
+		if err == nil && seen[name] {
+			err = errs.ErrValidationFailed.WithDetails("文件内围栏名称重复")
+		}
+		owner, exists := existing[name]
+		if err == nil && exists && opts.Tenant != nil && owner != *opts.Tenant {
+			err = errs.ErrForbidden.WithDetails("围栏名称已被其他租户使用")
+		}
+		if err == nil && exists && onConflict == ImportConflictError {
+			err = errs.ErrDuplicateEntry.WithDetails("围栏名称已存在")
+		}
+		if err != nil {
+			resp.Failed = append(resp.Failed, model.FenceImportError{Index: i, Name: name, Error: errDetails(err)})
+			continue
+		}
+		seen[name] = true
+
+		if exists && onConflict == ImportConflictSkip {
+			resp.Skipped++
+			continue
+		}
+		fences = append(fences, *fence)
+		pending = append(pending, importItem{index: i, name: name, replace: exists, repaired: repaired != nil})
+	}
+	if opts.Atomic && len(resp.Failed) > 0 {
+		return nil, errs.ErrValidationFailed.WithDetails(resp.Failed)
+	}
+
+	if opts.Atomic {
+		if err := s.polygonFenceRepo.Import(fences, editor, opts.Tenant); err != nil {
+			return nil, s.translateRepoErr(err, "PolygonFence")
+		}
+		for _, it := range pending {
+			countImported(resp, it)
+		}
+		return resp, nil
+	}
+
+	// 地图 / 节点不存在、并发改名等写入错误同样按要素报告
+	for k, err := range s.polygonFenceRepo.ImportEach(fences, editor, opts.Tenant) {
+		if err != nil {
+			resp.Failed = append(resp.Failed, model.FenceImportError{
+				Index: pending[k].index, Name: pending[k].name, Error: errDetails(s.translateRepoErr(err, "PolygonFence")),
+			})
+			continue
+		}
+		countImported(resp, pending[k])
+	}
+	sort.Slice(resp.Failed, func(a, b int) bool { return resp.Failed[a].Index < resp.Failed[b].Index })
+	if len(resp.Failed) == len(features) {
+		return nil, errs.ErrValidationFailed.WithDetails(resp.Failed)
+	}
+	return resp, nil
+}
+
+// importItem 通过校验、待写入的要素
+type importItem struct {
+	index    int
+	name     string
+	replace  bool // 覆盖同名围栏
+	repaired bool
+}
+
+// importRefs 导入时 map_id / node_id 的替换规则
+type importRefs struct {
+	drop    bool
+	mapID   string
+	nodeID  string
+	mapMap  map[string]string
+	nodeMap map[string]string
+}
+
+// parseImportRefs 校验目标地图 / 节点与ID映射
+func parseImportRefs(opts model.FenceImportOptions) (importRefs, error) {
+	refs := importRefs{drop: opts.DropRefs, mapID: opts.MapID, nodeID: opts.NodeID}
+	if _, err := parseMapID(opts.MapID); err != nil {
+		return refs, err
+	}
+	if _, err := parseNodeID(opts.NodeID); err != nil {
+		return refs, err
+	}
+	var err error
+	if refs.mapMap, err = parseIDMapping(opts.MapMapping, "map_mapping"); err != nil {
+		return refs, err
+	}
+	if refs.nodeMap, err = parseIDMapping(opts.NodeMapping, "node_mapping"); err != nil {
+		return refs, err
+	}
+	return refs, nil
+}
+
+// apply 依次丢弃、按映射替换、统一指定；目标地图只作用于室内围栏
+func (r importRefs) apply(f *fenceFeature) {
+	if r.drop {
+		f.MapID, f.NodeID = "", ""
+	}
+	if to, ok := r.mapMap[strings.ToLower(f.MapID)]; ok && f.MapID != "" {
+		f.MapID = to
+	}
+	if to, ok := r.nodeMap[strings.ToLower(f.NodeID)]; ok && f.NodeID != "" {
+		f.NodeID = to
+	}
+	if r.mapID != "" && f.IsIndoor != nil && *f.IsIndoor {
+		f.MapID = r.mapID
+	}
+	if r.nodeID != "" {
+		f.NodeID = r.nodeID
+	}
+}
+
+// parseIDMapping 解析 "旧ID:新ID,旧ID:新ID"，新ID可为空
+func parseIDMapping(s, param string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, ":")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok {
+			return nil, errs.ErrInvalidInput.WithDetails(fmt.Sprintf("%s 格式为 旧ID:新ID,...", param))
+		}
+		if _, err := uuid.Parse(from); err != nil {
+			return nil, errs.ErrInvalidID.WithDetails(fmt.Sprintf("%s 中的ID无效: %s", param, from))
+		}
+		if to != "" {
+			if _, err := uuid.Parse(to); err != nil {
+				return nil, errs.ErrInvalidID.WithDetails(fmt.Sprintf("%s 中的ID无效: %s", param, to))
+			}
+		}
+		out[strings.ToLower(from)] = to
+	}
+	return out, nil
+}
+
+// countImported 按写入的要素计数
+func countImported(resp *model.FenceImportResp, it importItem) {
+	if it.replace {
+		resp.Updated++
+	} else {
+		resp.Created++
+	}
+	if it.repaired {
+		resp.Repaired++
+	}
+}
+
+// featureToFence 属性映射为围栏字段并生成几何
+func featureToFence(f fenceFeature, name string, repair bool) (*model.PolygonFence, error) {
+	if name == "" {
+		return nil, errs.ErrValidationFailed.WithDetails("缺少围栏名称（name / fence_name）")
+	}
+	if utf8.RuneCountInString(name) > 255 {
+		return nil, errs.ErrValidationFailed.WithDetails("围栏名称最多 255 个字符")
+	}
+	if utf8.RuneCountInString(f.Description) > 1000 {
+		return nil, errs.ErrValidationFailed.WithDetails("描述最多 1000 个字符")
+	}
+
+	spec, err := featureShape(f)
+	if err != nil {
+		return nil, err
+	}
+	if repair {
+		spec = dropRepeated(spec)
+	}
+	if f.IsIndoor == nil || !*f.IsIndoor {
+		if err := checkWGS84(spec); err != nil {
+			return nil, err
+		}
+	}
+	shape, wkt, buffer, params, err := buildFenceGeometry(spec)
+	if err != nil {
+		return nil, err
+	}
+	mapID, err := fenceMapID(f.IsIndoor != nil && *f.IsIndoor, f.MapID)
+	if err != nil {
+		return nil, err
+	}
+	nodeID, err := parseNodeID(f.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	fence := &model.PolygonFence{
+		FenceName:   name,
+		Shape:       shape,
+		Geometry:    wkt,
+		ShapeParams: params,
+		Buffer:      buffer,
+		MapID:       mapID,
+		NodeID:      nodeID,
+		Description: f.Description,
+		IsActive:    true,
+	}
+	if f.IsIndoor != nil {
+		fence.IsIndoor = *f.IsIndoor
+	}
+	if f.IsActive != nil {
+		fence.IsActive = *f.IsActive
+	}
+	return fence, nil
+}
+
+// featureShape 优先按 shape 属性还原圆形 / 走廊，否则按要素几何类型：
+// Point + radius → circle，LineString + width → corridor，Polygon → polygon，MultiPolygon → multipolygon
+func featureShape(f fenceFeature) (model.FenceShapeSpec, error) {
+	switch {
+	case f.Shape == model.FenceShapeCircle && f.Center != nil && f.Radius > 0:
+		return model.FenceShapeSpec{Shape: model.FenceShapeCircle, Center: f.Center, Radius: f.Radius}, nil
+	case f.Shape == model.FenceShapeCorridor && len(f.Path) > 0 && f.Width > 0:
+		return model.FenceShapeSpec{Shape: model.FenceShapeCorridor, Path: f.Path, Width: f.Width}, nil
+	}
+
+	if f.BadCoords {
+		return model.FenceShapeSpec{}, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("%s 坐标无效", f.GeomType))
+	}
+	switch f.GeomType {
+	case "Point":
+		if f.Radius <= 0 {
+			return model.FenceShapeSpec{}, errs.ErrValidationFailed.WithDetails("Point 要素需要 radius 属性（圆形围栏）")
+		}
+		return model.FenceShapeSpec{Shape: model.FenceShapeCircle, Center: f.Point, Radius: f.Radius}, nil
+	case "LineString":
+		if f.Width <= 0 {
+			return model.FenceShapeSpec{}, errs.ErrValidationFailed.WithDetails("LineString 要素需要 width 属性（走廊围栏）")
+		}
+		return model.FenceShapeSpec{Shape: model.FenceShapeCorridor, Path: f.Line, Width: f.Width}, nil
+	case "Polygon":
+		if len(f.Polygons) != 1 {
+			return model.FenceShapeSpec{}, errs.ErrValidationFailed.WithDetails("Polygon 坐标无效")
+		}
+		return model.FenceShapeSpec{Shape: model.FenceShapePolygon, Points: f.Polygons[0].Points, Holes: f.Polygons[0].Holes}, nil
+	case "MultiPolygon":
+		return model.FenceShapeSpec{Shape: model.FenceShapeMultiPolygon, Polygons: f.Polygons}, nil
+	case "":
+		return model.FenceShapeSpec{}, errs.ErrValidationFailed.WithDetails("缺少几何")
+	}
+	return model.FenceShapeSpec{}, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("不支持的几何类型: %s", f.GeomType))
+}
+
+// detectFenceFormat 未指定格式时按内容首字符判断
+func detectFenceFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '<' {
+		return FenceFormatKML
+	}
+	return FenceFormatGeoJSON
+}
+
+/* ---------- 导出 ---------- */
+
+// ExportFences 导出围栏，返回文件内容和 Content-Type；按地图 / 节点 / 租户过滤，地图过滤时包含全局围栏
+func (s *PolygonFenceService) ExportFences(format string, activeOnly bool, scope model.ListScope) ([]byte, string, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var fences []model.PolygonFence
+	if activeOnly {
+		fences, err = s.polygonFenceRepo.ListActive(sc)
+	} else {
+		fences, err = s.polygonFenceRepo.ListAll(sc)
+	}
+	if err != nil {
+		return nil, "", s.translateRepoErr(err, "PolygonFence")
+	}
+
+	features := make([]fenceFeature, 0, len(fences))
+	for i := range fences {
+		features = append(features, fenceToFeature(&fences[i]))
+	}
+
+	switch format {
+	case "", FenceFormatGeoJSON:
+		out, err := encodeGeoJSONFences(features)
+		return out, "application/geo+json", err
+	case FenceFormatKML:
+		out, err := encodeKMLFences(features)
+		return out, "application/vnd.google-earth.kml+xml", err
+	}
+	return nil, "", errs.ErrUnsupportedFormat.WithDetails("format 只支持 geojson / kml")
+}
+
+// fenceToFeature 几何统一导出为面（圆形 / 走廊为缓冲后的多边形），原始参数写入属性
+func fenceToFeature(fence *model.PolygonFence) fenceFeature {
+	spec := fenceShapeSpec(fence)
+	isIndoor, isActive := fence.IsIndoor, fence.IsActive
+	f := fenceFeature{
+		Name:        fence.FenceName,
+		Description: fence.Description,
+		IsIndoor:    &isIndoor,
+		IsActive:    &isActive,
+		Shape:       spec.Shape,
+		Center:      spec.Center,
+		Radius:      spec.Radius,
+		Path:        spec.Path,
+		Width:       spec.Width,
+		GeomType:    "Polygon",
+		Polygons:    wktToPolygons(fence.Geometry),
+	}
+	if fence.MapID != nil {
+		f.MapID = fence.MapID.String()
+	}
+	if fence.NodeID != nil {
+		f.NodeID = fence.NodeID.String()
+	}
+	if spec.Shape == model.FenceShapeMultiPolygon || len(f.Polygons) > 1 {
+		f.GeomType = "MultiPolygon"
+	}
+	return f
+}
+
+/* ---------- GeoJSON ---------- */
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	Properties map[string]any   `json:"properties"`
+	Geometry   *geoJSONGeometry `json:"geometry"`
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func parseGeoJSONFences(data []byte) ([]fenceFeature, error) {
+	var fc geoJSONCollection
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, errs.ErrInvalidInput.WithDetails("GeoJSON 解析失败: " + err.Error())
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, errs.ErrInvalidInput.WithDetails("只支持 GeoJSON FeatureCollection")
+	}
+
+	features := make([]fenceFeature, 0, len(fc.Features))
+	for _, gf := range fc.Features {
+		props := make(map[string]string, len(gf.Properties))
+		for k, v := range gf.Properties {
+			props[k] = propString(v)
+		}
+		f := propsToFeature(props)
+		if gf.Geometry != nil {
+			f.GeomType = gf.Geometry.Type
+			if err := decodeGeoJSONCoords(&f, gf.Geometry.Coordinates); err != nil {
+				// 坐标错误留给校验阶段按要素报告
+				f.BadCoords = true
+			}
+		}
+		features = append(features, f)
+	}
+	return features, nil
+}
+
+func decodeGeoJSONCoords(f *fenceFeature, raw json.RawMessage) error {
+	switch f.GeomType {
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(raw, &c); err != nil || len(c) < 2 {
+			return fmt.Errorf("point")
+		}
+		f.Point = &model.Point{X: c[0], Y: c[1]}
+	case "LineString":
+		var c [][]float64
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return err
+		}
+		line, err := positionsToPoints(c)
+		if err != nil {
+			return err
+		}
+		f.Line = line
+	case "Polygon":
+		var c [][][]float64
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return err
+		}
+		rings, err := positionsToRings(c)
+		if err != nil {
+			return err
+		}
+		f.Polygons = []model.PolygonRings{rings}
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return err
+		}
+		for _, poly := range c {
+			rings, err := positionsToRings(poly)
+			if err != nil {
+				return err
+			}
+			f.Polygons = append(f.Polygons, rings)
+		}
+	}
+	return nil
+}
+
+func positionsToPoints(c [][]float64) ([]model.Point, error) {
+	points := make([]model.Point, 0, len(c))
+	for _, p := range c {
+		if len(p) < 2 {
+			return nil, fmt.Errorf("position")
+		}
+		points = append(points, model.Point{X: p[0], Y: p[1]})
+	}
+	return points, nil
+}
+
+// positionsToRings 第一个环为外环，其余为洞，去掉闭合点
+func positionsToRings(c [][][]float64) (model.PolygonRings, error) {
+	var rings model.PolygonRings
+	for i, ring := range c {
+		points, err := positionsToPoints(ring)
+		if err != nil {
+			return rings, err
+		}
+		if n := len(points); n > 1 && points[0] == points[n-1] {
+			points = points[:n-1]
+		}
+		if i == 0 {
+			rings.Points = points
+		} else {
+			rings.Holes = append(rings.Holes, points)
+		}
+	}
+	return rings, nil
+}
+
+func encodeGeoJSONFences(features []fenceFeature) ([]byte, error) {
+	fc := geoJSONCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0, len(features))}
+	for _, f := range features {
+		var coords any
+		if f.GeomType == "MultiPolygon" {
+			multi := make([][][][]float64, 0, len(f.Polygons))
+			for _, rings := range f.Polygons {
+				multi = append(multi, ringsToPositions(rings))
+			}
+			coords = multi
+		} else if len(f.Polygons) > 0 {
+			coords = ringsToPositions(f.Polygons[0])
+		}
+		raw, err := json.Marshal(coords)
+		if err != nil {
+			return nil, errs.ErrInternal.WithDetails(err.Error())
+		}
+
+		props := map[string]any{
+			"name":        f.Name,
+			"description": f.Description,
+			"is_indoor":   *f.IsIndoor,
+			"is_active":   *f.IsActive,
+			"shape":       f.Shape,
+		}
+		if f.MapID != "" {
+			props["map_id"] = f.MapID
+		}
+		if f.NodeID != "" {
+			props["node_id"] = f.NodeID
+		}
+		if f.Center != nil {
+			props["center"] = []float64{f.Center.X, f.Center.Y}
+			props["radius"] = f.Radius
+		}
+		if len(f.Path) > 0 {
+			props["path"] = ringToPositions(f.Path, false)
+			props["width"] = f.Width
+		}
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:       "Feature",
+			Properties: props,
+			Geometry:   &geoJSONGeometry{Type: f.GeomType, Coordinates: raw},
+		})
+	}
+	out, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
+	}
+	return out, nil
+}
+
+func ringsToPositions(rings model.PolygonRings) [][][]float64 {
+	out := [][][]float64{ringToPositions(rings.Points, true)}
+	for _, h := range rings.Holes {
+		out = append(out, ringToPositions(h, true))
+	}
+	return out
+}
+
+func ringToPositions(points []model.Point, closed bool) [][]float64 {
+	out := make([][]float64, 0, len(points)+1)
+	for _, p := range points {
+		out = append(out, []float64{p.X, p.Y})
+	}
+	if closed && len(points) > 0 {
+		out = append(out, []float64{points[0].X, points[0].Y})
+	}
+	return out
+}
+
+/* ---------- KML ---------- */
+
+type kmlRoot struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name          string            `xml:"name"`
+	Description   string            `xml:"description,omitempty"`
+	ExtendedData  *kmlExtendedData  `xml:"ExtendedData,omitempty"`
+	Point         *kmlPoint         `xml:"Point,omitempty"`
+	LineString    *kmlLineString    `xml:"LineString,omitempty"`
+	Polygon       *kmlPolygon       `xml:"Polygon,omitempty"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry,omitempty"`
+}
+
+type kmlExtendedData struct {
+	Data []kmlData `xml:"Data"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Outer kmlBoundary   `xml:"outerBoundaryIs"`
+	Inner []kmlBoundary `xml:"innerBoundaryIs,omitempty"`
+}
+
+type kmlBoundary struct {
+	Ring kmlRing `xml:"LinearRing"`
+}
+
+type kmlRing struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlMultiGeometry struct {
+	Polygons []kmlPolygon `xml:"Polygon"`
+}
+
+// parseKMLFences 读取文档中所有 Placemark（包括 Folder 内的）
+func parseKMLFences(data []byte) ([]fenceFeature, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var features []fenceFeature
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errs.ErrInvalidInput.WithDetails("KML 解析失败: " + err.Error())
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+		var pm kmlPlacemark
+		if err := dec.DecodeElement(&pm, &start); err != nil {
+			return nil, errs.ErrInvalidInput.WithDetails("KML 解析失败: " + err.Error())
+		}
+		features = append(features, placemarkToFeature(pm))
+	}
+	return features, nil
+}
+
+func placemarkToFeature(pm kmlPlacemark) fenceFeature {
+	props := map[string]string{}
+	if pm.ExtendedData != nil {
+		for _, d := range pm.ExtendedData.Data {
+			props[d.Name] = strings.TrimSpace(d.Value)
+		}
+	}
+	props["name"] = strings.TrimSpace(pm.Name)
+	props["description"] = strings.TrimSpace(pm.Description)
+	f := propsToFeature(props)
+
+	var err error
+	switch {
+	case pm.Polygon != nil:
+		f.GeomType = "Polygon"
+		var rings model.PolygonRings
+		rings, err = kmlPolygonRings(*pm.Polygon)
+		f.Polygons = []model.PolygonRings{rings}
+	case pm.MultiGeometry != nil:
+		f.GeomType = "MultiPolygon"
+		for _, p := range pm.MultiGeometry.Polygons {
+			var rings model.PolygonRings
+			if rings, err = kmlPolygonRings(p); err != nil {
+				break
+			}
+			f.Polygons = append(f.Polygons, rings)
+		}
+	case pm.LineString != nil:
+		f.GeomType = "LineString"
+		f.Line, err = parseKMLCoords(pm.LineString.Coordinates)
+	case pm.Point != nil:
+		f.GeomType = "Point"
+		var pts []model.Point
+		if pts, err = parseKMLCoords(pm.Point.Coordinates); err == nil && len(pts) == 1 {
+			f.Point = &pts[0]
+		} else {
+			err = fmt.Errorf("point")
+		}
+	}
+	f.BadCoords = err != nil
+	return f
+}
+
+func kmlPolygonRings(p kmlPolygon) (model.PolygonRings, error) {
+	var rings model.PolygonRings
+	outer, err := parseKMLCoords(p.Outer.Ring.Coordinates)
+	if err != nil {
+		return rings, err
+	}
+	rings.Points = trimClosing(outer)
+	for _, in := range p.Inner {
+		hole, err := parseKMLCoords(in.Ring.Coordinates)
+		if err != nil {
+			return rings, err
+		}
+		rings.Holes = append(rings.Holes, trimClosing(hole))
+	}
+	return rings, nil
+}
+
+// parseKMLCoords 解析 "x,y[,z] x,y[,z] ..."
+func parseKMLCoords(s string) ([]model.Point, error) {
+	fields := strings.Fields(s)
+	points := make([]model.Point, 0, len(fields))
+	for _, tuple := range fields {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("coordinates")
+		}
+		x, errX := strconv.ParseFloat(parts[0], 64)
+		y, errY := strconv.ParseFloat(parts[1], 64)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("coordinates")
+		}
+		points = append(points, model.Point{X: x, Y: y})
+	}
+	return points, nil
+}
+
+func trimClosing(points []model.Point) []model.Point {
+	if n := len(points); n > 1 && points[0] == points[n-1] {
+		return points[:n-1]
+	}
+	return points
+}
+
+func encodeKMLFences(features []fenceFeature) ([]byte, error) {
+	root := kmlRoot{
+		Xmlns:    "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{Name: "polygon_fences"},
+	}
+	for _, f := range features {
+		pm := kmlPlacemark{
+			Name:        f.Name,
+			Description: f.Description,
+			ExtendedData: &kmlExtendedData{Data: []kmlData{
+				{Name: "is_indoor", Value: strconv.FormatBool(*f.IsIndoor)},
+				{Name: "is_active", Value: strconv.FormatBool(*f.IsActive)},
+				{Name: "shape", Value: f.Shape},
+			}},
+		}
+		if f.MapID != "" {
+			pm.ExtendedData.Data = append(pm.ExtendedData.Data, kmlData{Name: "map_id", Value: f.MapID})
+		}
+		if f.NodeID != "" {
+			pm.ExtendedData.Data = append(pm.ExtendedData.Data, kmlData{Name: "node_id", Value: f.NodeID})
+		}
+		if f.Center != nil {
+			pm.ExtendedData.Data = append(pm.ExtendedData.Data,
+				kmlData{Name: "center", Value: kmlCoords([]model.Point{*f.Center}, false)},
+				kmlData{Name: "radius", Value: strconv.FormatFloat(f.Radius, 'f', -1, 64)})
+		}
+		if len(f.Path) > 0 {
+			pm.ExtendedData.Data = append(pm.ExtendedData.Data,
+				kmlData{Name: "path", Value: kmlCoords(f.Path, false)},
+				kmlData{Name: "width", Value: strconv.FormatFloat(f.Width, 'f', -1, 64)})
+		}
+
+		polygons := make([]kmlPolygon, 0, len(f.Polygons))
+		for _, rings := range f.Polygons {
+			p := kmlPolygon{Outer: kmlBoundary{Ring: kmlRing{Coordinates: kmlCoords(rings.Points, true)}}}
+			for _, h := range rings.Holes {
+				p.Inner = append(p.Inner, kmlBoundary{Ring: kmlRing{Coordinates: kmlCoords(h, true)}})
+			}
+			polygons = append(polygons, p)
+		}
+		if f.GeomType == "MultiPolygon" {
+			pm.MultiGeometry = &kmlMultiGeometry{Polygons: polygons}
+		} else if len(polygons) > 0 {
+			pm.Polygon = &polygons[0]
+		}
+		root.Document.Placemarks = append(root.Document.Placemarks, pm)
+	}
+
+	out, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func kmlCoords(points []model.Point, closed bool) string {
+	parts := make([]string, 0, len(points)+1)
+	for _, p := range points {
+		parts = append(parts, strconv.FormatFloat(p.X, 'f', -1, 64)+","+strconv.FormatFloat(p.Y, 'f', -1, 64))
+	}
+	if closed && len(points) > 0 {
+		parts = append(parts, parts[0])
+	}
+	return strings.Join(parts, " ")
+}
+
+/* ---------- 属性映射 ---------- */
+
+// propsToFeature 属性映射：name / fence_name → 名称，is_indoor / indoor → 室内，description → 描述，
+// is_active → 启用状态，map_id → 所属自制地图，node_id → 所属层级节点；shape、center、radius、path、width 用于还原圆形和走廊
+func propsToFeature(props map[string]string) fenceFeature {
+	f := fenceFeature{
+		Name:        firstNonEmpty(props["name"], props["fence_name"]),
+		Description: props["description"],
+		IsIndoor:    parseBoolProp(firstNonEmpty(props["is_indoor"], props["indoor"])),
+		IsActive:    parseBoolProp(props["is_active"]),
+		MapID:       props["map_id"],
+		NodeID:      props["node_id"],
+		Shape:       props["shape"],
+	}
+	if center, err := parsePointList(props["center"]); err == nil && len(center) == 1 {
+		f.Center = &center[0]
+	}
+	if path, err := parsePointList(props["path"]); err == nil {
+		f.Path = path
+	}
+	f.Radius, _ = strconv.ParseFloat(props["radius"], 64)
+	f.Width, _ = strconv.ParseFloat(props["width"], 64)
+	return f
+}
+
+// parsePointList 支持 JSON 数组 [x,y] / [[x,y],...] 与 KML 的 "x,y x,y"
+func parsePointList(s string) ([]model.Point, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty")
+	}
+	if strings.HasPrefix(s, "[[") {
+		var c [][]float64
+		if err := json.Unmarshal([]byte(s), &c); err != nil {
+			return nil, err
+		}
+		return positionsToPoints(c)
+	}
+	if strings.HasPrefix(s, "[") {
+		var c []float64
+		if err := json.Unmarshal([]byte(s), &c); err != nil || len(c) < 2 {
+			return nil, fmt.Errorf("point")
+		}
+		return []model.Point{{X: c[0], Y: c[1]}}, nil
+	}
+	return parseKMLCoords(s)
+}
+
+// propString GeoJSON 属性统一转为字符串，数组 / 对象保留 JSON 形式
+func propString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func parseBoolProp(s string) *bool {
+	switch strings.ToLower(s) {
+	case "true", "1", "yes":
+		v := true
+		return &v
+	case "false", "0", "no":
+		v := false
+		return &v
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"IOT-Manage-System/map-service/model"
+)
+
+func boolPtr(v bool) *bool { return &v }
+
+// transferFeatures 导出后再导入应原样还原的要素
+func transferFeatures() []fenceFeature {
+	square := []model.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+	hole := []model.Point{{X: 2, Y: 2}, {X: 4, Y: 2}, {X: 4, Y: 4}}
+	return []fenceFeature{
+		{
+			Name: "polygon with hole", Description: "仓库", IsIndoor: boolPtr(true), IsActive: boolPtr(true),
+			MapID: "7d1f3c9e-2b4a-4f6e-9a8b-1c2d3e4f5a6b", NodeID: "0b6e2f1a-3c4d-4e5f-8a9b-0c1d2e3f4a5b",
+			Shape: model.FenceShapePolygon, GeomType: "Polygon",
+			Polygons: []model.PolygonRings{{Points: square, Holes: [][]model.Point{hole}}},
+		},
+		{
+			Name: "multipolygon", IsIndoor: boolPtr(false), IsActive: boolPtr(false),
+			Shape: model.FenceShapeMultiPolygon, GeomType: "MultiPolygon",
+			Polygons: []model.PolygonRings{
+				{Points: []model.Point{{X: 121.5, Y: 31.2}, {X: 121.6, Y: 31.2}, {X: 121.6, Y: 31.3}}},
+				{Points: square, Holes: [][]model.Point{hole}},
+			},
+		},
+		{
+			Name: "circle", IsIndoor: boolPtr(true), IsActive: boolPtr(true),
+			Shape: model.FenceShapeCircle, Center: &model.Point{X: 5, Y: 5}, Radius: 2.5, GeomType: "Polygon",
+			Polygons: []model.PolygonRings{{Points: square}},
+		},
+		{
+			Name: "corridor", IsIndoor: boolPtr(true), IsActive: boolPtr(true),
+			Shape: model.FenceShapeCorridor, Path: []model.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 5}}, Width: 1.5,
+			GeomType: "Polygon", Polygons: []model.PolygonRings{{Points: square}},
+		},
+	}
+}
+
+func TestFenceTransferRoundTrip(t *testing.T) {
+	codecs := []struct {
+		format string
+		encode func([]fenceFeature) ([]byte, error)
+		parse  func([]byte) ([]fenceFeature, error)
+	}{
+		{FenceFormatGeoJSON, encodeGeoJSONFences, parseGeoJSONFences},
+		{FenceFormatKML, encodeKMLFences, parseKMLFences},
+	}
+	for _, c := range codecs {
+		t.Run(c.format, func(t *testing.T) {
+			want := transferFeatures()
+			data, err := c.encode(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := detectFenceFormat(data); got != c.format {
+				t.Errorf("detectFenceFormat = %s", got)
+			}
+			got, err := c.parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d features, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("feature %d\n got  %+v\n want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseGeoJSONFences(t *testing.T) {
+	data := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"fence_name":" 别名 ","indoor":true,"is_active":"no","description":"d","radius":3},
+		 "geometry":{"type":"Polygon","coordinates":[[[0,0,1],[1,0,1],[1,1,1],[0,0,1]]]}},
+		{"type":"Feature","properties":{"name":"point","is_indoor":"1","center":"[1,2]"},
+		 "geometry":{"type":"Point","coordinates":[1,2]}},
+		{"type":"Feature","properties":{"name":"line","path":[[0,0],[5,0]],"width":2},
+		 "geometry":{"type":"LineString","coordinates":[[0,0],[5,0]]}},
+		{"type":"Feature","properties":{"name":"short position"},
+		 "geometry":{"type":"Polygon","coordinates":[[[0,0],[1],[1,1]]]}},
+		{"type":"Feature","properties":{"name":"coordinates not array"},
+		 "geometry":{"type":"MultiPolygon","coordinates":"x"}},
+		{"type":"Feature","properties":{"name":"no geometry","is_indoor":"maybe"}}
+	]}`
+	want := []fenceFeature{
+		{
+			Name: "别名", Description: "d", IsIndoor: boolPtr(true), IsActive: boolPtr(false), Radius: 3,
+			GeomType: "Polygon", Polygons: []model.PolygonRings{{Points: []model.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}}},
+		},
+		{Name: "point", IsIndoor: boolPtr(true), Center: &model.Point{X: 1, Y: 2}, GeomType: "Point", Point: &model.Point{X: 1, Y: 2}},
+		{
+			Name: "line", Path: []model.Point{{X: 0, Y: 0}, {X: 5, Y: 0}}, Width: 2,
+			GeomType: "LineString", Line: []model.Point{{X: 0, Y: 0}, {X: 5, Y: 0}},
+		},
+		{Name: "short position", GeomType: "Polygon", BadCoords: true},
+		{Name: "coordinates not array", GeomType: "MultiPolygon", BadCoords: true},
+		{Name: "no geometry"},
+	}
+
+	got, err := parseGeoJSONFences([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d features, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("feature %d\n got  %+v\n want %+v", i, got[i], want[i])
+		}
+	}
+
+	for name, bad := range map[string]string{
+		"malformed":      `{"type":"FeatureCollection","features":[`,
+		"single feature": `{"type":"Feature","geometry":null}`,
+	} {
+		if _, err := parseGeoJSONFences([]byte(bad)); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+}
+
+func TestParseKMLFences(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Folder>
+  <Placemark>
+    <name> 园区 </name>
+    <description>两块场地</description>
+    <ExtendedData><Data name="indoor"><value>false</value></Data><Data name="is_active"><value>yes</value></Data></ExtendedData>
+    <MultiGeometry>
+      <Polygon><outerBoundaryIs><LinearRing><coordinates>0,0,5 10,0,5 10,10,5 0,0,5</coordinates></LinearRing></outerBoundaryIs>
+        <innerBoundaryIs><LinearRing><coordinates>2,2 4,2 4,4 2,2</coordinates></LinearRing></innerBoundaryIs></Polygon>
+      <Polygon><outerBoundaryIs><LinearRing><coordinates>20,20 21,20 21,21</coordinates></LinearRing></outerBoundaryIs></Polygon>
+    </MultiGeometry>
+  </Placemark>
+</Folder>
+  <Placemark><name>point</name><Point><coordinates>1,2</coordinates></Point></Placemark>
+  <Placemark><name>line</name><LineString><coordinates>0,0 5,0</coordinates></LineString></Placemark>
+  <Placemark><name>bad</name><Polygon><outerBoundaryIs><LinearRing><coordinates>0,0 a,b 1,1</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>
+  <Placemark><name>bad point</name><Point><coordinates>1,2 3,4</coordinates></Point></Placemark>
+</Document></kml>`
+	want := []fenceFeature{
+		{
+			Name: "园区", Description: "两块场地", IsIndoor: boolPtr(false), IsActive: boolPtr(true), GeomType: "MultiPolygon",
+			Polygons: []model.PolygonRings{
+				{
+					Points: []model.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}},
+					Holes:  [][]model.Point{{{X: 2, Y: 2}, {X: 4, Y: 2}, {X: 4, Y: 4}}},
+				},
+				{Points: []model.Point{{X: 20, Y: 20}, {X: 21, Y: 20}, {X: 21, Y: 21}}}, // 未闭合的环原样保留
+			},
+		},
+		{Name: "point", GeomType: "Point", Point: &model.Point{X: 1, Y: 2}},
+		{Name: "line", GeomType: "LineString", Line: []model.Point{{X: 0, Y: 0}, {X: 5, Y: 0}}},
+		{Name: "bad", GeomType: "Polygon", BadCoords: true, Polygons: []model.PolygonRings{{}}},
+		{Name: "bad point", GeomType: "Point", BadCoords: true},
+	}
+
+	got, err := parseKMLFences([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d features, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("feature %d\n got  %+v\n want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := parseKMLFences([]byte(`<kml><Document><Placemark><name>x</Document></kml>`)); err == nil {
+		t.Error("malformed kml parsed without error")
+	}
+}
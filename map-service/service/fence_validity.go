@@ -0,0 +1,129 @@
+package service
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/model"
+)
+
+// validityReasons ST_IsValidReason 常见原因的说明
+var validityReasons = map[string]string{
+	"Self-intersection":                    "边相互交叉（如“蝴蝶结”形多边形），顶点顺序可能有误",
+	"Ring Self-intersection":               "环在某个顶点处自身接触，通常是存在重复顶点",
+	"Too few points in geometry component": "去掉重复顶点后有效顶点不足",
+	"Hole lies outside shell":              "洞不在外环内",
+	"Nested holes":                         "洞互相嵌套",
+	"Interior is disconnected":             "洞把多边形内部分割成了不相连的部分",
+	"Nested shells":                        "多边形互相嵌套",
+	"Duplicate Rings":                      "存在重复的环",
+	"Invalid Coordinate":                   "坐标无效（NaN / Inf）",
+	"Ring is not closed":                   "环未闭合",
+}
+
+// reasonLocation 拆分 ST_IsValidReason 的 "原因[x y]"
+var reasonLocation = regexp.MustCompile(`^(.*?)\s*\[(\S+) (\S+)\]$`)
+
+// parseValidityReason 把 ST_IsValidReason 结果转为 GeometryIssue
+func parseValidityReason(reason string) *model.GeometryIssue {
+	issue := &model.GeometryIssue{Reason: reason}
+	kind := reason
+	if m := reasonLocation.FindStringSubmatch(reason); m != nil {
+		kind = m[1]
+		x, errX := strconv.ParseFloat(m[2], 64)
+		y, errY := strconv.ParseFloat(m[3], 64)
+		if errX == nil && errY == nil {
+			issue.Location = &model.Point{X: x, Y: y}
+		}
+	}
+	issue.Message = validityReasons[kind]
+	if issue.Message == "" {
+		issue.Message = "几何无效"
+	}
+	return issue
+}
+
+// checkFenceGeometry 用 PostGIS 校验多边形 / 多多边形围栏（圆形、走廊由缓冲生成，总是有效）。
+// 几何无效或面积为 0 时：repair 为 false 返回 VALIDATION_FAILED 并给出原因与位置；
+// repair 为 true 时用 ST_MakeValid 修复并写回 fence，返回修复前发现的问题
+func (s *PolygonFenceService) checkFenceGeometry(fence *model.PolygonFence, repair bool) (*model.GeometryIssue, error) {
+	if fence.Buffer > 0 || (fence.Shape != model.FenceShapePolygon && fence.Shape != model.FenceShapeMultiPolygon) {
+		return nil, nil
+	}
+
+	srid := fence.SRID()
+	v, err := s.polygonFenceRepo.CheckGeometry(fence.Geometry, srid)
+	if err != nil {
+		// ST_GeomFromText 拒绝的几何（如环的点数不足 4 个）
+		return nil, errs.ErrValidationFailed.WithDetails(&model.GeometryIssue{Reason: err.Error(), Message: "几何无法解析"})
+	}
+
+	var issue *model.GeometryIssue
+	switch {
+	case !v.Valid:
+		issue = parseValidityReason(v.Reason)
+	case v.Area == 0:
+		issue = &model.GeometryIssue{Reason: "Zero area", Message: "面积为 0，顶点可能共线"}
+	default:
+		return nil, nil
+	}
+	if !repair {
+		return nil, errs.ErrValidationFailed.WithDetails(issue)
+	}
+
+	wkt, err := s.polygonFenceRepo.MakeValid(fence.Geometry, srid)
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
+	}
+	if wkt == "" {
+		issue.Message += "，修复后没有剩余面积，无法自动修复"
+		return nil, errs.ErrValidationFailed.WithDetails(issue)
+	}
+
+	// 蝴蝶结形多边形修复后会拆成多个面
+	fence.Geometry = wkt
+	if strings.HasPrefix(wkt, "MULTIPOLYGON") {
+		fence.Shape = model.FenceShapeMultiPolygon
+	} else {
+		fence.Shape = model.FenceShapePolygon
+	}
+	log.Printf("[INFO] 围栏几何已自动修复  name=%s  reason=%s  shape=%s", fence.FenceName, issue.Reason, fence.Shape)
+	return issue, nil
+}
+
+// dropRepeated 去掉连续重复的顶点（含首尾重复的闭合点），自动修复时在生成 WKT 前调用
+func dropRepeated(spec model.FenceShapeSpec) model.FenceShapeSpec {
+	dedupe := func(points []model.Point) []model.Point {
+		out := make([]model.Point, 0, len(points))
+		for _, p := range points {
+			if len(out) == 0 || out[len(out)-1] != p {
+				out = append(out, p)
+			}
+		}
+		if len(out) > 1 && out[0] == out[len(out)-1] {
+			out = out[:len(out)-1]
+		}
+		return out
+	}
+	dedupeRings := func(rings model.PolygonRings) model.PolygonRings {
+		holes := make([][]model.Point, len(rings.Holes))
+		for i, h := range rings.Holes {
+			holes[i] = dedupe(h)
+		}
+		return model.PolygonRings{Points: dedupe(rings.Points), Holes: holes}
+	}
+
+	r := dedupeRings(model.PolygonRings{Points: spec.Points, Holes: spec.Holes})
+	spec.Points, spec.Holes = r.Points, r.Holes
+	if len(spec.Polygons) > 0 {
+		polygons := make([]model.PolygonRings, len(spec.Polygons))
+		for i, p := range spec.Polygons {
+			polygons[i] = dedupeRings(p)
+		}
+		spec.Polygons = polygons
+	}
+	return spec
+}
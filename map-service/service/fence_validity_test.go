@@ -0,0 +1,123 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"IOT-Manage-System/map-service/model"
+)
+
+func TestParseValidityReason(t *testing.T) {
+	cases := []struct {
+		reason string
+		want   model.GeometryIssue
+	}{
+		{
+			reason: "Self-intersection[5 5]",
+			want: model.GeometryIssue{
+				Reason:   "Self-intersection[5 5]",
+				Message:  validityReasons["Self-intersection"],
+				Location: &model.Point{X: 5, Y: 5},
+			},
+		},
+		{
+			reason: "Ring Self-intersection[121.5 -31.25]",
+			want: model.GeometryIssue{
+				Reason:   "Ring Self-intersection[121.5 -31.25]",
+				Message:  validityReasons["Ring Self-intersection"],
+				Location: &model.Point{X: 121.5, Y: -31.25},
+			},
+		},
+		{
+			reason: "Too few points in geometry component[1 1]",
+			want: model.GeometryIssue{
+				Reason:   "Too few points in geometry component[1 1]",
+				Message:  validityReasons["Too few points in geometry component"],
+				Location: &model.Point{X: 1, Y: 1},
+			},
+		},
+		{
+			// 坐标无法解析时不给位置，原因仍可识别
+			reason: "Invalid Coordinate[NaN x]",
+			want:   model.GeometryIssue{Reason: "Invalid Coordinate[NaN x]", Message: validityReasons["Invalid Coordinate"]},
+		},
+		{
+			reason: "Ring is not closed",
+			want:   model.GeometryIssue{Reason: "Ring is not closed", Message: validityReasons["Ring is not closed"]},
+		},
+		{
+			reason: "Something new[3 4]",
+			want:   model.GeometryIssue{Reason: "Something new[3 4]", Message: "几何无效", Location: &model.Point{X: 3, Y: 4}},
+		},
+		{
+			reason: "",
+			want:   model.GeometryIssue{Message: "几何无效"},
+		},
+	}
+	for _, tc := range cases {
+		got := parseValidityReason(tc.reason)
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("parseValidityReason(%q) = %v, want %v", tc.reason, got, tc.want)
+		}
+	}
+}
+
+func TestDropRepeated(t *testing.T) {
+	a, b, c, d := model.Point{X: 0, Y: 0}, model.Point{X: 10, Y: 0}, model.Point{X: 10, Y: 10}, model.Point{X: 0, Y: 10}
+	h1, h2, h3 := model.Point{X: 2, Y: 2}, model.Point{X: 4, Y: 2}, model.Point{X: 4, Y: 4}
+
+	cases := []struct {
+		name string
+		in   model.FenceShapeSpec
+		want model.FenceShapeSpec
+	}{
+		{
+			name: "closing vertex removed",
+			in:   model.FenceShapeSpec{Points: []model.Point{a, b, c, d, a}},
+			want: model.FenceShapeSpec{Points: []model.Point{a, b, c, d}, Holes: [][]model.Point{}},
+		},
+		{
+			name: "consecutive duplicates removed",
+			in:   model.FenceShapeSpec{Points: []model.Point{a, a, b, b, b, c, d, d}},
+			want: model.FenceShapeSpec{Points: []model.Point{a, b, c, d}, Holes: [][]model.Point{}},
+		},
+		{
+			// 非连续的重复顶点（环在该点自身接触）保留，交给 ST_MakeValid 处理
+			name: "non-consecutive duplicate kept",
+			in:   model.FenceShapeSpec{Points: []model.Point{a, b, c, a, d}},
+			want: model.FenceShapeSpec{Points: []model.Point{a, b, c, a, d}, Holes: [][]model.Point{}},
+		},
+		{
+			name: "holes deduplicated",
+			in:   model.FenceShapeSpec{Points: []model.Point{a, b, c, d}, Holes: [][]model.Point{{h1, h2, h2, h3, h1}}},
+			want: model.FenceShapeSpec{Points: []model.Point{a, b, c, d}, Holes: [][]model.Point{{h1, h2, h3}}},
+		},
+		{
+			name: "multipolygon parts deduplicated",
+			in: model.FenceShapeSpec{Polygons: []model.PolygonRings{
+				{Points: []model.Point{a, b, b, c, a}},
+				{Points: []model.Point{a, c, d, a}, Holes: [][]model.Point{{h1, h1, h2, h3}}},
+			}},
+			want: model.FenceShapeSpec{
+				Points: []model.Point{},
+				Holes:  [][]model.Point{},
+				Polygons: []model.PolygonRings{
+					{Points: []model.Point{a, b, c}, Holes: [][]model.Point{}},
+					{Points: []model.Point{a, c, d}, Holes: [][]model.Point{{h1, h2, h3}}},
+				},
+			},
+		},
+		{
+			name: "single repeated point kept",
+			in:   model.FenceShapeSpec{Points: []model.Point{a, a, a}},
+			want: model.FenceShapeSpec{Points: []model.Point{a}, Holes: [][]model.Point{}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := dropRepeated(tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package service
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 
 	"IOT-Manage-System/map-service/errs"
@@ -24,28 +23,58 @@ func NewPolygonFenceService(repo *repo.PolygonFenceRepo) *PolygonFenceService {
 
 /* ---------- 创建 ---------- */
 
-// CreatePolygonFence 创建多边形围栏
-func (s *PolygonFenceService) CreatePolygonFence(req *model.PolygonFenceCreateReq) error {
-	// 验证多边形有效性
-	if err := s.validatePolygon(req.Points); err != nil {
-		return err
+// CreatePolygonFence 创建多边形围栏，editor 为操作人（记入修订历史）
+// 返回自动修复前发现的几何问题（req.Repair 为 true 时）与同其他激活围栏的重叠；
+// req.BlockOverlap 为 true 时存在重叠即拒绝创建
+func (s *PolygonFenceService) CreatePolygonFence(req *model.PolygonFenceCreateReq, editor string) (*model.FenceWriteResult, error) {
+	// 验证形状有效性并转换为 WKT 格式
+	spec := req.FenceShapeSpec
+	if req.Repair {
+		spec = dropRepeated(spec)
+	}
+	if !req.IsIndoor {
+		if err := checkWGS84(spec); err != nil {
+			return nil, err
+		}
+	}
+	shape, wkt, buffer, params, err := buildFenceGeometry(spec)
+	if err != nil {
+		return nil, err
+	}
+	mapID, err := fenceMapID(req.IsIndoor, req.MapID)
+	if err != nil {
+		return nil, err
+	}
+	nodeID, err := parseNodeID(req.NodeID)
+	if err != nil {
+		return nil, err
 	}
-
-	// 转换为 WKT 格式
-	wkt := s.pointsToWKT(req.Points)
 
 	fence := &model.PolygonFence{
 		IsIndoor:    req.IsIndoor,
 		FenceName:   req.FenceName,
+		Shape:       shape,
 		Geometry:    wkt,
+		ShapeParams: params,
+		Buffer:      buffer,
+		MapID:       mapID,
+		NodeID:      nodeID,
 		Description: req.Description,
 		IsActive:    true,
 	}
-
-	if err := s.polygonFenceRepo.Create(fence); err != nil {
-		return s.translateRepoErr(err, "PolygonFence")
+	repaired, err := s.checkFenceGeometry(fence, req.Repair)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	var overlaps []model.FenceOverlap
+	check := s.overlapCheck(fence, nil, false, req.BlockOverlap, &overlaps)
+	if err := s.polygonFenceRepo.Create(fence, editor, check); err != nil {
+		return nil, s.translateRepoErr(err, "PolygonFence")
+	}
+	for i := range overlaps {
+		overlaps[i].FenceID = fence.ID.String()
+	}
+	return &model.FenceWriteResult{Repaired: repaired, Overlaps: overlaps}, nil
 }
 
 /* ---------- 查询 ---------- */
@@ -65,15 +94,18 @@ func (s *PolygonFenceService) GetPolygonFence(id string) (*model.PolygonFenceRes
 	return s.fenceToResp(fence), nil
 }
 
-// ListPolygonFences 获取所有围栏
-func (s *PolygonFenceService) ListPolygonFences(activeOnly bool) ([]model.PolygonFenceResp, error) {
-	var fences []model.PolygonFence
-	var err error
+// ListPolygonFences 获取所有围栏，按地图 / 节点 / 租户过滤，地图过滤时包含全局围栏
+func (s *PolygonFenceService) ListPolygonFences(activeOnly bool, scope model.ListScope) ([]model.PolygonFenceResp, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
 
+	var fences []model.PolygonFence
 	if activeOnly {
-		fences, err = s.polygonFenceRepo.ListActive()
+		fences, err = s.polygonFenceRepo.ListActive(sc)
 	} else {
-		fences, err = s.polygonFenceRepo.ListAll()
+		fences, err = s.polygonFenceRepo.ListAll(sc)
 	}
 
 	if err != nil {
@@ -91,15 +123,18 @@ func (s *PolygonFenceService) ListPolygonFences(activeOnly bool) ([]model.Polygo
 	return resp, nil
 }
 
-// ListIndoorFences 获取室内围栏
-func (s *PolygonFenceService) ListIndoorFences(activeOnly bool) ([]model.PolygonFenceResp, error) {
-	var fences []model.PolygonFence
-	var err error
+// ListIndoorFences 获取室内围栏，按地图 / 节点 / 租户过滤，地图过滤时包含全局围栏
+func (s *PolygonFenceService) ListIndoorFences(activeOnly bool, scope model.ListScope) ([]model.PolygonFenceResp, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
 
+	var fences []model.PolygonFence
 	if activeOnly {
-		fences, err = s.polygonFenceRepo.ListActiveIndoor()
+		fences, err = s.polygonFenceRepo.ListActiveIndoor(sc)
 	} else {
-		fences, err = s.polygonFenceRepo.ListIndoor()
+		fences, err = s.polygonFenceRepo.ListIndoor(sc)
 	}
 
 	if err != nil {
@@ -117,15 +152,18 @@ func (s *PolygonFenceService) ListIndoorFences(activeOnly bool) ([]model.Polygon
 	return resp, nil
 }
 
-// ListOutdoorFences 获取室外围栏
-func (s *PolygonFenceService) ListOutdoorFences(activeOnly bool) ([]model.PolygonFenceResp, error) {
-	var fences []model.PolygonFence
-	var err error
+// ListOutdoorFences 获取室外围栏，按节点 / 租户过滤
+func (s *PolygonFenceService) ListOutdoorFences(activeOnly bool, scope model.ListScope) ([]model.PolygonFenceResp, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
 
+	var fences []model.PolygonFence
 	if activeOnly {
-		fences, err = s.polygonFenceRepo.ListActiveOutdoor()
+		fences, err = s.polygonFenceRepo.ListActiveOutdoor(sc)
 	} else {
-		fences, err = s.polygonFenceRepo.ListOutdoor()
+		fences, err = s.polygonFenceRepo.ListOutdoor(sc)
 	}
 
 	if err != nil {
@@ -145,31 +183,60 @@ func (s *PolygonFenceService) ListOutdoorFences(activeOnly bool) ([]model.Polygo
 
 /* ---------- 更新 ---------- */
 
-// UpdatePolygonFence 更新围栏
-func (s *PolygonFenceService) UpdatePolygonFence(id string, req *model.PolygonFenceUpdateReq) error {
+// UpdatePolygonFence 更新围栏，修改前后的差异记入修订历史
+// 返回自动修复前发现的几何问题（形状变化且 req.Repair 为 true 时）与修改后同其他激活围栏的重叠；
+// req.BlockOverlap 为 true 时存在重叠即拒绝修改
+func (s *PolygonFenceService) UpdatePolygonFence(id string, req *model.PolygonFenceUpdateReq, editor string) (*model.FenceWriteResult, error) {
 	uid, err := uuid.Parse(id)
 	if err != nil {
-		return errs.ErrInvalidID.WithDetails("无效的围栏ID")
+		return nil, errs.ErrInvalidID.WithDetails("无效的围栏ID")
 	}
 
 	// 获取现有数据
 	fence, err := s.polygonFenceRepo.GetByID(uid)
 	if err != nil {
-		return s.translateRepoErr(err, "PolygonFence")
+		return nil, s.translateRepoErr(err, "PolygonFence")
 	}
 
 	// 应用更新
+	srid := fence.SRID()
+	wasActive, prevMap := fence.IsActive, fence.MapID
 	if req.IsIndoor != nil {
 		fence.IsIndoor = *req.IsIndoor
 	}
 	if req.FenceName != nil {
 		fence.FenceName = *req.FenceName
 	}
-	if req.Points != nil {
-		if err := s.validatePolygon(*req.Points); err != nil {
-			return err
+	// 室内外切换时坐标系随之改变，圆形 / 走廊需要按新坐标系重新缓冲
+	reshaped := shapeGiven(&req.FenceShapeSpec) || fence.SRID() != srid
+	if reshaped {
+		spec := mergeShape(fenceShapeSpec(fence), req.FenceShapeSpec)
+		if req.Repair {
+			spec = dropRepeated(spec)
+		}
+		if !fence.IsIndoor {
+			if err := checkWGS84(spec); err != nil {
+				return nil, err
+			}
+		}
+		shape, wkt, buffer, params, err := buildFenceGeometry(spec)
+		if err != nil {
+			return nil, err
+		}
+		fence.Shape, fence.Geometry, fence.ShapeParams, fence.Buffer = shape, wkt, params, buffer
+	}
+	if req.MapID != nil {
+		if fence.MapID, err = parseMapID(*req.MapID); err != nil {
+			return nil, err
+		}
+	}
+	if !fence.IsIndoor && fence.MapID != nil {
+		return nil, errOutdoorMap()
+	}
+	if req.NodeID != nil {
+		if fence.NodeID, err = parseNodeID(*req.NodeID); err != nil {
+			return nil, err
 		}
-		fence.Geometry = s.pointsToWKT(*req.Points)
 	}
 	if req.Description != nil {
 		fence.Description = *req.Description
@@ -178,16 +245,30 @@ func (s *PolygonFenceService) UpdatePolygonFence(id string, req *model.PolygonFe
 		fence.IsActive = *req.IsActive
 	}
 
-	if err := s.polygonFenceRepo.UpdateByID(uid, fence); err != nil {
-		return s.translateRepoErr(err, "PolygonFence")
+	var repaired *model.GeometryIssue
+	if reshaped {
+		if repaired, err = s.checkFenceGeometry(fence, req.Repair); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	// 几何与所在地图都没变、且修改前已激活时不会产生新的重叠，只改名称、描述等不再检查
+	var overlaps []model.FenceOverlap
+	var check repo.OverlapCheck
+	mapChanged := (prevMap == nil) != (fence.MapID == nil) || (prevMap != nil && *prevMap != *fence.MapID)
+	if reshaped || mapChanged || !wasActive {
+		check = s.overlapCheck(fence, &uid, !reshaped, req.BlockOverlap, &overlaps)
+	}
+
+	if err := s.polygonFenceRepo.UpdateByID(uid, fence, editor, check); err != nil {
+		return nil, s.translateRepoErr(err, "PolygonFence")
+	}
+	return &model.FenceWriteResult{Repaired: repaired, Overlaps: overlaps}, nil
 }
 
 /* ---------- 删除 ---------- */
 
-// DeletePolygonFence 删除围栏
-func (s *PolygonFenceService) DeletePolygonFence(id string) error {
+// DeletePolygonFence 删除围栏，修订历史保留
+func (s *PolygonFenceService) DeletePolygonFence(id string, editor string) error {
 	uid, err := uuid.Parse(id)
 	if err != nil {
 		return errs.ErrInvalidID.WithDetails("无效的围栏ID")
@@ -198,7 +279,7 @@ func (s *PolygonFenceService) DeletePolygonFence(id string) error {
 		return s.translateRepoErr(err, "PolygonFence")
 	}
 
-	if err := s.polygonFenceRepo.DeleteByID(uid); err != nil {
+	if err := s.polygonFenceRepo.DeleteByID(uid, editor); err != nil {
 		return s.translateRepoErr(err, "PolygonFence")
 	}
 	return nil
@@ -206,17 +287,24 @@ func (s *PolygonFenceService) DeletePolygonFence(id string) error {
 
 /* ---------- 空间查询 ---------- */
 
-// CheckPointInFence 检查点是否在指定围栏内
-func (s *PolygonFenceService) CheckPointInFence(fenceID string, x, y float64) (*model.PointCheckResp, error) {
+// CheckPointInFence 检查点是否在指定围栏内，点与围栏不在同一地图时视为不在围栏内
+func (s *PolygonFenceService) CheckPointInFence(fenceID string, x, y float64, mapID string) (*model.PointCheckResp, error) {
 	uid, err := uuid.Parse(fenceID)
 	if err != nil {
 		return nil, errs.ErrInvalidID.WithDetails("无效的围栏ID")
 	}
+	mid, err := parseMapID(mapID)
+	if err != nil {
+		return nil, err
+	}
 
 	fence, err := s.polygonFenceRepo.GetByID(uid)
 	if err != nil {
 		return nil, s.translateRepoErr(err, "PolygonFence")
 	}
+	if !sameMap(fence.MapID, mid) {
+		return &model.PointCheckResp{IsInside: false}, nil
+	}
 
 	isInside, err := s.polygonFenceRepo.IsPointInFence(uid, x, y)
 	if err != nil {
@@ -235,8 +323,12 @@ func (s *PolygonFenceService) CheckPointInFence(fenceID string, x, y float64) (*
 }
 
 // CheckPointInAllFences 检查点在哪些围栏内
-func (s *PolygonFenceService) CheckPointInAllFences(x, y float64) (*model.PointCheckResp, error) {
-	fences, err := s.polygonFenceRepo.FindFencesByPoint(x, y)
+func (s *PolygonFenceService) CheckPointInAllFences(x, y float64, mapID string) (*model.PointCheckResp, error) {
+	mid, err := parseMapID(mapID)
+	if err != nil {
+		return nil, err
+	}
+	fences, err := s.polygonFenceRepo.FindFencesByPoint(x, y, mid)
 	if err != nil {
 		return nil, errs.ErrInternal.WithDetails(err.Error())
 	}
@@ -259,17 +351,24 @@ func (s *PolygonFenceService) CheckPointInAllFences(x, y float64) (*model.PointC
 
 /* ---------- 室内/室外专用查询 ---------- */
 
-// CheckPointInIndoorFence 检查点是否在指定室内围栏内
-func (s *PolygonFenceService) CheckPointInIndoorFence(fenceID string, x, y float64) (*model.PointCheckResp, error) {
+// CheckPointInIndoorFence 检查点是否在指定室内围栏内，点与围栏不在同一地图时视为不在围栏内
+func (s *PolygonFenceService) CheckPointInIndoorFence(fenceID string, x, y float64, mapID string) (*model.PointCheckResp, error) {
 	uid, err := uuid.Parse(fenceID)
 	if err != nil {
 		return nil, errs.ErrInvalidID.WithDetails("无效的围栏ID")
 	}
+	mid, err := parseMapID(mapID)
+	if err != nil {
+		return nil, err
+	}
 
 	fence, err := s.polygonFenceRepo.GetByID(uid)
 	if err != nil {
 		return nil, s.translateRepoErr(err, "PolygonFence")
 	}
+	if !sameMap(fence.MapID, mid) {
+		return &model.PointCheckResp{IsInside: false}, nil
+	}
 
 	isInside, err := s.polygonFenceRepo.IsPointInIndoorFence(uid, x, y)
 	if err != nil {
@@ -289,6 +388,9 @@ func (s *PolygonFenceService) CheckPointInIndoorFence(fenceID string, x, y float
 
 // CheckPointInOutdoorFence 检查点是否在指定室外围栏内
 func (s *PolygonFenceService) CheckPointInOutdoorFence(fenceID string, x, y float64) (*model.PointCheckResp, error) {
+	if !validLonLat(x, y) {
+		return nil, errOutdoorCoords(x, y)
+	}
 	uid, err := uuid.Parse(fenceID)
 	if err != nil {
 		return nil, errs.ErrInvalidID.WithDetails("无效的围栏ID")
@@ -316,8 +418,12 @@ func (s *PolygonFenceService) CheckPointInOutdoorFence(fenceID string, x, y floa
 }
 
 // CheckPointInIndoorFences 检查点在哪些室内围栏内
-func (s *PolygonFenceService) CheckPointInIndoorFences(x, y float64) (*model.PointCheckResp, error) {
-	fences, err := s.polygonFenceRepo.FindIndoorFencesByPoint(x, y)
+func (s *PolygonFenceService) CheckPointInIndoorFences(x, y float64, mapID string) (*model.PointCheckResp, error) {
+	mid, err := parseMapID(mapID)
+	if err != nil {
+		return nil, err
+	}
+	fences, err := s.polygonFenceRepo.FindIndoorFencesByPoint(x, y, mid)
 	if err != nil {
 		return nil, errs.ErrInternal.WithDetails(err.Error())
 	}
@@ -340,6 +446,9 @@ func (s *PolygonFenceService) CheckPointInIndoorFences(x, y float64) (*model.Poi
 
 // CheckPointInOutdoorFences 检查点在哪些室外围栏内
 func (s *PolygonFenceService) CheckPointInOutdoorFences(x, y float64) (*model.PointCheckResp, error) {
+	if !validLonLat(x, y) {
+		return nil, errOutdoorCoords(x, y)
+	}
 	fences, err := s.polygonFenceRepo.FindOutdoorFencesByPoint(x, y)
 	if err != nil {
 		return nil, errs.ErrInternal.WithDetails(err.Error())
@@ -362,97 +471,133 @@ func (s *PolygonFenceService) CheckPointInOutdoorFences(x, y float64) (*model.Po
 }
 
 // IsPointInAnyIndoorFence 检查点是否在任意一个室内围栏内
-func (s *PolygonFenceService) IsPointInAnyIndoorFence(x, y float64) (bool, error) {
-	return s.polygonFenceRepo.IsPointInAnyIndoorFence(x, y)
+func (s *PolygonFenceService) IsPointInAnyIndoorFence(x, y float64, mapID string) (bool, error) {
+	mid, err := parseMapID(mapID)
+	if err != nil {
+		return false, err
+	}
+	return s.polygonFenceRepo.IsPointInAnyIndoorFence(x, y, mid)
 }
 
 // IsPointInAnyOutdoorFence 检查点是否在任意一个室外围栏内
 func (s *PolygonFenceService) IsPointInAnyOutdoorFence(x, y float64) (bool, error) {
+	if !validLonLat(x, y) {
+		return false, errOutdoorCoords(x, y)
+	}
 	return s.polygonFenceRepo.IsPointInAnyOutdoorFence(x, y)
 }
 
-/* ---------- 内部辅助函数 ---------- */
+// maxBatchPoints 批量检查单次最多的点数
+const maxBatchPoints = 10000
 
-// validatePolygon 验证多边形有效性
-func (s *PolygonFenceService) validatePolygon(points []model.Point) error {
-	if len(points) < 3 {
-		return errs.ErrValidationFailed.WithDetails("多边形至少需要3个顶点")
+// CheckPointsBatch 批量检查点所在的激活围栏，一次数据库查询完成；结果顺序与 points 一致
+func (s *PolygonFenceService) CheckPointsBatch(points []model.BatchCheckPoint) ([]model.BatchCheckResult, error) {
+	if len(points) > maxBatchPoints {
+		return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("单次最多检查 %d 个点", maxBatchPoints))
 	}
 
-	if len(points) > 10000 {
-		return errs.ErrValidationFailed.WithDetails("多边形顶点数量不能超过10000")
+	batch := make([]repo.BatchPoint, len(points))
+	for i, p := range points {
+		mid, err := parseMapID(p.MapID)
+		if err != nil {
+			return nil, err
+		}
+		if !p.Indoor {
+			if !validLonLat(p.X, p.Y) {
+				return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("第 %d 个点（%s）: 室外点需要 WGS84 坐标（x=经度, y=纬度）: (%f, %f)", i, p.DeviceID, p.X, p.Y))
+			}
+			if mid != nil {
+				return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("第 %d 个点（%s）: 室外点不能指定自制地图", i, p.DeviceID))
+			}
+		}
+		batch[i] = repo.BatchPoint{X: p.X, Y: p.Y, Indoor: p.Indoor, MapID: mid}
 	}
 
-	// 检查是否有重复的连续点
-	for i := 0; i < len(points)-1; i++ {
-		if points[i].X == points[i+1].X && points[i].Y == points[i+1].Y {
-			return errs.ErrValidationFailed.WithDetails(fmt.Sprintf("存在重复的连续顶点: (%f, %f)", points[i].X, points[i].Y))
-		}
+	hits, err := s.polygonFenceRepo.FindFencesByPoints(batch)
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
 	}
 
-	return nil
+	results := make([]model.BatchCheckResult, len(points))
+	for i, p := range points {
+		results[i] = model.BatchCheckResult{DeviceID: p.DeviceID, Fences: []model.BatchFenceHit{}}
+	}
+	for _, h := range hits {
+		r := &results[h.Idx]
+		r.IsInside = true
+		r.Fences = append(r.Fences, model.BatchFenceHit{FenceID: h.FenceID.String(), FenceName: h.FenceName})
+	}
+	return results, nil
 }
 
-// pointsToWKT 将点数组转换为 WKT POLYGON 格式
-func (s *PolygonFenceService) pointsToWKT(points []model.Point) string {
-	coords := make([]string, len(points)+1) // +1 用于闭合多边形
-	for i, p := range points {
-		coords[i] = fmt.Sprintf("%f %f", p.X, p.Y)
+/* ---------- 内部辅助函数 ---------- */
+
+// fenceMapID 解析围栏所属地图，室外围栏不能绑定自制地图
+func fenceMapID(isIndoor bool, mapID string) (*uuid.UUID, error) {
+	mid, err := parseMapID(mapID)
+	if err != nil {
+		return nil, err
+	}
+	if !isIndoor && mid != nil {
+		return nil, errOutdoorMap()
 	}
-	// 闭合多边形（最后一个点等于第一个点）
-	coords[len(points)] = fmt.Sprintf("%f %f", points[0].X, points[0].Y)
+	return mid, nil
+}
 
-	return fmt.Sprintf("POLYGON((%s))", strings.Join(coords, ","))
+func errOutdoorMap() error {
+	return errs.ErrValidationFailed.WithDetails("室外围栏使用 WGS84 经纬度，不能绑定自制地图")
 }
 
-// wktToPoints 将 WKT POLYGON 格式转换为点数组
-func (s *PolygonFenceService) wktToPoints(wkt string) []model.Point {
-	// 示例 WKT: POLYGON((0 0,10 0,10 10,0 10,0 0))
-	re := regexp.MustCompile(`POLYGON\(\((.*?)\)\)`)
-	matches := re.FindStringSubmatch(wkt)
-	if len(matches) < 2 {
-		return []model.Point{}
-	}
-
-	coordsStr := matches[1]
-	coordPairs := strings.Split(coordsStr, ",")
-
-	// 去掉最后一个点（闭合点）
-	points := make([]model.Point, 0, len(coordPairs)-1)
-	for i := 0; i < len(coordPairs)-1; i++ {
-		coords := strings.Fields(strings.TrimSpace(coordPairs[i]))
-		if len(coords) == 2 {
-			var x, y float64
-			fmt.Sscanf(coords[0], "%f", &x)
-			fmt.Sscanf(coords[1], "%f", &y)
-			points = append(points, model.Point{X: x, Y: y})
-		}
-	}
+// sameMap 围栏与点是否在同一地图上：全局围栏或未给出点所在地图时视为同一地图
+func sameMap(fenceMap, pointMap *uuid.UUID) bool {
+	return fenceMap == nil || pointMap == nil || *fenceMap == *pointMap
+}
 
-	return points
+// errOutdoorCoords 室外围栏检查的坐标不是经纬度（常见于经纬度顺序颠倒）
+func errOutdoorCoords(x, y float64) error {
+	return errs.ErrValidationFailed.WithDetails(fmt.Sprintf("室外围栏检查需要 WGS84 坐标（x / lon=经度, y / lat=纬度）: (%f, %f)", x, y))
 }
 
 // fenceToResp 转换为响应格式
 func (s *PolygonFenceService) fenceToResp(fence *model.PolygonFence) *model.PolygonFenceResp {
 	return &model.PolygonFenceResp{
-		ID:          fence.ID.String(),
-		IsIndoor:    fence.IsIndoor,
-		FenceName:   fence.FenceName,
-		Points:      s.wktToPoints(fence.Geometry),
-		Description: fence.Description,
-		IsActive:    fence.IsActive,
-		CreatedAt:   fence.CreatedAt,
-		UpdatedAt:   fence.UpdatedAt,
+		ID:             fence.ID.String(),
+		IsIndoor:       fence.IsIndoor,
+		FenceName:      fence.FenceName,
+		FenceShapeSpec: fenceShapeSpec(fence),
+		SRID:           fence.SRID(),
+		Area:           fence.Area,
+		Perimeter:      fence.Perimeter,
+		MapID:          model.MapIDString(fence.MapID),
+		NodeID:         model.MapIDString(fence.NodeID),
+		Description:    fence.Description,
+		IsActive:       fence.IsActive,
+		CreatedAt:      fence.CreatedAt,
+		UpdatedAt:      fence.UpdatedAt,
 	}
 }
 
 // translateRepoErr 翻译数据库错误
 func (s *PolygonFenceService) translateRepoErr(err error, resource string) error {
+	// 事务内的重叠检查已返回业务错误
+	var appErr *errs.AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return errs.NotFound(resource, fmt.Sprintf("%s 不存在", resource))
 	}
 	if strings.Contains(err.Error(), "duplicate key") {
 		return errs.ErrDuplicateEntry.WithDetails("围栏名称已存在")
 	}
+	if errors.Is(err, repo.ErrForeignTenant) {
+		return errs.ErrForbidden.WithDetails("围栏或其节点 / 地图属于其他租户")
+	}
+	if isNodeFKErr(err) {
+		return errs.ErrValidationFailed.WithDetails("层级节点不存在")
+	}
+	if isMapFKErr(err) {
+		return errs.ErrValidationFailed.WithDetails("地图不存在")
+	}
 	return errs.ErrInternal.WithDetails(err.Error())
 }
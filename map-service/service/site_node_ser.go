@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"IOT-Manage-System/map-service/errs"
+	"IOT-Manage-System/map-service/model"
+	"IOT-Manage-System/map-service/repo"
+)
+
+// parentTypes 各类节点允许的父节点类型，站点没有父节点
+var parentTypes = map[string]string{
+	model.NodeTypeBuilding: model.NodeTypeSite,
+	model.NodeTypeYard:     model.NodeTypeSite,
+	model.NodeTypeFloor:    model.NodeTypeBuilding,
+}
+
+// SiteNodeService 业务编排层
+type SiteNodeService struct {
+	siteNodeRepo *repo.SiteNodeRepo
+}
+
+func NewSiteNodeService(repo *repo.SiteNodeRepo) *SiteNodeService {
+	return &SiteNodeService{siteNodeRepo: repo}
+}
+
+/* ---------- 创建 ---------- */
+
+func (s *SiteNodeService) CreateSiteNode(req *model.SiteNodeCreateReq) (*model.SiteNodeResp, error) {
+	node := &model.SiteNode{
+		NodeType:    req.NodeType,
+		Name:        req.Name,
+		Tenant:      req.Tenant,
+		Description: req.Description,
+	}
+
+	if req.NodeType == model.NodeTypeSite {
+		if req.ParentID != "" {
+			return nil, errs.ErrValidationFailed.WithDetails("站点不能有父节点")
+		}
+	} else {
+		if req.Tenant != "" {
+			return nil, errs.ErrValidationFailed.WithDetails("只有站点可以设置租户，下级节点继承站点的租户")
+		}
+		parent, err := s.getParent(req.NodeType, req.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		node.ParentID = &parent.ID
+		node.Tenant = parent.Tenant
+	}
+
+	if err := s.siteNodeRepo.Create(node); err != nil {
+		return nil, s.translateRepoErr(err, "SiteNode")
+	}
+	return model.SiteNodeToSiteNodeResp(node), nil
+}
+
+/* ---------- 查询 ---------- */
+
+// GetSiteNode 获取单个节点，附带从站点到该节点的路径
+func (s *SiteNodeService) GetSiteNode(id string) (*model.SiteNodeResp, error) {
+	uid, err := parseUUID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := s.siteNodeRepo.GetByID(uid)
+	if err != nil {
+		return nil, s.translateRepoErr(err, "SiteNode")
+	}
+	ancestors, err := s.siteNodeRepo.Ancestors(uid)
+	if err != nil {
+		return nil, s.translateRepoErr(err, "SiteNode")
+	}
+
+	resp := model.SiteNodeToSiteNodeResp(node)
+	resp.Path = make([]model.SiteNodePathItem, 0, len(ancestors))
+	for _, a := range ancestors {
+		resp.Path = append(resp.Path, model.SiteNodePathItem{ID: a.ID.String(), NodeType: a.NodeType, Name: a.Name})
+	}
+	return resp, nil
+}
+
+/* ---------- 层级树 ---------- */
+
+// GetTree 返回层级树；rootID 非空时以该节点为根，tenant 非 nil 时只返回该租户的站点
+func (s *SiteNodeService) GetTree(rootID string, tenant *string) ([]model.SiteNodeTree, error) {
+	root, err := parseNodeID(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.siteNodeRepo.List(root, tenant)
+	if err != nil {
+		return nil, s.translateRepoErr(err, "SiteNode")
+	}
+	maps, stations, fences, err := s.siteNodeRepo.CountByNode()
+	if err != nil {
+		return nil, s.translateRepoErr(err, "SiteNode")
+	}
+
+	children := make(map[uuid.UUID][]model.SiteNode)
+	var roots []model.SiteNode
+	for _, n := range nodes {
+		switch {
+		case root != nil && n.ID == *root, root == nil && n.ParentID == nil:
+			roots = append(roots, n)
+		case n.ParentID != nil:
+			children[*n.ParentID] = append(children[*n.ParentID], n)
+		}
+	}
+
+	var build func(n model.SiteNode) model.SiteNodeTree
+	build = func(n model.SiteNode) model.SiteNodeTree {
+		t := model.SiteNodeTree{
+			ID:           n.ID.String(),
+			NodeType:     n.NodeType,
+			Name:         n.Name,
+			Tenant:       n.Tenant,
+			Description:  n.Description,
+			MapCount:     maps[n.ID],
+			StationCount: stations[n.ID],
+			FenceCount:   fences[n.ID],
+			Children:     make([]model.SiteNodeTree, 0, len(children[n.ID])),
+		}
+		for _, c := range children[n.ID] {
+			t.Children = append(t.Children, build(c))
+		}
+		return t
+	}
+
+	tree := make([]model.SiteNodeTree, 0, len(roots))
+	for _, r := range roots {
+		tree = append(tree, build(r))
+	}
+	return tree, nil
+}
+
+/* ---------- 更新 ---------- */
+
+func (s *SiteNodeService) UpdateSiteNode(id string, req *model.SiteNodeUpdateReq) error {
+	uid, err := parseUUID(id)
+	if err != nil {
+		return err
+	}
+
+	node, err := s.siteNodeRepo.GetByID(uid)
+	if err != nil {
+		return s.translateRepoErr(err, "SiteNode")
+	}
+
+	if req.Name != nil {
+		node.Name = *req.Name
+	}
+	if req.Description != nil {
+		node.Description = *req.Description
+	}
+	if req.Tenant != nil {
+		if node.NodeType != model.NodeTypeSite {
+			return errs.ErrValidationFailed.WithDetails("只有站点可以设置租户，下级节点继承站点的租户")
+		}
+		node.Tenant = *req.Tenant
+	}
+	if req.ParentID != nil {
+		if node.NodeType == model.NodeTypeSite {
+			return errs.ErrValidationFailed.WithDetails("站点不能有父节点")
+		}
+		parent, err := s.getParent(node.NodeType, *req.ParentID)
+		if err != nil {
+			return err
+		}
+		node.ParentID = &parent.ID
+		node.Tenant = parent.Tenant
+	}
+
+	if err := s.siteNodeRepo.UpdateByID(node); err != nil {
+		return s.translateRepoErr(err, "SiteNode")
+	}
+	return nil
+}
+
+/* ---------- 删除 ---------- */
+
+func (s *SiteNodeService) DeleteSiteNode(id string) error {
+	uid, err := parseUUID(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.siteNodeRepo.GetByID(uid); err != nil {
+		return s.translateRepoErr(err, "SiteNode")
+	}
+	// 仍有下级节点或绑定的地图、基站、围栏时拒绝删除
+	if err := s.siteNodeRepo.DeleteByID(uid); err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return errs.ErrResourceConflict.WithDetails("节点下仍有子节点或绑定的地图、基站、围栏，请先删除或解除绑定")
+		}
+		return s.translateRepoErr(err, "SiteNode")
+	}
+	return nil
+}
+
+/* ---------- 内部辅助 ---------- */
+
+// getParent 查询父节点并校验层级：building / yard 挂在站点下，floor 挂在楼栋下
+func (s *SiteNodeService) getParent(nodeType, parentID string) (*model.SiteNode, error) {
+	if parentID == "" {
+		return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("%s 节点必须指定父节点", nodeType))
+	}
+	pid, err := parseNodeID(parentID)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := s.siteNodeRepo.GetByID(*pid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.ErrValidationFailed.WithDetails("父节点不存在")
+		}
+		return nil, s.translateRepoErr(err, "SiteNode")
+	}
+	if want := parentTypes[nodeType]; parent.NodeType != want {
+		return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("%s 节点的父节点必须是 %s，实际为 %s", nodeType, want, parent.NodeType))
+	}
+	return parent, nil
+}
+
+// parseNodeID 解析可选的层级节点 ID，空串返回 nil（不绑定节点）
+func parseNodeID(id string) (*uuid.UUID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errs.ErrInvalidID.WithDetails(fmt.Sprintf("无效的节点ID: %s", id))
+	}
+	return &uid, nil
+}
+
+// parseScope 解析列表查询的过滤条件
+func parseScope(scope model.ListScope) (repo.Scope, error) {
+	mapID, err := parseMapID(scope.MapID)
+	if err != nil {
+		return repo.Scope{}, err
+	}
+	nodeID, err := parseNodeID(scope.NodeID)
+	if err != nil {
+		return repo.Scope{}, err
+	}
+	return repo.Scope{MapID: mapID, NodeID: nodeID, Tenant: scope.Tenant}, nil
+}
+
+// isNodeFKErr 写入的 node_id 在 site_nodes 中不存在
+func isNodeFKErr(err error) bool {
+	return strings.Contains(err.Error(), "foreign key") && strings.Contains(err.Error(), "_node")
+}
+
+// translateRepoErr 把 repo 层常见错误翻译成业务错误
+func (s *SiteNodeService) translateRepoErr(err error, resource string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errs.NotFound(resource, fmt.Sprintf("%s 不存在", resource))
+	}
+	if strings.Contains(err.Error(), "duplicate key") {
+		return errs.ErrDuplicateEntry.WithDetails("同一父节点下（站点为同一租户下）名称已存在")
+	}
+	return errs.ErrInternal.WithDetails(err.Error())
+}
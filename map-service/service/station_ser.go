@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -29,7 +30,18 @@ func (s *StationService) CreateStation(req *model.StationCreateReq) error {
 		return err
 	}
 
+	mapID, err := parseMapID(req.MapID)
+	if err != nil {
+		return err
+	}
+	nodeID, err := parseNodeID(req.NodeID)
+	if err != nil {
+		return err
+	}
+
 	station := model.StationCreateReqToStation(req)
+	station.MapID = mapID
+	station.NodeID = nodeID
 	if err := s.stationRepo.Create(station); err != nil {
 		return s.translateRepoErr(err, "Station")
 	}
@@ -53,8 +65,13 @@ func (s *StationService) GetStation(id string) (*model.StationResp, error) {
 
 /* ---------- 全量 ---------- */
 
-func (s *StationService) GetALLStation() ([]model.StationResp, error) {
-	list, err := s.stationRepo.ListAll()
+func (s *StationService) GetALLStation(scope model.ListScope) ([]model.StationResp, error) {
+	sc, err := parseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.stationRepo.ListAll(sc)
 	if err != nil {
 		return nil, s.translateRepoErr(err, "Station")
 	}
@@ -114,6 +131,20 @@ func (s *StationService) UpdateStation(id string, req *model.StationUpdateReq) e
 	if req.CoordinateY != nil {
 		updates["location_y"] = coordinateY
 	}
+	if req.MapID != nil {
+		mapID, err := parseMapID(*req.MapID)
+		if err != nil {
+			return err
+		}
+		updates["map_id"] = mapID
+	}
+	if req.NodeID != nil {
+		nodeID, err := parseNodeID(*req.NodeID)
+		if err != nil {
+			return err
+		}
+		updates["node_id"] = nodeID
+	}
 
 	if err := s.stationRepo.UpdateByIDWithMap(uid, updates); err != nil {
 		return s.translateRepoErr(err, "Station")
@@ -137,6 +168,23 @@ func (s *StationService) DeleteStation(id string) error {
 
 /* ---------- 内部辅助 ---------- */
 
+// parseMapID 解析可选的自制地图 ID，空串返回 nil（不绑定地图）
+func parseMapID(id string) (*uuid.UUID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errs.ErrInvalidID.WithDetails(fmt.Sprintf("无效的地图ID: %s", id))
+	}
+	return &uid, nil
+}
+
+// isMapFKErr 写入的 map_id 在 custom_maps 中不存在
+func isMapFKErr(err error) bool {
+	return strings.Contains(err.Error(), "foreign key") && strings.Contains(err.Error(), "map")
+}
+
 // parseUUID 统一解析并返回业务侧已定义的错误
 func parseUUID(id string) (uuid.UUID, error) {
 	uid, err := uuid.Parse(id)
@@ -151,6 +199,12 @@ func (s *StationService) translateRepoErr(err error, resource string) error {
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return errs.NotFound(resource, fmt.Sprintf("%s 不存在", resource))
 	}
+	if isNodeFKErr(err) {
+		return errs.ErrValidationFailed.WithDetails("层级节点不存在")
+	}
+	if isMapFKErr(err) {
+		return errs.ErrValidationFailed.WithDetails("地图不存在")
+	}
 	// 这里可以扩展更多 gorm/mysql 唯一键冲突、连接超时等判断
 	return errs.ErrInternal.WithDetails(err.Error())
 }
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"IOT-Manage-System/mark-service/errs"
+	"IOT-Manage-System/mark-service/service"
+	"IOT-Manage-System/mark-service/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CredentialHandler struct {
+	credentialService service.CredentialService
+}
+
+func NewCredentialHandler(credentialService service.CredentialService) *CredentialHandler {
+	return &CredentialHandler{credentialService: credentialService}
+}
+
+// requireAdmin 凭据涉及 broker 口令，仅 admin / root 可访问（X-UserType 由网关注入）
+func requireAdmin(c *fiber.Ctx) error {
+	switch c.Get("X-UserType") {
+	case "admin", "root":
+		return nil
+	case "":
+		return errs.ErrUnauthorized
+	default:
+		return errs.ErrForbidden
+	}
+}
+
+// GetCredential 查看标记的 MQTT 凭据（不含密码）
+func (h *CredentialHandler) GetCredential(c *fiber.Ctx) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+	cred, err := h.credentialService.Get(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, cred)
+}
+
+// RotateCredential 轮换密码（未签发时首次签发），新密码只返回这一次
+func (h *CredentialHandler) RotateCredential(c *fiber.Ctx) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+	cred, err := h.credentialService.Rotate(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, cred, "凭据已轮换，请重新导出 broker 配置")
+}
+
+// RevokeCredential 吊销凭据
+func (h *CredentialHandler) RevokeCredential(c *fiber.Ctx) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+	cred, err := h.credentialService.Revoke(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, cred, "凭据已吊销，请重新导出 broker 配置")
+}
+
+// ExportPasswd 导出 Mosquitto password_file
+func (h *CredentialHandler) ExportPasswd(c *fiber.Ctx) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+	out, err := h.credentialService.ExportPasswd()
+	if err != nil {
+		return err
+	}
+	c.Attachment("mosquitto.passwd")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(out)
+}
+
+// ExportACL 导出 Mosquitto acl_file
+func (h *CredentialHandler) ExportACL(c *fiber.Ctx) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+	out, err := h.credentialService.ExportACL()
+	if err != nil {
+		return err
+	}
+	c.Attachment("mosquitto.acl")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(out)
+}
+
+// ExportDynsec 导出 dynamic-security 插件配置（dynamic-security.json，非统一响应格式）
+func (h *CredentialHandler) ExportDynsec(c *fiber.Ctx) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+	cfg, err := h.credentialService.ExportDynsec()
+	if err != nil {
+		return err
+	}
+	c.Attachment("dynamic-security.json")
+	return c.JSON(cfg)
+}
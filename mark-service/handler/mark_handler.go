@@ -9,15 +9,17 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"log"
 	"time"
 )
 
 type MarkHandler struct {
-	markService service.MarkService
+	markService       service.MarkService
+	credentialService service.CredentialService
 }
 
-func NewMarkHandler(markService service.MarkService) *MarkHandler {
-	return &MarkHandler{markService: markService}
+func NewMarkHandler(markService service.MarkService, credentialService service.CredentialService) *MarkHandler {
+	return &MarkHandler{markService: markService, credentialService: credentialService}
 }
 
 // CreateMark 创建新标签
@@ -33,7 +35,13 @@ func (h *MarkHandler) CreateMark(c *fiber.Ctx) error {
 		return appErr
 	}
 
-	return utils.SendCreatedResponse(c, nil, "标记创建成功")
+	// 签发设备 MQTT 凭据；失败不回滚标记，可稍后调用 rotate 补签
+	cred, err := h.credentialService.Provision(req.DeviceID)
+	if err != nil {
+		log.Printf("[WARN] 设备凭据签发失败  deviceID=%s  err=%v", req.DeviceID, err)
+		return utils.SendCreatedResponse(c, nil, "标记创建成功，设备凭据签发失败，请调用 credential/rotate 重新签发")
+	}
+	return utils.SendCreatedResponse(c, fiber.Map{"mqtt_credential": cred}, "标记创建成功")
 }
 
 // GetMarkByID 根据 ID 获取标签
@@ -112,17 +120,58 @@ func (h *MarkHandler) DeleteMark(c *fiber.Ctx) error {
 }
 
 // UpdateMarkLastOnline 更新标记的最后在线时间
+// body 可选：{"online": false, "at": "..."} 用于上报离线；为空时视为此刻在线
 func (h *MarkHandler) UpdateMarkLastOnline(c *fiber.Ctx) error {
 	deviceID := c.Params("device_id")
 	if deviceID == "" {
 		return errs.ErrInvalidInput.WithDetails("device_id 不能为空")
 	}
-	if err := h.markService.UpdateMarkLastOnline(deviceID, time.Now()); err != nil {
+
+	var req model.MarkPresenceRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return errs.ErrInvalidInput.WithDetails(err.Error())
+		}
+	}
+	at := time.Now()
+	if req.At != nil {
+		at = *req.At
+	}
+	online := req.Online == nil || *req.Online
+
+	if err := h.markService.UpdateMarkPresence(deviceID, online, at); err != nil {
 		return err
 	}
 	return utils.SendSuccessResponse(c, nil, "标记最后在线时间更新成功")
 }
 
+// ListOnlineMarks 在线标记列表（分页）
+// GET /api/v1/marks/online?page=1&limit=10&stale_second=120&preload=false
+func (h *MarkHandler) ListOnlineMarks(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100 // 限制最大值
+	}
+	staleSecond := c.QueryInt("stale_second", utils.GetEnvInt("ONLINE_STALE_SECOND", 120))
+	if staleSecond <= 0 {
+		return errs.ErrInvalidInput.WithDetails("stale_second 必须大于 0")
+	}
+	preload := c.Query("preload", "false") == "true"
+
+	marks, total, appErr := h.markService.ListOnlineMarks(staleSecond, page, limit, preload)
+	if appErr != nil {
+		return appErr
+	}
+	return utils.SendPaginatedResponse(c, marks, total, page, limit)
+}
+
 // GetPersistMQTTByDeviceID 根据 DeviceID 查询 PersistMQTT 值
 func (h *MarkHandler) GetPersistMQTTByDeviceID(c *fiber.Ctx) error {
 	deviceID := c.Params("device_id")
@@ -40,10 +40,13 @@ func main() {
 
 	r1 := repo.NewMarkRepo(db)
 	r2 := repo.NewMarkPairRepo(db)
+	r3 := repo.NewCredentialRepo(db)
 	s1 := service.NewMarkService(r1)
 	s2 := service.NewMarkPairService(r2, r1)
-	h1 := handler.NewMarkHandler(s1)
+	s3 := service.NewCredentialService(r3, r1)
+	h1 := handler.NewMarkHandler(s1, s3)
 	h2 := handler.NewMarkPairHandler(s2)
+	h3 := handler.NewCredentialHandler(s3)
 
 	// 定义路由和处理函数
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -58,6 +61,7 @@ func main() {
 	// 静态路径优先（最具体的路径）
 	mark.Get("/id-to-name", h1.GetAllMarkIDToName)                                 // 获取全部 markID→markName 映射
 	mark.Get("/device/id-to-name", h1.GetAllDeviceIDToName)                        // 获取全部 deviceID→markName 映射
+	mark.Get("/online", h1.ListOnlineMarks)                                        // GET /api/marks/online?page=1&limit=10&stale_second=120
 	mark.Get("/persist/list", h1.GetMarksByPersistMQTT)                            // GET /api/marks/persist/list?persist=true&page=1&limit=10
 	mark.Get("/persist/device-ids", h1.GetDeviceIDsByPersistMQTT)                  // GET /api/marks/persist/device-ids?persist=true
 	mark.Get("/persist/device/:device_id", h1.GetPersistMQTTByDeviceID)            // GET /api/marks/persist/device/:device_id
@@ -65,6 +69,9 @@ func main() {
 	mark.Get("/device/:device_id/safe-distance", h1.GetMarkSafeDistanceByDeviceID) // 根据设备ID获取危险半径
 	mark.Get("/device/:device_id", h1.GetMarkByDeviceID)                           // 根据设备 ID 获取标记
 	mark.Get("/:id/safe-distance", h1.GetMarkSafeDistance)                         // 根据标记ID获取危险半径
+	mark.Get("/:id/credential", h3.GetCredential)                                  // 查看设备 MQTT 凭据（admin/root）
+	mark.Post("/:id/credential/rotate", h3.RotateCredential)                       // 轮换 / 补签设备 MQTT 凭据（admin/root）
+	mark.Post("/:id/credential/revoke", h3.RevokeCredential)                       // 吊销设备 MQTT 凭据（admin/root）
 	mark.Put("/:id", h1.UpdateMark)                                                // 更新标记
 	mark.Delete("/:id", h1.DeleteMark)                                             // 删除标记
 	mark.Get("/:id", h1.GetMarkByID)                                               // 根据 ID 获取标记
@@ -115,6 +122,12 @@ func main() {
 	// 根路径最后
 	markPair.Get("/", h2.ListMarkPairs) // 分页获取标记对列表
 
+	// ---------------- credential 相关路由 ----------------
+	credential := v1.Group("/credentials")
+	credential.Get("/export/passwd", h3.ExportPasswd) // 导出 Mosquitto password_file（admin/root）
+	credential.Get("/export/acl", h3.ExportACL)       // 导出 Mosquitto acl_file（admin/root）
+	credential.Get("/export/dynsec", h3.ExportDynsec) // 导出 dynamic-security.json（admin/root）
+
 	// 启动服务器
 	port := utils.GetEnv("PORT", "8004")
 	if err := app.Listen(":" + port); err != nil {
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,9 +11,13 @@ import (
 
 // MarkType 标记类型表：同一类型下可拥有多条 Mark 记录。
 type MarkType struct {
-	ID                   int      `gorm:"primaryKey;autoIncrement;column:id"`        // ID：主键，自增
-	TypeName             string   `gorm:"unique;size:255;not null;column:type_name"` // TypeName：类型名称，全局唯一
-	DefaultSafeDistanceM *float64 `gorm:"column:default_safe_distance_m;default:-1"` // DefaultSafeDistanceM：该类型下默认安全距离（米），-1 表示未设置
+	ID                   int             `gorm:"primaryKey;autoIncrement;column:id"`                       // ID：主键，自增
+	TypeName             string          `gorm:"unique;size:255;not null;column:type_name"`                // TypeName：类型名称，全局唯一
+	DefaultSafeDistanceM *float64        `gorm:"column:default_safe_distance_m;default:-1"`                // DefaultSafeDistanceM：该类型下默认安全距离（米），-1 表示未设置
+	PayloadDecoder       string          `gorm:"size:64;not null;default:'legacy';column:payload_decoder"` // PayloadDecoder：该类型设备上报载荷使用的解码器
+	DecoderConfig        json.RawMessage `gorm:"type:jsonb;column:decoder_config"`                         // DecoderConfig：解码器参数（JSON），由对应解码器解释，nil 表示无参数
+	SilenceAlarmSecond   *int            `gorm:"column:silence_alarm_second"`                              // SilenceAlarmSecond：在线设备静默多少秒触发报警，nil 或 <=0 表示不报警
+	SilenceAlarmInFenceS *int            `gorm:"column:silence_alarm_in_fence_second"`                     // SilenceAlarmInFenceS：设备处于围栏内时的静默报警阈值（秒），nil 时沿用 SilenceAlarmSecond
 
 	// 一对多关联：删除类型时被关联的 Mark 受外键 RESTRICT 保护。
 	Marks []Mark `gorm:"foreignKey:MarkTypeID;references:ID"`
@@ -44,6 +49,8 @@ type Mark struct {
 	CreatedAt     time.Time      `gorm:"not null;default:now();column:created_at"`                 // CreatedAt：记录创建时间
 	UpdatedAt     time.Time      `gorm:"not null;default:now();column:updated_at"`                 // UpdatedAt：记录最后更新时间
 	LastOnlineAt  *time.Time     `gorm:"column:last_online_at"`                                    // LastOnlineAt：设备最后一次上线时间，nil 表示从未上线
+	IsOnline      bool           `gorm:"not null;default:false;column:is_online"`                  // IsOnline：warning-service 推送的在线状态
+	MapID         *uuid.UUID     `gorm:"type:uuid;column:map_id"`                                  // MapID：设备被分配的自制地图（楼层），nil 表示未分配
 
 	// 外键实体：查询时自动填充。
 	MarkType MarkType `gorm:"foreignKey:MarkTypeID;references:ID;constraint:OnDelete:RESTRICT"`
@@ -71,3 +78,27 @@ func (m *MarkPairSafeDistance) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// 设备凭据状态
+const (
+	CredentialActive  = "active"
+	CredentialRevoked = "revoked"
+)
+
+// DeviceCredential 设备 MQTT 凭据：每条 Mark 一套独立账号，Mark 删除时级联删除。
+// 明文密码只在签发 / 轮换时返回一次，库中仅保存 Mosquitto 口令哈希。
+type DeviceCredential struct {
+	MarkID       uuid.UUID  `gorm:"primaryKey;type:uuid;column:mark_id"`             // MarkID：主键，关联 marks.id
+	DeviceID     string     `gorm:"size:255;not null;column:device_id"`              // DeviceID：冗余设备标识，用于拼接 ACL 主题
+	Username     string     `gorm:"unique;size:255;not null;column:username"`        // Username：broker 登录名
+	PasswordHash string     `gorm:"size:255;not null;column:password_hash"`          // PasswordHash：$7$ 格式 PBKDF2-SHA512 哈希
+	Status       string     `gorm:"size:32;not null;default:'active';column:status"` // Status：active / revoked
+	CreatedAt    time.Time  `gorm:"not null;default:now();column:created_at"`        // CreatedAt：首次签发时间
+	RotatedAt    *time.Time `gorm:"column:rotated_at"`                               // RotatedAt：最后一次轮换时间
+	RevokedAt    *time.Time `gorm:"column:revoked_at"`                               // RevokedAt：吊销时间，nil 表示未吊销
+
+	// 所属标记：导出 ACL 时预加载，读取自定义上报主题。
+	Mark *Mark `gorm:"foreignKey:MarkID;references:ID"`
+}
+
+func (DeviceCredential) TableName() string { return "device_credentials" }
@@ -1,14 +1,27 @@
 package model
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // MarkTypeCreateRequest 用于创建或更新标记类型
 type MarkTypeCreateRequest struct {
-	TypeName             string   `json:"type_name" validate:"required,max=255"`
-	DefaultSafeDistanceM *float64 `json:"default_danger_zone_m"`
+	TypeName             string          `json:"type_name" validate:"required,max=255"`
+	DefaultSafeDistanceM *float64        `json:"default_danger_zone_m"`
+	PayloadDecoder       string          `json:"payload_decoder,omitempty"` // 为空时使用 legacy
+	DecoderConfig        json.RawMessage `json:"decoder_config,omitempty"`
+	SilenceAlarmSecond   *int            `json:"silence_alarm_second"`
+	SilenceAlarmInFenceS *int            `json:"silence_alarm_in_fence_second"`
 }
 
 type MarkTypeUpdateRequest struct {
-	TypeName             *string  `json:"type_name" validate:"omitempty,max=255"`
-	DefaultSafeDistanceM *float64 `json:"default_danger_zone_m"`
+	TypeName             *string         `json:"type_name" validate:"omitempty,max=255"`
+	DefaultSafeDistanceM *float64        `json:"default_danger_zone_m"`
+	PayloadDecoder       *string         `json:"payload_decoder"`
+	DecoderConfig        json.RawMessage `json:"decoder_config,omitempty"`
+	SilenceAlarmSecond   *int            `json:"silence_alarm_second"`          // <=0 关闭静默报警
+	SilenceAlarmInFenceS *int            `json:"silence_alarm_in_fence_second"` // <=0 恢复为沿用 silence_alarm_second
 }
 
 // MarkTagRequest 用于创建或更新标记标签
@@ -24,6 +37,7 @@ type MarkRequest struct {
 	PersistMQTT   *bool    `json:"persist_mqtt,omitempty"`
 	SafeDistanceM *float64 `json:"danger_zone_m,omitempty"`
 	MarkTypeID    *int     `json:"mark_type_id,omitempty"`
+	MapID         string   `json:"map_id,omitempty" validate:"omitempty,uuid"` // 分配的自制地图（楼层）
 	Tags          []string `json:"tags,omitempty"`
 }
 
@@ -35,6 +49,7 @@ type MarkUpdateRequest struct {
 	PersistMQTT   *bool    `json:"persist_mqtt,omitempty"`
 	SafeDistanceM *float64 `json:"danger_zone_m,omitempty"`
 	MarkTypeID    *int     `json:"mark_type_id,omitempty"`
+	MapID         *string  `json:"map_id,omitempty"` // 分配的自制地图，空字符串表示取消分配
 	Tags          []string `json:"tags,omitempty"`
 }
 
@@ -59,3 +74,9 @@ type SetDistanceMarkReq struct {
 	Mark2ID  string  `json:"mark2_id" validate:"required,uuid"`
 	Distance float64 `json:"distance" validate:"required,min=0"`
 }
+
+// MarkPresenceRequest 设备上下线状态上报，body 为空时视为此刻在线
+type MarkPresenceRequest struct {
+	Online *bool      `json:"online"`
+	At     *time.Time `json:"at"` // 最后活跃时间，缺省为服务端当前时间
+}
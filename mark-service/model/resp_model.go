@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -8,9 +9,13 @@ import (
 // MarkType
 // ==========================
 type MarkTypeResponse struct {
-	ID                 int      `json:"id"`
-	TypeName           string   `json:"type_name"`
-	DefaultDangerZoneM *float64 `json:"default_danger_zone_m,omitempty"`
+	ID                 int             `json:"id"`
+	TypeName           string          `json:"type_name"`
+	DefaultDangerZoneM *float64        `json:"default_danger_zone_m,omitempty"`
+	PayloadDecoder     string          `json:"payload_decoder,omitempty"`
+	DecoderConfig      json.RawMessage `json:"decoder_config,omitempty"`
+	SilenceAlarmS      *int            `json:"silence_alarm_second,omitempty"`
+	SilenceAlarmFenceS *int            `json:"silence_alarm_in_fence_second,omitempty"`
 }
 
 // ==========================
@@ -34,6 +39,8 @@ type MarkResponse struct {
 	CreatedAt    time.Time         `json:"created_at"`
 	UpdatedAt    time.Time         `json:"updated_at"`
 	LastOnlineAt *time.Time        `json:"last_online_at"`
+	IsOnline     bool              `json:"is_online"`
+	MapID        *string           `json:"map_id"` // 分配的自制地图，null 表示未分配
 }
 
 // ==========================
@@ -44,3 +51,60 @@ type MarkPairResponse struct {
 	Mark2ID   string  `json:"mark2_id"`
 	DistanceM float64 `json:"distance_m"`
 }
+
+// ==========================
+// DeviceCredential
+// ==========================
+type CredentialResponse struct {
+	MarkID    string        `json:"mark_id"`
+	DeviceID  string        `json:"device_id"`
+	Username  string        `json:"username"`
+	Password  string        `json:"password,omitempty"` // 仅签发 / 轮换时返回一次
+	Status    string        `json:"status"`
+	CreatedAt time.Time     `json:"created_at"`
+	RotatedAt *time.Time    `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time    `json:"revoked_at,omitempty"`
+	ACL       CredentialACL `json:"acl"`
+}
+
+// CredentialACL 设备允许发布 / 订阅的主题
+type CredentialACL struct {
+	Publish   []string `json:"publish"`
+	Subscribe []string `json:"subscribe"`
+}
+
+// ==========================
+// Mosquitto dynamic-security 配置（dynamic-security.json）
+// ==========================
+type DynsecConfig struct {
+	DefaultACLAccess map[string]bool `json:"defaultACLAccess"`
+	Clients          []DynsecClient  `json:"clients"`
+	Groups           []any           `json:"groups"`
+	Roles            []DynsecRole    `json:"roles"`
+}
+
+type DynsecClient struct {
+	Username   string          `json:"username"`
+	TextName   string          `json:"textname,omitempty"`
+	Password   string          `json:"password"` // base64(PBKDF2-SHA512)
+	Salt       string          `json:"salt"`     // base64
+	Iterations int             `json:"iterations"`
+	Disabled   bool            `json:"disabled,omitempty"`
+	Roles      []DynsecRoleRef `json:"roles"`
+}
+
+type DynsecRoleRef struct {
+	RoleName string `json:"rolename"`
+}
+
+type DynsecRole struct {
+	RoleName string      `json:"rolename"`
+	ACLs     []DynsecACL `json:"acls"`
+}
+
+type DynsecACL struct {
+	ACLType  string `json:"acltype"` // publishClientSend / publishClientReceive / subscribeLiteral / subscribePattern
+	Topic    string `json:"topic"`
+	Priority int    `json:"priority"`
+	Allow    bool   `json:"allow"`
+}
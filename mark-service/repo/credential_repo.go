@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"IOT-Manage-System/mark-service/model"
+)
+
+// CredentialRepo 设备 MQTT 凭据仓库接口
+type CredentialRepo interface {
+	// Get 根据标记 ID 查询凭据，不存在返回 nil
+	Get(markID string) (*model.DeviceCredential, error)
+	// Save 插入或整体更新一条凭据（按 mark_id）
+	Save(cred *model.DeviceCredential) error
+	// ListWithMark 全部凭据，预加载所属标记（导出用）
+	ListWithMark() ([]model.DeviceCredential, error)
+}
+
+type credentialRepo struct {
+	db *gorm.DB
+}
+
+func NewCredentialRepo(db *gorm.DB) CredentialRepo {
+	return &credentialRepo{db: db}
+}
+
+func (r *credentialRepo) Get(markID string) (*model.DeviceCredential, error) {
+	var cred model.DeviceCredential
+	err := r.db.First(&cred, "mark_id = ?", markID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &cred, err
+}
+
+func (r *credentialRepo) Save(cred *model.DeviceCredential) error {
+	return r.db.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "mark_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"device_id", "username", "password_hash", "status", "rotated_at", "revoked_at"}),
+	}).Create(cred).Error
+}
+
+func (r *credentialRepo) ListWithMark() ([]model.DeviceCredential, error) {
+	var creds []model.DeviceCredential
+	err := r.db.Preload("Mark").Order("username").Find(&creds).Error
+	return creds, err
+}
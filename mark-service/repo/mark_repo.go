@@ -101,6 +101,7 @@ func (r *markRepo) UpdateMark(mark *model.Mark, tagNames []string) error {
 			"persist_mqtt":    mark.PersistMQTT,
 			"safe_distance_m": mark.SafeDistanceM,
 			"mark_type_id":    mark.MarkTypeID,
+			"map_id":          mark.MapID,
 		}).Error; err != nil {
 		return err
 	}
@@ -133,6 +134,31 @@ func (r *markRepo) UpdateMarkLastOnline(deviceID string, t time.Time) error {
 		Update("last_online_at", t).Error
 }
 
+// UpdateMarkPresence 同时更新在线状态与最后在线时间
+func (r *markRepo) UpdateMarkPresence(deviceID string, online bool, t time.Time) error {
+	return r.db.Model(&model.Mark{}).
+		Where("device_id = ?", deviceID).
+		Updates(map[string]any{"is_online": online, "last_online_at": t}).Error
+}
+
+// ListOnlineMarks 在线标记列表，按最后在线时间倒序
+func (r *markRepo) ListOnlineMarks(since time.Time, offset, limit int, preload bool) ([]model.Mark, int64, error) {
+	q := r.db.Model(&model.Mark{}).
+		Where("is_online = ? AND last_online_at >= ?", true, since)
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if preload {
+		q = q.Preload("MarkType").Preload("Tags")
+	}
+	var marks []model.Mark
+	err := q.Offset(offset).Limit(limit).Order("last_online_at DESC").Find(&marks).Error
+	return marks, total, err
+}
+
 // ---------- 内部辅助 ----------
 // getOrCreateTags 内部复用，批量获取或创建标签
 func (r *markRepo) getOrCreateTags(names []string) ([]model.MarkTag, error) {
@@ -22,6 +22,9 @@ type MarkRepo interface {
 	UpdateMark(mark *model.Mark, tagNames []string) error
 	DeleteMark(id string) error
 	UpdateMarkLastOnline(deviceID string, t time.Time) error
+	UpdateMarkPresence(deviceID string, online bool, t time.Time) error
+	// ListOnlineMarks 在线标记列表：is_online 且 last_online_at 不早于 since
+	ListOnlineMarks(since time.Time, offset, limit int, preload bool) ([]model.Mark, int64, error)
 	GetMarksByPersistMQTT(persist bool, preload bool, offset, limit int) ([]model.Mark, int64, error)
 	GetPersistMQTTByDeviceID(deviceID string) (bool, error)
 	GetDeviceIDsByPersistMQTT(persist bool) ([]string, error)
@@ -0,0 +1,441 @@
+// service/credential_service.go
+package service
+
+import (
+	"bufio"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"IOT-Manage-System/mark-service/errs"
+	"IOT-Manage-System/mark-service/model"
+	"IOT-Manage-System/mark-service/repo"
+	"IOT-Manage-System/mark-service/utils"
+)
+
+// Mosquitto $7$ 口令参数（与 mosquitto_passwd / dynamic-security 默认值一致）
+const (
+	credentialUserPrefix = "dev-"
+	credentialIterations = 101
+	credentialSaltLen    = 12
+	credentialHashLen    = 64
+	credentialPassLen    = 24 // 随机字节数，base64url 后 32 个字符
+	serviceRoleName      = "service"
+	deviceRolePrefix     = "device-"
+)
+
+type CredentialService interface {
+	// Provision 为新建标记签发凭据，已存在时返回错误
+	Provision(deviceID string) (*model.CredentialResponse, error)
+	Get(markID string) (*model.CredentialResponse, error)
+	// Rotate 重新生成密码；没有凭据时即首次签发，已吊销的凭据会被重新启用
+	Rotate(markID string) (*model.CredentialResponse, error)
+	Revoke(markID string) (*model.CredentialResponse, error)
+	ExportPasswd() (string, error)
+	ExportACL() (string, error)
+	ExportDynsec() (*model.DynsecConfig, error)
+}
+
+// credentialService 设备 MQTT 凭据：
+//   - 每个标记一个 broker 账号（dev-<device_id>），只允许读写本设备的主题
+//   - 服务账号（MQTT_SERVICE_USERS，默认 admin）读写全部主题，其口令来自 MOSQUITTO_BASE_PASSWD
+//   - 导出为 Mosquitto password_file / acl_file 或 dynamic-security.json
+type credentialService struct {
+	repo     repo.CredentialRepo
+	markRepo repo.MarkRepo
+
+	basePasswd   string
+	serviceUsers []string
+}
+
+func NewCredentialService(r repo.CredentialRepo, markRepo repo.MarkRepo) CredentialService {
+	var users []string
+	for _, u := range strings.Split(utils.GetEnv("MQTT_SERVICE_USERS", "admin"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			users = append(users, u)
+		}
+	}
+	return &credentialService{
+		repo:         r,
+		markRepo:     markRepo,
+		basePasswd:   utils.GetEnv("MOSQUITTO_BASE_PASSWD", ""),
+		serviceUsers: users,
+	}
+}
+
+func (s *credentialService) Provision(deviceID string) (*model.CredentialResponse, error) {
+	mark, err := s.markRepo.GetMarkByDeviceID(deviceID, false)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if mark == nil {
+		return nil, errs.NotFound("Mark", "标记未找到")
+	}
+	cred, err := s.repo.Get(mark.ID.String())
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if cred != nil {
+		return nil, errs.AlreadyExists("Credential", "设备凭据已存在")
+	}
+	return s.issue(mark, nil)
+}
+
+func (s *credentialService) Get(markID string) (*model.CredentialResponse, error) {
+	mark, cred, err := s.load(markID)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		return nil, errs.NotFound("Credential", "设备凭据未签发")
+	}
+	return credentialResponse(cred, mark, ""), nil
+}
+
+func (s *credentialService) Rotate(markID string) (*model.CredentialResponse, error) {
+	mark, cred, err := s.load(markID)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(mark, cred)
+}
+
+func (s *credentialService) Revoke(markID string) (*model.CredentialResponse, error) {
+	mark, cred, err := s.load(markID)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		return nil, errs.NotFound("Credential", "设备凭据未签发")
+	}
+	if cred.Status != model.CredentialRevoked {
+		now := time.Now()
+		cred.Status = model.CredentialRevoked
+		cred.RevokedAt = &now
+		if err := s.repo.Save(cred); err != nil {
+			return nil, errs.ErrDatabase.WithDetails(err.Error())
+		}
+	}
+	return credentialResponse(cred, mark, ""), nil
+}
+
+// issue 生成新密码并保存；cred 为 nil 时首次签发
+func (s *credentialService) issue(mark *model.Mark, cred *model.DeviceCredential) (*model.CredentialResponse, error) {
+	password, err := randomPassword()
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, errs.ErrInternal.WithDetails(err.Error())
+	}
+
+	now := time.Now()
+	if cred == nil {
+		cred = &model.DeviceCredential{
+			MarkID:    mark.ID,
+			Username:  credentialUserPrefix + mark.DeviceID,
+			CreatedAt: now,
+		}
+	} else {
+		cred.RotatedAt = &now
+	}
+	cred.DeviceID = mark.DeviceID
+	cred.PasswordHash = hash
+	cred.Status = model.CredentialActive
+	cred.RevokedAt = nil
+	if err := s.repo.Save(cred); err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return credentialResponse(cred, mark, password), nil
+}
+
+func (s *credentialService) load(markID string) (*model.Mark, *model.DeviceCredential, error) {
+	mark, err := s.markRepo.GetMarkByID(markID, false)
+	if err != nil {
+		return nil, nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if mark == nil {
+		return nil, nil, errs.NotFound("Mark", "标记未找到")
+	}
+	cred, err := s.repo.Get(markID)
+	if err != nil {
+		return nil, nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return mark, cred, nil
+}
+
+// ExportPasswd Mosquitto password_file：基础口令文件（服务账号）+ 未吊销的设备账号
+func (s *credentialService) ExportPasswd() (string, error) {
+	creds, err := s.repo.ListWithMark()
+	if err != nil {
+		return "", errs.ErrDatabase.WithDetails(err.Error())
+	}
+	base, err := s.readBasePasswd(creds)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, l := range base {
+		b.WriteString(l.user + ":" + l.hash + "\n")
+	}
+	for _, c := range creds {
+		if c.Status == model.CredentialActive {
+			b.WriteString(c.Username + ":" + c.PasswordHash + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// ExportACL Mosquitto acl_file：服务账号读写全部主题，设备账号只能访问本设备主题
+func (s *credentialService) ExportACL() (string, error) {
+	creds, err := s.repo.ListWithMark()
+	if err != nil {
+		return "", errs.ErrDatabase.WithDetails(err.Error())
+	}
+
+	var b strings.Builder
+	b.WriteString("# 由 mark-service 生成，请勿手工修改\n\n")
+	for _, u := range s.serviceUsers {
+		b.WriteString("user " + u + "\ntopic readwrite #\n\n")
+	}
+	for _, c := range creds {
+		if c.Status != model.CredentialActive {
+			continue
+		}
+		acl := deviceACL(deviceIDOf(&c), c.Mark)
+		b.WriteString("user " + c.Username + "\n")
+		for _, t := range acl.Publish {
+			b.WriteString("topic write " + t + "\n")
+		}
+		for _, t := range acl.Subscribe {
+			b.WriteString("topic read " + t + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// ExportDynsec dynamic-security 插件配置；吊销的设备保留为 disabled，便于审计
+func (s *credentialService) ExportDynsec() (*model.DynsecConfig, error) {
+	creds, err := s.repo.ListWithMark()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	base, err := s.readBasePasswd(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &model.DynsecConfig{
+		DefaultACLAccess: map[string]bool{
+			"publishClientSend":    false,
+			"publishClientReceive": true,
+			"subscribe":            false,
+			"unsubscribe":          true,
+		},
+		Clients: []model.DynsecClient{},
+		Groups:  []any{},
+		Roles: []model.DynsecRole{{
+			RoleName: serviceRoleName,
+			ACLs: []model.DynsecACL{
+				{ACLType: "publishClientSend", Topic: "#", Allow: true},
+				{ACLType: "publishClientReceive", Topic: "#", Allow: true},
+				{ACLType: "subscribePattern", Topic: "#", Allow: true},
+			},
+		}},
+	}
+
+	isService := make(map[string]bool, len(s.serviceUsers))
+	for _, u := range s.serviceUsers {
+		isService[u] = true
+	}
+	for _, l := range base {
+		client, err := dynsecClient(l.user, l.hash)
+		if err != nil {
+			return nil, errs.ErrConfig.WithDetails(fmt.Sprintf("基础口令文件中 %s 的哈希无法转换: %v", l.user, err))
+		}
+		if isService[l.user] {
+			client.Roles = []model.DynsecRoleRef{{RoleName: serviceRoleName}}
+		}
+		cfg.Clients = append(cfg.Clients, *client)
+	}
+
+	for _, c := range creds {
+		client, err := dynsecClient(c.Username, c.PasswordHash)
+		if err != nil {
+			return nil, errs.ErrInternal.WithDetails(fmt.Sprintf("%s 的哈希无法转换: %v", c.Username, err))
+		}
+		role := deviceRolePrefix + deviceIDOf(&c)
+		client.TextName = c.DeviceID
+		client.Disabled = c.Status != model.CredentialActive
+		client.Roles = []model.DynsecRoleRef{{RoleName: role}}
+		cfg.Clients = append(cfg.Clients, *client)
+
+		acl := deviceACL(deviceIDOf(&c), c.Mark)
+		r := model.DynsecRole{RoleName: role}
+		for _, t := range acl.Publish {
+			r.ACLs = append(r.ACLs, model.DynsecACL{ACLType: "publishClientSend", Topic: t, Allow: true})
+		}
+		for _, t := range acl.Subscribe {
+			r.ACLs = append(r.ACLs,
+				model.DynsecACL{ACLType: "subscribeLiteral", Topic: t, Allow: true},
+				model.DynsecACL{ACLType: "publishClientReceive", Topic: t, Allow: true},
+			)
+		}
+		cfg.Roles = append(cfg.Roles, r)
+	}
+	return cfg, nil
+}
+
+type passwdLine struct {
+	user string
+	hash string
+}
+
+// readBasePasswd 读取基础口令文件，跳过注释和设备账号（导出结果再次作为基础文件时不重复）
+func (s *credentialService) readBasePasswd(creds []model.DeviceCredential) ([]passwdLine, error) {
+	if s.basePasswd == "" {
+		return nil, nil
+	}
+	f, err := os.Open(s.basePasswd)
+	if err != nil {
+		return nil, errs.ErrConfig.WithDetails("读取基础口令文件失败: " + err.Error())
+	}
+	defer f.Close()
+
+	device := make(map[string]bool, len(creds))
+	for _, c := range creds {
+		device[c.Username] = true
+	}
+	var out []passwdLine
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || device[user] {
+			continue
+		}
+		out = append(out, passwdLine{user: user, hash: hash})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errs.ErrConfig.WithDetails("读取基础口令文件失败: " + err.Error())
+	}
+	return out, nil
+}
+
+// deviceIDOf 以标记当前的设备 ID 为准（标记改过设备 ID 时主题随之变化）
+func deviceIDOf(c *model.DeviceCredential) string {
+	if c.Mark != nil && c.Mark.DeviceID != "" {
+		return c.Mark.DeviceID
+	}
+	return c.DeviceID
+}
+
+// deviceACL 设备可发布：上报类主题及标记自定义主题；可订阅：下发类主题
+func deviceACL(deviceID string, mark *model.Mark) model.CredentialACL {
+	acl := model.CredentialACL{
+		Publish: []string{
+			"location/" + deviceID,
+			"online/" + deviceID,
+			"offline/" + deviceID,
+			"cmd-ack/" + deviceID,
+			"shadow/" + deviceID + "/reported",
+			"ota-progress/" + deviceID,
+		},
+		Subscribe: []string{
+			"cmd/" + deviceID,
+			"warning/" + deviceID,
+			"echo/" + deviceID,
+			"shadow/" + deviceID + "/delta",
+			"ota/" + deviceID,
+		},
+	}
+	if mark != nil {
+		seen := make(map[string]bool, len(acl.Publish))
+		for _, t := range acl.Publish {
+			seen[t] = true
+		}
+		custom := append([]string(nil), mark.MqttTopic...)
+		sort.Strings(custom)
+		for _, t := range custom {
+			if t = strings.TrimSpace(t); t != "" && !seen[t] {
+				seen[t] = true
+				acl.Publish = append(acl.Publish, t)
+			}
+		}
+	}
+	return acl
+}
+
+func credentialResponse(c *model.DeviceCredential, mark *model.Mark, password string) *model.CredentialResponse {
+	return &model.CredentialResponse{
+		MarkID:    c.MarkID.String(),
+		DeviceID:  mark.DeviceID,
+		Username:  c.Username,
+		Password:  password,
+		Status:    c.Status,
+		CreatedAt: c.CreatedAt,
+		RotatedAt: c.RotatedAt,
+		RevokedAt: c.RevokedAt,
+		ACL:       deviceACL(mark.DeviceID, mark),
+	}
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, credentialPassLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashPassword 生成 Mosquitto 口令文件格式：$7$<iterations>$<base64 salt>$<base64 hash>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, credentialSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPasswordWithSalt(password, salt)
+}
+
+// hashPasswordWithSalt 用给定的盐生成 $7$ 哈希
+func hashPasswordWithSalt(password string, salt []byte) (string, error) {
+	key, err := pbkdf2.Key(sha512.New, password, salt, credentialIterations, credentialHashLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$7$%d$%s$%s", credentialIterations,
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key)), nil
+}
+
+// dynsecClient 把 $7$ 哈希拆成 dynamic-security 的 password / salt / iterations
+func dynsecClient(username, hash string) (*model.DynsecClient, error) {
+	parts := strings.Split(hash, "$")
+	// "$7$101$salt$hash" 切分后为 ["", "7", "101", salt, hash]
+	if len(parts) != 5 || parts[1] != "7" {
+		return nil, fmt.Errorf("仅支持 $7$ 格式")
+	}
+	iter, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("迭代次数非法")
+	}
+	return &model.DynsecClient{
+		Username:   username,
+		Password:   parts[4],
+		Salt:       parts[3],
+		Iterations: iter,
+		Roles:      []model.DynsecRoleRef{},
+	}, nil
+}
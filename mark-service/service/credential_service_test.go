@@ -0,0 +1,217 @@
+package service
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"IOT-Manage-System/mark-service/model"
+)
+
+// fakeCredentialRepo 只实现导出用到的 ListWithMark
+type fakeCredentialRepo struct {
+	creds []model.DeviceCredential
+}
+
+func (f *fakeCredentialRepo) Get(string) (*model.DeviceCredential, error) { return nil, nil }
+func (f *fakeCredentialRepo) Save(*model.DeviceCredential) error          { return nil }
+func (f *fakeCredentialRepo) ListWithMark() ([]model.DeviceCredential, error) {
+	return f.creds, nil
+}
+
+func TestHashPasswordWithSalt(t *testing.T) {
+	// 参考值由 Python hashlib.pbkdf2_hmac("sha512", b"secret", bytes(range(12)), 101, 64) 计算
+	salt := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	want := "$7$101$AAECAwQFBgcICQoL$Xr99N9ym9ys8TWxis5ajETJq6EVYzmc6nb8t3pUYnPBbCAbICS4xejTltonXWCtJNBvA+By+TXUqU6qCblO00w=="
+
+	got, err := hashPasswordWithSalt("secret", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("hash = %s\nwant   %s", got, want)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	h1, err := hashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := hashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 == h2 {
+		t.Error("same password hashed twice with the same salt")
+	}
+
+	// 用哈希中的盐重新计算，应与哈希值一致
+	parts := strings.Split(h1, "$")
+	if len(parts) != 5 || parts[1] != "7" || parts[2] != "101" {
+		t.Fatalf("hash %q is not in $7$101$salt$hash form", h1)
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(salt) != credentialSaltLen {
+		t.Fatalf("salt %q: len=%d err=%v", parts[3], len(salt), err)
+	}
+	key, err := pbkdf2.Key(sha512.New, "secret", salt, credentialIterations, credentialHashLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts[4] != base64.StdEncoding.EncodeToString(key) {
+		t.Error("hash does not verify against its own salt")
+	}
+}
+
+func TestDynsecClient(t *testing.T) {
+	cases := []struct {
+		name    string
+		hash    string
+		want    *model.DynsecClient
+		wantErr bool
+	}{
+		{
+			name: "pbkdf2 sha512",
+			hash: "$7$101$c2FsdA==$aGFzaA==",
+			want: &model.DynsecClient{Username: "u", Password: "aGFzaA==", Salt: "c2FsdA==", Iterations: 101, Roles: []model.DynsecRoleRef{}},
+		},
+		{name: "sha512 (mosquitto 1.x)", hash: "$6$c2FsdA==$aGFzaA==", wantErr: true},
+		{name: "plain text", hash: "admin", wantErr: true},
+		{name: "bad iterations", hash: "$7$abc$c2FsdA==$aGFzaA==", wantErr: true},
+		{name: "extra field", hash: "$7$101$c2FsdA==$aGFzaA==$x", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := dynsecClient("u", tc.hash)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("dynsecClient(%q) = %+v, want error", tc.hash, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("dynsecClient(%q) = %+v, want %+v", tc.hash, got, tc.want)
+			}
+		})
+	}
+}
+
+// newExportService 两个设备（d1 有效、d2 已吊销）加基础口令文件中的 admin 与 bridge 账号
+func newExportService(t *testing.T) *credentialService {
+	t.Helper()
+	base := filepath.Join(t.TempDir(), "passwd")
+	content := "# 基础口令\nadmin:$7$101$YWRtaW4=$YWRtaW5oYXNo\nbridge:$7$101$YnJpZGdl$YnJpZGdlaGFzaA==\n" +
+		"dev-d1:$7$101$b2xk$b2xkaGFzaA==\n" // 旧的导出结果中的设备账号，应被跳过
+	if err := os.WriteFile(base, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d1, d2 := uuid.New(), uuid.New()
+	return &credentialService{
+		repo: &fakeCredentialRepo{creds: []model.DeviceCredential{
+			{
+				MarkID: d1, DeviceID: "d1", Username: "dev-d1", PasswordHash: "$7$101$ZDE=$ZDFoYXNo",
+				Status: model.CredentialActive,
+				Mark:   &model.Mark{ID: d1, DeviceID: "d1", MqttTopic: []string{"custom/d1"}},
+			},
+			{
+				MarkID: d2, DeviceID: "d2", Username: "dev-d2", PasswordHash: "$7$101$ZDI=$ZDJoYXNo",
+				Status: model.CredentialRevoked,
+				Mark:   &model.Mark{ID: d2, DeviceID: "d2"},
+			},
+		}},
+		basePasswd:   base,
+		serviceUsers: []string{"admin"},
+	}
+}
+
+func TestExportPasswd(t *testing.T) {
+	out, err := newExportService(t).ExportPasswd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "admin:$7$101$YWRtaW4=$YWRtaW5oYXNo\n" +
+		"bridge:$7$101$YnJpZGdl$YnJpZGdlaGFzaA==\n" +
+		"dev-d1:$7$101$ZDE=$ZDFoYXNo\n"
+	if out != want {
+		t.Errorf("passwd =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestExportDynsec(t *testing.T) {
+	cfg, err := newExportService(t).ExportDynsec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := make(map[string]model.DynsecClient, len(cfg.Clients))
+	for _, c := range cfg.Clients {
+		clients[c.Username] = c
+	}
+	cases := []struct {
+		user     string
+		salt     string
+		disabled bool
+		roles    []model.DynsecRoleRef
+	}{
+		{"admin", "YWRtaW4=", false, []model.DynsecRoleRef{{RoleName: serviceRoleName}}},
+		{"bridge", "YnJpZGdl", false, []model.DynsecRoleRef{}}, // 不在 MQTT_SERVICE_USERS 中，无角色
+		{"dev-d1", "ZDE=", false, []model.DynsecRoleRef{{RoleName: "device-d1"}}},
+		{"dev-d2", "ZDI=", true, []model.DynsecRoleRef{{RoleName: "device-d2"}}}, // 吊销的保留为 disabled
+	}
+	if len(cfg.Clients) != len(cases) {
+		t.Errorf("got %d clients, want %d", len(cfg.Clients), len(cases))
+	}
+	for _, tc := range cases {
+		t.Run(tc.user, func(t *testing.T) {
+			c, ok := clients[tc.user]
+			if !ok {
+				t.Fatal("client missing")
+			}
+			if c.Salt != tc.salt || c.Iterations != credentialIterations || c.Disabled != tc.disabled {
+				t.Errorf("client = %+v", c)
+			}
+			if !reflect.DeepEqual(c.Roles, tc.roles) {
+				t.Errorf("roles = %v, want %v", c.Roles, tc.roles)
+			}
+		})
+	}
+
+	roles := make(map[string]model.DynsecRole, len(cfg.Roles))
+	for _, r := range cfg.Roles {
+		roles[r.RoleName] = r
+	}
+	if _, ok := roles[serviceRoleName]; !ok {
+		t.Error("service role missing")
+	}
+	allowed := make(map[string]bool)
+	for _, a := range roles["device-d1"].ACLs {
+		allowed[a.ACLType+" "+a.Topic] = a.Allow
+	}
+	for _, want := range []string{
+		"publishClientSend location/d1",
+		"publishClientSend custom/d1", // 标记自定义主题
+		"subscribeLiteral cmd/d1",
+		"publishClientReceive cmd/d1",
+	} {
+		if !allowed[want] {
+			t.Errorf("device-d1 role lacks %q", want)
+		}
+	}
+	for key := range allowed {
+		if strings.Contains(key, "d2") || strings.HasSuffix(key, "#") {
+			t.Errorf("device-d1 role allows %q", key)
+		}
+	}
+}
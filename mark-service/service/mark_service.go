@@ -2,8 +2,11 @@
 package service
 
 import (
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"IOT-Manage-System/mark-service/errs"
 	"IOT-Manage-System/mark-service/model"
 )
@@ -55,6 +58,11 @@ func (s *markService) CreateMark(mark *model.MarkRequest) error {
 		}
 	}
 
+	mapID, err := parseMapID(mark.MapID)
+	if err != nil {
+		return err
+	}
+
 	// 6. 组装持久化对象
 	dbMark := model.Mark{
 		DeviceID:      mark.DeviceID,
@@ -63,11 +71,12 @@ func (s *markService) CreateMark(mark *model.MarkRequest) error {
 		PersistMQTT:   persistMQTT,
 		SafeDistanceM: safeDistance,
 		MarkTypeID:    markTypeID,
+		MapID:         mapID,
 	}
 
 	// 7. 入库并自动处理标签
 	if err := s.repo.CreateMarkAutoTag(&dbMark, mark.Tags); err != nil {
-		return errs.ErrDatabase.WithDetails(err.Error())
+		return translateMapErr(err)
 	}
 
 	return nil
@@ -131,6 +140,26 @@ func (s *markService) fallbackSafeDistance(reqSafe *float64, markTypeID int) (*f
 	return &zero, nil
 }
 
+// parseMapID 解析分配的自制地图 ID，空串返回 nil（未分配）
+func parseMapID(id string) (*uuid.UUID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errs.ErrValidationFailed.WithDetails("无效的地图ID: " + id)
+	}
+	return &uid, nil
+}
+
+// translateMapErr map_id 在 custom_maps 中不存在时返回校验错误，其余按数据库错误处理
+func translateMapErr(err error) error {
+	if strings.Contains(err.Error(), "fk_marks_map") {
+		return errs.ErrValidationFailed.WithDetails("地图不存在")
+	}
+	return errs.ErrDatabase.WithDetails(err.Error())
+}
+
 // UpdateMark 更新标记
 func (s *markService) UpdateMark(ID string, req *model.MarkUpdateRequest) error {
 	// 先拿到现有记录
@@ -178,10 +207,15 @@ func (s *markService) UpdateMark(ID string, req *model.MarkUpdateRequest) error
 	if req.MarkTypeID != nil {
 		m.MarkTypeID = *req.MarkTypeID
 	}
+	if req.MapID != nil {
+		if m.MapID, err = parseMapID(*req.MapID); err != nil {
+			return err
+		}
+	}
 
 	// 更新数据库（含标签）
 	if err := s.repo.UpdateMark(m, req.Tags); err != nil {
-		return errs.ErrDatabase.WithDetails(err.Error())
+		return translateMapErr(err)
 	}
 	return nil
 }
@@ -196,6 +230,30 @@ func (s *markService) UpdateMarkLastOnline(deviceID string, t time.Time) error {
 	return s.repo.UpdateMarkLastOnline(deviceID, t)
 }
 
+// UpdateMarkPresence 更新标记的在线状态
+func (s *markService) UpdateMarkPresence(deviceID string, online bool, t time.Time) error {
+	if err := s.repo.UpdateMarkPresence(deviceID, online, t); err != nil {
+		return errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return nil
+}
+
+// ListOnlineMarks 获取在线标记列表（分页），staleSecond 内未刷新的视为已离线
+func (s *markService) ListOnlineMarks(staleSecond, page, limit int, preload bool) ([]model.MarkResponse, int64, error) {
+	offset := (page - 1) * limit
+	since := time.Now().Add(-time.Duration(staleSecond) * time.Second)
+	marks, total, err := s.repo.ListOnlineMarks(since, offset, limit, preload)
+	if err != nil {
+		return nil, 0, errs.ErrDatabase.WithDetails(err.Error())
+	}
+
+	responses := make([]model.MarkResponse, 0, len(marks))
+	for _, mark := range marks {
+		responses = append(responses, *s.convertToMarkResponse(&mark))
+	}
+	return responses, total, nil
+}
+
 // convertToMarkResponse 将数据库模型转换为响应模型
 func (s *markService) convertToMarkResponse(mark *model.Mark) *model.MarkResponse {
 	response := &model.MarkResponse{
@@ -208,13 +266,22 @@ func (s *markService) convertToMarkResponse(mark *model.Mark) *model.MarkRespons
 		CreatedAt:    mark.CreatedAt,
 		UpdatedAt:    mark.UpdatedAt,
 		LastOnlineAt: mark.LastOnlineAt,
+		IsOnline:     mark.IsOnline,
+	}
+	if mark.MapID != nil {
+		mapID := mark.MapID.String()
+		response.MapID = &mapID
 	}
 
 	// 处理 MarkType
 	if mark.MarkType.ID != 0 {
 		response.MarkType = &model.MarkTypeResponse{
-			ID:       mark.MarkType.ID,
-			TypeName: mark.MarkType.TypeName,
+			ID:                 mark.MarkType.ID,
+			TypeName:           mark.MarkType.TypeName,
+			PayloadDecoder:     mark.MarkType.PayloadDecoder,
+			DecoderConfig:      mark.MarkType.DecoderConfig,
+			SilenceAlarmS:      mark.MarkType.SilenceAlarmSecond,
+			SilenceAlarmFenceS: mark.MarkType.SilenceAlarmInFenceS,
 		}
 	}
 
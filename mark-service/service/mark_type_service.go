@@ -2,10 +2,38 @@
 package service
 
 import (
+	"encoding/json"
+
 	"IOT-Manage-System/mark-service/errs"
 	"IOT-Manage-System/mark-service/model"
 )
 
+// payloadDecoders 可选的载荷解码器，与 mqtt-watch / warning-service 的 decoder 注册表保持一致
+var payloadDecoders = map[string]bool{
+	"legacy":   true, // {"id","sens":[{n,u,v}]}，同时兼容 SenML 内容嗅探
+	"senml":    true, // RFC 8428 JSON / CBOR
+	"jsonpath": true, // 按 JSON 路径映射字段，需要 decoder_config
+	"binary":   true, // 定长二进制结构体，需要 decoder_config
+	"flat":     true, // 厂商内置：扁平 JSON {"id","lat","lon","x","y",...}
+}
+
+// validateDecoder 校验解码器名称及参数
+func validateDecoder(kind string, cfg json.RawMessage) error {
+	if !payloadDecoders[kind] {
+		return errs.ErrValidationFailed.WithDetails("不支持的 payload_decoder: " + kind)
+	}
+	if len(cfg) > 0 {
+		var obj map[string]any
+		if err := json.Unmarshal(cfg, &obj); err != nil {
+			return errs.ErrValidationFailed.WithDetails("decoder_config 必须是 JSON 对象")
+		}
+	}
+	if (kind == "jsonpath" || kind == "binary") && len(cfg) == 0 {
+		return errs.ErrValidationFailed.WithDetails(kind + " 解码器必须提供 decoder_config")
+	}
+	return nil
+}
+
 // 转换为响应模型
 func (s *markService) convertToMarkTypeResponse(markType *model.MarkType) *model.MarkTypeResponse {
 	if markType == nil {
@@ -15,9 +43,21 @@ func (s *markService) convertToMarkTypeResponse(markType *model.MarkType) *model
 		ID:                 markType.ID,
 		TypeName:           markType.TypeName,
 		DefaultDangerZoneM: markType.DefaultSafeDistanceM,
+		PayloadDecoder:     markType.PayloadDecoder,
+		DecoderConfig:      markType.DecoderConfig,
+		SilenceAlarmS:      markType.SilenceAlarmSecond,
+		SilenceAlarmFenceS: markType.SilenceAlarmInFenceS,
 	}
 }
 
+// positiveOrNil 静默阈值 <=0 统一存为 NULL（关闭）
+func positiveOrNil(v *int) *int {
+	if v == nil || *v <= 0 {
+		return nil
+	}
+	return v
+}
+
 // CreateMarkType 创建标记类型
 func (s *markService) CreateMarkType(req *model.MarkTypeCreateRequest) error {
 	exist, err := s.repo.IsTypeNameExists(req.TypeName)
@@ -25,10 +65,21 @@ func (s *markService) CreateMarkType(req *model.MarkTypeCreateRequest) error {
 		return errs.AlreadyExists("MARK_TYPE", "标记类型重复")
 	}
 
+	if req.PayloadDecoder == "" {
+		req.PayloadDecoder = "legacy"
+	}
+	if err := validateDecoder(req.PayloadDecoder, req.DecoderConfig); err != nil {
+		return err
+	}
+
 	// 将请求模型转换为数据库模型
 	markType := model.MarkType{
 		TypeName:             req.TypeName,
 		DefaultSafeDistanceM: req.DefaultSafeDistanceM,
+		PayloadDecoder:       req.PayloadDecoder,
+		DecoderConfig:        req.DecoderConfig,
+		SilenceAlarmSecond:   positiveOrNil(req.SilenceAlarmSecond),
+		SilenceAlarmInFenceS: positiveOrNil(req.SilenceAlarmInFenceS),
 	}
 
 	return s.repo.CreateMarkType(&markType)
@@ -103,6 +154,23 @@ func (s *markService) UpdateMarkType(typeID int, req *model.MarkTypeUpdateReques
 	if req.DefaultSafeDistanceM != nil {
 		mt.DefaultSafeDistanceM = req.DefaultSafeDistanceM
 	}
+	if req.PayloadDecoder != nil {
+		mt.PayloadDecoder = *req.PayloadDecoder
+	}
+	if len(req.DecoderConfig) > 0 {
+		mt.DecoderConfig = req.DecoderConfig
+	}
+	if req.SilenceAlarmSecond != nil {
+		mt.SilenceAlarmSecond = positiveOrNil(req.SilenceAlarmSecond)
+	}
+	if req.SilenceAlarmInFenceS != nil {
+		mt.SilenceAlarmInFenceS = positiveOrNil(req.SilenceAlarmInFenceS)
+	}
+	if req.PayloadDecoder != nil || len(req.DecoderConfig) > 0 {
+		if err := validateDecoder(mt.PayloadDecoder, mt.DecoderConfig); err != nil {
+			return err
+		}
+	}
 
 	// 3. 入库
 	return s.repo.UpdateMarkType(mt)
@@ -15,6 +15,8 @@ type MarkService interface {
 	UpdateMark(ID string, req *model.MarkUpdateRequest) error
 	DeleteMark(id string) error
 	UpdateMarkLastOnline(deviceID string, t time.Time) error
+	UpdateMarkPresence(deviceID string, online bool, t time.Time) error
+	ListOnlineMarks(staleSecond, page, limit int, preload bool) ([]model.MarkResponse, int64, error)
 	GetPersistMQTTByDeviceID(deviceID string) (bool, error)
 	GetMarksByPersistMQTT(persist bool, page, limit int, preload bool) ([]model.MarkResponse, int64, error)
 	GetDeviceIDsByPersistMQTT(persist bool) ([]string, error)
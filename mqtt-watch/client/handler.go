@@ -6,8 +6,8 @@ import (
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/goccy/go-json"
 
+	"IOT-Manage-System/mqtt-watch/decoder"
 	"IOT-Manage-System/mqtt-watch/model"
 	"IOT-Manage-System/mqtt-watch/service"
 	"IOT-Manage-System/mqtt-watch/utils"
@@ -18,7 +18,11 @@ type MqttCallback struct {
 	cli             mqtt.Client
 	markService     service.MarkService
 	markPairService service.MarkPairService
-	mongoService    service.MongoService // <-- 新增
+	mongoService    service.MongoService  // <-- 新增
+	decoders        *decoder.Registry     // 按设备类型选择载荷解码器
+	stream          *service.StreamHub    // 实时推送，nil 时不推送
+	onlineHooks     []mqtt.MessageHandler // online/# 的附加回调，需在 Subscribe 之前注册
+	guard           *service.IngestGuard  // 位置上报去重 / 乱序丢弃
 }
 
 // NewMqttClient 构造函数，一次性把 repo & service 注入
@@ -26,6 +30,7 @@ func NewMqttCallback(cli mqtt.Client,
 	markService service.MarkService,
 	markPairService service.MarkPairService,
 	mongoService service.MongoService, // <-- 新增
+	stream *service.StreamHub,
 ) *MqttCallback {
 
 	return &MqttCallback{
@@ -33,9 +38,29 @@ func NewMqttCallback(cli mqtt.Client,
 		markService:     markService,
 		markPairService: markPairService,
 		mongoService:    mongoService, // <-- 保存
+		decoders:        decoder.NewRegistry(markService.GetDecoderByDeviceID, time.Minute),
+		stream:          stream,
+		// 去重状态只在本副本内存中：设置 MQTT_SHARE_GROUP 后同一设备的消息（含 broker 重投）会分到不同副本，
+		// 本副本看不到其他副本接受过的消息，重投与跨副本的乱序都可能漏过
+		guard: service.NewIngestGuard(
+			time.Duration(utils.GetEnvInt("INGEST_DUP_WINDOW_SECOND", 10))*time.Second,
+			time.Duration(utils.GetEnvInt("INGEST_STATE_TTL_SECOND", 600))*time.Second,
+			uint64(utils.GetEnvInt("INGEST_SEQ_RESET_GAP", 1000)),
+			time.Duration(utils.GetEnvInt("INGEST_SEQ_RESET_IDLE_SECOND", 30))*time.Second,
+		),
 	}
 }
 
+// Close 停止去重状态的后台清理
+func (m *MqttCallback) Close() {
+	m.guard.Close()
+}
+
+// AddOnlineHook 追加 online/# 回调（如设备影子补发），须在 Subscribe 之前调用
+func (m *MqttCallback) AddOnlineHook(h mqtt.MessageHandler) {
+	m.onlineHooks = append(m.onlineHooks, h)
+}
+
 /* ---------- 以下全部是内部回调 / 主动下发接口 ---------- */
 
 func (m *MqttCallback) defaultMsgHandler(c mqtt.Client, msg mqtt.Message) {
@@ -76,17 +101,41 @@ func (m *MqttCallback) SendWarningEnd(deviceID string) {
 
 // saveLocation 对应原来的 SaveLocation，现在可以直接用注入的 repo/service 落库
 func (m *MqttCallback) saveLocation(c mqtt.Client, msg mqtt.Message) {
-	deviceID := utils.ParseOnlineId(msg.Topic(), msg.Payload())
+	m.handleLocation(msg.Topic(), msg.Payload(), "", msg.Duplicate())
+}
 
-	var locMsg model.LocMsg
-	if err := json.Unmarshal(msg.Payload(), &locMsg); err != nil {
-		log.Println("[ERROR] json 解析失败:", err)
+// handleLocation 载荷按设备所属 MarkType 配置的解码器归一化，未配置时兼容旧格式与 SenML。
+// owner 非空表示消息来自该标记的自定义主题，设备 ID 以其为准；dup 为 broker 重投标志。
+// 重复与乱序的消息在推送、落库之前丢弃
+func (m *MqttCallback) handleLocation(topic string, payload []byte, owner string, dup bool) {
+	deviceID := owner
+	if deviceID == "" {
+		deviceID = decoder.TopicDeviceID(topic)
+	}
+	locMsg, err := m.decoders.ForDevice(deviceID).Decode(topic, payload)
+	if err != nil {
+		log.Printf("[ERROR] 载荷解析失败  topic=%s  err=%v", topic, err)
+		return
+	}
+	if owner != "" {
+		locMsg.ID = owner
+	}
+	if len(locMsg.Sens) == 0 || locMsg.ID == "" {
 		return
 	}
-	if len(locMsg.Sens) == 0 {
+	deviceID = locMsg.ID
+	if ok, reason := m.guard.Accept(deviceID, locMsg.Seq, locMsg.Time, payload, dup); !ok {
+		log.Printf("[DEBUG] 丢弃位置上报  deviceID=%s  reason=%s", deviceID, reason)
 		return
 	}
 
+	data, rtk, uwb := buildDeviceLoc(deviceID, locMsg, time.Now())
+	data.SetID()
+	indoor := data.Indoor
+
+	// 实时推送不受 persist_mqtt 限制
+	m.publishPosition(data)
+
 	is_save, err := m.markService.GetPersistMQTTByDeviceID(deviceID)
 	if err != nil {
 		log.Printf("[ERROR] 获取 persist 失败: %v", err)
@@ -95,38 +144,74 @@ func (m *MqttCallback) saveLocation(c mqtt.Client, msg mqtt.Message) {
 	if !is_save {
 		return
 	}
+	if err := m.mongoService.SaveDeviceLoc(*data); err != nil {
+		log.Printf("[ERROR] 保存位置信息失败  deviceID=%s  err=%v", deviceID, err)
+		return
+	}
+	log.Printf("[INFO] 保存位置信息成功  deviceID=%s  indoor=%t  rtk=%v  uwb=%v  telemetry=%d",
+		deviceID, indoor, rtk, uwb, len(data.Telemetry))
+}
 
-	var rtk, uwb *model.Sens
+// buildDeviceLoc 由归一化后的上报构造位置记录：RTK v=[经度, 纬度]，UWB v=[x, y]，其余传感器记为遥测；
+// now 为服务器收到时间，上报不带采样时间时也作为记录时间
+func buildDeviceLoc(deviceID string, locMsg *model.LocMsg, now time.Time) (data *model.DeviceLoc, rtk, uwb bool) {
+	var rtkS, uwbS *model.Sens
+	telemetry := make(map[string]any)
 	for i := range locMsg.Sens {
-		switch locMsg.Sens[i].N {
+		s := &locMsg.Sens[i]
+		switch s.N {
 		case "RTK":
-			rtk = &locMsg.Sens[i]
+			rtkS = s
 		case "UWB":
-			uwb = &locMsg.Sens[i]
+			uwbS = s
+		default:
+			if v, ok := sensValue(s); ok {
+				telemetry[s.N] = v
+			}
 		}
 	}
-	indoor := uwb != nil && len(uwb.V) >= 2
+	rtk = rtkS != nil && len(rtkS.V) >= 2
+	uwb = uwbS != nil && len(uwbS.V) >= 2
 
-	recTime := time.Now()
+	recTime := now
+	if locMsg.Time != nil {
+		recTime = *locMsg.Time
+	}
 
 	// 构造实体
-	data := &model.DeviceLoc{
+	data = &model.DeviceLoc{
 		DeviceID:   deviceID,
-		Indoor:     indoor,
+		Indoor:     uwb,
+		MapID:      locMsg.Map,
 		RecordTime: recTime,
-		CreatedAt:  time.Now(), // 服务器收到时间
+		CreatedAt:  now,
 	}
-	data.SetID()
-	if rtk != nil && len(rtk.V) >= 2 {
-		data.Latitude = &rtk.V[0]
-		data.Longitude = &rtk.V[1]
+	if rtk {
+		data.SetRTK(rtkS.V)
+	}
+	if uwb {
+		data.UWBX = &uwbS.V[0]
+		data.UWBY = &uwbS.V[1]
+	}
+	if len(telemetry) > 0 {
+		data.Telemetry = telemetry
 	}
-	if uwb != nil && len(uwb.V) >= 2 {
-		data.UWBX = &uwb.V[0]
-		data.UWBY = &uwb.V[1]
+	return data, rtk, uwb
+}
+
+// sensValue 取遥测读数：单值取标量，多值取数组，其次字符串、布尔
+func sensValue(s *model.Sens) (any, bool) {
+	switch {
+	case len(s.V) == 1:
+		return s.V[0], true
+	case len(s.V) > 1:
+		return s.V, true
+	case s.VS != nil:
+		return *s.VS, true
+	case s.VB != nil:
+		return *s.VB, true
 	}
-	m.mongoService.SaveDeviceLoc(*data) // <-- 新增
-	log.Printf("[INFO] 保存位置信息成功  deviceID=%s  indoor=%t  lat=%f  lon=%f  uwb_x=%f  uwb_y=%f", deviceID, indoor, *data.Latitude, *data.Longitude, *data.UWBX, *data.UWBY)
+	return nil, false
 }
 
 type DistanceMsg struct {
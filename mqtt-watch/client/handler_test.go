@@ -0,0 +1,52 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"IOT-Manage-System/mqtt-watch/decoder"
+)
+
+// rtkPayload 设备实际上报的载荷（同 test/example.json），RTK v=[经度, 纬度]
+const rtkPayload = `{
+	"id": "device-001",
+	"sens": [
+		{"n": "RTK", "u": "deg", "v": [121.891751, 30.902079]},
+		{"n": "UWB", "u": "cm", "v": [11.4, 51.4]},
+		{"n": "BAT", "u": "%", "v": [87]}
+	]
+}`
+
+func TestBuildDeviceLocRTK(t *testing.T) {
+	msg, err := decoder.Decode("location/device-001", []byte(rtkPayload))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	loc, rtk, uwb := buildDeviceLoc(msg.ID, msg, now)
+	if !rtk || !uwb {
+		t.Fatalf("rtk=%v uwb=%v, want both true", rtk, uwb)
+	}
+	if loc.Longitude == nil || *loc.Longitude != 121.891751 {
+		t.Errorf("longitude = %v, want 121.891751", loc.Longitude)
+	}
+	if loc.Latitude == nil || *loc.Latitude != 30.902079 {
+		t.Errorf("latitude = %v, want 30.902079", loc.Latitude)
+	}
+	if !loc.LonLat {
+		t.Error("LonLat marker not set")
+	}
+	if lon, lat, ok := loc.StoredLonLat(); !ok || lon != 121.891751 || lat != 30.902079 {
+		t.Errorf("StoredLonLat = (%v, %v, %v)", lon, lat, ok)
+	}
+	if !loc.Indoor || loc.UWBX == nil || *loc.UWBX != 11.4 {
+		t.Errorf("uwb not mapped: indoor=%v x=%v", loc.Indoor, loc.UWBX)
+	}
+	if _, ok := loc.Telemetry["BAT"]; !ok {
+		t.Errorf("telemetry = %v, want BAT", loc.Telemetry)
+	}
+	if !loc.RecordTime.Equal(now) {
+		t.Errorf("record time = %v, want %v", loc.RecordTime, now)
+	}
+}
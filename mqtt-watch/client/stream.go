@@ -0,0 +1,92 @@
+package client
+
+import (
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+// StreamPositionTopicPrefix 共享订阅模式下位置事件的副本间广播主题：stream/position/<device_id>
+const StreamPositionTopicPrefix = "stream/position/"
+
+// publishPosition 普通模式直接投递本机；共享订阅模式下本副本只收到部分位置，
+// 以 QoS 0 广播给所有副本（含自己），由 forwardPosition 投递
+func (m *MqttCallback) publishPosition(loc *model.DeviceLoc) {
+	if m.stream == nil {
+		return
+	}
+	if utils.ShareGroup() == "" {
+		m.stream.Publish(model.StreamEvent{Type: model.StreamPosition, DeviceID: loc.DeviceID, At: loc.CreatedAt, Data: loc})
+		return
+	}
+	payload, err := json.Marshal(loc)
+	if err != nil {
+		return
+	}
+	m.cli.Publish(StreamPositionTopicPrefix+loc.DeviceID, 0, false, payload) // QoS 0 不等待确认
+}
+
+// forwardPosition stream/position/<device_id>：其他副本广播的位置
+func (m *MqttCallback) forwardPosition(c mqtt.Client, msg mqtt.Message) {
+	var loc model.DeviceLoc
+	if err := json.Unmarshal(msg.Payload(), &loc); err != nil || loc.DeviceID == "" {
+		return
+	}
+	m.stream.Publish(model.StreamEvent{Type: model.StreamPosition, DeviceID: loc.DeviceID, At: loc.CreatedAt, Data: &loc})
+}
+
+// forwardPresence presence/<device_id>：warning-service 发布的上下线事件（JSON），原样转发
+func (m *MqttCallback) forwardPresence(c mqtt.Client, msg mqtt.Message) {
+	m.forwardJSON(model.StreamPresence, msg)
+}
+
+// forwardAlarm alarm/<device_id>：静默报警等结构化报警事件（JSON），原样转发
+func (m *MqttCallback) forwardAlarm(c mqtt.Client, msg mqtt.Message) {
+	m.forwardJSON(model.StreamAlarm, msg)
+}
+
+// forwardWarning warning/<device_id>：围栏 / 距离报警开关（"1" / "0"），转换为报警事件
+func (m *MqttCallback) forwardWarning(c mqtt.Client, msg mqtt.Message) {
+	deviceID := topicTail(msg.Topic())
+	if deviceID == "" {
+		return
+	}
+	state := "cleared"
+	if strings.TrimSpace(string(msg.Payload())) == "1" {
+		state = "raised"
+	}
+	now := time.Now()
+	m.stream.Publish(model.StreamEvent{
+		Type:     model.StreamAlarm,
+		DeviceID: deviceID,
+		At:       now,
+		Data:     map[string]any{"device_id": deviceID, "type": "warning", "state": state, "at": now},
+	})
+}
+
+func (m *MqttCallback) forwardJSON(typ string, msg mqtt.Message) {
+	deviceID := topicTail(msg.Topic())
+	if deviceID == "" || !json.Valid(msg.Payload()) {
+		return
+	}
+	m.stream.Publish(model.StreamEvent{
+		Type:     typ,
+		DeviceID: deviceID,
+		At:       time.Now(),
+		Data:     json.RawMessage(append([]byte(nil), msg.Payload()...)),
+	})
+}
+
+func topicTail(topic string) string {
+	topic = strings.Trim(topic, "/")
+	if i := strings.LastIndex(topic, "/"); i >= 0 {
+		return topic[i+1:]
+	}
+	return ""
+}
@@ -4,39 +4,45 @@ import (
 	"log"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"IOT-Manage-System/mqtt-watch/utils"
 )
 
-func (mc *MqttCallback) MustSubscribe() {
+// Subscribe 挂接固定订阅，返回第一个失败的订阅错误。
+// 订阅经 utils.SubscribeMQTT 登记，重复调用或断线重连都不会产生重复回调。
+// 设置 MQTT_SHARE_GROUP 后，online / location 改为共享订阅，多副本分摊；
+// 实时推送所需的事件每个副本都要收到，仍为普通订阅
+func (mc *MqttCallback) Subscribe() error {
 	// online 主题需要两个回调
-	token := mc.cli.Subscribe("online/#", 1, MultiHandler(EchoMsg))
-	if token.Wait() && token.Error() != nil {
-		log.Fatalf("[FATAL] 订阅 online/# 失败: %v", token.Error())
+	if err := utils.SubscribeMQTT(utils.SharedTopic("online/#"), 1, MultiHandler(append([]mqtt.MessageHandler{EchoMsg}, mc.onlineHooks...)...)); err != nil {
+		return err
 	}
 
 	// location 主题：打印 + 落库
-	token = mc.cli.Subscribe("location/#", 1, MultiHandler(mc.saveLocation))
-	if token.Wait() && token.Error() != nil {
-		log.Fatalf("[FATAL] 订阅 location/# 失败: %v", token.Error())
-	}
-
-	log.Println("[INFO] MQTT 订阅已完成")
-}
-
-// MustSubscribe 一次性挂接所有订阅，失败 fatal。
-func MustSubscribe(c mqtt.Client) {
-	// online 主题需要两个回调
-	token := c.Subscribe("online/#", 1, MultiHandler(EchoMsg))
-	if token.Wait() && token.Error() != nil {
-		log.Fatalf("[FATAL] 订阅 online/# 失败: %v", token.Error())
+	if err := utils.SubscribeMQTT(utils.SharedTopic("location/#"), 1, MultiHandler(mc.saveLocation)); err != nil {
+		return err
 	}
 
-	// location 主题只要打印
-	token = c.Subscribe("location/#", 1, MultiHandler())
-	if token.Wait() && token.Error() != nil {
-		log.Fatalf("[FATAL] 订阅 location/# 失败: %v", token.Error())
+	// 实时推送：上下线与报警事件
+	if mc.stream != nil {
+		topics := map[string]mqtt.MessageHandler{
+			"presence/#": mc.forwardPresence,
+			"alarm/#":    mc.forwardAlarm,
+			"warning/#":  mc.forwardWarning,
+		}
+		// 共享订阅下每个副本只收到部分位置，经 stream/position/# 广播给所有副本
+		if utils.ShareGroup() != "" {
+			topics[StreamPositionTopicPrefix+"#"] = mc.forwardPosition
+		}
+		for topic, h := range topics {
+			if err := utils.SubscribeMQTT(topic, 1, h); err != nil {
+				return err
+			}
+		}
 	}
 
 	log.Println("[INFO] MQTT 订阅已完成")
+	return nil
 }
 
 // MultiHandler 把多个 mqtt.MessageHandler 串成一次调用。
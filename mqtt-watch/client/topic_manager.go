@@ -0,0 +1,217 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+// defaultTopics Subscribe 固定订阅的主题，被其覆盖的自定义主题不再重复订阅
+var defaultTopics = []string{"online/#", "location/#"}
+
+// TopicSub 一条自定义主题订阅及其归属设备
+type TopicSub struct {
+	Topic     string   `json:"topic"`
+	DeviceIDs []string `json:"device_ids"`
+}
+
+// TopicManager 按 marks.mqtt_topic 动态维护订阅：
+// 定时与数据库比对，新增的主题订阅、删除的主题退订，
+// 收到的消息按旧格式/SenML/类型解码器走 location 流程。
+type TopicManager struct {
+	mc       *MqttCallback
+	interval time.Duration
+
+	mu   sync.RWMutex
+	subs map[string][]string // 主题 -> 设备 ID 列表
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewTopicManager 构造函数，interval 为与数据库比对的周期
+func NewTopicManager(mc *MqttCallback, interval time.Duration) *TopicManager {
+	return &TopicManager{
+		mc:       mc,
+		interval: interval,
+		subs:     make(map[string][]string),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start 立即同步一次，之后按周期同步
+func (tm *TopicManager) Start() {
+	if err := tm.Sync(); err != nil {
+		log.Printf("[ERROR] 同步自定义主题失败: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(tm.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := tm.Sync(); err != nil {
+					log.Printf("[ERROR] 同步自定义主题失败: %v", err)
+				}
+			case <-tm.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止周期同步（不退订，断开连接时由 broker 清理）
+func (tm *TopicManager) Stop() {
+	tm.once.Do(func() { close(tm.stop) })
+}
+
+// Sync 与数据库比对一次，返回第一个订阅/退订错误
+func (tm *TopicManager) Sync() error {
+	byDevice, err := tm.mc.markService.GetMqttTopics()
+	if err != nil {
+		return err
+	}
+
+	// 1. 计算期望的 主题 -> 设备 映射
+	want := make(map[string][]string)
+	for deviceID, topics := range byDevice {
+		for _, t := range topics {
+			t = strings.TrimSpace(t)
+			if err := validTopicFilter(t); err != nil {
+				log.Printf("[WARN] 跳过非法主题  deviceID=%s  topic=%q  err=%v", deviceID, t, err)
+				continue
+			}
+			if coveredByDefault(t) {
+				continue
+			}
+			want[t] = append(want[t], deviceID)
+		}
+	}
+	for t := range want {
+		sort.Strings(want[t])
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	var firstErr error
+	// 2. 退订已删除的主题
+	for t := range tm.subs {
+		if _, ok := want[t]; ok {
+			continue
+		}
+		if err := utils.UnsubscribeMQTT(utils.SharedTopic(t)); err != nil {
+			log.Printf("[ERROR] %v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(tm.subs, t)
+		log.Printf("[INFO] 已退订自定义主题  topic=%s", t)
+	}
+
+	// 3. 订阅新增主题；已订阅的只更新归属设备，回调按主题实时查找
+	for t, devices := range want {
+		if _, ok := tm.subs[t]; !ok {
+			if err := utils.SubscribeMQTT(utils.SharedTopic(t), 1, tm.handler(t)); err != nil {
+				log.Printf("[ERROR] %v", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			log.Printf("[INFO] 已订阅自定义主题  topic=%s  devices=%v", t, devices)
+		}
+		tm.subs[t] = devices
+	}
+	return firstErr
+}
+
+// Subscriptions 当前自定义主题订阅快照
+func (tm *TopicManager) Subscriptions() []TopicSub {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	out := make([]TopicSub, 0, len(tm.subs))
+	for t, devices := range tm.subs {
+		out = append(out, TopicSub{Topic: t, DeviceIDs: append([]string(nil), devices...)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Topic < out[j].Topic })
+	return out
+}
+
+// handler 自定义主题只归属一个设备时，以该设备为准；
+// 多个设备共用同一主题时，设备 ID 由载荷 / topic 决定
+func (tm *TopicManager) handler(topic string) mqtt.MessageHandler {
+	return func(c mqtt.Client, msg mqtt.Message) {
+		tm.mu.RLock()
+		devices := tm.subs[topic]
+		tm.mu.RUnlock()
+
+		owner := ""
+		if len(devices) == 1 {
+			owner = devices[0]
+		}
+		tm.mc.handleLocation(msg.Topic(), msg.Payload(), owner, msg.Duplicate())
+	}
+}
+
+// validTopicFilter 按 MQTT 3.1.1 校验订阅过滤器
+func validTopicFilter(t string) error {
+	if t == "" {
+		return fmt.Errorf("主题为空")
+	}
+	if strings.HasPrefix(t, "$") {
+		return fmt.Errorf("不允许订阅系统主题")
+	}
+	segs := strings.Split(t, "/")
+	for i, s := range segs {
+		if strings.Contains(s, "#") && (s != "#" || i != len(segs)-1) {
+			return fmt.Errorf("# 只能作为最后一级")
+		}
+		if strings.Contains(s, "+") && s != "+" {
+			return fmt.Errorf("+ 必须独占一级")
+		}
+	}
+	return nil
+}
+
+// coveredByDefault 判断过滤器 f 能匹配的主题是否都已被默认订阅覆盖
+func coveredByDefault(f string) bool {
+	for _, d := range defaultTopics {
+		if filterCovers(d, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCovers 判断过滤器 d 是否覆盖过滤器 f
+func filterCovers(d, f string) bool {
+	ds, fs := strings.Split(d, "/"), strings.Split(f, "/")
+	for i, seg := range ds {
+		if seg == "#" {
+			return true
+		}
+		if i >= len(fs) {
+			return false
+		}
+		switch {
+		case fs[i] == "#":
+			return false
+		case seg == "+":
+			continue
+		case fs[i] == "+" || seg != fs[i]:
+			return false
+		}
+	}
+	return len(ds) == len(fs)
+}
@@ -0,0 +1,129 @@
+// decoder/binary.go
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// BinaryConfig binary 解码器参数，描述定长结构体布局，例：
+//
+//	{
+//	  "byte_order": "little",
+//	  "fields": [
+//	    {"name": "time",  "offset": 0,  "type": "uint32"},
+//	    {"name": "lat",   "offset": 4,  "type": "int32", "scale": 1e-7},
+//	    {"name": "lon",   "offset": 8,  "type": "int32", "scale": 1e-7},
+//	    {"name": "battery", "offset": 12, "type": "uint8", "unit": "%"}
+//	  ]
+//	}
+//
+// 名为 time 的字段作为采样时间（unit 为 ms 时按毫秒），设备 ID 取自 topic
+type BinaryConfig struct {
+	ByteOrder string        `json:"byte_order"` // big（默认） / little
+	Fields    []BinaryField `json:"fields"`
+}
+
+// BinaryField 结构体中的一个字段
+type BinaryField struct {
+	Name   string  `json:"name"`
+	Offset int     `json:"offset"`
+	Type   string  `json:"type"` // int8/uint8/int16/uint16/int32/uint32/int64/uint64/float32/float64
+	Scale  float64 `json:"scale"`
+	Unit   string  `json:"unit"`
+}
+
+var binaryTypeSize = map[string]int{
+	"int8": 1, "uint8": 1,
+	"int16": 2, "uint16": 2,
+	"int32": 4, "uint32": 4, "float32": 4,
+	"int64": 8, "uint64": 8, "float64": 8,
+}
+
+type binaryDecoder struct {
+	order  binary.ByteOrder
+	fields []BinaryField
+	minLen int
+}
+
+func newBinaryDecoder(raw json.RawMessage) (Decoder, error) {
+	var cfg BinaryConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("binary 配置解析失败: %w", err)
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, errors.New("binary 配置缺少 fields")
+	}
+
+	d := &binaryDecoder{order: binary.BigEndian, fields: cfg.Fields}
+	if strings.EqualFold(cfg.ByteOrder, "little") {
+		d.order = binary.LittleEndian
+	}
+	for i, f := range d.fields {
+		size, ok := binaryTypeSize[f.Type]
+		if !ok {
+			return nil, fmt.Errorf("binary 字段 %s 类型不支持: %s", f.Name, f.Type)
+		}
+		if f.Offset < 0 {
+			return nil, fmt.Errorf("binary 字段 %s 偏移非法", f.Name)
+		}
+		if f.Scale == 0 {
+			d.fields[i].Scale = 1
+		}
+		if end := f.Offset + size; end > d.minLen {
+			d.minLen = end
+		}
+	}
+	return d, nil
+}
+
+func (d *binaryDecoder) Decode(topic string, payload []byte) (*model.LocMsg, error) {
+	if len(payload) < d.minLen {
+		return nil, fmt.Errorf("binary 载荷长度不足: 需要 %d 字节，实际 %d", d.minLen, len(payload))
+	}
+
+	b := newLocBuilder(TopicDeviceID(topic))
+	for _, f := range d.fields {
+		v := d.read(payload[f.Offset:], f.Type) * f.Scale
+		if f.Name == "time" {
+			b.setTime(unixTime(v, f.Unit))
+			continue
+		}
+		b.add(f.Name, f.Unit, &v, nil, nil, time.Time{})
+	}
+	return b.build(), nil
+}
+
+func (d *binaryDecoder) read(buf []byte, typ string) float64 {
+	switch typ {
+	case "int8":
+		return float64(int8(buf[0]))
+	case "uint8":
+		return float64(buf[0])
+	case "int16":
+		return float64(int16(d.order.Uint16(buf)))
+	case "uint16":
+		return float64(d.order.Uint16(buf))
+	case "int32":
+		return float64(int32(d.order.Uint32(buf)))
+	case "uint32":
+		return float64(d.order.Uint32(buf))
+	case "int64":
+		return float64(int64(d.order.Uint64(buf)))
+	case "uint64":
+		return float64(d.order.Uint64(buf))
+	case "float32":
+		return float64(math.Float32frombits(d.order.Uint32(buf)))
+	case "float64":
+		return math.Float64frombits(d.order.Uint64(buf))
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+func TestBinaryDecoder(t *testing.T) {
+	// time(uint32) | lat(int32, 1e-7) | lon(int32, 1e-7) | battery(uint8) | temp(int16, 0.1) | pressure(float32)
+	fields := `[
+		{"name": "time", "offset": 0, "type": "uint32"},
+		{"name": "lat", "offset": 4, "type": "int32", "scale": 1e-7},
+		{"name": "lon", "offset": 8, "type": "int32", "scale": 1e-7},
+		{"name": "battery", "offset": 12, "type": "uint8", "unit": "%"},
+		{"name": "temp", "offset": 13, "type": "int16", "scale": 0.1, "unit": "Cel"},
+		{"name": "pressure", "offset": 15, "type": "float32", "unit": "hPa"}
+	]`
+	frame := func(order binary.ByteOrder) []byte {
+		buf := make([]byte, 19)
+		order.PutUint32(buf[0:], 1700000000)
+		order.PutUint32(buf[4:], uint32(int32(312000000)))
+		order.PutUint32(buf[8:], uint32(int32(1215000000)))
+		buf[12] = 88
+		temp := int16(-52)
+		order.PutUint16(buf[13:], uint16(temp))
+		order.PutUint32(buf[15:], math.Float32bits(1013.25))
+		return buf
+	}
+
+	cases := []struct {
+		name  string
+		order string
+		frame []byte
+	}{
+		{"big endian by default", "", frame(binary.BigEndian)},
+		{"little endian", "little", frame(binary.LittleEndian)},
+		{"trailing bytes ignored", "little", append(frame(binary.LittleEndian), 0xff, 0xff)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec, err := New("binary", []byte(`{"byte_order":"`+tc.order+`","fields":`+fields+`}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := dec.Decode("location/112", tc.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != "112" || got.Time == nil || !got.Time.Equal(time.Unix(1700000000, 0)) {
+				t.Errorf("id=%s time=%v", got.ID, got.Time)
+			}
+			want := map[string][]float64{
+				"battery":  {88},
+				"temp":     {-5.2},
+				"pressure": {1013.25},
+				"RTK":      {121.5, 31.2},
+			}
+			if len(got.Sens) != len(want) {
+				t.Fatalf("sens = %s", dump(got))
+			}
+			for _, s := range got.Sens {
+				w, ok := want[s.N]
+				if !ok || len(s.V) != len(w) {
+					t.Fatalf("unexpected sens %+v", s)
+				}
+				for i := range w {
+					if math.Abs(s.V[i]-w[i]) > 1e-6 {
+						t.Errorf("%s = %v, want %v", s.N, s.V, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBinaryDecoderTypes(t *testing.T) {
+	buf := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}
+	cases := []struct {
+		typ  string
+		want float64
+	}{
+		{"int8", -1},
+		{"uint8", 255},
+		{"int16", -1},
+		{"uint16", 65535},
+		{"int32", -1},
+		{"uint32", 4294967295},
+		{"int64", -2},
+		{"uint64", 18446744073709551614},
+	}
+	for _, tc := range cases {
+		dec, err := New("binary", []byte(`{"fields":[{"name":"v","offset":0,"type":"`+tc.typ+`"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dec.Decode("location/112", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []model.Sens{{N: "v", V: []float64{tc.want}}}; !reflect.DeepEqual(got.Sens, want) {
+			t.Errorf("%s: sens = %+v, want %v", tc.typ, got.Sens, tc.want)
+		}
+	}
+}
+
+func TestBinaryDecoderErrors(t *testing.T) {
+	for name, cfg := range map[string]string{
+		"no fields":       `{"fields":[]}`,
+		"unknown type":    `{"fields":[{"name":"v","offset":0,"type":"int24"}]}`,
+		"negative offset": `{"fields":[{"name":"v","offset":-1,"type":"uint8"}]}`,
+		"not json":        `[`,
+	} {
+		if _, err := New("binary", []byte(cfg)); err == nil {
+			t.Errorf("%s: config accepted", name)
+		}
+	}
+
+	// 最后一个字段越界：偏移 6 的 uint32 需要 10 字节
+	dec, err := New("binary", []byte(`{"fields":[{"name":"a","offset":0,"type":"uint8"},{"name":"b","offset":6,"type":"uint32"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dec.Decode("location/112", make([]byte, 9))
+	if err == nil || !strings.Contains(err.Error(), "需要 10 字节") {
+		t.Errorf("short payload: err = %v", err)
+	}
+}
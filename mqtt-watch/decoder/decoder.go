@@ -0,0 +1,103 @@
+// decoder/decoder.go
+package decoder
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// Format 载荷格式
+type Format int
+
+const (
+	FormatLegacy    Format = iota // 旧格式 {"id":..,"sens":[{n,u,v}]}
+	FormatSenMLJSON               // RFC 8428 JSON
+	FormatSenMLCBOR               // RFC 8428 CBOR
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatSenMLJSON:
+		return "senml+json"
+	case FormatSenMLCBOR:
+		return "senml+cbor"
+	default:
+		return "legacy"
+	}
+}
+
+// Detect 判断载荷格式：topic 中显式声明优先（如 location/112/senml+cbor），
+// 否则按内容嗅探：'[' 开头为 SenML JSON，'{' 开头为旧格式，CBOR 数组头为 SenML CBOR
+func Detect(topic string, payload []byte) Format {
+	senml := false
+	for _, seg := range strings.Split(topic, "/") {
+		switch strings.ToLower(seg) {
+		case "senml+cbor", "senml-cbor", "cbor":
+			return FormatSenMLCBOR
+		case "senml+json", "senml-json":
+			return FormatSenMLJSON
+		case "senml":
+			senml = true
+		}
+	}
+
+	trimmed := bytes.TrimSpace(payload)
+	if senml {
+		// 只声明了 senml，JSON 与 CBOR 仍按首字节区分
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			return FormatSenMLJSON
+		}
+		return FormatSenMLCBOR
+	}
+	if len(trimmed) == 0 {
+		return FormatLegacy
+	}
+	switch c := trimmed[0]; {
+	case c == '[':
+		return FormatSenMLJSON
+	case c == '{':
+		return FormatLegacy
+	case c >= 0x80 && c <= 0x9f: // CBOR major type 4（数组）
+		return FormatSenMLCBOR
+	}
+	return FormatLegacy
+}
+
+// Decode 按格式把载荷归一化为 LocMsg，设备 ID 缺失时回退到 topic 最后一段
+func Decode(topic string, payload []byte) (*model.LocMsg, error) {
+	fallbackID := TopicDeviceID(topic)
+
+	switch Detect(topic, payload) {
+	case FormatSenMLJSON:
+		return DecodeSenMLJSON(payload, fallbackID)
+	case FormatSenMLCBOR:
+		return DecodeSenMLCBOR(payload, fallbackID)
+	}
+
+	var msg model.LocMsg
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("json 解析失败: %w", err)
+	}
+	if strings.TrimSpace(msg.ID) == "" {
+		msg.ID = fallbackID
+	}
+	return &msg, nil
+}
+
+// TopicDeviceID 取 topic 中最后一个非格式声明的段作为设备 ID
+func TopicDeviceID(topic string) string {
+	segs := strings.Split(strings.Trim(topic, "/"), "/")
+	for i := len(segs) - 1; i > 0; i-- {
+		switch strings.ToLower(segs[i]) {
+		case "senml", "senml+json", "senml-json", "senml+cbor", "senml-cbor", "cbor", "":
+			continue
+		}
+		return segs[i]
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+// decoder/jsonpath.go
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// JSONPathConfig jsonpath 解码器参数，例：
+//
+//	{
+//	  "id": "$.devEUI",
+//	  "time": "$.ts", "time_unit": "ms",
+//	  "fields": {"lat": "$.gps.lat", "lon": "$.gps.lng", "battery": "$.status.bat"},
+//	  "units": {"battery": "%"}
+//	}
+type JSONPathConfig struct {
+	ID       string            `json:"id"`
+	Time     string            `json:"time"`
+	TimeUnit string            `json:"time_unit"` // s（默认） / ms
+	Fields   map[string]string `json:"fields"`
+	Units    map[string]string `json:"units"`
+}
+
+type jsonPathDecoder struct {
+	cfg    JSONPathConfig
+	id     []pathSeg
+	time   []pathSeg
+	fields map[string][]pathSeg
+}
+
+// pathSeg 路径中的一段：对象键或数组下标
+type pathSeg struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+func newJSONPathDecoder(raw json.RawMessage) (Decoder, error) {
+	var cfg JSONPathConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("jsonpath 配置解析失败: %w", err)
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, errors.New("jsonpath 配置缺少 fields")
+	}
+
+	d := &jsonPathDecoder{cfg: cfg, fields: make(map[string][]pathSeg, len(cfg.Fields))}
+	var err error
+	if cfg.ID != "" {
+		if d.id, err = parsePath(cfg.ID); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Time != "" {
+		if d.time, err = parsePath(cfg.Time); err != nil {
+			return nil, err
+		}
+	}
+	for name, p := range cfg.Fields {
+		if d.fields[name], err = parsePath(p); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// parsePath 解析 "$.a.b[0].c" 形式的简化 JSONPath
+func parsePath(p string) ([]pathSeg, error) {
+	p = strings.TrimPrefix(strings.TrimSpace(p), "$")
+	var segs []pathSeg
+	for _, part := range strings.Split(p, ".") {
+		if part == "" {
+			continue
+		}
+		for part != "" {
+			open := strings.IndexByte(part, '[')
+			if open < 0 {
+				segs = append(segs, pathSeg{key: part})
+				break
+			}
+			if open > 0 {
+				segs = append(segs, pathSeg{key: part[:open]})
+			}
+			end := strings.IndexByte(part, ']')
+			if end < open {
+				return nil, fmt.Errorf("jsonpath 格式错误: %s", p)
+			}
+			idx, err := strconv.Atoi(part[open+1 : end])
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath 下标错误: %s", p)
+			}
+			segs = append(segs, pathSeg{index: idx, isIdx: true})
+			part = part[end+1:]
+		}
+	}
+	return segs, nil
+}
+
+// lookup 沿路径取值，取不到返回 nil
+func lookup(doc any, segs []pathSeg) any {
+	cur := doc
+	for _, s := range segs {
+		switch node := cur.(type) {
+		case map[string]any:
+			if s.isIdx {
+				return nil
+			}
+			cur = node[s.key]
+		case []any:
+			if !s.isIdx || s.index < 0 || s.index >= len(node) {
+				return nil
+			}
+			cur = node[s.index]
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+func (d *jsonPathDecoder) Decode(topic string, payload []byte) (*model.LocMsg, error) {
+	var doc any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("json 解析失败: %w", err)
+	}
+
+	deviceID := TopicDeviceID(topic)
+	if d.id != nil {
+		if v := lookup(doc, d.id); v != nil {
+			deviceID = fmt.Sprint(v)
+		}
+	}
+	b := newLocBuilder(deviceID)
+
+	if d.time != nil {
+		switch v := lookup(doc, d.time).(type) {
+		case float64:
+			b.setTime(unixTime(v, d.cfg.TimeUnit))
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				b.setTime(t)
+			}
+		}
+	}
+
+	for name, segs := range d.fields {
+		addValue(b, name, d.cfg.Units[name], lookup(doc, segs))
+	}
+	return b.build(), nil
+}
+
+// addValue 按 JSON 值的类型写入 builder，数字字符串按数值处理
+func addValue(b *locBuilder, name, unit string, v any) {
+	switch val := v.(type) {
+	case float64:
+		b.add(name, unit, &val, nil, nil, time.Time{})
+	case bool:
+		b.add(name, unit, nil, nil, &val, time.Time{})
+	case string:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			b.add(name, unit, &f, nil, nil, time.Time{})
+			return
+		}
+		b.add(name, unit, nil, &val, nil, time.Time{})
+	}
+}
@@ -0,0 +1,121 @@
+package decoder
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+func TestParsePath(t *testing.T) {
+	cases := []struct {
+		path    string
+		want    []pathSeg
+		wantErr bool
+	}{
+		{path: "$.devEUI", want: []pathSeg{{key: "devEUI"}}},
+		{path: "$.gps.lat", want: []pathSeg{{key: "gps"}, {key: "lat"}}},
+		{path: "$.data[1].v", want: []pathSeg{{key: "data"}, {index: 1, isIdx: true}, {key: "v"}}},
+		{path: "$.m[0][2]", want: []pathSeg{{key: "m"}, {index: 0, isIdx: true}, {index: 2, isIdx: true}}},
+		{path: "$", want: nil},
+		{path: "$.a[x]", wantErr: true},
+		{path: "$.a]0[", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := parsePath(tc.path)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parsePath(%q) = %v, want error", tc.path, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parsePath(%q) = %v, %v, want %v", tc.path, got, err, tc.want)
+		}
+	}
+}
+
+func TestJSONPathDecoder(t *testing.T) {
+	cfg := `{
+		"id": "$.devEUI",
+		"time": "$.ts", "time_unit": "ms",
+		"fields": {"lat": "$.gps.lat", "lon": "$.gps.lng", "battery": "$.status.bat", "x": "$.uwb[0]", "y": "$.uwb[1]", "state": "$.status.state"},
+		"units": {"battery": "%", "x": "m", "y": "m"}
+	}`
+	dec, err := New("jsonpath", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		payload string
+		want    *model.LocMsg
+		wantErr bool
+	}{
+		{
+			name:    "all fields",
+			payload: `{"devEUI":"a1","ts":1700000000500,"gps":{"lat":31.2,"lng":121.5},"uwb":[1.5,2],"status":{"bat":"88","state":"idle"}}`,
+			want: &model.LocMsg{
+				ID:   "a1",
+				Time: func() *time.Time { t := time.UnixMilli(1700000000500); return &t }(),
+				Sens: []model.Sens{
+					{N: "battery", U: "%", V: []float64{88}}, // 数字字符串按数值处理
+					{N: "state", VS: sptr("idle")},
+					{N: "RTK", U: "deg", V: []float64{121.5, 31.2}},
+					{N: "UWB", U: "cm", V: []float64{150, 200}},
+				},
+			},
+		},
+		{
+			// 缺少的路径忽略，设备 ID 回退到 topic
+			name:    "missing paths",
+			payload: `{"gps":{"lat":31.2},"uwb":[1]}`,
+			want:    &model.LocMsg{ID: "112"},
+		},
+		{name: "malformed json", payload: `{"devEUI":`, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := dec.Decode("location/112", []byte(tc.payload))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want error", dump(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sortSens(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %s\nwant %s", dump(got), dump(tc.want))
+			}
+		})
+	}
+}
+
+func TestJSONPathConfig(t *testing.T) {
+	for name, cfg := range map[string]string{
+		"no fields":   `{"id":"$.id"}`,
+		"bad path":    `{"fields":{"lat":"$.a[b]"}}`,
+		"bad id path": `{"id":"$.a[","fields":{"lat":"$.lat"}}`,
+		"not json":    `{`,
+	} {
+		if _, err := New("jsonpath", []byte(cfg)); err == nil {
+			t.Errorf("%s: config accepted", name)
+		}
+	}
+}
+
+// sortSens 遥测按 map 遍历顺序写入，定位量固定在最后；按名称排序遥测后再比较
+func sortSens(m *model.LocMsg) {
+	n := 0
+	for n < len(m.Sens) && m.Sens[n].N != "RTK" && m.Sens[n].N != "UWB" {
+		n++
+	}
+	tel := m.Sens[:n]
+	sort.Slice(tel, func(i, j int) bool { return tel[i].N < tel[j].N })
+}
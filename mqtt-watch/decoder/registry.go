@@ -0,0 +1,133 @@
+// decoder/registry.go
+package decoder
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// Decoder 把原始载荷归一化为内部 LocMsg
+type Decoder interface {
+	Decode(topic string, payload []byte) (*model.LocMsg, error)
+}
+
+// DecoderFunc 让普通函数满足 Decoder 接口
+type DecoderFunc func(topic string, payload []byte) (*model.LocMsg, error)
+
+func (f DecoderFunc) Decode(topic string, payload []byte) (*model.LocMsg, error) {
+	return f(topic, payload)
+}
+
+// Factory 根据 MarkType.decoder_config 构造解码器
+type Factory func(cfg json.RawMessage) (Decoder, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		"legacy":   func(json.RawMessage) (Decoder, error) { return DecoderFunc(Decode), nil },
+		"senml":    func(json.RawMessage) (Decoder, error) { return DecoderFunc(decodeSenML), nil },
+		"jsonpath": newJSONPathDecoder,
+		"binary":   newBinaryDecoder,
+		"flat":     newFlatDecoder,
+	}
+)
+
+// Register 注册（或覆盖）一个解码器，名称与 mark_types.payload_decoder 对应
+func Register(kind string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[kind] = f
+}
+
+// New 按名称与参数构造解码器
+func New(kind string, cfg json.RawMessage) (Decoder, error) {
+	factoriesMu.RLock()
+	f, ok := factories[kind]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的解码器: %s", kind)
+	}
+	return f(cfg)
+}
+
+// decodeSenML 只按 SenML 解析（JSON / CBOR 按首字节区分）
+func decodeSenML(topic string, payload []byte) (*model.LocMsg, error) {
+	fallbackID := TopicDeviceID(topic)
+	if Detect(topic, payload) == FormatSenMLJSON {
+		return DecodeSenMLJSON(payload, fallbackID)
+	}
+	return DecodeSenMLCBOR(payload, fallbackID)
+}
+
+// Lookup 查询设备所属类型配置的解码器，设备不存在时返回空 kind
+type Lookup func(deviceID string) (kind string, cfg []byte, err error)
+
+type cacheEntry struct {
+	dec      Decoder
+	expireAt time.Time
+}
+
+// Registry 按设备缓存解码器，设备 ID 取自 topic 最后一段；
+// 查不到配置或配置错误时回退到 legacy（旧格式 + SenML 嗅探）。
+// 类型的解码器配置在 mark-service 中修改，本服务收不到变更通知，修改在缓存过期（ttl）后生效
+type Registry struct {
+	lookup Lookup
+	ttl    time.Duration
+
+	mu    sync.RWMutex
+	cache map[string]cacheEntry
+}
+
+// NewRegistry 构造函数，ttl 为设备→解码器映射的缓存时间
+func NewRegistry(lookup Lookup, ttl time.Duration) *Registry {
+	return &Registry{
+		lookup: lookup,
+		ttl:    ttl,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+// Decode 选出设备对应的解码器并解析
+func (r *Registry) Decode(topic string, payload []byte) (*model.LocMsg, error) {
+	return r.ForDevice(TopicDeviceID(topic)).Decode(topic, payload)
+}
+
+// ForDevice 返回设备对应的解码器
+func (r *Registry) ForDevice(deviceID string) Decoder {
+	fallback := DecoderFunc(Decode)
+	if r == nil || r.lookup == nil || deviceID == "" {
+		return fallback
+	}
+
+	now := time.Now()
+	r.mu.RLock()
+	e, ok := r.cache[deviceID]
+	r.mu.RUnlock()
+	if ok && now.Before(e.expireAt) {
+		return e.dec
+	}
+
+	dec := Decoder(fallback)
+	kind, cfg, err := r.lookup(deviceID)
+	switch {
+	case err != nil:
+		log.Printf("[WARN] 查询解码器失败  deviceID=%s  err=%v", deviceID, err)
+	case kind != "" && kind != "legacy":
+		if d, err := New(kind, cfg); err != nil {
+			log.Printf("[WARN] 构造解码器失败，回退 legacy  deviceID=%s  kind=%s  err=%v", deviceID, kind, err)
+		} else {
+			dec = d
+		}
+	}
+
+	r.mu.Lock()
+	r.cache[deviceID] = cacheEntry{dec: dec, expireAt: now.Add(r.ttl)}
+	r.mu.Unlock()
+	return dec
+}
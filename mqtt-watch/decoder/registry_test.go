@@ -0,0 +1,133 @@
+package decoder
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// 设备 d-flat 配置 flat，d-json 配置 jsonpath，d-bad 配置了错误的 jsonpath，d-legacy 显式配置 legacy，
+// d-err 查询失败，其余设备不存在
+func TestRegistryForDevice(t *testing.T) {
+	calls := map[string]int{}
+	lookup := func(deviceID string) (string, []byte, error) {
+		calls[deviceID]++
+		switch deviceID {
+		case "d-flat":
+			return "flat", nil, nil
+		case "d-json":
+			return "jsonpath", []byte(`{"fields":{"lat":"$.p[0]","lon":"$.p[1]"}}`), nil
+		case "d-bad":
+			return "jsonpath", []byte(`{}`), nil
+		case "d-unknown":
+			return "no-such-decoder", nil, nil
+		case "d-legacy":
+			return "legacy", nil, nil
+		case "d-err":
+			return "", nil, errors.New("db down")
+		}
+		return "", nil, nil
+	}
+	r := NewRegistry(lookup, time.Hour)
+
+	legacy := `{"id":"x","sens":[{"n":"BAT","u":"%","v":[87]}]}`
+	cases := []struct {
+		deviceID string
+		payload  string
+		wantN    string // 解码结果的第一个 Sens
+	}{
+		{"d-flat", `{"lat":31.2,"lon":121.5}`, "RTK"},
+		{"d-json", `{"p":[31.2,121.5]}`, "RTK"},
+		{"d-bad", legacy, "BAT"},     // 配置错误回退 legacy
+		{"d-unknown", legacy, "BAT"}, // 未知解码器回退 legacy
+		{"d-legacy", legacy, "BAT"},
+		{"d-err", legacy, "BAT"}, // 查询失败回退 legacy
+		{"d-none", legacy, "BAT"},
+		{"", legacy, "BAT"}, // topic 中没有设备 ID
+	}
+	for _, tc := range cases {
+		t.Run(tc.deviceID, func(t *testing.T) {
+			msg, err := r.ForDevice(tc.deviceID).Decode("location/"+tc.deviceID, []byte(tc.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msg.Sens) == 0 || msg.Sens[0].N != tc.wantN {
+				t.Errorf("sens = %+v, want %s first", msg.Sens, tc.wantN)
+			}
+		})
+	}
+
+	// 同一设备只查询一次；空设备 ID 不查询
+	for _, tc := range cases {
+		r.ForDevice(tc.deviceID)
+	}
+	for id, n := range calls {
+		if n != 1 {
+			t.Errorf("lookup(%q) called %d times, want 1", id, n)
+		}
+	}
+	if calls[""] != 0 {
+		t.Error("lookup called for empty device id")
+	}
+}
+
+// 缓存过期后重新查询，类型配置的修改随之生效
+func TestRegistryTTL(t *testing.T) {
+	kind := "flat"
+	calls := 0
+	r := NewRegistry(func(string) (string, []byte, error) {
+		calls++
+		return kind, nil, nil
+	}, 20*time.Millisecond)
+
+	payload := []byte(`{"id":"d1","sens":[{"n":"BAT","v":[1]}]}`)
+	decode := func() *model.LocMsg {
+		msg, err := r.Decode("location/d1", payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	// flat 把 sens 当作未知字段丢弃
+	if msg := decode(); len(msg.Sens) != 0 {
+		t.Fatalf("flat decoded sens %+v", msg.Sens)
+	}
+	kind = "legacy"
+	if msg := decode(); len(msg.Sens) != 0 || calls != 1 {
+		t.Fatalf("cached decoder not used: sens=%+v calls=%d", msg.Sens, calls)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if msg := decode(); len(msg.Sens) != 1 || calls != 2 {
+		t.Errorf("expired entry not refreshed: sens=%+v calls=%d", msg.Sens, calls)
+	}
+}
+
+func TestRegistryNil(t *testing.T) {
+	var r *Registry
+	msg, err := r.Decode("location/d1", []byte(`{"sens":[{"n":"BAT","v":[1]}]}`))
+	if err != nil || msg.ID != "d1" || len(msg.Sens) != 1 {
+		t.Errorf("nil registry: msg=%+v err=%v", msg, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-fixed", func(cfg json.RawMessage) (Decoder, error) {
+		return DecoderFunc(func(topic string, _ []byte) (*model.LocMsg, error) {
+			return &model.LocMsg{ID: TopicDeviceID(topic) + string(cfg)}, nil
+		}), nil
+	})
+	dec, err := New("test-fixed", []byte("-cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := dec.Decode("location/d1", nil); msg.ID != "d1-cfg" {
+		t.Errorf("id = %s", msg.ID)
+	}
+	if _, err := New("no-such-decoder", nil); err == nil {
+		t.Error("unknown decoder constructed")
+	}
+}
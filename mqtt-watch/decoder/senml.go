@@ -0,0 +1,172 @@
+// decoder/senml.go
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// senmlRecord SenML 单条记录（RFC 8428），JSON 用短字段名，CBOR 用整数键
+type senmlRecord struct {
+	BaseName    string   `json:"bn,omitempty" cbor:"-2,keyasint,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty" cbor:"-3,keyasint,omitempty"`
+	BaseUnit    string   `json:"bu,omitempty" cbor:"-4,keyasint,omitempty"`
+	BaseValue   *float64 `json:"bv,omitempty" cbor:"-5,keyasint,omitempty"`
+	BaseSum     *float64 `json:"bs,omitempty" cbor:"-6,keyasint,omitempty"`
+	BaseVersion int      `json:"bver,omitempty" cbor:"-1,keyasint,omitempty"`
+	Name        string   `json:"n,omitempty" cbor:"0,keyasint,omitempty"`
+	Unit        string   `json:"u,omitempty" cbor:"1,keyasint,omitempty"`
+	Value       *float64 `json:"v,omitempty" cbor:"2,keyasint,omitempty"`
+	StringValue *string  `json:"vs,omitempty" cbor:"3,keyasint,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty" cbor:"4,keyasint,omitempty"`
+	Sum         *float64 `json:"s,omitempty" cbor:"5,keyasint,omitempty"`
+	Time        float64  `json:"t,omitempty" cbor:"6,keyasint,omitempty"`
+	UpdateTime  float64  `json:"ut,omitempty" cbor:"7,keyasint,omitempty"`
+}
+
+// resolvedRecord 合并 base 字段之后的记录
+type resolvedRecord struct {
+	Name  string
+	Unit  string
+	Value *float64
+	VS    *string
+	VB    *bool
+	Time  time.Time
+}
+
+// 相对时间阈值：RFC 8428 规定小于 2^28 的时间值表示相对当前时间的秒数
+const senmlRelativeTimeLimit = 1 << 28
+
+// DecodeSenMLJSON 解析 SenML JSON pack 并归一化
+func DecodeSenMLJSON(payload []byte, fallbackID string) (*model.LocMsg, error) {
+	var pack []senmlRecord
+	if err := json.Unmarshal(payload, &pack); err != nil {
+		return nil, fmt.Errorf("senml json 解析失败: %w", err)
+	}
+	return normalizeSenML(pack, fallbackID)
+}
+
+// DecodeSenMLCBOR 解析 SenML CBOR pack 并归一化
+func DecodeSenMLCBOR(payload []byte, fallbackID string) (*model.LocMsg, error) {
+	var pack []senmlRecord
+	if err := cbor.Unmarshal(payload, &pack); err != nil {
+		return nil, fmt.Errorf("senml cbor 解析失败: %w", err)
+	}
+	return normalizeSenML(pack, fallbackID)
+}
+
+// resolveSenML 按 RFC 8428 第 4.6 节把 base 字段展开到每条记录
+func resolveSenML(pack []senmlRecord) ([]resolvedRecord, error) {
+	var (
+		baseName  string
+		baseTime  float64
+		baseUnit  string
+		baseValue float64
+		now       = time.Now()
+	)
+	out := make([]resolvedRecord, 0, len(pack))
+	for _, r := range pack {
+		if r.BaseName != "" {
+			baseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			baseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			baseUnit = r.BaseUnit
+		}
+		if r.BaseValue != nil {
+			baseValue = *r.BaseValue
+		}
+
+		// 只有 base 字段、没有任何值的记录不产生数据
+		if r.Value == nil && r.StringValue == nil && r.BoolValue == nil && r.Sum == nil {
+			continue
+		}
+
+		rec := resolvedRecord{
+			Name: baseName + r.Name,
+			Unit: r.Unit,
+			VS:   r.StringValue,
+			VB:   r.BoolValue,
+		}
+		if rec.Name == "" {
+			return nil, errors.New("senml 记录缺少名称")
+		}
+		if rec.Unit == "" {
+			rec.Unit = baseUnit
+		}
+		switch {
+		case r.Value != nil:
+			v := baseValue + *r.Value
+			rec.Value = &v
+		case r.Sum != nil:
+			v := *r.Sum
+			rec.Value = &v
+		}
+
+		t := baseTime + r.Time
+		switch {
+		case t == 0:
+			rec.Time = now
+		case t < senmlRelativeTimeLimit:
+			rec.Time = now.Add(time.Duration(t * float64(time.Second)))
+		default:
+			sec, frac := math.Modf(t)
+			rec.Time = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// splitSenMLName 把 "urn:dev:mac:0024befffe804ff1:lat" / "tag-01/lat" 拆成设备 ID 和字段名
+func splitSenMLName(name string) (deviceID, field string) {
+	idx := strings.LastIndexAny(name, ":/.")
+	if idx < 0 {
+		return "", name
+	}
+	prefix, field := name[:idx], name[idx+1:]
+	// urn:dev:<type>:<id> 只取最后一段
+	if strings.HasPrefix(prefix, "urn:dev:") {
+		if i := strings.LastIndex(prefix, ":"); i >= 0 {
+			prefix = prefix[i+1:]
+		}
+	}
+	return strings.Trim(prefix, ":/."), field
+}
+
+// normalizeSenML 把 SenML 记录归一化为内部 LocMsg，设备 ID 取自记录名前缀；
+// 一条消息只对应一台设备，记录名前缀指向多台设备的 pack 整体拒绝
+func normalizeSenML(pack []senmlRecord, fallbackID string) (*model.LocMsg, error) {
+	records, err := resolveSenML(pack)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("senml pack 为空")
+	}
+
+	b := newLocBuilder(fallbackID)
+	packID := ""
+	for _, r := range records {
+		deviceID, field := splitSenMLName(r.Name)
+		if deviceID != "" {
+			if packID != "" && deviceID != packID {
+				return nil, fmt.Errorf("senml pack 包含多台设备: %s, %s", packID, deviceID)
+			}
+			packID = deviceID
+			b.msg.ID = deviceID
+		}
+		b.add(field, r.Unit, r.Value, r.VS, r.VB, r.Time)
+	}
+	return b.build(), nil
+}
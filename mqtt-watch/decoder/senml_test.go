@@ -0,0 +1,235 @@
+package decoder
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+func sptr(v string) *string { return &v }
+func bptr(v bool) *bool     { return &v }
+
+func tptr(sec int64) *time.Time {
+	t := time.Unix(sec, 0)
+	return &t
+}
+
+func TestDecodeSenMLJSON(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+		want    *model.LocMsg
+		wantErr string
+	}{
+		{
+			name: "urn base name and base time",
+			payload: `[
+				{"bn":"urn:dev:mac:0024befffe804ff1:","bt":1700000000,"n":"lat","u":"deg","v":31.2},
+				{"n":"lon","u":"deg","v":121.5,"t":1},
+				{"n":"battery","u":"%","v":88}
+			]`,
+			want: &model.LocMsg{
+				ID:   "0024befffe804ff1",
+				Time: tptr(1700000001),
+				Sens: []model.Sens{
+					{N: "battery", U: "%", V: []float64{88}},
+					{N: "RTK", U: "deg", V: []float64{121.5, 31.2}},
+				},
+			},
+		},
+		{
+			name: "slash base name, base unit and base value",
+			payload: `[
+				{"bn":"tag-01/","bt":1700000000,"bu":"m","bv":1,"n":"x","v":1.5},
+				{"n":"y","v":2}
+			]`,
+			want: &model.LocMsg{
+				ID:   "tag-01",
+				Time: tptr(1700000000),
+				Sens: []model.Sens{{N: "UWB", U: "cm", V: []float64{250, 300}}},
+			},
+		},
+		{
+			name: "string, bool and map values",
+			payload: `[
+				{"bn":"tag-01/","bt":1700000000,"n":"state","vs":"charging"},
+				{"n":"alarm","vb":true},
+				{"n":"map","vs":"floor-2"},
+				{"n":"seq","v":42}
+			]`,
+			want: &model.LocMsg{
+				ID:   "tag-01",
+				Time: tptr(1700000000),
+				Map:  "floor-2",
+				Seq:  func() *uint64 { v := uint64(42); return &v }(),
+				Sens: []model.Sens{
+					{N: "state", VS: sptr("charging")},
+					{N: "alarm", VB: bptr(true)},
+				},
+			},
+		},
+		{
+			name:    "names without device prefix use topic id",
+			payload: `[{"bt":1700000000,"n":"temp","u":"Cel","v":21.5}]`,
+			want: &model.LocMsg{
+				ID:   "112",
+				Time: tptr(1700000000),
+				Sens: []model.Sens{{N: "temp", U: "Cel", V: []float64{21.5}}},
+			},
+		},
+		{
+			name:    "sum used when value missing",
+			payload: `[{"bn":"tag-01/","bt":1700000000,"n":"energy","u":"J","s":12}]`,
+			want: &model.LocMsg{
+				ID:   "tag-01",
+				Time: tptr(1700000000),
+				Sens: []model.Sens{{N: "energy", U: "J", V: []float64{12}}},
+			},
+		},
+		{
+			name:    "multiple devices rejected",
+			payload: `[{"bn":"tag-01/","n":"lat","v":31.2},{"bn":"tag-02/","n":"lat","v":31.3}]`,
+			wantErr: "多台设备",
+		},
+		{name: "record without name", payload: `[{"v":1}]`, wantErr: "缺少名称"},
+		{name: "base fields only", payload: `[{"bn":"tag-01/","bt":1700000000}]`, wantErr: "为空"},
+		{name: "empty pack", payload: `[]`, wantErr: "为空"},
+		{name: "malformed json", payload: `[{"n":"lat","v":}]`, wantErr: "解析失败"},
+		{name: "object instead of array", payload: `{"n":"lat","v":1}`, wantErr: "解析失败"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeSenMLJSON([]byte(tc.payload), "112")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %s\nwant %s", dump(got), dump(tc.want))
+			}
+		})
+	}
+}
+
+// 相对时间（小于 2^28）按接收时间偏移
+func TestDecodeSenMLRelativeTime(t *testing.T) {
+	before := time.Now()
+	got, err := DecodeSenMLJSON([]byte(`[{"bt":-10,"n":"temp","v":1}]`), "112")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+	if got.Time == nil || got.Time.Before(before.Add(-10*time.Second)) || got.Time.After(after.Add(-10*time.Second)) {
+		t.Errorf("time = %v, want about 10s before now", got.Time)
+	}
+}
+
+func TestDecodeSenMLCBOR(t *testing.T) {
+	// 整数键：-2 bn / -3 bt / 0 n / 1 u / 2 v / 3 vs / 6 t
+	pack := []map[int]any{
+		{-2: "urn:dev:mac:0024befffe804ff1:", -3: 1700000000, 0: "lat", 1: "deg", 2: 31.2},
+		{0: "lon", 1: "deg", 2: 121.5, 6: 1},
+		{0: "state", 3: "idle"},
+	}
+	payload, err := cbor.Marshal(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := Detect("location/112", payload); f != FormatSenMLCBOR {
+		t.Fatalf("Detect = %v, want senml+cbor", f)
+	}
+
+	got, err := DecodeSenMLCBOR(payload, "112")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &model.LocMsg{
+		ID:   "0024befffe804ff1",
+		Time: tptr(1700000001),
+		Sens: []model.Sens{
+			{N: "state", VS: sptr("idle")},
+			{N: "RTK", U: "deg", V: []float64{121.5, 31.2}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %s\nwant %s", dump(got), dump(want))
+	}
+
+	if _, err := DecodeSenMLCBOR([]byte{0x82, 0xff}, "112"); err == nil {
+		t.Error("malformed cbor decoded without error")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		topic   string
+		payload string
+		want    Format
+	}{
+		{"location/112", `{"id":"112","sens":[]}`, FormatLegacy},
+		{"location/112", `  [{"n":"lat","v":1}]`, FormatSenMLJSON},
+		{"location/112", "\x81\xa1\x00\x63lat", FormatSenMLCBOR},
+		{"location/112", ``, FormatLegacy},
+		{"location/112/senml+cbor", `[{"n":"lat"}]`, FormatSenMLCBOR}, // topic 声明优先
+		{"location/112/senml+json", "\x81", FormatSenMLJSON},
+		{"location/112/senml", `[{"n":"lat"}]`, FormatSenMLJSON},
+		{"location/112/senml", "\x81", FormatSenMLCBOR},
+	}
+	for _, tc := range cases {
+		if got := Detect(tc.topic, []byte(tc.payload)); got != tc.want {
+			t.Errorf("Detect(%q, %q) = %v, want %v", tc.topic, tc.payload, got, tc.want)
+		}
+	}
+}
+
+func TestTopicDeviceID(t *testing.T) {
+	cases := map[string]string{
+		"location/112":             "112",
+		"location/112/senml+cbor":  "112",
+		"location/112/senml/":      "112",
+		"custom/vendor/tag-01":     "tag-01",
+		"location":                 "",
+		"/location/112/senml-json": "112",
+	}
+	for topic, want := range cases {
+		if got := TopicDeviceID(topic); got != want {
+			t.Errorf("TopicDeviceID(%q) = %q, want %q", topic, got, want)
+		}
+	}
+}
+
+// dump 输出指针字段的值，便于比较失败时查看
+func dump(m *model.LocMsg) string {
+	if m == nil {
+		return "<nil>"
+	}
+	out := fmt.Sprintf("id=%s map=%s", m.ID, m.Map)
+	if m.Time != nil {
+		out += " time=" + m.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if m.Seq != nil {
+		out += fmt.Sprintf(" seq=%d", *m.Seq)
+	}
+	for _, s := range m.Sens {
+		out += fmt.Sprintf(" {%s %s %v", s.N, s.U, s.V)
+		if s.VS != nil {
+			out += " vs=" + *s.VS
+		}
+		if s.VB != nil {
+			out += fmt.Sprintf(" vb=%t", *s.VB)
+		}
+		out += "}"
+	}
+	return out
+}
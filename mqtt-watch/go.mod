@@ -4,6 +4,7 @@ go 1.24.6
 
 require (
 	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/goccy/go-json v0.10.5
 	github.com/gofiber/fiber/v2 v2.52.9
 	go.mongodb.org/mongo-driver v1.17.4
@@ -11,6 +12,8 @@ require (
 	gorm.io/gorm v1.30.3
 )
 
+require github.com/x448/float16 v0.8.4 // indirect
+
 require (
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/golang/snappy v1.0.0 // indirect
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/service"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+type CommandHandler interface {
+	SendCommand(c *fiber.Ctx) error
+	ListDeviceCommands(c *fiber.Ctx) error
+	ListCommands(c *fiber.Ctx) error
+	GetCommand(c *fiber.Ctx) error
+	CancelCommand(c *fiber.Ctx) error
+}
+
+type commandHandler struct {
+	cmdSer service.CommandService
+}
+
+func NewCommandHandler(s service.CommandService) CommandHandler {
+	return &commandHandler{cmdSer: s}
+}
+
+// 下发指令  POST /mqtt/devices/:deviceId/commands
+func (h *commandHandler) SendCommand(c *fiber.Ctx) error {
+	var req model.SendCommandReq
+	if err := c.BodyParser(&req); err != nil {
+		return errs.ErrInvalidInput.WithDetails(err.Error())
+	}
+	cmd, err := h.cmdSer.Send(c.Params("deviceId"), req, c.Get("X-UserID"))
+	if err != nil {
+		return err
+	}
+	return utils.SendCreatedResponse(c, cmd, "指令已下发")
+}
+
+// 设备指令历史  GET /mqtt/devices/:deviceId/commands
+func (h *commandHandler) ListDeviceCommands(c *fiber.Ctx) error {
+	q := parseCommandQuery(c)
+	q.DeviceID = c.Params("deviceId")
+	return h.list(c, q)
+}
+
+// 指令历史  GET /mqtt/commands?device_id=&status=&name=&page=&limit=
+func (h *commandHandler) ListCommands(c *fiber.Ctx) error {
+	q := parseCommandQuery(c)
+	q.DeviceID = c.Query("device_id")
+	return h.list(c, q)
+}
+
+// 指令详情  GET /mqtt/commands/:id
+func (h *commandHandler) GetCommand(c *fiber.Ctx) error {
+	cmd, err := h.cmdSer.Get(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, cmd)
+}
+
+// 取消指令  POST /mqtt/commands/:id/cancel
+func (h *commandHandler) CancelCommand(c *fiber.Ctx) error {
+	cmd, err := h.cmdSer.Cancel(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, cmd, "指令已取消")
+}
+
+func (h *commandHandler) list(c *fiber.Ctx, q model.CommandQuery) error {
+	list, total, err := h.cmdSer.List(q)
+	if err != nil {
+		return err
+	}
+	return utils.SendPaginatedResponse(c, list, total, q.Page, q.Limit)
+}
+
+func parseCommandQuery(c *fiber.Ctx) model.CommandQuery {
+	q := model.CommandQuery{
+		Status: c.Query("status"),
+		Name:   c.Query("name"),
+		Page:   c.QueryInt("page", 1),
+		Limit:  c.QueryInt("limit", 20),
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Limit < 1 || q.Limit > 100 {
+		q.Limit = 20
+	}
+	return q
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"gorm.io/gorm"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+// healthPingTimeout 单个依赖的探测超时
+const healthPingTimeout = 2 * time.Second
+
+type HealthHandler interface {
+	// Live 进程存活即返回 200
+	Live(c *fiber.Ctx) error
+	// Ready broker / Postgres / MongoDB 均可用且未进入关闭流程时返回 200，否则 503
+	Ready(c *fiber.Ctx) error
+	// Drain 进入关闭流程，此后 Ready 一律返回 503
+	Drain()
+}
+
+type healthHandler struct {
+	db       *gorm.DB
+	mongo    *mongo.Client
+	draining atomic.Bool
+}
+
+func NewHealthHandler(db *gorm.DB, mongo *mongo.Client) HealthHandler {
+	return &healthHandler{db: db, mongo: mongo}
+}
+
+func (h *healthHandler) Live(c *fiber.Ctx) error {
+	return c.SendString("服务运行正常")
+}
+
+func (h *healthHandler) Ready(c *fiber.Ctx) error {
+	checks := map[string]string{"mqtt": "ok", "postgres": "ok", "mongo": "ok"}
+	ready := true
+	fail := func(name, msg string) {
+		checks[name] = msg
+		ready = false
+	}
+
+	if h.draining.Load() {
+		checks["shutdown"] = "draining"
+		ready = false
+	}
+	if !utils.MQTTConnected() {
+		fail("mqtt", "disconnected")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), healthPingTimeout)
+	defer cancel()
+	if sqlDB, err := h.db.DB(); err != nil {
+		fail("postgres", err.Error())
+	} else if err := sqlDB.PingContext(ctx); err != nil {
+		fail("postgres", err.Error())
+	}
+	if err := h.mongo.Ping(ctx, readpref.Primary()); err != nil {
+		fail("mongo", err.Error())
+	}
+
+	if !ready {
+		return errs.ErrNetwork.WithDetails(checks)
+	}
+	return utils.SendSuccessResponse(c, checks)
+}
+
+func (h *healthHandler) Drain() {
+	h.draining.Store(true)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/service"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+type OTAHandler interface {
+	UploadFirmware(c *fiber.Ctx) error
+	ListFirmwares(c *fiber.Ctx) error
+	GetFirmware(c *fiber.Ctx) error
+	DeleteFirmware(c *fiber.Ctx) error
+
+	CreateCampaign(c *fiber.Ctx) error
+	ListCampaigns(c *fiber.Ctx) error
+	GetCampaign(c *fiber.Ctx) error
+	ListCampaignDevices(c *fiber.Ctx) error
+	StartCampaign(c *fiber.Ctx) error
+	AbortCampaign(c *fiber.Ctx) error
+}
+
+type otaHandler struct {
+	otaSer service.OTAService
+}
+
+func NewOTAHandler(s service.OTAService) OTAHandler {
+	return &otaHandler{otaSer: s}
+}
+
+/* ---------- 固件 ---------- */
+
+// 上传固件（multipart：file / name / version / notes）  POST /mqtt/ota/firmwares
+func (h *otaHandler) UploadFirmware(c *fiber.Ctx) error {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return errs.ErrInvalidInput.WithDetails("缺少固件文件 file")
+	}
+	fw, err := h.otaSer.UploadFirmware(c.FormValue("name"), c.FormValue("version"), c.FormValue("notes"), c.Get("X-UserID"), fh)
+	if err != nil {
+		return err
+	}
+	return utils.SendCreatedResponse(c, fw, "固件上传成功")
+}
+
+// 固件列表  GET /mqtt/ota/firmwares
+func (h *otaHandler) ListFirmwares(c *fiber.Ctx) error {
+	list, err := h.otaSer.ListFirmwares()
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, list)
+}
+
+// 固件详情  GET /mqtt/ota/firmwares/:id
+func (h *otaHandler) GetFirmware(c *fiber.Ctx) error {
+	fw, err := h.otaSer.GetFirmware(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, fw)
+}
+
+// 删除固件  DELETE /mqtt/ota/firmwares/:id
+func (h *otaHandler) DeleteFirmware(c *fiber.Ctx) error {
+	if err := h.otaSer.DeleteFirmware(c.Params("id")); err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, nil, "固件已删除")
+}
+
+/* ---------- 任务 ---------- */
+
+// 创建升级任务（草稿）  POST /mqtt/ota/campaigns
+func (h *otaHandler) CreateCampaign(c *fiber.Ctx) error {
+	var req model.CreateCampaignReq
+	if err := c.BodyParser(&req); err != nil {
+		return errs.ErrInvalidInput.WithDetails(err.Error())
+	}
+	campaign, err := h.otaSer.CreateCampaign(req, c.Get("X-UserID"))
+	if err != nil {
+		return err
+	}
+	return utils.SendCreatedResponse(c, campaign, "升级任务已创建")
+}
+
+// 任务列表  GET /mqtt/ota/campaigns?status=&page=&limit=
+func (h *otaHandler) ListCampaigns(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	list, total, err := h.otaSer.ListCampaigns(c.Query("status"), page, limit)
+	if err != nil {
+		return err
+	}
+	return utils.SendPaginatedResponse(c, list, total, page, limit)
+}
+
+// 任务详情（含各状态设备数）  GET /mqtt/ota/campaigns/:id
+func (h *otaHandler) GetCampaign(c *fiber.Ctx) error {
+	campaign, err := h.otaSer.GetCampaign(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, campaign)
+}
+
+// 任务设备进度  GET /mqtt/ota/campaigns/:id/devices?status=&page=&limit=
+func (h *otaHandler) ListCampaignDevices(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	list, total, err := h.otaSer.ListCampaignDevices(c.Params("id"), c.Query("status"), page, limit)
+	if err != nil {
+		return err
+	}
+	return utils.SendPaginatedResponse(c, list, total, page, limit)
+}
+
+// 启动任务  POST /mqtt/ota/campaigns/:id/start
+func (h *otaHandler) StartCampaign(c *fiber.Ctx) error {
+	campaign, err := h.otaSer.StartCampaign(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, campaign, "升级任务已启动")
+}
+
+// 中止任务  POST /mqtt/ota/campaigns/:id/abort  body: {"reason": "..."}（可选）
+func (h *otaHandler) AbortCampaign(c *fiber.Ctx) error {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return errs.ErrInvalidInput.WithDetails(err.Error())
+		}
+	}
+	campaign, err := h.otaSer.AbortCampaign(c.Params("id"), body.Reason)
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, campaign, "升级任务已中止")
+}
+
+func pageParams(c *fiber.Ctx) (int, int) {
+	page, limit := c.QueryInt("page", 1), c.QueryInt("limit", 20)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/service"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+type ReportHandler interface {
+	Occupancy(c *fiber.Ctx) error
+	Traffic(c *fiber.Ctx) error
+	Dwell(c *fiber.Ctx) error
+	Peak(c *fiber.Ctx) error
+}
+
+type reportHandler struct {
+	reportSer service.ReportService
+}
+
+func NewReportHandler(s service.ReportService) ReportHandler {
+	return &reportHandler{reportSer: s}
+}
+
+// 围栏当前人数  GET /mqtt/reports/occupancy?window_seconds=&device_ids=&format=
+func (h *reportHandler) Occupancy(c *fiber.Ctx) error {
+	window := time.Duration(c.QueryInt("window_seconds", int(service.DefaultOccupancyWindow.Seconds()))) * time.Second
+	list, err := h.reportSer.Occupancy(window, splitIDs(c.Query("device_ids")))
+	if err != nil {
+		return err
+	}
+	if !wantCSV(c) {
+		return utils.SendSuccessResponse(c, list)
+	}
+	rows := make([][]string, 0, len(list))
+	for _, o := range list {
+		rows = append(rows, []string{o.FenceID, o.FenceName, strconv.Itoa(o.Count), strings.Join(o.DeviceIDs, ";")})
+	}
+	return sendCSV(c, "fence_occupancy", []string{"fence_id", "fence_name", "count", "device_ids"}, rows)
+}
+
+// 围栏进出次数  GET /mqtt/reports/traffic?from=&to=&device_ids=&gap_seconds=&format=
+func (h *reportHandler) Traffic(c *fiber.Ctx) error {
+	q, err := parseReportQuery(c)
+	if err != nil {
+		return err
+	}
+	list, err := h.reportSer.Traffic(q)
+	if err != nil {
+		return err
+	}
+	if !wantCSV(c) {
+		return utils.SendSuccessResponse(c, list)
+	}
+	rows := make([][]string, 0, len(list))
+	for _, t := range list {
+		rows = append(rows, []string{t.FenceID, t.FenceName, strconv.Itoa(t.Entries), strconv.Itoa(t.Exits)})
+	}
+	return sendCSV(c, "fence_traffic", []string{"fence_id", "fence_name", "entries", "exits"}, rows)
+}
+
+// 设备停留时间  GET /mqtt/reports/dwell?from=&to=&device_ids=&gap_seconds=&format=
+func (h *reportHandler) Dwell(c *fiber.Ctx) error {
+	q, err := parseReportQuery(c)
+	if err != nil {
+		return err
+	}
+	list, err := h.reportSer.Dwell(q)
+	if err != nil {
+		return err
+	}
+	if !wantCSV(c) {
+		return utils.SendSuccessResponse(c, list)
+	}
+	rows := make([][]string, 0, len(list))
+	for _, d := range list {
+		rows = append(rows, []string{d.FenceID, d.FenceName, d.DeviceID, strconv.Itoa(d.Visits),
+			strconv.FormatFloat(d.DwellSeconds, 'f', 0, 64)})
+	}
+	return sendCSV(c, "fence_dwell", []string{"fence_id", "fence_name", "device_id", "visits", "dwell_seconds"}, rows)
+}
+
+// 围栏峰值人数  GET /mqtt/reports/peak?from=&to=&device_ids=&gap_seconds=&format=
+func (h *reportHandler) Peak(c *fiber.Ctx) error {
+	q, err := parseReportQuery(c)
+	if err != nil {
+		return err
+	}
+	list, err := h.reportSer.Peak(q)
+	if err != nil {
+		return err
+	}
+	if !wantCSV(c) {
+		return utils.SendSuccessResponse(c, list)
+	}
+	rows := make([][]string, 0, len(list))
+	for _, p := range list {
+		at := ""
+		if p.PeakAt != nil {
+			at = p.PeakAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{p.FenceID, p.FenceName, strconv.Itoa(p.Peak), at})
+	}
+	return sendCSV(c, "fence_peak", []string{"fence_id", "fence_name", "peak", "peak_at"}, rows)
+}
+
+// parseReportQuery from / to 为 RFC3339，缺省统计最近 24 小时
+func parseReportQuery(c *fiber.Ctx) (model.ReportQuery, error) {
+	q := model.ReportQuery{
+		To:        time.Now(),
+		DeviceIDs: splitIDs(c.Query("device_ids")),
+		Gap:       time.Duration(c.QueryInt("gap_seconds", int(service.DefaultReportGap.Seconds()))) * time.Second,
+	}
+	if s := c.Query("to"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, errs.ErrInvalidInput.WithDetails("to 必须为 RFC3339 时间")
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	if s := c.Query("from"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, errs.ErrInvalidInput.WithDetails("from 必须为 RFC3339 时间")
+		}
+		q.From = t
+	}
+	if q.Gap <= 0 {
+		return q, errs.ErrInvalidInput.WithDetails("gap_seconds 必须为正整数")
+	}
+	return q, nil
+}
+
+// splitIDs 逗号分隔的设备 ID 列表
+func splitIDs(s string) []string {
+	var ids []string
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func wantCSV(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Query("format"), "csv")
+}
+
+// sendCSV 以附件形式返回 CSV，带 UTF-8 BOM 以便 Excel 正确显示中文围栏名
+func sendCSV(c *fiber.Ctx, name string, header []string, rows [][]string) error {
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	_ = w.Write(header)
+	_ = w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		return errs.ErrInternal.WithDetails(err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s_%s.csv"`, name, time.Now().Format("20060102150405")))
+	return c.Send(buf.Bytes())
+}
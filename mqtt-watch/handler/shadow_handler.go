@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/service"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+type ShadowHandler interface {
+	GetShadow(c *fiber.Ctx) error
+	ReplaceDesired(c *fiber.Ctx) error
+	PatchDesired(c *fiber.Ctx) error
+}
+
+type shadowHandler struct {
+	shadowSer service.ShadowService
+}
+
+func NewShadowHandler(s service.ShadowService) ShadowHandler {
+	return &shadowHandler{shadowSer: s}
+}
+
+// 查询设备影子  GET /mqtt/shadows/:deviceId
+func (h *shadowHandler) GetShadow(c *fiber.Ctx) error {
+	view, err := h.shadowSer.Get(c.Params("deviceId"))
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, view)
+}
+
+// 覆盖期望配置  PUT /mqtt/shadows/:deviceId/desired
+func (h *shadowHandler) ReplaceDesired(c *fiber.Ctx) error {
+	var req model.ShadowDesiredReq
+	if err := c.BodyParser(&req); err != nil {
+		return errs.ErrInvalidInput.WithDetails(err.Error())
+	}
+	view, err := h.shadowSer.ReplaceDesired(c.Params("deviceId"), req)
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, view, "期望配置已更新")
+}
+
+// 合并修改期望配置（JSON Merge Patch，null 删除）  PATCH /mqtt/shadows/:deviceId/desired
+func (h *shadowHandler) PatchDesired(c *fiber.Ctx) error {
+	var req model.ShadowDesiredReq
+	if err := c.BodyParser(&req); err != nil {
+		return errs.ErrInvalidInput.WithDetails(err.Error())
+	}
+	view, err := h.shadowSer.PatchDesired(c.Params("deviceId"), req)
+	if err != nil {
+		return err
+	}
+	return utils.SendSuccessResponse(c, view, "期望配置已更新")
+}
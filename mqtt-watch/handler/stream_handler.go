@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/service"
+)
+
+// streamHeartbeat SSE 心跳间隔，防止代理断开空闲连接，同时用于发现已断开的客户端
+const streamHeartbeat = 15 * time.Second
+
+type StreamHandler interface {
+	Stream(c *fiber.Ctx) error
+}
+
+type streamHandler struct {
+	hub *service.StreamHub
+}
+
+func NewStreamHandler(hub *service.StreamHub) StreamHandler {
+	return &streamHandler{hub: hub}
+}
+
+// 实时事件流（SSE）  GET /mqtt/stream
+// 需经网关鉴权（X-UserID），过滤参数见 parseStreamFilter
+func (h *streamHandler) Stream(c *fiber.Ctx) error {
+	if c.Get("X-UserID") == "" {
+		return errs.ErrUnauthorized
+	}
+	filter, err := parseStreamFilter(c)
+	if err != nil {
+		return err
+	}
+
+	sub := h.hub.Subscribe(filter)
+	userID := c.Get("X-UserID")
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.hub.Unsubscribe(sub)
+		log.Printf("[INFO] 实时推送连接建立  userID=%s", userID)
+
+		ticker := time.NewTicker(streamHeartbeat)
+		defer ticker.Stop()
+
+		// 先发一条注释，客户端据此确认连接成功
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		var seq uint64
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return // 服务关闭
+				}
+				payload, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				seq++
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", seq, e.Type, payload)
+			case <-ticker.C:
+				if n := sub.Dropped(); n > 0 {
+					fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", n)
+				} else {
+					fmt.Fprint(w, ": ping\n\n")
+				}
+			}
+			if err := w.Flush(); err != nil {
+				log.Printf("[INFO] 实时推送连接断开  userID=%s", userID)
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// parseStreamFilter 解析过滤参数，多个值用逗号分隔：
+//
+//	events=position,presence,alarm  事件类型
+//	devices=112,113                 设备 ID
+//	types=1,人员                    标记类型 ID 或名称
+//	tags=2,班组A                    标签 ID 或名称
+//	bbox=minLon,minLat,maxLon,maxLat  室外区域
+//	xy=minX,minY,maxX,maxY            室内 UWB 区域（cm）
+func parseStreamFilter(c *fiber.Ctx) (service.StreamFilter, error) {
+	var f service.StreamFilter
+
+	if events := splitList(c.Query("events")); len(events) > 0 {
+		f.Events = make(map[string]bool, len(events))
+		for _, e := range events {
+			switch e {
+			case model.StreamPosition, model.StreamPresence, model.StreamAlarm:
+				f.Events[e] = true
+			default:
+				return f, errs.ErrInvalidInput.WithDetails("未知的事件类型: " + e)
+			}
+		}
+	}
+	if devices := splitList(c.Query("devices")); len(devices) > 0 {
+		f.Devices = make(map[string]bool, len(devices))
+		for _, d := range devices {
+			f.Devices[d] = true
+		}
+	}
+	f.Types = splitList(c.Query("types"))
+	f.Tags = splitList(c.Query("tags"))
+
+	var err error
+	if f.BBox, err = parseBox(c.Query("bbox")); err != nil {
+		return f, errs.ErrInvalidInput.WithDetails("bbox " + err.Error())
+	}
+	if f.XYBox, err = parseBox(c.Query("xy")); err != nil {
+		return f, errs.ErrInvalidInput.WithDetails("xy " + err.Error())
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseBox 解析 "min1,min2,max1,max2"，为空返回 nil
+func parseBox(s string) (*[4]float64, error) {
+	parts := splitList(s)
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("需要 4 个数值")
+	}
+	var b [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("数值非法: %s", p)
+		}
+		b[i] = v
+	}
+	if b[0] > b[2] || b[1] > b[3] {
+		return nil, fmt.Errorf("最小值大于最大值")
+	}
+	return &b, nil
+}
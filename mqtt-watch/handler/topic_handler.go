@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"IOT-Manage-System/mqtt-watch/client"
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+type TopicHandler interface {
+	ListTopics(c *fiber.Ctx) error
+	RefreshTopics(c *fiber.Ctx) error
+}
+
+type topicHandler struct {
+	tm *client.TopicManager
+}
+
+func NewTopicHandler(tm *client.TopicManager) TopicHandler {
+	return &topicHandler{tm: tm}
+}
+
+// 当前自定义主题订阅  GET /mqtt/topics
+func (h *topicHandler) ListTopics(c *fiber.Ctx) error {
+	return utils.SendSuccessResponse(c, h.tm.Subscriptions())
+}
+
+// 立即与数据库同步自定义主题  POST /mqtt/topics/refresh
+func (h *topicHandler) RefreshTopics(c *fiber.Ctx) error {
+	if err := h.tm.Sync(); err != nil {
+		if appErr, ok := err.(*errs.AppError); ok {
+			return appErr
+		}
+		return errs.ErrThirdParty.WithDetails(err.Error())
+	}
+	return utils.SendSuccessResponse(c, h.tm.Subscriptions(), "主题订阅已刷新")
+}
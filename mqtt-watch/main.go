@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
@@ -13,13 +18,27 @@ import (
 	"IOT-Manage-System/mqtt-watch/utils"
 )
 
+// mqttQuiesceMs 断开 MQTT 时等待处理中消息的时间（毫秒）
+const mqttQuiesceMs = 1000
+
 func main() {
-	utils.InitMQTT()
-	defer utils.CloseMQTT()
+	if err := run(); err != nil {
+		log.Fatalf("[FATAL] %v", err)
+	}
+	log.Println("mqtt-watch 已退出")
+}
+
+// run 启动顺序：Postgres → MongoDB → 各服务 → MQTT 订阅 → HTTP；
+// 收到 SIGINT / SIGTERM 后先断开 MQTT（不再接收消息），再停 HTTP，
+// 其余组件按 defer 逆序关闭，位置写缓冲在 MongoDB 断开前写完
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdownTimeout := time.Duration(utils.GetEnvInt("SHUTDOWN_TIMEOUT_SECOND", 15)) * time.Second
 
 	db, err := utils.InitDB()
 	if err != nil {
-		log.Fatalf("初始化数据库失败: %v", err)
+		return fmt.Errorf("初始化数据库失败: %w", err)
 	}
 	defer func() {
 		if err := utils.CloseDB(db); err != nil {
@@ -28,9 +47,11 @@ func main() {
 			log.Println("数据库已正常关闭")
 		}
 	}()
-	if _, err := utils.InitMongo(); err != nil {
-		panic(err)
+	mongoClient, err := utils.InitMongo()
+	if err != nil {
+		return fmt.Errorf("初始化 MongoDB 失败: %w", err)
 	}
+	defer utils.CloseMongo()
 
 	mark_repo := repo.NewMarkRepo(db)
 	mark_pair_repo := repo.NewMarkPairRepo(db)
@@ -39,13 +60,70 @@ func main() {
 	mark_service := service.NewMarkService(mark_repo)
 	mark_pair_service := service.NewMarkPairService(mark_pair_repo, mark_repo)
 	mongoService := service.NewMongoService(deviceLocRepo)
+	mongoService.Start()
+	defer mongoService.Stop()
+	// 实时推送：位置 / 上下线 / 报警事件扇出给 SSE 连接
+	streamHub := service.NewStreamHub(mark_service)
+	defer streamHub.Close()
+	streamHandler := handler.NewStreamHandler(streamHub)
+	healthHandler := handler.NewHealthHandler(db, mongoClient)
+
+	if err := utils.InitMQTT(); err != nil {
+		return err
+	}
+	defer utils.CloseMQTT(mqttQuiesceMs)
 	c := utils.MQTTClient
-	mqttCallback := client.NewMqttCallback(c, mark_service, mark_pair_service, mongoService)
+	mqttCallback := client.NewMqttCallback(c, mark_service, mark_pair_service, mongoService, streamHub)
+	defer mqttCallback.Close()
 
-	mqttCallback.MustSubscribe()
+	// 设备影子：上线时补发未生效的配置
+	shadowService := service.NewShadowService(c, repo.NewShadowRepo(utils.ShadowColl()), mark_service)
+	shadowService.Start()
+	defer shadowService.Stop()
+	mqttCallback.AddOnlineHook(shadowService.OnOnline)
+	shadowHandler := handler.NewShadowHandler(shadowService)
+
+	if err := mqttCallback.Subscribe(); err != nil {
+		return err
+	}
+	if err := utils.SubscribeMQTT(utils.SharedTopic(service.ShadowReportedPattern), 1, shadowService.OnReported); err != nil {
+		return err
+	}
+	// 标记自定义主题：启动时同步一次，之后周期比对
+	topicManager := client.NewTopicManager(mqttCallback,
+		time.Duration(utils.GetEnvInt("MQTT_TOPIC_SYNC_SECOND", 30))*time.Second)
+	topicManager.Start()
+	defer topicManager.Stop()
+	topicHandler := handler.NewTopicHandler(topicManager)
 	mqttService := service.NewMqttService(c)
+
+	// 多副本协调：指令跟踪按副本归属，OTA 分批推进只由租约持有者执行
+	instance := utils.InstanceID()
+	leaseRepo := repo.NewLeaseRepo(db)
+
+	// 下行指令：cmd/<device_id> 下发，cmd-ack/<device_id> 回执
+	commandService := service.NewCommandService(c, repo.NewCommandRepo(utils.CommandColl()), leaseRepo, instance)
+	commandService.Start()
+	defer commandService.Stop()
+	// 回执须由跟踪该指令的副本处理（在途指令只在其内存中），不使用共享订阅
+	if err := utils.SubscribeMQTT(service.CmdAckTopicPrefix+"#", 1, commandService.OnAck); err != nil {
+		return err
+	}
+	commandHandler := handler.NewCommandHandler(commandService)
+
+	// 固件 OTA：ota/<device_id> 通知，ota-progress/<device_id> 进度
+	otaService := service.NewOTAService(c, repo.NewOTARepo(db), leaseRepo, instance, utils.GetEnv("OTA_BASE_URL", "http://localhost:8000"))
+	otaService.Start()
+	defer otaService.Stop()
+	if err := utils.SubscribeMQTT(service.OTAProgressTopicPrefix+"#", 1, otaService.OnProgress); err != nil {
+		return err
+	}
+	otaHandler := handler.NewOTAHandler(otaService)
 	mqttHandler := handler.NewMqttService(mqttService)
-	mqttService.SendWarningStart("213")
+
+	// 围栏统计报表：历史定位回放，围栏判定调用 map-service
+	mapServiceURL := fmt.Sprintf("http://%s:%s", utils.GetEnv("MAP_SERVICE_HOST", "map-service"), utils.GetEnv("MAP_SERVICE_PORT", "8002"))
+	reportHandler := handler.NewReportHandler(service.NewReportService(deviceLocRepo, mark_repo, service.NewFenceClient(mapServiceURL)))
 
 	app := fiber.New(fiber.Config{
 		Prefork:            false,
@@ -56,9 +134,14 @@ func main() {
 		ErrorHandler:       handler.CustomErrorHandler,
 		JSONEncoder:        json.Marshal,
 		JSONDecoder:        json.Unmarshal,
+		BodyLimit:          utils.GetEnvInt("OTA_MAX_FIRMWARE_MB", 64) * 1024 * 1024, // 固件上传
 	})
 
 	// 2. 挂路由
+	app.Get("/health", healthHandler.Live)
+	app.Get("/health/live", healthHandler.Live)
+	app.Get("/health/ready", healthHandler.Ready)
+
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
 	mqtt := v1.Group("/mqtt")
@@ -67,6 +150,41 @@ func main() {
 
 	mqtt.Post("/warning/:deviceId/end", mqttHandler.SendWarningEnd)
 
+	mqtt.Get("/topics", topicHandler.ListTopics)
+	mqtt.Post("/topics/refresh", topicHandler.RefreshTopics)
+
+	mqtt.Get("/stream", streamHandler.Stream)
+
+	mqtt.Post("/devices/:deviceId/commands", commandHandler.SendCommand)
+	mqtt.Get("/devices/:deviceId/commands", commandHandler.ListDeviceCommands)
+	mqtt.Get("/commands", commandHandler.ListCommands)
+	mqtt.Get("/commands/:id", commandHandler.GetCommand)
+	mqtt.Post("/commands/:id/cancel", commandHandler.CancelCommand)
+
+	mqtt.Get("/shadows/:deviceId", shadowHandler.GetShadow)
+	mqtt.Put("/shadows/:deviceId/desired", shadowHandler.ReplaceDesired)
+	mqtt.Patch("/shadows/:deviceId/desired", shadowHandler.PatchDesired)
+
+	reports := mqtt.Group("/reports")
+	reports.Get("/occupancy", reportHandler.Occupancy)
+	reports.Get("/traffic", reportHandler.Traffic)
+	reports.Get("/dwell", reportHandler.Dwell)
+	reports.Get("/peak", reportHandler.Peak)
+
+	// 固件文件下载（设备使用通知中的 url）
+	app.Static(service.FirmwareRoute, "./"+service.FirmwareDir)
+	ota := mqtt.Group("/ota")
+	ota.Post("/firmwares", otaHandler.UploadFirmware)
+	ota.Get("/firmwares", otaHandler.ListFirmwares)
+	ota.Get("/firmwares/:id", otaHandler.GetFirmware)
+	ota.Delete("/firmwares/:id", otaHandler.DeleteFirmware)
+	ota.Post("/campaigns", otaHandler.CreateCampaign)
+	ota.Get("/campaigns", otaHandler.ListCampaigns)
+	ota.Get("/campaigns/:id", otaHandler.GetCampaign)
+	ota.Get("/campaigns/:id/devices", otaHandler.ListCampaignDevices)
+	ota.Post("/campaigns/:id/start", otaHandler.StartCampaign)
+	ota.Post("/campaigns/:id/abort", otaHandler.AbortCampaign)
+
 	// 3. 打印路由（必须放在 Listen 之前）
 	app.Stack() // 或者 app.GetRoutes(true)
 	for _, routes := range app.Stack() {
@@ -76,7 +194,24 @@ func main() {
 	}
 
 	port := utils.GetEnv("PORT", "8003")
-	if err := app.Listen(":" + port); err != nil {
-		log.Fatalf("启动 HTTP 服务失败: %v", err)
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- app.Listen(":" + port) }()
+
+	select {
+	case err := <-listenErr:
+		return fmt.Errorf("启动 HTTP 服务失败: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("[INFO] 收到退出信号，开始优雅关闭")
+	healthHandler.Drain()
+	// 1. 断开 MQTT：不再接收消息，等待处理中的回调结束（会话按固定 ClientID 保留，重启前的 QoS 1 消息由 broker 暂存）
+	utils.CloseMQTT(mqttQuiesceMs)
+	// 2. 关闭 SSE 连接后停止 HTTP，否则长连接会拖满超时
+	streamHub.Close()
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		log.Printf("[WARN] HTTP 服务关闭超时: %v", err)
 	}
+	// 3. 其余组件按 defer 逆序关闭：后台任务 → 位置写缓冲 → MongoDB → Postgres
+	return nil
 }
@@ -0,0 +1,71 @@
+package model
+
+import "time"
+
+// 下行指令状态
+const (
+	CmdPending  = "pending"  // 已创建，尚未成功发布
+	CmdSent     = "sent"     // 已发布到 cmd/<device_id>，等待回执
+	CmdAcked    = "acked"    // 设备回执成功
+	CmdFailed   = "failed"   // 设备回执失败，或发布失败且重试耗尽
+	CmdTimeout  = "timeout"  // 重试耗尽仍未收到回执
+	CmdCanceled = "canceled" // 等待回执期间被取消
+)
+
+// DeviceCommand 下行指令及其投递记录，存储在 Mongo device_cmd 集合
+type DeviceCommand struct {
+	ID            string         `bson:"_id" json:"id"` // 指令 ID，随指令下发，设备回执时原样带回
+	DeviceID      string         `bson:"device_id" json:"device_id"`
+	Name          string         `bson:"name" json:"name"`
+	Params        map[string]any `bson:"params,omitempty" json:"params,omitempty"`
+	Status        string         `bson:"status" json:"status"`
+	Attempts      int            `bson:"attempts" json:"attempts"`             // 已发布次数
+	MaxRetries    int            `bson:"max_retries" json:"max_retries"`       // 超时后最多重发次数
+	TimeoutSecond int            `bson:"timeout_second" json:"timeout_second"` // 每次发布后等待回执的时间
+	Result        map[string]any `bson:"result,omitempty" json:"result,omitempty"`
+	Error         string         `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy     string         `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt     time.Time      `bson:"created_at" json:"created_at"`
+	SentAt        *time.Time     `bson:"sent_at,omitempty" json:"sent_at,omitempty"` // 最近一次发布时间
+	AckedAt       *time.Time     `bson:"acked_at,omitempty" json:"acked_at,omitempty"`
+	UpdatedAt     time.Time      `bson:"updated_at" json:"updated_at"`
+	Owner         string         `bson:"owner,omitempty" json:"-"` // 跟踪该指令（重发 / 超时判定）的副本
+}
+
+// Finished 是否已结束（不再重发）
+func (c *DeviceCommand) Finished() bool {
+	return c.Status != CmdPending && c.Status != CmdSent
+}
+
+// CmdMsg 发布到 cmd/<device_id> 的载荷
+type CmdMsg struct {
+	CmdID  string         `json:"cmd_id"`
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params,omitempty"`
+	TS     int64          `json:"ts"` // 发布时间（毫秒）
+}
+
+// CmdAckMsg 设备在 cmd-ack/<device_id> 上回执的载荷
+type CmdAckMsg struct {
+	CmdID  string         `json:"cmd_id"`
+	Status string         `json:"status"` // ok / error
+	Result map[string]any `json:"result,omitempty"`
+	Msg    string         `json:"msg,omitempty"`
+}
+
+// SendCommandReq 下发指令请求
+type SendCommandReq struct {
+	Name          string         `json:"name"`
+	Params        map[string]any `json:"params"`
+	TimeoutSecond int            `json:"timeout_second"` // 默认 10，最大 300
+	MaxRetries    *int           `json:"max_retries"`    // 默认 2，最大 10
+}
+
+// CommandQuery 指令历史查询条件
+type CommandQuery struct {
+	DeviceID string
+	Status   string
+	Name     string
+	Page     int
+	Limit    int
+}
@@ -11,9 +11,12 @@ type DeviceLoc struct {
 	DeviceID   string             `bson:"device_id" json:"id"`
 	Latitude   *float64           `bson:"latitude,omitempty" json:"lat,omitempty"`
 	Longitude  *float64           `bson:"longitude,omitempty" json:"lon,omitempty"`
+	LonLat     bool               `bson:"lonlat,omitempty" json:"-"`              // 经纬度已按 RTK v=[经度, 纬度] 写入；早期记录缺少该标记，两列是对调的
 	UWBX       *float64           `bson:"uwb_x,omitempty" json:"uwb_x,omitempty"` // 局部坐标系 X
 	UWBY       *float64           `bson:"uwb_y,omitempty" json:"uwb_y,omitempty"`
 	Speed      *float64           `bson:"speed,omitempty" json:"speed,omitempty"`
+	Telemetry  map[string]any     `bson:"telemetry,omitempty" json:"telemetry,omitempty"` // 非定位类传感器读数
+	MapID      string             `bson:"map_id,omitempty" json:"map,omitempty"`          // 上报携带的自制地图（楼层）ID
 	RecordTime time.Time          `bson:"record_time" json:"record_time"`
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
 }
@@ -24,13 +27,36 @@ func (d *DeviceLoc) SetID() {
 	}
 }
 
+// SetRTK 按 RTK 读数 v=[经度, 纬度] 填写经纬度
+func (d *DeviceLoc) SetRTK(v []float64) {
+	lon, lat := v[0], v[1]
+	d.Longitude, d.Latitude = &lon, &lat
+	d.LonLat = true
+}
+
+// StoredLonLat 读取库中记录的经纬度：早期记录把 v[0]（经度）存进了 latitude，没有 LonLat 标记时对调回来
+func (d *DeviceLoc) StoredLonLat() (lon, lat float64, ok bool) {
+	if d.Latitude == nil || d.Longitude == nil {
+		return 0, 0, false
+	}
+	if d.LonLat {
+		return *d.Longitude, *d.Latitude, true
+	}
+	return *d.Latitude, *d.Longitude, true
+}
+
 type LocMsg struct {
-	ID   string `json:"id"`
-	Sens []Sens `json:"sens"`
+	ID   string     `json:"id"`
+	Sens []Sens     `json:"sens"`
+	Time *time.Time `json:"-"`             // 设备侧采样时间，仅 SenML 等携带时间的格式会填充
+	Seq  *uint64    `json:"seq,omitempty"` // 设备侧递增序号（可选），用于去重与乱序判定
+	Map  string     `json:"map,omitempty"` // 设备所在的自制地图（楼层）ID（可选），缺省时使用设备被分配的地图
 }
 
 type Sens struct {
-	N string    `json:"n"` // 传感器名称
-	U string    `json:"u"` // 单位
-	V []float64 `json:"v"` // 数值数组
+	N  string    `json:"n"`            // 传感器名称
+	U  string    `json:"u"`            // 单位
+	V  []float64 `json:"v"`            // 数值数组
+	VS *string   `json:"vs,omitempty"` // 字符串值（SenML vs）
+	VB *bool     `json:"vb,omitempty"` // 布尔值（SenML vb）
 }
@@ -10,9 +10,11 @@ import (
 
 // MarkType 标记类型表：同一类型下可拥有多条 Mark 记录。
 type MarkType struct {
-	ID                   int      `gorm:"primaryKey;autoIncrement;column:id"`        // ID：主键，自增
-	TypeName             string   `gorm:"unique;size:255;not null;column:type_name"` // TypeName：类型名称，全局唯一
-	DefaultSafeDistanceM *float64 `gorm:"column:default_safe_distance_m;default:-1"` // DefaultSafeDistanceM：该类型下默认安全距离（米），-1 表示未设置
+	ID                   int      `gorm:"primaryKey;autoIncrement;column:id"`                       // ID：主键，自增
+	TypeName             string   `gorm:"unique;size:255;not null;column:type_name"`                // TypeName：类型名称，全局唯一
+	DefaultSafeDistanceM *float64 `gorm:"column:default_safe_distance_m;default:-1"`                // DefaultSafeDistanceM：该类型下默认安全距离（米），-1 表示未设置
+	PayloadDecoder       string   `gorm:"size:64;not null;default:'legacy';column:payload_decoder"` // PayloadDecoder：该类型设备上报载荷使用的解码器
+	DecoderConfig        []byte   `gorm:"type:jsonb;column:decoder_config"`                         // DecoderConfig：解码器参数（JSON）
 
 	// 一对多关联：删除类型时被关联的 Mark 受外键 RESTRICT 保护。
 	Marks []Mark `gorm:"foreignKey:MarkTypeID;references:ID"`
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// OTA 任务状态
+const (
+	OTACampaignDraft     = "draft"
+	OTACampaignRunning   = "running"
+	OTACampaignCompleted = "completed"
+	OTACampaignAborted   = "aborted"
+)
+
+// OTA 设备状态，downloading / installing / succeeded / failed 由设备上报
+const (
+	OTADeviceQueued      = "queued"
+	OTADeviceNotified    = "notified"
+	OTADeviceDownloading = "downloading"
+	OTADeviceInstalling  = "installing"
+	OTADeviceSucceeded   = "succeeded"
+	OTADeviceFailed      = "failed"
+	OTADeviceAborted     = "aborted"
+)
+
+// OTADeviceActive 已推送、尚未结束的设备状态
+var OTADeviceActive = []string{OTADeviceNotified, OTADeviceDownloading, OTADeviceInstalling}
+
+// Firmware 固件包：文件保存在 uploads/firmware，下载地址由 OTA_BASE_URL 拼接
+type Firmware struct {
+	ID        uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid();column:id" json:"id"`
+	Name      string    `gorm:"size:255;not null;column:name" json:"name"`      // Name：固件名称，通常对应硬件型号
+	Version   string    `gorm:"size:64;not null;column:version" json:"version"` // Version：版本号，与 Name 联合唯一
+	FilePath  string    `gorm:"size:512;not null;column:file_path" json:"-"`    // FilePath：相对路径 uploads/firmware/<file>
+	FileSize  int64     `gorm:"not null;column:file_size" json:"file_size"`     // FileSize：字节数
+	SHA256    string    `gorm:"size:64;not null;column:sha256" json:"sha256"`   // SHA256：十六进制校验和，随通知下发
+	Notes     string    `gorm:"not null;default:'';column:notes" json:"notes"`  // Notes：更新说明
+	CreatedBy string    `gorm:"size:255;not null;default:'';column:created_by" json:"created_by"`
+	CreatedAt time.Time `gorm:"not null;default:now();column:created_at" json:"created_at"`
+	URL       string    `gorm:"-" json:"url"` // URL：设备下载地址，查询时填充
+}
+
+func (Firmware) TableName() string { return "firmwares" }
+
+// OTACampaign 升级任务：按类型 / 标签 / 设备圈定目标（取并集），按 batch_size 分批推送
+type OTACampaign struct {
+	ID                 uuid.UUID      `gorm:"primaryKey;type:uuid;default:gen_random_uuid();column:id" json:"id"`
+	Name               string         `gorm:"size:255;not null;column:name" json:"name"`
+	FirmwareID         uuid.UUID      `gorm:"type:uuid;not null;column:firmware_id" json:"firmware_id"`
+	TargetTypeIDs      pq.Int64Array  `gorm:"type:integer[];not null;default:'{}';column:target_type_ids" json:"target_type_ids"`
+	TargetTagIDs       pq.Int64Array  `gorm:"type:integer[];not null;default:'{}';column:target_tag_ids" json:"target_tag_ids"`
+	TargetDeviceIDs    pq.StringArray `gorm:"type:text[];not null;default:'{}';column:target_device_ids" json:"target_device_ids"`
+	BatchSize          int            `gorm:"not null;default:10;column:batch_size" json:"batch_size"`                       // BatchSize：每批设备数
+	StageTimeoutSecond int            `gorm:"not null;default:1800;column:stage_timeout_second" json:"stage_timeout_second"` // StageTimeoutSecond：单批最长等待，超时未完成的设备记为失败
+	MaxFailureRatio    float64        `gorm:"not null;default:0.2;column:max_failure_ratio" json:"max_failure_ratio"`        // MaxFailureRatio：单批失败率超过该值时自动中止
+	Status             string         `gorm:"size:32;not null;default:'draft';column:status" json:"status"`
+	CurrentStage       int            `gorm:"not null;default:0;column:current_stage" json:"current_stage"` // CurrentStage：当前批次，从 1 开始，0 表示未开始
+	StageStartedAt     *time.Time     `gorm:"column:stage_started_at" json:"stage_started_at,omitempty"`
+	Reason             string         `gorm:"not null;default:'';column:reason" json:"reason,omitempty"` // Reason：中止原因
+	CreatedBy          string         `gorm:"size:255;not null;default:'';column:created_by" json:"created_by"`
+	CreatedAt          time.Time      `gorm:"not null;default:now();column:created_at" json:"created_at"`
+	StartedAt          *time.Time     `gorm:"column:started_at" json:"started_at,omitempty"`
+	FinishedAt         *time.Time     `gorm:"column:finished_at" json:"finished_at,omitempty"`
+
+	Firmware *Firmware        `gorm:"foreignKey:FirmwareID;references:ID" json:"firmware,omitempty"`
+	Counts   map[string]int64 `gorm:"-" json:"counts,omitempty"` // Counts：各状态设备数，查询时填充
+}
+
+func (OTACampaign) TableName() string { return "ota_campaigns" }
+
+// OTACampaignDevice 任务内单台设备的进度
+type OTACampaignDevice struct {
+	CampaignID uuid.UUID  `gorm:"primaryKey;type:uuid;column:campaign_id" json:"campaign_id"`
+	DeviceID   string     `gorm:"primaryKey;size:255;column:device_id" json:"device_id"`
+	Stage      int        `gorm:"not null;default:0;column:stage" json:"stage"` // Stage：所属批次，0 表示尚未分批
+	Status     string     `gorm:"size:32;not null;default:'queued';column:status" json:"status"`
+	Progress   int        `gorm:"not null;default:0;column:progress" json:"progress"` // Progress：0-100
+	Message    string     `gorm:"not null;default:'';column:message" json:"message,omitempty"`
+	NotifiedAt *time.Time `gorm:"column:notified_at" json:"notified_at,omitempty"`
+	UpdatedAt  time.Time  `gorm:"not null;default:now();column:updated_at" json:"updated_at"`
+}
+
+func (OTACampaignDevice) TableName() string { return "ota_campaign_devices" }
+
+// Finished 设备是否已结束
+func (d *OTACampaignDevice) Finished() bool {
+	return d.Status == OTADeviceSucceeded || d.Status == OTADeviceFailed || d.Status == OTADeviceAborted
+}
+
+// CreateCampaignReq 创建升级任务
+type CreateCampaignReq struct {
+	Name               string   `json:"name"`
+	FirmwareID         string   `json:"firmware_id"`
+	TypeIDs            []int64  `json:"type_ids"`
+	TagIDs             []int64  `json:"tag_ids"`
+	DeviceIDs          []string `json:"device_ids"`
+	BatchSize          int      `json:"batch_size"`           // 默认 10
+	StageTimeoutSecond int      `json:"stage_timeout_second"` // 默认 1800
+	MaxFailureRatio    *float64 `json:"max_failure_ratio"`    // 默认 0.2，取值 0~1
+}
+
+// OTANotifyMsg 发布到 ota/<device_id> 的载荷；action 为 abort 时只带 campaign_id
+type OTANotifyMsg struct {
+	Action     string `json:"action"` // upgrade / abort
+	CampaignID string `json:"campaign_id"`
+	FirmwareID string `json:"firmware_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	URL        string `json:"url,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// OTAProgressMsg 设备在 ota-progress/<device_id> 上报的进度
+type OTAProgressMsg struct {
+	CampaignID string `json:"campaign_id"`
+	Status     string `json:"status"`   // downloading / installing / succeeded / failed
+	Progress   int    `json:"progress"` // 0-100
+	Msg        string `json:"msg"`
+}
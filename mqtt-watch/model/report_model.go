@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// ReportQuery 围栏统计的时间范围与设备过滤
+type ReportQuery struct {
+	From      time.Time
+	To        time.Time
+	DeviceIDs []string      // 为空时统计全部设备
+	Gap       time.Duration // 相邻两次定位间隔超过该值视为信号丢失，按最后一次定位时间离开围栏
+}
+
+// FencePoint 参与围栏判定的一次定位；室外点 X 为经度、Y 为纬度
+type FencePoint struct {
+	DeviceID string  `json:"device_id"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Indoor   bool    `json:"indoor"`
+	MapID    string  `json:"map_id,omitempty"`
+}
+
+// FenceHit 点命中的围栏
+type FenceHit struct {
+	FenceID   string `json:"fence_id"`
+	FenceName string `json:"fence_name"`
+}
+
+// FenceOccupancy 围栏当前人数（最近一次定位在围栏内的设备）
+type FenceOccupancy struct {
+	FenceID   string   `json:"fence_id"`
+	FenceName string   `json:"fence_name"`
+	Count     int      `json:"count"`
+	DeviceIDs []string `json:"device_ids"`
+}
+
+// FenceTraffic 围栏在时间范围内的进出次数
+type FenceTraffic struct {
+	FenceID   string `json:"fence_id"`
+	FenceName string `json:"fence_name"`
+	Entries   int    `json:"entries"`
+	Exits     int    `json:"exits"`
+}
+
+// FenceDwell 设备在围栏内的累计停留时间
+type FenceDwell struct {
+	FenceID      string  `json:"fence_id"`
+	FenceName    string  `json:"fence_name"`
+	DeviceID     string  `json:"device_id"`
+	Visits       int     `json:"visits"`
+	DwellSeconds float64 `json:"dwell_seconds"`
+}
+
+// FencePeak 围栏在时间范围内的最高同时人数，PeakAt 为首次达到峰值的时间
+type FencePeak struct {
+	FenceID   string     `json:"fence_id"`
+	FenceName string     `json:"fence_name"`
+	Peak      int        `json:"peak"`
+	PeakAt    *time.Time `json:"peak_at"`
+}
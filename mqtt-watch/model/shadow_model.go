@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// DeviceShadow 设备影子：desired 为平台期望的配置，reported 为设备实际生效的配置，
+// 存储在 Mongo device_shadow 集合，以 device_id 为主键
+type DeviceShadow struct {
+	DeviceID   string         `bson:"_id" json:"device_id"`
+	Desired    map[string]any `bson:"desired" json:"desired"`
+	Reported   map[string]any `bson:"reported" json:"reported"`
+	Version    int64          `bson:"version" json:"version"` // desired 每次修改 +1，随 delta 下发
+	DesiredAt  *time.Time     `bson:"desired_at,omitempty" json:"desired_at,omitempty"`
+	ReportedAt *time.Time     `bson:"reported_at,omitempty" json:"reported_at,omitempty"`
+	DeltaAt    *time.Time     `bson:"delta_at,omitempty" json:"delta_at,omitempty"` // 最近一次下发 delta 的时间
+	Rev        int64          `bson:"rev" json:"-"`                                 // 文档修订号，每次写入 +1，作为多副本并发写的条件
+}
+
+// ShadowView 接口返回的影子，附带当前差异
+type ShadowView struct {
+	DeviceShadow
+	Delta  map[string]any `json:"delta"`
+	InSync bool           `json:"in_sync"`
+}
+
+// ShadowDesiredReq 修改期望配置；version 不为空时作为乐观锁，与当前版本不一致返回 409
+type ShadowDesiredReq struct {
+	State   map[string]any `json:"state"`
+	Version *int64         `json:"version"`
+}
+
+// ShadowDeltaMsg 发布到 shadow/<device_id>/delta 的载荷
+type ShadowDeltaMsg struct {
+	Version int64          `json:"version"`
+	State   map[string]any `json:"state"`
+	TS      int64          `json:"ts"` // 发布时间（毫秒）
+}
+
+// ShadowReportedMsg 设备在 shadow/<device_id>/reported 上报的载荷，state 按 JSON Merge Patch 合并
+type ShadowReportedMsg struct {
+	State map[string]any `json:"state"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 实时推送事件类型
+const (
+	StreamPosition = "position" // 设备位置
+	StreamPresence = "presence" // 上下线（warning-service 发布的 presence/<id>）
+	StreamAlarm    = "alarm"    // 报警（alarm/<id> 与 warning/<id>）
+)
+
+// StreamEvent 推送给前端的一条实时事件
+type StreamEvent struct {
+	Type     string    `json:"type"`
+	DeviceID string    `json:"device_id"`
+	At       time.Time `json:"at"`
+	Data     any       `json:"data"`
+}
+
+// MarkMeta 推送过滤所需的标记信息
+type MarkMeta struct {
+	TypeID   int
+	TypeName string
+	TagIDs   []int
+	TagNames []string
+}
@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// mongoOpTimeout 单次 Mongo 操作超时
+const mongoOpTimeout = 5 * time.Second
+
+// ErrCommandChanged 指令已被其他副本接管或取消，当前副本不应再写入
+var ErrCommandChanged = errors.New("指令已被其他副本接管或已结束")
+
+// unfinishedStatus 未结束的指令状态
+var unfinishedStatus = []string{model.CmdPending, model.CmdSent}
+
+type CommandRepo interface {
+	Create(cmd *model.DeviceCommand) error
+	Update(cmd *model.DeviceCommand, from ...string) error
+	Get(id string) (*model.DeviceCommand, error)
+	List(q model.CommandQuery) ([]model.DeviceCommand, int64, error)
+	ListUnfinished() ([]model.DeviceCommand, error)
+	Claim(id, from, to string) (bool, error)
+	Cancel(id string, now time.Time) (bool, error)
+}
+
+type commandRepo struct {
+	coll *mongo.Collection
+}
+
+func NewCommandRepo(coll *mongo.Collection) CommandRepo {
+	r := &commandRepo{coll: coll}
+	r.ensureIndexes()
+	return r
+}
+
+func (r *commandRepo) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	_, _ = r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+}
+
+func (r *commandRepo) Create(cmd *model.DeviceCommand) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	_, err := r.coll.InsertOne(ctx, cmd)
+	return err
+}
+
+// Update 仅当指令仍归 cmd.Owner 跟踪、且库中状态仍为 from 之一时整体写入，否则返回 ErrCommandChanged
+func (r *commandRepo) Update(cmd *model.DeviceCommand, from ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	res, err := r.coll.ReplaceOne(ctx, bson.M{"_id": cmd.ID, "owner": cmd.Owner, "status": bson.M{"$in": from}}, cmd)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrCommandChanged
+	}
+	return nil
+}
+
+// Claim 把未结束指令的跟踪者由 from 改为 to；from 为空表示早期没有归属的记录。
+// 多个副本同时接管同一条指令时只有一个成功
+func (r *commandRepo) Claim(id, from, to string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	filter := bson.M{"_id": id, "status": bson.M{"$in": unfinishedStatus}, "owner": from}
+	if from == "" {
+		filter["owner"] = bson.M{"$in": bson.A{nil, ""}}
+	}
+	res, err := r.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"owner": to}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// Cancel 直接在库中取消未结束的指令，用于取消由其他副本跟踪的指令；
+// 跟踪副本随后的写入因状态不符失败，从而停止重发
+func (r *commandRepo) Cancel(id string, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": unfinishedStatus}},
+		bson.M{"$set": bson.M{"status": model.CmdCanceled, "updated_at": now}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// Get 不存在时返回 nil, nil
+func (r *commandRepo) Get(id string) (*model.DeviceCommand, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	var cmd model.DeviceCommand
+	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&cmd)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// List 按创建时间倒序分页
+func (r *commandRepo) List(q model.CommandQuery) ([]model.DeviceCommand, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if q.DeviceID != "" {
+		filter["device_id"] = q.DeviceID
+	}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	if q.Name != "" {
+		filter["name"] = q.Name
+	}
+
+	total, err := r.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((q.Page - 1) * q.Limit)).
+		SetLimit(int64(q.Limit))
+	cur, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	list := make([]model.DeviceCommand, 0, q.Limit)
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// ListUnfinished 未结束的指令，用于接管重启前或已失联副本的重发 / 超时判定
+func (r *commandRepo) ListUnfinished() ([]model.DeviceCommand, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	cur, err := r.coll.Find(ctx, bson.M{"status": bson.M{"$in": unfinishedStatus}})
+	if err != nil {
+		return nil, err
+	}
+	var list []model.DeviceCommand
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
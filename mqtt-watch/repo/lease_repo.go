@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LeaseRepo service_leases 租约表：同名租约同一时刻只有一个持有者，过期后可被接管
+type LeaseRepo interface {
+	// Acquire 租约空闲、已过期或本就由 holder 持有时占用 ttl，返回是否持有
+	Acquire(name, holder string, ttl time.Duration) (bool, error)
+	// Release 只释放 holder 自己持有的租约
+	Release(name, holder string) error
+	// Alive names 中尚未过期的租约
+	Alive(names []string) (map[string]bool, error)
+}
+
+type leaseRepo struct {
+	db *gorm.DB
+}
+
+func NewLeaseRepo(db *gorm.DB) LeaseRepo {
+	return &leaseRepo{db: db}
+}
+
+// Acquire 以数据库时间判断过期，不依赖各副本的时钟
+func (r *leaseRepo) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	var held []string
+	err := r.db.Raw(`
+		INSERT INTO service_leases (name, holder, expires_at)
+		VALUES (?, ?, now() + make_interval(secs => ?))
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE service_leases.holder = EXCLUDED.holder OR service_leases.expires_at < now()
+		RETURNING holder
+	`, name, holder, ttl.Seconds()).Scan(&held).Error
+	return len(held) == 1, err
+}
+
+func (r *leaseRepo) Release(name, holder string) error {
+	return r.db.Exec(`DELETE FROM service_leases WHERE name = ? AND holder = ?`, name, holder).Error
+}
+
+func (r *leaseRepo) Alive(names []string) (map[string]bool, error) {
+	alive := make(map[string]bool, len(names))
+	if len(names) == 0 {
+		return alive, nil
+	}
+	var list []string
+	if err := r.db.Raw(`SELECT name FROM service_leases WHERE name IN ? AND expires_at >= now()`, names).
+		Scan(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, n := range list {
+		alive[n] = true
+	}
+	return alive, nil
+}
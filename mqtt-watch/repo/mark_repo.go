@@ -10,6 +10,10 @@ import (
 type MarkRepo interface {
 	GetPersistMQTTByDeviceID(deviceID string) (bool, error)
 	GetDeviceIDsByPersistMQTT(persist bool) ([]string, error)
+	GetDecoderByDeviceID(deviceID string) (string, []byte, error)
+	GetMqttTopics() (map[string][]string, error)
+	GetMarkMeta(deviceID string) (*model.MarkMeta, error)
+	GetMapIDs() (map[string]string, error)
 }
 
 type markRepo struct {
@@ -61,3 +65,93 @@ func (r *markRepo) GetDeviceIDsByPersistMQTT(persist bool) ([]string, error) {
 
 	return deviceIDs, nil
 }
+
+// GetDecoderByDeviceID 查询设备所属类型配置的载荷解码器及参数
+// 如果设备不存在，返回空串, nil
+func (r *markRepo) GetDecoderByDeviceID(deviceID string) (string, []byte, error) {
+	var row struct {
+		PayloadDecoder string
+		DecoderConfig  []byte
+	}
+
+	result := r.db.Table("marks").
+		Select("mark_types.payload_decoder, mark_types.decoder_config").
+		Joins("JOIN mark_types ON mark_types.id = marks.mark_type_id").
+		Where("marks.device_id = ?", deviceID).
+		Limit(1).
+		Scan(&row)
+
+	if result.Error != nil {
+		return "", nil, result.Error
+	}
+	return row.PayloadDecoder, row.DecoderConfig, nil
+}
+
+// GetMqttTopics 查询所有配置了自定义主题的标记，返回 DeviceID -> 主题列表
+func (r *markRepo) GetMqttTopics() (map[string][]string, error) {
+	var rows []model.Mark
+
+	result := r.db.Model(&model.Mark{}).
+		Select("device_id", "mqtt_topic").
+		Where("cardinality(mqtt_topic) > 0").
+		Find(&rows)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	out := make(map[string][]string, len(rows))
+	for _, m := range rows {
+		out[m.DeviceID] = m.MqttTopic
+	}
+	return out, nil
+}
+
+// GetMarkMeta 查询设备所属类型与标签
+// 如果设备不存在，返回 nil, nil
+func (r *markRepo) GetMarkMeta(deviceID string) (*model.MarkMeta, error) {
+	var mark model.Mark
+
+	result := r.db.Model(&model.Mark{}).
+		Preload("MarkType").
+		Preload("Tags").
+		Where("device_id = ?", deviceID).
+		First(&mark)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	meta := &model.MarkMeta{TypeID: mark.MarkTypeID, TypeName: mark.MarkType.TypeName}
+	for _, t := range mark.Tags {
+		meta.TagIDs = append(meta.TagIDs, t.ID)
+		meta.TagNames = append(meta.TagNames, t.TagName)
+	}
+	return meta, nil
+}
+
+// GetMapIDs 查询已分配自制地图的设备，返回 DeviceID -> 地图 ID
+func (r *markRepo) GetMapIDs() (map[string]string, error) {
+	var rows []struct {
+		DeviceID string
+		MapID    string
+	}
+
+	result := r.db.Table("marks").
+		Select("device_id, map_id").
+		Where("map_id IS NOT NULL").
+		Scan(&rows)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	out := make(map[string]string, len(rows))
+	for _, row := range rows {
+		out[row.DeviceID] = row.MapID
+	}
+	return out, nil
+}
@@ -2,14 +2,26 @@ package repo
 
 import (
 	"context"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"IOT-Manage-System/mqtt-watch/model"
 )
 
+// reportScanTimeout 统计报表遍历历史定位的超时
+const reportScanTimeout = 5 * time.Minute
+
 type MongoRepo interface {
 	CreateLoc(loc model.DeviceLoc) error
+	// CreateLocs 批量写入，单条失败不影响其余记录
+	CreateLocs(locs []model.DeviceLoc) error
+	// EachLoc 按 record_time 升序遍历时间范围内的定位，fn 返回错误时中止
+	EachLoc(q model.ReportQuery, fn func(loc model.DeviceLoc) error) error
+	// LatestLocs 每台设备在 since 之后的最后一条定位
+	LatestLocs(since time.Time, deviceIDs []string) ([]model.DeviceLoc, error)
 }
 
 type mongoRepo struct {
@@ -17,9 +29,20 @@ type mongoRepo struct {
 }
 
 func NewMongoRepo(coll *mongo.Collection) MongoRepo {
-	return &mongoRepo{
+	r := &mongoRepo{
 		coll: coll,
 	}
+	r.ensureIndexes()
+	return r
+}
+
+func (r *mongoRepo) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	_, _ = r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "record_time", Value: 1}}},
+		{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "record_time", Value: -1}}},
+	})
 }
 
 func (r *mongoRepo) CreateLoc(loc model.DeviceLoc) error {
@@ -27,51 +50,70 @@ func (r *mongoRepo) CreateLoc(loc model.DeviceLoc) error {
 	return err
 }
 
-// var (
-// 	locBuffer   []model.DeviceLoc // 缓存
-// 	bufferMux   sync.Mutex        // 保护缓存
-// 	batchSize   = 200             // 多少条写一次
-// 	flushPeriod = 5 * time.Second // 最长多久写一次
-// 	coll        *mongo.Collection // mongo 集合
-// )
+func (r *mongoRepo) CreateLocs(locs []model.DeviceLoc) error {
+	if len(locs) == 0 {
+		return nil
+	}
+	docs := make([]any, len(locs))
+	for i := range locs {
+		docs[i] = locs[i]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := r.coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
 
-// func addBuffer(loc model.DeviceLoc) {
-// 	bufferMux.Lock()
-// 	locBuffer = append(locBuffer, loc)
-// 	needFlush := len(locBuffer) >= batchSize
-// 	bufferMux.Unlock()
+func (r *mongoRepo) EachLoc(q model.ReportQuery, fn func(loc model.DeviceLoc) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reportScanTimeout)
+	defer cancel()
 
-// 	if needFlush {
-// 		flush()
-// 	}
-// }
+	filter := bson.M{"record_time": bson.M{"$gte": q.From, "$lt": q.To}}
+	if len(q.DeviceIDs) > 0 {
+		filter["device_id"] = bson.M{"$in": q.DeviceIDs}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "record_time", Value: 1}}).
+		SetProjection(bson.M{"telemetry": 0})
+	cur, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
 
-// func flush() {
-// 	bufferMux.Lock()
-// 	if len(locBuffer) == 0 {
-// 		bufferMux.Unlock()
-// 		return
-// 	}
-// 	batch := make([]interface{}, len(locBuffer))
-// 	for i, v := range locBuffer {
-// 		batch[i] = v
-// 	}
-// 	locBuffer = locBuffer[:0] // 清空
-// 	bufferMux.Unlock()
+	for cur.Next(ctx) {
+		var loc model.DeviceLoc
+		if err := cur.Decode(&loc); err != nil {
+			return err
+		}
+		if err := fn(loc); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
 
-// 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-// 	defer cancel()
-// 	if _, err := coll.InsertMany(ctx, batch); err != nil {
-// 		log.Printf("[ERROR] insert many err: %v", err)
-// 		return
-// 	}
-// 	log.Printf("[INFO] 插入 %d 条定位", len(batch))
-// }
+func (r *mongoRepo) LatestLocs(since time.Time, deviceIDs []string) ([]model.DeviceLoc, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportScanTimeout)
+	defer cancel()
 
-// func timedFlush() {
-// 	ticker := time.NewTicker(flushPeriod)
-// 	defer ticker.Stop()
-// 	for range ticker.C {
-// 		flush()
-// 	}
-// }
+	match := bson.M{"record_time": bson.M{"$gte": since}}
+	if len(deviceIDs) > 0 {
+		match["device_id"] = bson.M{"$in": deviceIDs}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "device_id", Value: 1}, {Key: "record_time", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$device_id", "loc": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$loc"}}},
+	}
+	cur, err := r.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var list []model.DeviceLoc
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
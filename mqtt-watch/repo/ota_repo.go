@@ -0,0 +1,321 @@
+package repo
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+type OTARepo interface {
+	CreateFirmware(f *model.Firmware) error
+	GetFirmware(id uuid.UUID) (*model.Firmware, error)
+	ListFirmwares() ([]model.Firmware, error)
+	DeleteFirmware(id uuid.UUID) error
+	FirmwareInUse(id uuid.UUID) (bool, error)
+
+	ResolveTargets(typeIDs, tagIDs []int64, deviceIDs []string) ([]string, error)
+	CreateCampaign(c *model.OTACampaign, deviceIDs []string) error
+	GetCampaign(id uuid.UUID) (*model.OTACampaign, error)
+	ListCampaigns(status string, offset, limit int) ([]model.OTACampaign, int64, error)
+	ListRunningCampaigns() ([]model.OTACampaign, error)
+	StartCampaign(id uuid.UUID, now time.Time) (bool, error)
+	AdvanceStage(id uuid.UUID, stage, n int, now time.Time) (ids []string, ok bool, err error)
+	AbortCampaign(id uuid.UUID, reason string, now time.Time) (notified []string, ok bool, err error)
+
+	CountDevices(campaignID uuid.UUID) (map[string]int64, error)
+	ListDevices(campaignID uuid.UUID, status string, offset, limit int) ([]model.OTACampaignDevice, int64, error)
+	ListStageDevices(campaignID uuid.UUID, stage int) ([]model.OTACampaignDevice, error)
+	GetDevice(campaignID uuid.UUID, deviceID string) (*model.OTACampaignDevice, error)
+	SaveProgress(d *model.OTACampaignDevice, prevStatus string) (bool, error)
+	MarkDevices(campaignID uuid.UUID, stage int, from []string, to, msg string) ([]string, error)
+}
+
+type otaRepo struct {
+	db *gorm.DB
+}
+
+func NewOTARepo(db *gorm.DB) OTARepo {
+	return &otaRepo{db: db}
+}
+
+/* ---------- 固件 ---------- */
+
+func (r *otaRepo) CreateFirmware(f *model.Firmware) error {
+	return r.db.Create(f).Error
+}
+
+// GetFirmware 不存在时返回 nil, nil
+func (r *otaRepo) GetFirmware(id uuid.UUID) (*model.Firmware, error) {
+	var f model.Firmware
+	if err := r.db.First(&f, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *otaRepo) ListFirmwares() ([]model.Firmware, error) {
+	var list []model.Firmware
+	err := r.db.Order("created_at DESC").Find(&list).Error
+	return list, err
+}
+
+func (r *otaRepo) DeleteFirmware(id uuid.UUID) error {
+	return r.db.Delete(&model.Firmware{}, "id = ?", id).Error
+}
+
+// FirmwareInUse 是否被任何升级任务引用
+func (r *otaRepo) FirmwareInUse(id uuid.UUID) (bool, error) {
+	var n int64
+	err := r.db.Model(&model.OTACampaign{}).Where("firmware_id = ?", id).Count(&n).Error
+	return n > 0, err
+}
+
+/* ---------- 任务 ---------- */
+
+// ResolveTargets 按类型 / 标签 / 设备 ID 取并集，返回去重后的设备 ID
+func (r *otaRepo) ResolveTargets(typeIDs, tagIDs []int64, deviceIDs []string) ([]string, error) {
+	q := r.db.Table("marks").Distinct("marks.device_id").
+		Joins("LEFT JOIN mark_tag_relation ON mark_tag_relation.mark_id = marks.id")
+	cond := r.db.Where("1 = 0")
+	if len(typeIDs) > 0 {
+		cond = cond.Or("marks.mark_type_id IN ?", typeIDs)
+	}
+	if len(tagIDs) > 0 {
+		cond = cond.Or("mark_tag_relation.tag_id IN ?", tagIDs)
+	}
+	if len(deviceIDs) > 0 {
+		cond = cond.Or("marks.device_id IN ?", deviceIDs)
+	}
+
+	var ids []string
+	err := q.Where(cond).Order("marks.device_id").Pluck("marks.device_id", &ids).Error
+	return ids, err
+}
+
+// CreateCampaign 任务与设备清单在同一事务中写入
+func (r *otaRepo) CreateCampaign(c *model.OTACampaign, deviceIDs []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Firmware").Create(c).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		rows := make([]model.OTACampaignDevice, 0, len(deviceIDs))
+		for _, id := range deviceIDs {
+			rows = append(rows, model.OTACampaignDevice{
+				CampaignID: c.ID,
+				DeviceID:   id,
+				Status:     model.OTADeviceQueued,
+				UpdatedAt:  now,
+			})
+		}
+		return tx.CreateInBatches(rows, 500).Error
+	})
+}
+
+// GetCampaign 不存在时返回 nil, nil
+func (r *otaRepo) GetCampaign(id uuid.UUID) (*model.OTACampaign, error) {
+	var c model.OTACampaign
+	if err := r.db.Preload("Firmware").First(&c, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *otaRepo) ListCampaigns(status string, offset, limit int) ([]model.OTACampaign, int64, error) {
+	q := r.db.Model(&model.OTACampaign{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []model.OTACampaign
+	err := q.Preload("Firmware").Order("created_at DESC").Offset(offset).Limit(limit).Find(&list).Error
+	return list, total, err
+}
+
+func (r *otaRepo) ListRunningCampaigns() ([]model.OTACampaign, error) {
+	var list []model.OTACampaign
+	err := r.db.Preload("Firmware").Where("status = ?", model.OTACampaignRunning).Find(&list).Error
+	return list, err
+}
+
+// 任务状态只做条件更新：各副本持有的任务可能已过期，整行覆盖会把其他副本写入的中止改回运行中
+
+// StartCampaign 草稿任务改为运行中；任务已不是草稿时返回 false
+func (r *otaRepo) StartCampaign(id uuid.UUID, now time.Time) (bool, error) {
+	res := r.db.Model(&model.OTACampaign{}).
+		Where("id = ? AND status = ?", id, model.OTACampaignDraft).
+		Updates(map[string]any{"status": model.OTACampaignRunning, "started_at": now})
+	return res.RowsAffected > 0, res.Error
+}
+
+// AdvanceStage 锁定运行中的任务，认领下一批（第 stage 批）设备并推进批次；没有排队设备时任务完成。
+// 任务已不在运行中时返回 ok=false。认领与批次在同一事务中提交，与中止互斥
+func (r *otaRepo) AdvanceStage(id uuid.UUID, stage, n int, now time.Time) (ids []string, ok bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if ok, err = lockCampaign(tx, id, model.OTACampaignRunning); err != nil || !ok {
+			return err
+		}
+		if ids, err = (&otaRepo{db: tx}).assignStage(id, stage, n, now); err != nil {
+			return err
+		}
+		updates := map[string]any{"current_stage": stage, "stage_started_at": now}
+		if len(ids) == 0 {
+			updates = map[string]any{"status": model.OTACampaignCompleted, "finished_at": now}
+		}
+		return tx.Model(&model.OTACampaign{}).Where("id = ?", id).Updates(updates).Error
+	})
+	return ids, ok, err
+}
+
+// AbortCampaign 锁定草稿或运行中的任务，排队与已推送的设备记为中止，返回已推送的设备 ID；
+// 任务已结束时返回 ok=false
+func (r *otaRepo) AbortCampaign(id uuid.UUID, reason string, now time.Time) (notified []string, ok bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if ok, err = lockCampaign(tx, id, model.OTACampaignDraft, model.OTACampaignRunning); err != nil || !ok {
+			return err
+		}
+		txRepo := &otaRepo{db: tx}
+		if notified, err = txRepo.markDevices(id, -1, model.OTADeviceActive, model.OTADeviceAborted, reason); err != nil {
+			return err
+		}
+		if _, err = txRepo.markDevices(id, -1, []string{model.OTADeviceQueued}, model.OTADeviceAborted, reason); err != nil {
+			return err
+		}
+		return tx.Model(&model.OTACampaign{}).Where("id = ?", id).
+			Updates(map[string]any{"status": model.OTACampaignAborted, "reason": reason, "finished_at": now}).Error
+	})
+	return notified, ok, err
+}
+
+// lockCampaign 对状态属于 status 的任务加行锁，任务不存在或状态不符时返回 false
+func lockCampaign(tx *gorm.DB, id uuid.UUID, status ...string) (bool, error) {
+	var ids []uuid.UUID
+	err := tx.Raw(`SELECT id FROM ota_campaigns WHERE id = ? AND status IN ? FOR UPDATE`, id, status).Scan(&ids).Error
+	return len(ids) > 0, err
+}
+
+/* ---------- 设备进度 ---------- */
+
+func (r *otaRepo) CountDevices(campaignID uuid.UUID) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		N      int64
+	}
+	err := r.db.Model(&model.OTACampaignDevice{}).
+		Select("status, COUNT(*) AS n").
+		Where("campaign_id = ?", campaignID).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		out[row.Status] = row.N
+	}
+	return out, nil
+}
+
+func (r *otaRepo) ListDevices(campaignID uuid.UUID, status string, offset, limit int) ([]model.OTACampaignDevice, int64, error) {
+	q := r.db.Model(&model.OTACampaignDevice{}).Where("campaign_id = ?", campaignID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []model.OTACampaignDevice
+	err := q.Order("stage, device_id").Offset(offset).Limit(limit).Find(&list).Error
+	return list, total, err
+}
+
+func (r *otaRepo) ListStageDevices(campaignID uuid.UUID, stage int) ([]model.OTACampaignDevice, error) {
+	var list []model.OTACampaignDevice
+	err := r.db.Where("campaign_id = ? AND stage = ?", campaignID, stage).Find(&list).Error
+	return list, err
+}
+
+// assignStage 从排队设备中取 n 台划入第 stage 批并标记为已通知，返回设备 ID；
+// 用 FOR UPDATE SKIP LOCKED 认领，多副本同时推进时同一台设备不会被划入两批
+func (r *otaRepo) assignStage(campaignID uuid.UUID, stage, n int, now time.Time) ([]string, error) {
+	var ids []string
+	err := r.db.Raw(`
+		UPDATE ota_campaign_devices SET stage = ?, status = ?, notified_at = ?, updated_at = ?
+		WHERE campaign_id = ? AND device_id IN (
+			SELECT device_id FROM ota_campaign_devices
+			WHERE campaign_id = ? AND status = ? AND stage = 0
+			ORDER BY device_id LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING device_id
+	`, stage, model.OTADeviceNotified, now, now, campaignID, campaignID, model.OTADeviceQueued, n).Scan(&ids).Error
+	sort.Strings(ids)
+	return ids, err
+}
+
+// GetDevice 不存在时返回 nil, nil
+func (r *otaRepo) GetDevice(campaignID uuid.UUID, deviceID string) (*model.OTACampaignDevice, error) {
+	var d model.OTACampaignDevice
+	err := r.db.First(&d, "campaign_id = ? AND device_id = ?", campaignID, deviceID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// SaveProgress 写入设备进度：只在设备状态仍为 prevStatus 且任务仍在运行时生效，否则返回 false
+func (r *otaRepo) SaveProgress(d *model.OTACampaignDevice, prevStatus string) (bool, error) {
+	res := r.db.Model(&model.OTACampaignDevice{}).
+		Where("campaign_id = ? AND device_id = ? AND status = ?", d.CampaignID, d.DeviceID, prevStatus).
+		Where("EXISTS (SELECT 1 FROM ota_campaigns WHERE id = ? AND status = ?)", d.CampaignID, model.OTACampaignRunning).
+		Updates(map[string]any{"status": d.Status, "progress": d.Progress, "message": d.Message, "updated_at": d.UpdatedAt})
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkDevices 把指定批次（stage < 0 表示全部）中状态属于 from 的设备改为 to，返回受影响的设备 ID
+func (r *otaRepo) MarkDevices(campaignID uuid.UUID, stage int, from []string, to, msg string) ([]string, error) {
+	var ids []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		ids, err = (&otaRepo{db: tx}).markDevices(campaignID, stage, from, to, msg)
+		return err
+	})
+	return ids, err
+}
+
+// markDevices 见 MarkDevices，调用方负责事务
+func (r *otaRepo) markDevices(campaignID uuid.UUID, stage int, from []string, to, msg string) ([]string, error) {
+	var ids []string
+	q := r.db.Model(&model.OTACampaignDevice{}).Where("campaign_id = ? AND status IN ?", campaignID, from)
+	if stage >= 0 {
+		q = q.Where("stage = ?", stage)
+	}
+	if err := q.Pluck("device_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	err := r.db.Model(&model.OTACampaignDevice{}).
+		Where("campaign_id = ? AND device_id IN ?", campaignID, ids).
+		Updates(map[string]any{"status": to, "message": msg, "updated_at": time.Now()}).Error
+	return ids, err
+}
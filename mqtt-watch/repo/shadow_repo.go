@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// ErrShadowConflict 影子在读取后已被其他请求或副本修改
+var ErrShadowConflict = errors.New("设备影子已被并发修改")
+
+type ShadowRepo interface {
+	Get(deviceID string) (*model.DeviceShadow, error)
+	Save(s *model.DeviceShadow) error
+	SetDeltaAt(deviceID string, t time.Time) error
+}
+
+type shadowRepo struct {
+	coll *mongo.Collection
+}
+
+func NewShadowRepo(coll *mongo.Collection) ShadowRepo {
+	return &shadowRepo{coll: coll}
+}
+
+// Get 不存在时返回 nil, nil
+func (r *shadowRepo) Get(deviceID string) (*model.DeviceShadow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	var s model.DeviceShadow
+	err := r.coll.FindOne(ctx, bson.M{"_id": deviceID}).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save 以读取时的 rev 为条件整体写入并将 rev +1，不存在时创建；
+// 文档已被修改（rev 不一致，或并发创建时主键冲突）返回 ErrShadowConflict
+func (r *shadowRepo) Save(s *model.DeviceShadow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+
+	filter := bson.M{"_id": s.DeviceID, "rev": s.Rev}
+	if s.Rev == 0 {
+		// 新建，或早期写入的文档没有 rev 字段
+		filter["rev"] = bson.M{"$in": bson.A{nil, 0}}
+	}
+	next := *s
+	next.Rev++
+	res, err := r.coll.ReplaceOne(ctx, filter, &next, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrShadowConflict
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 && res.UpsertedCount == 0 {
+		return ErrShadowConflict
+	}
+	s.Rev = next.Rev
+	return nil
+}
+
+// SetDeltaAt 只更新下发时间一个字段，不存在的影子不创建
+func (r *shadowRepo) SetDeltaAt(deviceID string, t time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": deviceID},
+		bson.M{"$set": bson.M{"delta_at": t}, "$inc": bson.M{"rev": 1}})
+	return err
+}
@@ -0,0 +1,479 @@
+// service/command_service.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/repo"
+)
+
+const (
+	CmdTopicPrefix    = "cmd/"
+	CmdAckTopicPrefix = "cmd-ack/"
+
+	defaultCmdTimeout = 10
+	maxCmdTimeout     = 300
+	defaultCmdRetries = 2
+	maxCmdRetries     = 10
+
+	// cmdLeaseTTL 副本存活租约时长，副本失联超过该时间后其在途指令由其他副本接管
+	cmdLeaseTTL = 30 * time.Second
+	// cmdAdoptInterval 续租与接管检查周期
+	cmdAdoptInterval = 10 * time.Second
+)
+
+// unfinishedCmd 在途指令在库中的状态
+var unfinishedCmd = []string{model.CmdPending, model.CmdSent}
+
+// CommandValidator 校验指令参数
+type CommandValidator func(params map[string]any) error
+
+var (
+	commandSpecsMu sync.RWMutex
+	commandSpecs   = map[string]CommandValidator{
+		// 蜂鸣：pattern 为设备约定的节奏名称（如 short / long / sos），duration_ms 可选
+		"buzzer": func(p map[string]any) error {
+			if v, ok := p["pattern"]; ok {
+				if s, ok := v.(string); !ok || s == "" {
+					return fmt.Errorf("pattern 必须为非空字符串")
+				}
+			}
+			return optionalPositive(p, "duration_ms")
+		},
+		// 振动：duration_ms 必填
+		"vibrate": func(p map[string]any) error {
+			return requirePositive(p, "duration_ms")
+		},
+		// 设置上报周期：second 必填
+		"set_interval": func(p map[string]any) error {
+			return requirePositive(p, "second")
+		},
+		// 重启：无参数
+		"reboot": func(p map[string]any) error {
+			if len(p) > 0 {
+				return fmt.Errorf("reboot 不接受参数")
+			}
+			return nil
+		},
+	}
+)
+
+// RegisterCommand 注册（或覆盖）一种指令
+func RegisterCommand(name string, v CommandValidator) {
+	commandSpecsMu.Lock()
+	defer commandSpecsMu.Unlock()
+	commandSpecs[name] = v
+}
+
+func requirePositive(p map[string]any, key string) error {
+	if _, ok := p[key]; !ok {
+		return fmt.Errorf("缺少参数 %s", key)
+	}
+	return optionalPositive(p, key)
+}
+
+func optionalPositive(p map[string]any, key string) error {
+	v, ok := p[key]
+	if !ok {
+		return nil
+	}
+	if f, ok := v.(float64); !ok || f <= 0 {
+		return fmt.Errorf("%s 必须为正数", key)
+	}
+	return nil
+}
+
+type CommandService interface {
+	Send(deviceID string, req model.SendCommandReq, userID string) (*model.DeviceCommand, error)
+	Get(id string) (*model.DeviceCommand, error)
+	List(q model.CommandQuery) ([]model.DeviceCommand, int64, error)
+	Cancel(id string) (*model.DeviceCommand, error)
+	OnAck(c mqtt.Client, msg mqtt.Message)
+	Start()
+	Stop()
+}
+
+// commandService 指令下发与投递跟踪：
+//   - 发布到 cmd/<device_id>（QoS 1），等待 cmd-ack/<device_id> 上带相同 cmd_id 的回执
+//   - 超时未回执按 max_retries 重发（cmd_id 不变，设备据此去重），耗尽后置为 timeout
+//   - 所有状态变化写入 Mongo，未结束的指令在重启后恢复跟踪
+//
+// 多副本部署时每条指令只由一个副本（owner）跟踪，回执为普通订阅、各副本都会收到，只有跟踪副本处理。
+// 各副本以 instance:<id> 租约声明存活，租约过期的副本留下的指令由其他副本通过条件更新认领，
+// 写库均以 owner 与状态为条件，被接管或在其他副本取消的指令不会被旧副本覆盖
+type commandService struct {
+	c        mqtt.Client
+	repo     repo.CommandRepo
+	leases   repo.LeaseRepo
+	instance string
+	alive    *Lease // 本副本的存活租约
+
+	mu       sync.Mutex // 保护 inflight，并串行化状态写库，避免回执与重发的写入乱序
+	inflight map[string]*model.DeviceCommand
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewCommandService instance 为本副本标识，同一副本重启后应保持不变以便直接恢复自己的指令
+func NewCommandService(c mqtt.Client, r repo.CommandRepo, leases repo.LeaseRepo, instance string) CommandService {
+	return &commandService{
+		c:        c,
+		repo:     r,
+		leases:   leases,
+		instance: instance,
+		alive:    NewLease(leases, instanceLease(instance), instance, cmdLeaseTTL),
+		inflight: make(map[string]*model.DeviceCommand),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 登记本副本存活，接管未结束的指令并启动超时检查
+func (s *commandService) Start() {
+	s.alive.Hold()
+	s.adopt()
+	go s.loop()
+}
+
+// Stop 停止跟踪并释放存活租约，在途指令由其他副本立即接管
+func (s *commandService) Stop() {
+	close(s.stop)
+	<-s.done
+	s.alive.Release()
+}
+
+func instanceLease(instance string) string {
+	return "instance:" + instance
+}
+
+// adopt 接管未结束的指令：本副本上次运行留下的、跟踪副本租约已过期的，以及早期没有归属的
+func (s *commandService) adopt() {
+	list, err := s.repo.ListUnfinished()
+	if err != nil {
+		log.Printf("[ERROR] 查询未结束指令失败: %v", err)
+		return
+	}
+	var owners []string
+	for _, cmd := range list {
+		if cmd.Owner != "" && cmd.Owner != s.instance {
+			owners = append(owners, instanceLease(cmd.Owner))
+		}
+	}
+	alive, err := s.leases.Alive(owners)
+	if err != nil {
+		log.Printf("[ERROR] 查询副本租约失败: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	adopted := 0
+	for i := range list {
+		cmd := list[i]
+		if _, ok := s.inflight[cmd.ID]; ok || (cmd.Owner != s.instance && alive[instanceLease(cmd.Owner)]) {
+			continue
+		}
+		ok, err := s.repo.Claim(cmd.ID, cmd.Owner, s.instance)
+		if err != nil {
+			log.Printf("[ERROR] 接管指令失败  cmdID=%s  err=%v", cmd.ID, err)
+			continue
+		}
+		if !ok {
+			continue // 已被其他副本认领或已结束
+		}
+		if cmd.Owner != s.instance {
+			log.Printf("[INFO] 接管指令  cmdID=%s  from=%q", cmd.ID, cmd.Owner)
+		}
+		cmd.Owner = s.instance
+		s.inflight[cmd.ID] = &cmd
+		adopted++
+	}
+	if adopted > 0 {
+		log.Printf("[INFO] 已恢复未结束指令  count=%d", adopted)
+	}
+}
+
+func (s *commandService) Send(deviceID string, req model.SendCommandReq, userID string) (*model.DeviceCommand, error) {
+	deviceID = strings.TrimSpace(deviceID)
+	req.Name = strings.TrimSpace(req.Name)
+	if deviceID == "" {
+		return nil, errs.ErrValidationFailed.WithDetails("device_id 不能为空")
+	}
+	commandSpecsMu.RLock()
+	validate, ok := commandSpecs[req.Name]
+	commandSpecsMu.RUnlock()
+	if !ok {
+		return nil, errs.ErrValidationFailed.WithDetails("不支持的指令: " + req.Name)
+	}
+	if err := validate(req.Params); err != nil {
+		return nil, errs.ErrValidationFailed.WithDetails(err.Error())
+	}
+
+	timeout := req.TimeoutSecond
+	if timeout == 0 {
+		timeout = defaultCmdTimeout
+	}
+	if timeout < 1 || timeout > maxCmdTimeout {
+		return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("timeout_second 取值 1~%d", maxCmdTimeout))
+	}
+	retries := defaultCmdRetries
+	if req.MaxRetries != nil {
+		retries = *req.MaxRetries
+	}
+	if retries < 0 || retries > maxCmdRetries {
+		return nil, errs.ErrValidationFailed.WithDetails(fmt.Sprintf("max_retries 取值 0~%d", maxCmdRetries))
+	}
+
+	now := time.Now()
+	cmd := &model.DeviceCommand{
+		ID:            uuid.NewString(),
+		DeviceID:      deviceID,
+		Name:          req.Name,
+		Params:        req.Params,
+		Status:        model.CmdPending,
+		MaxRetries:    retries,
+		TimeoutSecond: timeout,
+		CreatedBy:     userID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Owner:         s.instance,
+	}
+	if err := s.repo.Create(cmd); err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+
+	s.mu.Lock()
+	s.inflight[cmd.ID] = cmd
+	snapshot, ok := s.markAttempt(cmd, now)
+	s.mu.Unlock()
+
+	if ok {
+		s.publish(snapshot)
+	}
+	return s.Get(cmd.ID)
+}
+
+func (s *commandService) Get(id string) (*model.DeviceCommand, error) {
+	s.mu.Lock()
+	if cmd, ok := s.inflight[id]; ok {
+		cp := *cmd
+		s.mu.Unlock()
+		return &cp, nil
+	}
+	s.mu.Unlock()
+
+	cmd, err := s.repo.Get(id)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if cmd == nil {
+		return nil, errs.ErrResourceNotFound.WithDetails("指令不存在")
+	}
+	return cmd, nil
+}
+
+func (s *commandService) List(q model.CommandQuery) ([]model.DeviceCommand, int64, error) {
+	list, total, err := s.repo.List(q)
+	if err != nil {
+		return nil, 0, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return list, total, nil
+}
+
+// Cancel 取消等待回执的指令，不再重发；已发出的指令设备仍可能执行。
+// 由其他副本跟踪的指令直接在库中取消，跟踪副本下次写库失败后停止重发
+func (s *commandService) Cancel(id string) (*model.DeviceCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cmd, ok := s.inflight[id]; ok && s.finish(cmd, model.CmdCanceled, "", nil) {
+		cp := *cmd
+		return &cp, nil
+	}
+	canceled, err := s.repo.Cancel(id, time.Now())
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	stored, err := s.repo.Get(id)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if stored == nil {
+		return nil, errs.ErrResourceNotFound.WithDetails("指令不存在")
+	}
+	if !canceled {
+		return nil, errs.ErrStatusConflict.WithDetails("指令已结束: " + stored.Status)
+	}
+	return stored, nil
+}
+
+// OnAck 订阅 cmd-ack/#，按 cmd_id 关联回执
+func (s *commandService) OnAck(c mqtt.Client, msg mqtt.Message) {
+	var ack model.CmdAckMsg
+	if err := json.Unmarshal(msg.Payload(), &ack); err != nil || ack.CmdID == "" {
+		log.Printf("[WARN] 无法解析指令回执  topic=%s  payload=%s", msg.Topic(), string(msg.Payload()))
+		return
+	}
+	deviceID := strings.TrimPrefix(msg.Topic(), CmdAckTopicPrefix)
+
+	status, errMsg := model.CmdAcked, ""
+	if !strings.EqualFold(ack.Status, "ok") && ack.Status != "" {
+		status, errMsg = model.CmdFailed, ack.Msg
+		if errMsg == "" {
+			errMsg = ack.Status
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd, ok := s.inflight[ack.CmdID]
+	if !ok {
+		// 超时后才到的回执仍记录结果，设备实际已执行；各副本都会收到，条件写入保证只记录一次
+		stored, err := s.repo.Get(ack.CmdID)
+		if err != nil || stored == nil || stored.Status != model.CmdTimeout {
+			return
+		}
+		cmd = stored
+	}
+	if cmd.DeviceID != deviceID {
+		log.Printf("[WARN] 指令回执设备不匹配  cmdID=%s  want=%s  got=%s", ack.CmdID, cmd.DeviceID, deviceID)
+		return
+	}
+	if !s.finish(cmd, status, errMsg, ack.Result) {
+		return
+	}
+	log.Printf("[INFO] 收到指令回执  deviceID=%s  cmdID=%s  status=%s", deviceID, cmd.ID, status)
+}
+
+func (s *commandService) loop() {
+	defer close(s.done)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	adopt := time.NewTicker(cmdAdoptInterval)
+	defer adopt.Stop()
+	for {
+		select {
+		case <-tick.C:
+			s.checkTimeouts(time.Now())
+		case <-adopt.C:
+			if !s.alive.Hold() {
+				log.Printf("[WARN] 副本存活租约续租失败，在途指令可能被其他副本接管  instance=%s", s.instance)
+			}
+			s.adopt()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// checkTimeouts 到期未回执的指令重发或置为超时；发布在锁外进行
+func (s *commandService) checkTimeouts(now time.Time) {
+	var resend []model.DeviceCommand
+
+	s.mu.Lock()
+	for _, cmd := range s.inflight {
+		if cmd.SentAt != nil && now.Sub(*cmd.SentAt) < time.Duration(cmd.TimeoutSecond)*time.Second {
+			continue
+		}
+		if cmd.Attempts > cmd.MaxRetries {
+			reason := "等待回执超时"
+			if cmd.Error != "" {
+				reason = cmd.Error
+			}
+			if s.finish(cmd, model.CmdTimeout, reason, nil) {
+				log.Printf("[WARN] 指令超时  deviceID=%s  cmdID=%s  attempts=%d", cmd.DeviceID, cmd.ID, cmd.Attempts)
+			}
+			continue
+		}
+		if snapshot, ok := s.markAttempt(cmd, now); ok {
+			resend = append(resend, snapshot)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, cmd := range resend {
+		s.publish(cmd)
+	}
+}
+
+// markAttempt 记一次发布并写库，返回用于发布的快照；
+// 指令已被其他副本接管或取消时停止跟踪，不再发布。调用方持有 mu
+func (s *commandService) markAttempt(cmd *model.DeviceCommand, now time.Time) (model.DeviceCommand, bool) {
+	cmd.Attempts++
+	cmd.Status = model.CmdSent
+	cmd.SentAt = &now
+	cmd.UpdatedAt = now
+	if err := s.repo.Update(cmd, unfinishedCmd...); err != nil {
+		if errors.Is(err, repo.ErrCommandChanged) {
+			delete(s.inflight, cmd.ID)
+			log.Printf("[WARN] 指令已被其他副本接管或取消，停止跟踪  cmdID=%s", cmd.ID)
+			return *cmd, false
+		}
+		log.Printf("[ERROR] 更新指令记录失败  cmdID=%s  err=%v", cmd.ID, err)
+	}
+	return *cmd, true
+}
+
+// finish 结束指令并写库，返回是否写入；指令已被其他副本接管或结束时不覆盖。调用方持有 mu
+func (s *commandService) finish(cmd *model.DeviceCommand, status, errMsg string, result map[string]any) bool {
+	from := unfinishedCmd
+	if cmd.Finished() {
+		from = []string{cmd.Status} // 超时后到达的回执
+	}
+	now := time.Now()
+	cmd.Status = status
+	cmd.Error = errMsg
+	cmd.UpdatedAt = now
+	if result != nil {
+		cmd.Result = result
+	}
+	if status == model.CmdAcked || status == model.CmdFailed {
+		cmd.AckedAt = &now
+	}
+	delete(s.inflight, cmd.ID)
+	if err := s.repo.Update(cmd, from...); err != nil {
+		if errors.Is(err, repo.ErrCommandChanged) {
+			return false
+		}
+		log.Printf("[ERROR] 更新指令记录失败  cmdID=%s  err=%v", cmd.ID, err)
+	}
+	return true
+}
+
+// publish 发布失败只记录原因，到期后按重试规则处理
+func (s *commandService) publish(cmd model.DeviceCommand) {
+	payload, err := json.Marshal(model.CmdMsg{
+		CmdID:  cmd.ID,
+		Name:   cmd.Name,
+		Params: cmd.Params,
+		TS:     time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return
+	}
+	token := s.c.Publish(CmdTopicPrefix+cmd.DeviceID, 1, false, payload)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Printf("[ERROR] 指令发布失败  deviceID=%s  cmdID=%s  err=%v", cmd.DeviceID, cmd.ID, err)
+		s.mu.Lock()
+		if c, ok := s.inflight[cmd.ID]; ok {
+			c.Error = "发布失败: " + err.Error()
+		}
+		s.mu.Unlock()
+		return
+	}
+	log.Printf("[PUB] topic=%s%s cmdID=%s name=%s attempt=%d", CmdTopicPrefix, cmd.DeviceID, cmd.ID, cmd.Name, cmd.Attempts)
+}
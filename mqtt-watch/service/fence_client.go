@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+// fenceBatchSize 单次请求 map-service 的点数（map-service 上限为 10000）
+const fenceBatchSize = 5000
+
+// FenceClient 调用 map-service 批量判定点所在的围栏
+type FenceClient interface {
+	// CheckBatch 返回每个点命中的围栏，顺序与 points 一致
+	CheckBatch(points []model.FencePoint) ([][]model.FenceHit, error)
+}
+
+type fenceClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewFenceClient baseURL 形如 http://map-service:8002
+func NewFenceClient(baseURL string) FenceClient {
+	return &fenceClient{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: baseURL,
+	}
+}
+
+type batchCheckResp struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    []struct {
+		Fences []model.FenceHit `json:"fences"`
+	} `json:"data"`
+}
+
+func (f *fenceClient) CheckBatch(points []model.FencePoint) ([][]model.FenceHit, error) {
+	out := make([][]model.FenceHit, 0, len(points))
+	for start := 0; start < len(points); start += fenceBatchSize {
+		end := min(start+fenceBatchSize, len(points))
+		hits, err := f.checkChunk(points[start:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, hits...)
+	}
+	return out, nil
+}
+
+func (f *fenceClient) checkChunk(points []model.FencePoint) ([][]model.FenceHit, error) {
+	body, err := json.Marshal(map[string]any{"points": points})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, f.baseURL+"/api/v1/polygon-fence/check-batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求map-service失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	var r batchCheckResp
+	if err := json.Unmarshal(respBody, &r); err != nil {
+		return nil, fmt.Errorf("解析响应失败: status=%d  %w", resp.StatusCode, err)
+	}
+	if !r.Success {
+		return nil, fmt.Errorf("map-service返回错误: status=%d  %s", resp.StatusCode, r.Message)
+	}
+	if len(r.Data) != len(points) {
+		return nil, fmt.Errorf("map-service返回结果数量不符: 期望 %d，实际 %d", len(points), len(r.Data))
+	}
+
+	hits := make([][]model.FenceHit, len(points))
+	for i := range r.Data {
+		hits[i] = r.Data[i].Fences
+	}
+	return hits, nil
+}
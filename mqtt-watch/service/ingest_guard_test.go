@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestGuardAccept(t *testing.T) {
+	base := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	seq := func(v uint64) *uint64 { return &v }
+	at := func(sec int) *time.Time { v := base.Add(time.Duration(sec) * time.Second); return &v }
+
+	type msg struct {
+		after   time.Duration // 距上一条的服务器时间
+		seq     *uint64
+		at      *time.Time
+		payload string
+		dup     bool
+		want    string // 空表示接受
+	}
+	cases := []struct {
+		name string
+		msgs []msg
+	}{
+		{"seq increasing", []msg{
+			{seq: seq(1)},
+			{after: time.Second, seq: seq(2)},
+			{after: time.Second, seq: seq(5)},
+		}},
+		{"seq duplicate", []msg{
+			{seq: seq(7)},
+			{after: time.Second, seq: seq(7), dup: true, want: DropDuplicate},
+		}},
+		{"seq reordered", []msg{
+			{seq: seq(10)},
+			{after: time.Second, seq: seq(12)},
+			{after: time.Second, seq: seq(11), want: DropStale},
+			{after: time.Second, seq: seq(13)},
+		}},
+		{"reset by large backward jump", []msg{
+			{seq: seq(5000)},
+			{after: time.Second, seq: seq(1)},
+			{after: time.Second, seq: seq(2)},
+		}},
+		// 计数小于 resetGap 的设备重启：回退幅度不够，靠采样时间或空闲时长识别
+		{"reset with newer sample time", []msg{
+			{seq: seq(500), at: at(0)},
+			{after: time.Second, seq: seq(1), at: at(20)},
+			{after: time.Second, seq: seq(2), at: at(21)},
+		}},
+		{"reordered with older sample time", []msg{
+			{seq: seq(500), at: at(10)},
+			{after: time.Second, seq: seq(499), at: at(9), want: DropStale},
+		}},
+		{"reset after idle", []msg{
+			{seq: seq(500)},
+			{after: 5 * time.Second, seq: seq(1), want: DropStale},
+			{after: 26 * time.Second, seq: seq(2)},
+			{after: time.Second, seq: seq(3)},
+		}},
+		{"redelivery after idle is not a reset", []msg{
+			{seq: seq(500)},
+			{after: 40 * time.Second, seq: seq(499), dup: true, want: DropStale},
+		}},
+		{"sample time only", []msg{
+			{at: at(0)},
+			{after: time.Second, at: at(0), want: DropDuplicate},
+			{after: time.Second, at: at(-1), want: DropStale},
+			{after: time.Second, at: at(1)},
+		}},
+		{"broker redelivery without seq", []msg{
+			{payload: "a"},
+			{after: time.Second, payload: "a", dup: true, want: DropDuplicate},
+			{after: time.Second, payload: "a"},
+			{after: 20 * time.Second, payload: "a", dup: true},
+		}},
+		{"state expires after ttl", []msg{
+			{seq: seq(500)},
+			{after: 11 * time.Minute, seq: seq(500), dup: true},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := base
+			g := newIngestGuard(10*time.Second, 10*time.Minute, 1000, 30*time.Second)
+			g.now = func() time.Time { return now }
+			for i, m := range tc.msgs {
+				now = now.Add(m.after)
+				ok, reason := g.Accept("d1", m.seq, m.at, []byte(m.payload), m.dup)
+				if ok != (m.want == "") || reason != m.want {
+					t.Fatalf("msg %d: ok=%v reason=%q, want reason %q", i, ok, reason, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIngestGuardClose(t *testing.T) {
+	g := NewIngestGuard(time.Second, time.Millisecond, 1000, time.Second)
+	g.Close()
+	g.Close() // 可重复调用
+}
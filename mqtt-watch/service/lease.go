@@ -0,0 +1,39 @@
+// service/lease.go
+package service
+
+import (
+	"log"
+	"time"
+
+	"IOT-Manage-System/mqtt-watch/repo"
+)
+
+// Lease 多副本部署时的后台任务租约：同一时刻只有一个副本持有，
+// 持有者退出时主动释放，宕机后最迟 ttl 后由其他副本接管
+type Lease struct {
+	repo   repo.LeaseRepo
+	name   string
+	holder string
+	ttl    time.Duration
+}
+
+func NewLease(r repo.LeaseRepo, name, holder string, ttl time.Duration) *Lease {
+	return &Lease{repo: r, name: name, holder: holder, ttl: ttl}
+}
+
+// Hold 续租或接管；数据库不可用时视为未持有，宁可少执行一轮也不与其他副本重复执行
+func (l *Lease) Hold() bool {
+	ok, err := l.repo.Acquire(l.name, l.holder, l.ttl)
+	if err != nil {
+		log.Printf("[WARN] 续租失败  lease=%s  holder=%s  err=%v", l.name, l.holder, err)
+		return false
+	}
+	return ok
+}
+
+// Release 退出时释放，其他副本不必等到过期
+func (l *Lease) Release() {
+	if err := l.repo.Release(l.name, l.holder); err != nil {
+		log.Printf("[WARN] 释放租约失败  lease=%s  holder=%s  err=%v", l.name, l.holder, err)
+	}
+}
@@ -2,7 +2,7 @@ package service
 
 import (
 	"IOT-Manage-System/mqtt-watch/errs"
-	// "IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/model"
 	"IOT-Manage-System/mqtt-watch/repo"
 	// "time"
 )
@@ -10,6 +10,9 @@ import (
 type MarkService interface {
 	GetPersistMQTTByDeviceID(deviceID string) (bool, error)
 	GetDeviceIDsByPersistMQTT(persist bool) ([]string, error)
+	GetDecoderByDeviceID(deviceID string) (string, []byte, error)
+	GetMqttTopics() (map[string][]string, error)
+	GetMarkMeta(deviceID string) (*model.MarkMeta, error)
 }
 
 type markService struct {
@@ -37,3 +40,30 @@ func (s *markService) GetDeviceIDsByPersistMQTT(persist bool) ([]string, error)
 	}
 	return deviceIDs, nil
 }
+
+// GetDecoderByDeviceID 查询设备所属类型配置的载荷解码器
+func (s *markService) GetDecoderByDeviceID(deviceID string) (string, []byte, error) {
+	kind, cfg, err := s.repo.GetDecoderByDeviceID(deviceID)
+	if err != nil {
+		return "", nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return kind, cfg, nil
+}
+
+// GetMqttTopics 查询所有标记配置的自定义 MQTT 主题
+func (s *markService) GetMqttTopics() (map[string][]string, error) {
+	topics, err := s.repo.GetMqttTopics()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return topics, nil
+}
+
+// GetMarkMeta 查询设备所属类型与标签，设备不存在时返回 nil
+func (s *markService) GetMarkMeta(deviceID string) (*model.MarkMeta, error) {
+	meta, err := s.repo.GetMarkMeta(deviceID)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return meta, nil
+}
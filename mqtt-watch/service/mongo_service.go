@@ -2,26 +2,115 @@
 package service
 
 import (
+	"log"
+	"time"
+
 	"IOT-Manage-System/mqtt-watch/model"
 	"IOT-Manage-System/mqtt-watch/repo"
+	"IOT-Manage-System/mqtt-watch/utils"
 )
 
 // 定义接口 -
 type MongoService interface {
+	// SaveDeviceLoc 投递到写缓冲，攒批后写入；缓冲满时阻塞调用方（背压）
 	SaveDeviceLoc(loc model.DeviceLoc) error
+	Start()
+	// Stop 停止攒批并把缓冲中的记录全部写完
+	Stop()
 }
 
 // 实现层 -------------------------------------------------
 type mongoService struct {
 	deviceLocRepo repo.MongoRepo // 接口依赖
+
+	batchSize  int
+	flushEvery time.Duration
+
+	queue chan model.DeviceLoc
+	stop  chan struct{}
+	done  chan struct{}
 }
 
 // 构造函数 ----------------------------------------------
 func NewMongoService(dr repo.MongoRepo) MongoService {
-	return &mongoService{deviceLocRepo: dr}
+	return &mongoService{
+		deviceLocRepo: dr,
+		batchSize:     utils.GetEnvInt("MONGO_BATCH_SIZE", 200),
+		flushEvery:    time.Duration(utils.GetEnvInt("MONGO_FLUSH_MS", 1000)) * time.Millisecond,
+		queue:         make(chan model.DeviceLoc, 8192),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
 }
 
 // 业务方法 ----------------------------------------------
 func (s *mongoService) SaveDeviceLoc(loc model.DeviceLoc) error {
-	return s.deviceLocRepo.CreateLoc(loc)
+	select {
+	case <-s.stop:
+		// 已停止攒批（关闭过程中的迟到消息），直接写入
+		return s.deviceLocRepo.CreateLoc(loc)
+	default:
+	}
+	select {
+	case s.queue <- loc:
+		return nil
+	case <-s.stop:
+		return s.deviceLocRepo.CreateLoc(loc)
+	}
+}
+
+func (s *mongoService) Start() {
+	go s.loop()
+}
+
+func (s *mongoService) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *mongoService) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]model.DeviceLoc, 0, s.batchSize)
+	for {
+		select {
+		case loc := <-s.queue:
+			batch = append(batch, loc)
+			if len(batch) >= s.batchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.stop:
+			// 取尽缓冲后最后写一次
+			for {
+				select {
+				case loc := <-s.queue:
+					batch = append(batch, loc)
+					if len(batch) >= s.batchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					if n := len(batch); n > 0 {
+						s.flush(batch)
+						log.Printf("[INFO] 退出前写入剩余位置记录  count=%d", n)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 写入一批并返回清空后的切片；失败只记录日志，不重试以免阻塞后续写入
+func (s *mongoService) flush(batch []model.DeviceLoc) []model.DeviceLoc {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := s.deviceLocRepo.CreateLocs(batch); err != nil {
+		log.Printf("[ERROR] 批量写入位置记录失败  count=%d  err=%v", len(batch), err)
+	}
+	return batch[:0]
 }
@@ -22,7 +22,6 @@ func (m *mqttService) SendWarningStart(deviceID string) *errs.AppError {
 	token := m.c.Publish("warning/"+deviceID, 2, false, "1")
 	token.Wait()
 	if err := token.Error(); err != nil {
-		log.Fatalln("❌")
 		// 网络 / Broker 不可用 → 503 第三方服务异常
 		return errs.ErrThirdParty.WithDetails(err.Error())
 	}
@@ -36,6 +35,7 @@ func (m *mqttService) SendWarningEnd(deviceID string) *errs.AppError {
 	if err := token.Error(); err != nil {
 		return errs.ErrThirdParty.WithDetails(err.Error())
 	}
+	log.Printf("[PUB] topic=%s payload=%s", "warning/"+deviceID, "0")
 	return nil
 }
 
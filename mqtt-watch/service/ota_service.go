@@ -0,0 +1,595 @@
+// service/ota_service.go
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/repo"
+)
+
+const (
+	OTATopicPrefix         = "ota/"
+	OTAProgressTopicPrefix = "ota-progress/"
+
+	// FirmwareDir 固件存放目录，与自制地图图片一样放在 uploads 下
+	FirmwareDir = "uploads/firmware"
+	// FirmwareRoute 固件静态下载路由，经网关 /api/v1/mqtt/* 转发
+	FirmwareRoute = "/api/v1/mqtt/ota/files"
+
+	otaTick = 5 * time.Second
+	// otaLeaseTTL 分批推进租约时长，持有副本失联超过该时间后由其他副本接手
+	otaLeaseTTL = 30 * time.Second
+	// OTALeaseName 分批推进只由持有该租约的副本执行
+	OTALeaseName = "ota-rollout"
+)
+
+type OTAService interface {
+	UploadFirmware(name, version, notes, userID string, fh *multipart.FileHeader) (*model.Firmware, error)
+	ListFirmwares() ([]model.Firmware, error)
+	GetFirmware(id string) (*model.Firmware, error)
+	DeleteFirmware(id string) error
+
+	CreateCampaign(req model.CreateCampaignReq, userID string) (*model.OTACampaign, error)
+	StartCampaign(id string) (*model.OTACampaign, error)
+	AbortCampaign(id, reason string) (*model.OTACampaign, error)
+	GetCampaign(id string) (*model.OTACampaign, error)
+	ListCampaigns(status string, page, limit int) ([]model.OTACampaign, int64, error)
+	ListCampaignDevices(id, status string, page, limit int) ([]model.OTACampaignDevice, int64, error)
+
+	OnProgress(c mqtt.Client, msg mqtt.Message)
+	Start()
+	Stop()
+}
+
+// otaService 固件升级：
+//   - 任务启动后按 batch_size 分批，每批通过 ota/<device_id> 通知设备下载
+//   - 设备在 ota-progress/<device_id> 上报进度，本批全部结束或超时后，
+//     失败率不超过 max_failure_ratio 才推进下一批，否则自动中止
+//   - 中止时向已通知的设备发送 abort
+//
+// 多副本部署时分批推进只由持有 ota-rollout 租约的副本执行，批次分配以行锁认领；
+// 任务状态只做条件更新，启动 / 中止可由任意副本处理
+type otaService struct {
+	c       mqtt.Client
+	repo    repo.OTARepo
+	lease   *Lease
+	baseURL string
+
+	mu   sync.Mutex // 串行化任务状态推进，避免与中止操作交错
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewOTAService baseURL 为设备可访问的网关地址，用于拼接固件下载链接；instance 为本副本标识
+func NewOTAService(c mqtt.Client, r repo.OTARepo, leases repo.LeaseRepo, instance, baseURL string) OTAService {
+	return &otaService{
+		c:       c,
+		repo:    r,
+		lease:   NewLease(leases, OTALeaseName, instance, otaLeaseTTL),
+		baseURL: strings.TrimRight(baseURL, "/"),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *otaService) Start() {
+	go s.loop()
+}
+
+func (s *otaService) Stop() {
+	close(s.stop)
+	<-s.done
+	s.lease.Release()
+}
+
+/* ---------- 固件 ---------- */
+
+func (s *otaService) UploadFirmware(name, version, notes, userID string, fh *multipart.FileHeader) (*model.Firmware, error) {
+	name, version = strings.TrimSpace(name), strings.TrimSpace(version)
+	if name == "" || version == "" {
+		return nil, errs.ErrValidationFailed.WithDetails("name 与 version 不能为空")
+	}
+	if fh == nil || fh.Size == 0 {
+		return nil, errs.ErrValidationFailed.WithDetails("固件文件不能为空")
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return nil, errs.ErrUploadFailed.WithDetails(err.Error())
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(FirmwareDir, 0755); err != nil {
+		return nil, errs.ErrUploadFailed.WithDetails(fmt.Sprintf("创建上传目录失败: %v", err))
+	}
+	filename := fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), filepath.Ext(fh.Filename))
+	relativePath := filepath.Join(FirmwareDir, filename)
+	dst, err := os.Create(relativePath)
+	if err != nil {
+		return nil, errs.ErrUploadFailed.WithDetails(err.Error())
+	}
+
+	// 写盘同时计算校验和
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, h), src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(relativePath)
+		return nil, errs.ErrUploadFailed.WithDetails(err.Error())
+	}
+
+	f := &model.Firmware{
+		Name:      name,
+		Version:   version,
+		FilePath:  filepath.ToSlash(relativePath),
+		FileSize:  size,
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+		Notes:     notes,
+		CreatedBy: userID,
+	}
+	if err := s.repo.CreateFirmware(f); err != nil {
+		_ = os.Remove(relativePath)
+		if strings.Contains(err.Error(), "uq_firmware_name_version") {
+			return nil, errs.AlreadyExists("FIRMWARE", "同名同版本固件已存在")
+		}
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	s.fillURL(f)
+	log.Printf("[INFO] 固件已上传  name=%s  version=%s  size=%d  sha256=%s", f.Name, f.Version, f.FileSize, f.SHA256)
+	return f, nil
+}
+
+func (s *otaService) ListFirmwares() ([]model.Firmware, error) {
+	list, err := s.repo.ListFirmwares()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	for i := range list {
+		s.fillURL(&list[i])
+	}
+	return list, nil
+}
+
+func (s *otaService) GetFirmware(id string) (*model.Firmware, error) {
+	fid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errs.ErrInvalidInput.WithDetails("固件 ID 格式错误")
+	}
+	f, err := s.repo.GetFirmware(fid)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if f == nil {
+		return nil, errs.ErrResourceNotFound.WithDetails("固件不存在")
+	}
+	s.fillURL(f)
+	return f, nil
+}
+
+// DeleteFirmware 被任务引用的固件不可删除
+func (s *otaService) DeleteFirmware(id string) error {
+	f, err := s.GetFirmware(id)
+	if err != nil {
+		return err
+	}
+	used, err := s.repo.FirmwareInUse(f.ID)
+	if err != nil {
+		return errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if used {
+		return errs.ErrResourceConflict.WithDetails("固件已被升级任务引用")
+	}
+	if err := s.repo.DeleteFirmware(f.ID); err != nil {
+		return errs.ErrDatabase.WithDetails(err.Error())
+	}
+	_ = os.Remove(filepath.FromSlash(f.FilePath))
+	return nil
+}
+
+func (s *otaService) fillURL(f *model.Firmware) {
+	f.URL = s.baseURL + FirmwareRoute + "/" + filepath.Base(f.FilePath)
+}
+
+/* ---------- 任务 ---------- */
+
+func (s *otaService) CreateCampaign(req model.CreateCampaignReq, userID string) (*model.OTACampaign, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, errs.ErrValidationFailed.WithDetails("name 不能为空")
+	}
+	if len(req.TypeIDs) == 0 && len(req.TagIDs) == 0 && len(req.DeviceIDs) == 0 {
+		return nil, errs.ErrValidationFailed.WithDetails("type_ids / tag_ids / device_ids 至少指定一项")
+	}
+	if req.BatchSize == 0 {
+		req.BatchSize = 10
+	}
+	if req.StageTimeoutSecond == 0 {
+		req.StageTimeoutSecond = 1800
+	}
+	ratio := 0.2
+	if req.MaxFailureRatio != nil {
+		ratio = *req.MaxFailureRatio
+	}
+	if req.BatchSize < 1 || req.StageTimeoutSecond < 10 || ratio < 0 || ratio > 1 {
+		return nil, errs.ErrValidationFailed.WithDetails("batch_size >= 1，stage_timeout_second >= 10，max_failure_ratio 取值 0~1")
+	}
+
+	fw, err := s.GetFirmware(req.FirmwareID)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.repo.ResolveTargets(req.TypeIDs, req.TagIDs, req.DeviceIDs)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if len(devices) == 0 {
+		return nil, errs.ErrValidationFailed.WithDetails("没有匹配的设备")
+	}
+
+	c := &model.OTACampaign{
+		ID:                 uuid.New(),
+		Name:               req.Name,
+		FirmwareID:         fw.ID,
+		TargetTypeIDs:      req.TypeIDs,
+		TargetTagIDs:       req.TagIDs,
+		TargetDeviceIDs:    req.DeviceIDs,
+		BatchSize:          req.BatchSize,
+		StageTimeoutSecond: req.StageTimeoutSecond,
+		MaxFailureRatio:    ratio,
+		Status:             model.OTACampaignDraft,
+		CreatedBy:          userID,
+		CreatedAt:          time.Now(),
+	}
+	if c.TargetTypeIDs == nil {
+		c.TargetTypeIDs = []int64{}
+	}
+	if c.TargetTagIDs == nil {
+		c.TargetTagIDs = []int64{}
+	}
+	if c.TargetDeviceIDs == nil {
+		c.TargetDeviceIDs = []string{}
+	}
+	if err := s.repo.CreateCampaign(c, devices); err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return s.GetCampaign(c.ID.String())
+}
+
+// StartCampaign 草稿任务开始推送第一批
+func (s *otaService) StartCampaign(id string) (*model.OTACampaign, error) {
+	s.mu.Lock()
+	c, err := s.loadCampaign(id)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if c.Status != model.OTACampaignDraft {
+		s.mu.Unlock()
+		return nil, errs.ErrStatusConflict.WithDetails("只有草稿任务可以启动，当前状态: " + c.Status)
+	}
+	now := time.Now()
+	ok, err := s.repo.StartCampaign(c.ID, now)
+	if err == nil && ok {
+		c.Status = model.OTACampaignRunning
+		c.StartedAt = &now
+		s.advance(c)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if !ok {
+		return nil, errs.ErrStatusConflict.WithDetails("任务已被其他请求启动或中止")
+	}
+	log.Printf("[INFO] OTA 任务已启动  campaignID=%s  firmware=%s@%s", c.ID, c.Firmware.Name, c.Firmware.Version)
+	return s.GetCampaign(id)
+}
+
+// AbortCampaign 中止任务：排队设备不再推送，已通知的设备收到 abort
+func (s *otaService) AbortCampaign(id, reason string) (*model.OTACampaign, error) {
+	s.mu.Lock()
+	c, err := s.loadCampaign(id)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if c.Status != model.OTACampaignDraft && c.Status != model.OTACampaignRunning {
+		s.mu.Unlock()
+		return nil, errs.ErrStatusConflict.WithDetails("任务已结束: " + c.Status)
+	}
+	if reason == "" {
+		reason = "手动中止"
+	}
+	ok, err := s.abort(c, reason)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if !ok {
+		return nil, errs.ErrStatusConflict.WithDetails("任务已结束")
+	}
+	return s.GetCampaign(id)
+}
+
+func (s *otaService) GetCampaign(id string) (*model.OTACampaign, error) {
+	c, err := s.loadCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Counts, err = s.repo.CountDevices(c.ID); err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if c.Firmware != nil {
+		s.fillURL(c.Firmware)
+	}
+	return c, nil
+}
+
+func (s *otaService) ListCampaigns(status string, page, limit int) ([]model.OTACampaign, int64, error) {
+	list, total, err := s.repo.ListCampaigns(status, (page-1)*limit, limit)
+	if err != nil {
+		return nil, 0, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	for i := range list {
+		if list[i].Firmware != nil {
+			s.fillURL(list[i].Firmware)
+		}
+	}
+	return list, total, nil
+}
+
+func (s *otaService) ListCampaignDevices(id, status string, page, limit int) ([]model.OTACampaignDevice, int64, error) {
+	c, err := s.loadCampaign(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	list, total, err := s.repo.ListDevices(c.ID, status, (page-1)*limit, limit)
+	if err != nil {
+		return nil, 0, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	return list, total, nil
+}
+
+func (s *otaService) loadCampaign(id string) (*model.OTACampaign, error) {
+	cid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errs.ErrInvalidInput.WithDetails("任务 ID 格式错误")
+	}
+	c, err := s.repo.GetCampaign(cid)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if c == nil {
+		return nil, errs.ErrResourceNotFound.WithDetails("升级任务不存在")
+	}
+	return c, nil
+}
+
+/* ---------- 设备进度 ---------- */
+
+// OnProgress 订阅 ota-progress/#
+func (s *otaService) OnProgress(c mqtt.Client, msg mqtt.Message) {
+	deviceID := strings.TrimPrefix(msg.Topic(), OTAProgressTopicPrefix)
+	var p model.OTAProgressMsg
+	if err := json.Unmarshal(msg.Payload(), &p); err != nil {
+		log.Printf("[WARN] 无法解析 OTA 进度  topic=%s  payload=%s", msg.Topic(), string(msg.Payload()))
+		return
+	}
+	switch p.Status {
+	case model.OTADeviceDownloading, model.OTADeviceInstalling, model.OTADeviceSucceeded, model.OTADeviceFailed:
+	default:
+		log.Printf("[WARN] 未知的 OTA 状态  deviceID=%s  status=%s", deviceID, p.Status)
+		return
+	}
+	cid, err := uuid.Parse(p.CampaignID)
+	if err != nil {
+		return
+	}
+
+	d, err := s.repo.GetDevice(cid, deviceID)
+	if err != nil {
+		log.Printf("[ERROR] 查询 OTA 设备失败  deviceID=%s  err=%v", deviceID, err)
+		return
+	}
+	if d == nil {
+		return
+	}
+	// 已结束的设备只接受超时后补到的成功
+	if d.Finished() && !(d.Status == model.OTADeviceFailed && p.Status == model.OTADeviceSucceeded) {
+		return
+	}
+
+	// 任务已中止 / 完成，或设备状态已被其他写入改变时不再更新
+	prev := d.Status
+	d.Status = p.Status
+	d.Progress = min(max(p.Progress, 0), 100)
+	if p.Status == model.OTADeviceSucceeded {
+		d.Progress = 100
+	}
+	d.Message = p.Msg
+	d.UpdatedAt = time.Now()
+	ok, err := s.repo.SaveProgress(d, prev)
+	if err != nil {
+		log.Printf("[ERROR] 更新 OTA 进度失败  deviceID=%s  err=%v", deviceID, err)
+		return
+	}
+	if !ok {
+		log.Printf("[WARN] 忽略 OTA 进度：任务不在运行中或设备状态已变化  campaignID=%s  deviceID=%s  status=%s", cid, deviceID, p.Status)
+		return
+	}
+	if d.Finished() {
+		log.Printf("[INFO] OTA 设备结束  campaignID=%s  deviceID=%s  status=%s", cid, deviceID, d.Status)
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+/* ---------- 分批推进 ---------- */
+
+func (s *otaService) loop() {
+	defer close(s.done)
+	tick := time.NewTicker(otaTick)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-s.kick:
+		case <-s.stop:
+			return
+		}
+		s.step()
+	}
+}
+
+// step 检查所有运行中的任务，当前批结束（或超时）后推进；未持有租约的副本跳过
+func (s *otaService) step() {
+	if !s.lease.Hold() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.repo.ListRunningCampaigns()
+	if err != nil {
+		log.Printf("[ERROR] 查询运行中的 OTA 任务失败: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range list {
+		c := &list[i]
+		devices, err := s.repo.ListStageDevices(c.ID, c.CurrentStage)
+		if err != nil {
+			log.Printf("[ERROR] 查询 OTA 批次失败  campaignID=%s  err=%v", c.ID, err)
+			continue
+		}
+
+		finished := true
+		for _, d := range devices {
+			if !d.Finished() {
+				finished = false
+				break
+			}
+		}
+		timedOut := c.StageStartedAt != nil && now.Sub(*c.StageStartedAt) > time.Duration(c.StageTimeoutSecond)*time.Second
+		if !finished && !timedOut {
+			continue
+		}
+		if !finished {
+			if _, err := s.repo.MarkDevices(c.ID, c.CurrentStage, model.OTADeviceActive, model.OTADeviceFailed, "本批超时未完成"); err != nil {
+				log.Printf("[ERROR] 标记 OTA 超时设备失败  campaignID=%s  err=%v", c.ID, err)
+				continue
+			}
+			if devices, err = s.repo.ListStageDevices(c.ID, c.CurrentStage); err != nil {
+				continue
+			}
+		}
+
+		failed := 0
+		for _, d := range devices {
+			if d.Status == model.OTADeviceFailed {
+				failed++
+			}
+		}
+		if len(devices) > 0 && float64(failed)/float64(len(devices)) > c.MaxFailureRatio {
+			reason := fmt.Sprintf("第 %d 批失败率 %d/%d 超过阈值 %.2f", c.CurrentStage, failed, len(devices), c.MaxFailureRatio)
+			if _, err := s.abort(c, reason); err != nil {
+				log.Printf("[ERROR] 中止 OTA 任务失败  campaignID=%s  err=%v", c.ID, err)
+			}
+			continue
+		}
+		s.advance(c)
+	}
+}
+
+// advance 推送下一批；没有排队设备时任务完成，任务已不在运行中（被其他副本中止）时不推送。调用方持有 mu。
+// 设备状态与批次先落库再发布通知，避免设备的进度上报早于 notified 状态写入
+func (s *otaService) advance(c *model.OTACampaign) {
+	now := time.Now()
+	ids, ok, err := s.repo.AdvanceStage(c.ID, c.CurrentStage+1, c.BatchSize, now)
+	if err != nil {
+		log.Printf("[ERROR] 推进 OTA 批次失败  campaignID=%s  err=%v", c.ID, err)
+		return
+	}
+	if !ok {
+		log.Printf("[WARN] OTA 任务已不在运行中，停止推进  campaignID=%s", c.ID)
+		return
+	}
+	if len(ids) == 0 {
+		c.Status = model.OTACampaignCompleted
+		c.FinishedAt = &now
+		log.Printf("[INFO] OTA 任务完成  campaignID=%s  stages=%d", c.ID, c.CurrentStage)
+		return
+	}
+
+	c.CurrentStage++
+	c.StageStartedAt = &now
+	fw := c.Firmware
+	if fw == nil {
+		return
+	}
+	s.fillURL(fw)
+	for _, id := range ids {
+		s.notify(id, model.OTANotifyMsg{
+			Action:     "upgrade",
+			CampaignID: c.ID.String(),
+			FirmwareID: fw.ID.String(),
+			Name:       fw.Name,
+			Version:    fw.Version,
+			URL:        fw.URL,
+			SHA256:     fw.SHA256,
+			Size:       fw.FileSize,
+		})
+	}
+	log.Printf("[INFO] OTA 推送第 %d 批  campaignID=%s  devices=%d", c.CurrentStage, c.ID, len(ids))
+}
+
+// abort 中止任务并通知已推送的设备；任务已结束（如被其他副本完成或中止）时返回 false。调用方持有 mu
+func (s *otaService) abort(c *model.OTACampaign, reason string) (bool, error) {
+	now := time.Now()
+	notified, ok, err := s.repo.AbortCampaign(c.ID, reason, now)
+	if err != nil || !ok {
+		return ok, err
+	}
+	c.Status = model.OTACampaignAborted
+	c.Reason = reason
+	c.FinishedAt = &now
+	for _, id := range notified {
+		s.notify(id, model.OTANotifyMsg{Action: "abort", CampaignID: c.ID.String()})
+	}
+	log.Printf("[WARN] OTA 任务已中止  campaignID=%s  reason=%s  notified=%d", c.ID, reason, len(notified))
+	return true, nil
+}
+
+func (s *otaService) notify(deviceID string, m model.OTANotifyMsg) {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	token := s.c.Publish(OTATopicPrefix+deviceID, 1, false, payload)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Printf("[ERROR] OTA 通知发布失败  deviceID=%s  err=%v", deviceID, err)
+	}
+}
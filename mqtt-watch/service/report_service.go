@@ -0,0 +1,384 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/repo"
+)
+
+const (
+	MaxReportRange         = 31 * 24 * time.Hour
+	DefaultReportGap       = 5 * time.Minute
+	DefaultOccupancyWindow = 5 * time.Minute
+)
+
+// ReportService 围栏人数与进出统计：历史定位取自 device_loc，围栏判定交给 map-service
+type ReportService interface {
+	// Occupancy 当前人数：每台设备取 window 内最后一次定位
+	Occupancy(window time.Duration, deviceIDs []string) ([]model.FenceOccupancy, error)
+	// Traffic 时间范围内各围栏的进出次数
+	Traffic(q model.ReportQuery) ([]model.FenceTraffic, error)
+	// Dwell 时间范围内各设备在各围栏的累计停留时间
+	Dwell(q model.ReportQuery) ([]model.FenceDwell, error)
+	// Peak 时间范围内各围栏的最高同时人数
+	Peak(q model.ReportQuery) ([]model.FencePeak, error)
+}
+
+type reportService struct {
+	locRepo  repo.MongoRepo
+	markRepo repo.MarkRepo
+	fences   FenceClient
+}
+
+func NewReportService(locRepo repo.MongoRepo, markRepo repo.MarkRepo, fences FenceClient) ReportService {
+	return &reportService{locRepo: locRepo, markRepo: markRepo, fences: fences}
+}
+
+/* ---------- 当前人数 ---------- */
+
+func (s *reportService) Occupancy(window time.Duration, deviceIDs []string) ([]model.FenceOccupancy, error) {
+	if window <= 0 || window > MaxReportRange {
+		return nil, errs.ErrInvalidInput.WithDetails("window_seconds 超出范围")
+	}
+	locs, err := s.locRepo.LatestLocs(time.Now().Add(-window), deviceIDs)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	assigned, err := s.markRepo.GetMapIDs()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+
+	points := make([]model.FencePoint, 0, len(locs))
+	for _, loc := range locs {
+		if p, ok := toFencePoint(loc, assigned); ok {
+			points = append(points, p)
+		}
+	}
+	hits, err := s.fences.CheckBatch(points)
+	if err != nil {
+		return nil, errs.ErrThirdParty.WithDetails(err.Error())
+	}
+
+	byFence := make(map[string]*model.FenceOccupancy)
+	for i, p := range points {
+		for _, h := range hits[i] {
+			o, ok := byFence[h.FenceID]
+			if !ok {
+				o = &model.FenceOccupancy{FenceID: h.FenceID, FenceName: h.FenceName, DeviceIDs: []string{}}
+				byFence[h.FenceID] = o
+			}
+			o.Count++
+			o.DeviceIDs = append(o.DeviceIDs, p.DeviceID)
+		}
+	}
+
+	out := make([]model.FenceOccupancy, 0, len(byFence))
+	for _, o := range byFence {
+		sort.Strings(o.DeviceIDs)
+		out = append(out, *o)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].FenceName < out[j].FenceName
+	})
+	return out, nil
+}
+
+/* ---------- 时间范围统计 ---------- */
+
+func (s *reportService) Traffic(q model.ReportQuery) ([]model.FenceTraffic, error) {
+	a, err := s.analyze(q)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.FenceTraffic, 0, len(a.traffic))
+	for _, t := range a.traffic {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Entries != out[j].Entries {
+			return out[i].Entries > out[j].Entries
+		}
+		return out[i].FenceName < out[j].FenceName
+	})
+	return out, nil
+}
+
+func (s *reportService) Dwell(q model.ReportQuery) ([]model.FenceDwell, error) {
+	a, err := s.analyze(q)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.FenceDwell, 0, len(a.dwell))
+	for _, d := range a.dwell {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].FenceName != out[j].FenceName {
+			return out[i].FenceName < out[j].FenceName
+		}
+		if out[i].DwellSeconds != out[j].DwellSeconds {
+			return out[i].DwellSeconds > out[j].DwellSeconds
+		}
+		return out[i].DeviceID < out[j].DeviceID
+	})
+	return out, nil
+}
+
+func (s *reportService) Peak(q model.ReportQuery) ([]model.FencePeak, error) {
+	a, err := s.analyze(q)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.FencePeak, 0, len(a.peak))
+	for _, p := range a.peak {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Peak != out[j].Peak {
+			return out[i].Peak > out[j].Peak
+		}
+		return out[i].FenceName < out[j].FenceName
+	})
+	return out, nil
+}
+
+// analyze 按时间顺序回放范围内的定位，每批点交给 map-service 判定后更新各设备的围栏状态
+func (s *reportService) analyze(q model.ReportQuery) (*fenceAnalysis, error) {
+	if !q.To.After(q.From) {
+		return nil, errs.ErrInvalidInput.WithDetails("to 必须晚于 from")
+	}
+	if q.To.Sub(q.From) > MaxReportRange {
+		return nil, errs.ErrInvalidInput.WithDetails(fmt.Sprintf("时间范围不能超过 %d 天", int(MaxReportRange.Hours()/24)))
+	}
+	if q.Gap <= 0 {
+		q.Gap = DefaultReportGap
+	}
+
+	assigned, err := s.markRepo.GetMapIDs()
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+
+	a := newFenceAnalysis(q.Gap)
+	points := make([]model.FencePoint, 0, fenceBatchSize)
+	times := make([]time.Time, 0, fenceBatchSize)
+	var fenceErr error
+	flush := func() error {
+		if len(points) == 0 {
+			return nil
+		}
+		hits, err := s.fences.CheckBatch(points)
+		if err != nil {
+			fenceErr = err
+			return err
+		}
+		for i := range points {
+			a.apply(points[i].DeviceID, times[i], hits[i])
+		}
+		points, times = points[:0], times[:0]
+		return nil
+	}
+
+	total := 0
+	err = s.locRepo.EachLoc(q, func(loc model.DeviceLoc) error {
+		p, ok := toFencePoint(loc, assigned)
+		if !ok {
+			return nil
+		}
+		total++
+		points = append(points, p)
+		times = append(times, loc.RecordTime)
+		if len(points) >= fenceBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if fenceErr != nil {
+		return nil, errs.ErrThirdParty.WithDetails(fenceErr.Error())
+	}
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+
+	a.finish()
+	log.Printf("[INFO] 围栏统计完成  from=%s  to=%s  points=%d  devices=%d  fences=%d",
+		q.From.Format(time.RFC3339), q.To.Format(time.RFC3339), total, len(a.devices), len(a.traffic))
+	return a, nil
+}
+
+// toFencePoint 有 UWB 坐标时按室内点判定（地图取上报携带的，否则取设备分配的），否则按 RTK 经纬度判定；
+// 经纬度经 StoredLonLat 读取，兼容早期对调存储的记录
+func toFencePoint(loc model.DeviceLoc, assigned map[string]string) (model.FencePoint, bool) {
+	p := model.FencePoint{DeviceID: loc.DeviceID}
+	switch {
+	case loc.UWBX != nil && loc.UWBY != nil:
+		p.X, p.Y, p.Indoor = *loc.UWBX, *loc.UWBY, true
+		p.MapID = loc.MapID
+		if p.MapID == "" {
+			p.MapID = assigned[loc.DeviceID]
+		}
+		// map-service 拒绝非 UUID 的地图 ID，避免一条脏数据使整批判定失败
+		if _, err := uuid.Parse(p.MapID); err != nil {
+			p.MapID = ""
+		}
+	case loc.Latitude != nil && loc.Longitude != nil:
+		p.X, p.Y, _ = loc.StoredLonLat()
+		if p.X < -180 || p.X > 180 || p.Y < -90 || p.Y > 90 {
+			return p, false
+		}
+	default:
+		return p, false
+	}
+	return p, true
+}
+
+/* ---------- 状态回放 ---------- */
+
+type dwellKey struct {
+	fenceID  string
+	deviceID string
+}
+
+// deviceFences 设备当前所在的围栏及进入时间
+type deviceFences struct {
+	lastSeen time.Time
+	inside   map[string]time.Time
+}
+
+// fenceAnalysis 按时间顺序消费定位点的统计状态
+type fenceAnalysis struct {
+	gap       time.Duration
+	nextSweep time.Time
+
+	devices map[string]*deviceFences
+	current map[string]int // fenceID -> 当前人数
+	traffic map[string]*model.FenceTraffic
+	dwell   map[dwellKey]*model.FenceDwell
+	peak    map[string]*model.FencePeak
+}
+
+func newFenceAnalysis(gap time.Duration) *fenceAnalysis {
+	return &fenceAnalysis{
+		gap:     gap,
+		devices: make(map[string]*deviceFences),
+		current: make(map[string]int),
+		traffic: make(map[string]*model.FenceTraffic),
+		dwell:   make(map[dwellKey]*model.FenceDwell),
+		peak:    make(map[string]*model.FencePeak),
+	}
+}
+
+// apply 处理设备在 t 时刻的一次定位；范围内的第一次定位只确定初始位置，不计入进入次数
+func (a *fenceAnalysis) apply(deviceID string, t time.Time, hits []model.FenceHit) {
+	// 定期清理信号丢失的设备，否则它们会一直计入当前人数，抬高峰值
+	if !t.Before(a.nextSweep) {
+		a.sweep(t)
+		a.nextSweep = t.Add(a.gap / 4)
+	}
+
+	d, seen := a.devices[deviceID]
+	if !seen {
+		d = &deviceFences{inside: make(map[string]time.Time)}
+		a.devices[deviceID] = d
+	} else if t.Sub(d.lastSeen) > a.gap {
+		a.leaveAll(deviceID, d)
+	}
+
+	cur := make(map[string]bool, len(hits))
+	for _, h := range hits {
+		cur[h.FenceID] = true
+		a.trafficOf(h.FenceID, h.FenceName)
+	}
+	for fenceID, since := range d.inside {
+		if !cur[fenceID] {
+			a.leave(deviceID, d, fenceID, since, t)
+		}
+	}
+	for _, h := range hits {
+		if _, ok := d.inside[h.FenceID]; !ok {
+			a.enter(deviceID, d, h.FenceID, t, seen)
+		}
+	}
+	d.lastSeen = t
+}
+
+// sweep 超过 gap 未上报的设备按最后一次定位时间离开全部围栏
+func (a *fenceAnalysis) sweep(now time.Time) {
+	for deviceID, d := range a.devices {
+		if len(d.inside) > 0 && now.Sub(d.lastSeen) > a.gap {
+			a.leaveAll(deviceID, d)
+		}
+	}
+}
+
+func (a *fenceAnalysis) leaveAll(deviceID string, d *deviceFences) {
+	for fenceID, since := range d.inside {
+		a.leave(deviceID, d, fenceID, since, d.lastSeen)
+	}
+}
+
+func (a *fenceAnalysis) enter(deviceID string, d *deviceFences, fenceID string, t time.Time, counted bool) {
+	d.inside[fenceID] = t
+	if counted {
+		a.traffic[fenceID].Entries++
+	}
+	a.dwellOf(fenceID, deviceID).Visits++
+
+	a.current[fenceID]++
+	p := a.peak[fenceID]
+	if a.current[fenceID] > p.Peak {
+		at := t
+		p.Peak, p.PeakAt = a.current[fenceID], &at
+	}
+}
+
+func (a *fenceAnalysis) leave(deviceID string, d *deviceFences, fenceID string, since, t time.Time) {
+	delete(d.inside, fenceID)
+	a.traffic[fenceID].Exits++
+	a.dwellOf(fenceID, deviceID).DwellSeconds += t.Sub(since).Seconds()
+	a.current[fenceID]--
+}
+
+// finish 范围结束时仍在围栏内的设备，停留时间计到其最后一次定位，不计离开次数
+func (a *fenceAnalysis) finish() {
+	for deviceID, d := range a.devices {
+		for fenceID, since := range d.inside {
+			a.dwellOf(fenceID, deviceID).DwellSeconds += d.lastSeen.Sub(since).Seconds()
+		}
+	}
+}
+
+// trafficOf 首次出现的围栏同时建立进出与峰值记录
+func (a *fenceAnalysis) trafficOf(fenceID, fenceName string) *model.FenceTraffic {
+	t, ok := a.traffic[fenceID]
+	if !ok {
+		t = &model.FenceTraffic{FenceID: fenceID, FenceName: fenceName}
+		a.traffic[fenceID] = t
+		a.peak[fenceID] = &model.FencePeak{FenceID: fenceID, FenceName: fenceName}
+	}
+	return t
+}
+
+func (a *fenceAnalysis) dwellOf(fenceID, deviceID string) *model.FenceDwell {
+	k := dwellKey{fenceID: fenceID, deviceID: deviceID}
+	d, ok := a.dwell[k]
+	if !ok {
+		d = &model.FenceDwell{FenceID: fenceID, FenceName: a.traffic[fenceID].FenceName, DeviceID: deviceID}
+		a.dwell[k] = d
+	}
+	return d
+}
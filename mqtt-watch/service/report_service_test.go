@@ -0,0 +1,168 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+func TestToFencePointRTK(t *testing.T) {
+	lon, lat := 121.891751, 30.902079
+	cases := []struct {
+		name string
+		loc  model.DeviceLoc
+	}{
+		// 当前写入：Longitude=v[0]，带 LonLat 标记
+		{"current", model.DeviceLoc{DeviceID: "d1", Longitude: &lon, Latitude: &lat, LonLat: true}},
+		// 早期记录：v[0] 存进了 latitude，没有标记
+		{"legacy", model.DeviceLoc{DeviceID: "d1", Latitude: &lon, Longitude: &lat}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, ok := toFencePoint(tc.loc, nil)
+			if !ok {
+				t.Fatal("point rejected")
+			}
+			if p.Indoor || p.X != lon || p.Y != lat {
+				t.Errorf("point = (%v, %v, indoor=%v), want (%v, %v, outdoor)", p.X, p.Y, p.Indoor, lon, lat)
+			}
+		})
+	}
+}
+
+// fix 设备在 min 分钟时的一次定位，fences 为命中的围栏
+type fix struct {
+	device string
+	min    float64
+	fences []string
+}
+
+type traffic struct{ entries, exits int }
+
+type dwell struct {
+	visits  int
+	seconds float64
+}
+
+type peak struct {
+	peak int
+	min  float64 // 首次达到峰值的时间（分钟）
+}
+
+func TestFenceAnalysis(t *testing.T) {
+	const gap = 10 * time.Minute
+	cases := []struct {
+		name    string
+		fixes   []fix
+		traffic map[string]traffic
+		dwell   map[string]dwell // key: 围栏/设备
+		peak    map[string]peak
+	}{
+		{
+			// 范围内第一次定位只确定初始位置，离开仍计数
+			name:    "first fix not counted as entry",
+			fixes:   []fix{{"d1", 0, []string{"A"}}, {"d1", 1, []string{"A"}}, {"d1", 2, nil}},
+			traffic: map[string]traffic{"A": {0, 1}},
+			dwell:   map[string]dwell{"A/d1": {1, 120}},
+			peak:    map[string]peak{"A": {1, 0}},
+		},
+		{
+			name:    "enter and leave",
+			fixes:   []fix{{"d1", 0, nil}, {"d1", 1, []string{"A"}}, {"d1", 3, nil}},
+			traffic: map[string]traffic{"A": {1, 1}},
+			dwell:   map[string]dwell{"A/d1": {1, 120}},
+			peak:    map[string]peak{"A": {1, 1}},
+		},
+		{
+			// 范围结束时仍在围栏内：停留计到最后一次定位，不计离开
+			name:    "dwell at finish",
+			fixes:   []fix{{"d1", 0, nil}, {"d1", 1, []string{"A"}}, {"d1", 5, []string{"A"}}},
+			traffic: map[string]traffic{"A": {1, 0}},
+			dwell:   map[string]dwell{"A/d1": {1, 240}},
+			peak:    map[string]peak{"A": {1, 1}},
+		},
+		{
+			// 信号丢失超过 gap：按最后一次定位离开全部围栏，恢复后重新进入并计数
+			name: "leave all on signal loss",
+			fixes: []fix{
+				{"d1", 0, []string{"A", "B"}},
+				{"d1", 2, []string{"A", "B"}},
+				{"d1", 20, []string{"A"}},
+				{"d1", 21, []string{"A"}},
+			},
+			traffic: map[string]traffic{"A": {1, 1}, "B": {0, 1}},
+			dwell:   map[string]dwell{"A/d1": {2, 180}, "B/d1": {1, 120}},
+			peak:    map[string]peak{"A": {1, 0}, "B": {1, 0}},
+		},
+		{
+			// d1 之后不再上报，由其他设备的定位触发清理，不再计入当前人数
+			name: "gap sweep keeps silent devices out of peak",
+			fixes: []fix{
+				{"d1", 0, []string{"A"}},
+				{"d2", 15, nil},
+				{"d3", 16, []string{"A"}},
+				{"d3", 18, []string{"A"}},
+			},
+			traffic: map[string]traffic{"A": {0, 1}},
+			dwell:   map[string]dwell{"A/d1": {1, 0}, "A/d3": {1, 120}},
+			peak:    map[string]peak{"A": {1, 0}},
+		},
+		{
+			name: "concurrent devices peak",
+			fixes: []fix{
+				{"d1", 0, nil}, {"d2", 0, nil},
+				{"d1", 1, []string{"A"}},
+				{"d2", 2, []string{"A"}},
+				{"d1", 3, nil},
+				{"d2", 4, nil},
+			},
+			traffic: map[string]traffic{"A": {2, 2}},
+			dwell:   map[string]dwell{"A/d1": {1, 120}, "A/d2": {1, 120}},
+			peak:    map[string]peak{"A": {2, 2}},
+		},
+	}
+
+	t0 := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	at := func(min float64) time.Time { return t0.Add(time.Duration(min * float64(time.Minute))) }
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newFenceAnalysis(gap)
+			for _, f := range tc.fixes {
+				hits := make([]model.FenceHit, 0, len(f.fences))
+				for _, id := range f.fences {
+					hits = append(hits, model.FenceHit{FenceID: id, FenceName: "fence-" + id})
+				}
+				a.apply(f.device, at(f.min), hits)
+			}
+			a.finish()
+
+			if len(a.traffic) != len(tc.traffic) {
+				t.Errorf("traffic for %d fences, want %d", len(a.traffic), len(tc.traffic))
+			}
+			for id, want := range tc.traffic {
+				got := a.traffic[id]
+				if got == nil || got.Entries != want.entries || got.Exits != want.exits || got.FenceName != "fence-"+id {
+					t.Errorf("traffic[%s] = %+v, want %+v", id, got, want)
+				}
+			}
+
+			if len(a.dwell) != len(tc.dwell) {
+				t.Errorf("dwell has %d entries, want %d", len(a.dwell), len(tc.dwell))
+			}
+			for k, d := range a.dwell {
+				want, ok := tc.dwell[k.fenceID+"/"+k.deviceID]
+				if !ok || d.Visits != want.visits || d.DwellSeconds != want.seconds {
+					t.Errorf("dwell[%s/%s] = %+v, want %+v", k.fenceID, k.deviceID, d, want)
+				}
+			}
+
+			for id, want := range tc.peak {
+				got := a.peak[id]
+				if got == nil || got.Peak != want.peak || got.PeakAt == nil || !got.PeakAt.Equal(at(want.min)) {
+					t.Errorf("peak[%s] = %+v, want %d at %v", id, got, want.peak, at(want.min))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// service/shadow_service.go
+package service
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/mqtt-watch/errs"
+	"IOT-Manage-System/mqtt-watch/model"
+	"IOT-Manage-System/mqtt-watch/repo"
+	"IOT-Manage-System/mqtt-watch/utils"
+)
+
+// 影子主题：shadow/<device_id>/delta 下发差异，shadow/<device_id>/reported 设备上报
+const (
+	ShadowTopicPrefix     = "shadow/"
+	ShadowDeltaSuffix     = "/delta"
+	ShadowReportedSuffix  = "/reported"
+	ShadowReportedPattern = ShadowTopicPrefix + "+" + ShadowReportedSuffix
+
+	// shadowSaveRetries 条件写入冲突时的最多重试次数
+	shadowSaveRetries = 5
+)
+
+// errShadowUnknownDevice 上报影子的设备未登记为标记
+var errShadowUnknownDevice = errors.New("未登记的设备")
+
+type ShadowService interface {
+	Get(deviceID string) (*model.ShadowView, error)
+	ReplaceDesired(deviceID string, req model.ShadowDesiredReq) (*model.ShadowView, error)
+	PatchDesired(deviceID string, req model.ShadowDesiredReq) (*model.ShadowView, error)
+	OnReported(c mqtt.Client, msg mqtt.Message)
+	OnOnline(c mqtt.Client, msg mqtt.Message)
+	Start()
+	Stop()
+}
+
+// shadowService 设备影子：
+//   - 修改 desired 或设备上线（online/#）时，计算 desired 与 reported 的差异并下发
+//   - 设备应用配置后在 reported 主题上报，按 JSON Merge Patch 合并
+//
+// 下发在独立协程中进行，不在 MQTT 回调里等待 QoS 1 确认。
+// reported 主题为共享订阅、desired 可由任一副本修改，读-改-写以文档 rev 条件写入，冲突时重读重试
+type shadowService struct {
+	c           mqtt.Client
+	repo        repo.ShadowRepo
+	markService MarkService
+
+	push chan string
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewShadowService(c mqtt.Client, r repo.ShadowRepo, markService MarkService) ShadowService {
+	return &shadowService{
+		c:           c,
+		repo:        r,
+		markService: markService,
+		push:        make(chan string, 1024),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (s *shadowService) Start() {
+	go s.pushLoop()
+}
+
+func (s *shadowService) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *shadowService) Get(deviceID string) (*model.ShadowView, error) {
+	sh, err := s.load(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if sh == nil {
+		if err := s.ensureMark(deviceID); err != nil {
+			return nil, err
+		}
+		sh = newShadow(deviceID)
+	}
+	return viewOf(sh), nil
+}
+
+func (s *shadowService) ReplaceDesired(deviceID string, req model.ShadowDesiredReq) (*model.ShadowView, error) {
+	return s.updateDesired(deviceID, req, func(sh *model.DeviceShadow) {
+		sh.Desired = req.State
+	})
+}
+
+func (s *shadowService) PatchDesired(deviceID string, req model.ShadowDesiredReq) (*model.ShadowView, error) {
+	return s.updateDesired(deviceID, req, func(sh *model.DeviceShadow) {
+		sh.Desired = mergePatch(sh.Desired, req.State)
+	})
+}
+
+func (s *shadowService) updateDesired(deviceID string, req model.ShadowDesiredReq, apply func(*model.DeviceShadow)) (*model.ShadowView, error) {
+	if req.State == nil {
+		return nil, errs.ErrValidationFailed.WithDetails("state 不能为空")
+	}
+	if err := s.ensureMark(deviceID); err != nil {
+		return nil, err
+	}
+
+	sh, err := s.modify(deviceID, func(sh *model.DeviceShadow) error {
+		if req.Version != nil && *req.Version != sh.Version {
+			return errs.ErrResourceConflict.WithDetails(map[string]int64{"current_version": sh.Version})
+		}
+		apply(sh)
+		if sh.Desired == nil {
+			sh.Desired = map[string]any{}
+		}
+		now := time.Now()
+		sh.Version++
+		sh.DesiredAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.enqueue(deviceID)
+	return viewOf(sh), nil
+}
+
+// OnReported 订阅 shadow/+/reported；影子不存在时只为已登记的标记新建，未知设备的上报丢弃
+func (s *shadowService) OnReported(c mqtt.Client, msg mqtt.Message) {
+	deviceID := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), ShadowTopicPrefix), ShadowReportedSuffix)
+	var rep model.ShadowReportedMsg
+	if err := json.Unmarshal(msg.Payload(), &rep); err != nil || rep.State == nil || deviceID == "" {
+		log.Printf("[WARN] 无法解析影子上报  topic=%s  payload=%s", msg.Topic(), string(msg.Payload()))
+		return
+	}
+
+	sh, err := s.modify(deviceID, func(sh *model.DeviceShadow) error {
+		if sh.Rev == 0 {
+			meta, err := s.markService.GetMarkMeta(deviceID)
+			if err != nil {
+				return err
+			}
+			if meta == nil {
+				return errShadowUnknownDevice
+			}
+		}
+		now := time.Now()
+		sh.Reported = mergePatch(sh.Reported, rep.State)
+		sh.ReportedAt = &now
+		return nil
+	})
+	if errors.Is(err, errShadowUnknownDevice) {
+		log.Printf("[WARN] 未登记的设备上报影子，已丢弃  deviceID=%s", deviceID)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] 保存设备影子失败  deviceID=%s  err=%v", deviceID, err)
+		return
+	}
+	log.Printf("[INFO] 设备影子已上报  deviceID=%s  inSync=%t", deviceID, len(computeDelta(sh.Desired, sh.Reported)) == 0)
+}
+
+// OnOnline 设备上线时补发未生效的配置
+func (s *shadowService) OnOnline(c mqtt.Client, msg mqtt.Message) {
+	if deviceID := utils.ParseOnlineId(msg.Topic(), msg.Payload()); deviceID != "" {
+		s.enqueue(deviceID)
+	}
+}
+
+func (s *shadowService) enqueue(deviceID string) {
+	select {
+	case s.push <- deviceID:
+	default:
+		log.Printf("[WARN] 影子下发队列已满，丢弃  deviceID=%s", deviceID)
+	}
+}
+
+func (s *shadowService) pushLoop() {
+	defer close(s.done)
+	for {
+		select {
+		case id := <-s.push:
+			s.pushDelta(id)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// pushDelta 有差异时下发，没有影子或已同步时不发
+func (s *shadowService) pushDelta(deviceID string) {
+	sh, err := s.load(deviceID)
+	if err != nil {
+		log.Printf("[ERROR] 读取设备影子失败  deviceID=%s  err=%v", deviceID, err)
+		return
+	}
+	if sh == nil {
+		return
+	}
+	delta := computeDelta(sh.Desired, sh.Reported)
+	if len(delta) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(model.ShadowDeltaMsg{Version: sh.Version, State: delta, TS: time.Now().UnixMilli()})
+	if err != nil {
+		return
+	}
+	token := s.c.Publish(ShadowTopicPrefix+deviceID+ShadowDeltaSuffix, 1, false, payload)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Printf("[ERROR] 影子差异下发失败  deviceID=%s  err=%v", deviceID, err)
+		return
+	}
+	log.Printf("[PUB] topic=%s%s%s version=%d keys=%d", ShadowTopicPrefix, deviceID, ShadowDeltaSuffix, sh.Version, len(delta))
+
+	if err := s.repo.SetDeltaAt(deviceID, time.Now()); err != nil {
+		log.Printf("[WARN] 记录影子下发时间失败  deviceID=%s  err=%v", deviceID, err)
+	}
+}
+
+// modify 读取影子（不存在时新建）交给 apply 修改后条件写入；
+// 写入期间被其他请求或副本修改时重读重试，apply 返回的错误原样返回
+func (s *shadowService) modify(deviceID string, apply func(sh *model.DeviceShadow) error) (*model.DeviceShadow, error) {
+	for i := 0; i < shadowSaveRetries; i++ {
+		sh, err := s.load(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if sh == nil {
+			sh = newShadow(deviceID)
+		}
+		if err := apply(sh); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(sh)
+		if errors.Is(err, repo.ErrShadowConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, errs.ErrDatabase.WithDetails(err.Error())
+		}
+		return sh, nil
+	}
+	return nil, errs.ErrResourceConflict.WithDetails("设备影子并发修改频繁，请稍后重试")
+}
+
+func (s *shadowService) load(deviceID string) (*model.DeviceShadow, error) {
+	sh, err := s.repo.Get(deviceID)
+	if err != nil {
+		return nil, errs.ErrDatabase.WithDetails(err.Error())
+	}
+	if sh != nil {
+		sh.Desired = normalizeDoc(sh.Desired)
+		sh.Reported = normalizeDoc(sh.Reported)
+	}
+	return sh, nil
+}
+
+// ensureMark 影子只对已登记的标记开放编辑
+func (s *shadowService) ensureMark(deviceID string) error {
+	meta, err := s.markService.GetMarkMeta(deviceID)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return errs.ErrResourceNotFound.WithDetails("标记不存在: " + deviceID)
+	}
+	return nil
+}
+
+func newShadow(deviceID string) *model.DeviceShadow {
+	return &model.DeviceShadow{DeviceID: deviceID, Desired: map[string]any{}, Reported: map[string]any{}}
+}
+
+func viewOf(sh *model.DeviceShadow) *model.ShadowView {
+	delta := computeDelta(sh.Desired, sh.Reported)
+	return &model.ShadowView{DeviceShadow: *sh, Delta: delta, InSync: len(delta) == 0}
+}
+
+// mergePatch RFC 7386：patch 中 null 删除键，对象递归合并，其余整体替换
+func mergePatch(dst, patch map[string]any) map[string]any {
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		if pm, ok := v.(map[string]any); ok {
+			dm, _ := dst[k].(map[string]any)
+			dst[k] = mergePatch(dm, pm)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// computeDelta desired 中与 reported 不一致的部分；对象逐层比较，数组整体比较
+func computeDelta(desired, reported map[string]any) map[string]any {
+	delta := map[string]any{}
+	for k, dv := range desired {
+		rv, ok := reported[k]
+		if dm, isMap := dv.(map[string]any); isMap {
+			rm, _ := rv.(map[string]any)
+			if sub := computeDelta(dm, rm); len(sub) > 0 {
+				delta[k] = sub
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(dv, rv) {
+			delta[k] = dv
+		}
+	}
+	return delta
+}
+
+// normalizeDoc Mongo 解码出的 primitive.M / primitive.A 转为 JSON 同构的 map / slice，
+// 数字统一为 float64，保证与请求体解码结果可直接比较
+func normalizeDoc(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return m
+	}
+	out := map[string]any{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return m
+	}
+	return out
+}
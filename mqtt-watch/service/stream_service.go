@@ -0,0 +1,267 @@
+// service/stream_service.go
+package service
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+const (
+	streamQueueSize  = 4096        // MQTT 回调 -> 分发协程的缓冲
+	streamSubBuffer  = 256         // 每个订阅者的缓冲，满了丢弃，慢客户端不拖累其他人
+	streamMetaTTL    = time.Minute // 标记类型 / 标签缓存时间
+	streamMetaRetry  = 10 * time.Second
+	streamMaxPosKeep = 24 * time.Hour // 超过该时间未更新的最后位置不再参与区域过滤
+)
+
+// StreamFilter 订阅过滤条件，各条件之间为“且”，同一条件内为“或”；零值表示不过滤
+type StreamFilter struct {
+	Events  map[string]bool // position / presence / alarm
+	Devices map[string]bool
+	Types   []string    // 标记类型 ID 或名称
+	Tags    []string    // 标签 ID 或名称
+	BBox    *[4]float64 // 室外经纬度范围：minLon,minLat,maxLon,maxLat
+	XYBox   *[4]float64 // 室内 UWB 坐标范围（cm）：minX,minY,maxX,maxY
+}
+
+func (f *StreamFilter) needMeta() bool {
+	return len(f.Types) > 0 || len(f.Tags) > 0
+}
+
+// StreamSubscriber 一个实时推送连接
+type StreamSubscriber struct {
+	C      chan model.StreamEvent
+	filter StreamFilter
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// Dropped 取出并清零因缓冲满而丢弃的事件数
+func (s *StreamSubscriber) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
+
+type streamMetaEntry struct {
+	meta     *model.MarkMeta
+	expireAt time.Time
+}
+
+// StreamHub 实时事件分发：MQTT 回调调用 Publish 投递，
+// 单个分发协程按订阅者的过滤条件扇出，类型 / 标签按设备缓存
+type StreamHub struct {
+	markService MarkService
+	in          chan model.StreamEvent
+
+	mu   sync.RWMutex
+	subs map[*StreamSubscriber]struct{}
+
+	// 以下只在分发协程中访问
+	meta    map[string]streamMetaEntry
+	lastPos map[string]*model.DeviceLoc
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewStreamHub 构造函数，启动分发协程
+func NewStreamHub(markService MarkService) *StreamHub {
+	h := &StreamHub{
+		markService: markService,
+		in:          make(chan model.StreamEvent, streamQueueSize),
+		subs:        make(map[*StreamSubscriber]struct{}),
+		meta:        make(map[string]streamMetaEntry),
+		lastPos:     make(map[string]*model.DeviceLoc),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go h.loop()
+	return h
+}
+
+// Publish 投递事件，不阻塞调用方（MQTT 回调），队列满时丢弃
+func (h *StreamHub) Publish(e model.StreamEvent) {
+	if h == nil {
+		return
+	}
+	select {
+	case h.in <- e:
+	default:
+		log.Printf("[WARN] 实时推送队列已满，丢弃事件  type=%s  deviceID=%s", e.Type, e.DeviceID)
+	}
+}
+
+// Subscribe 新增订阅者
+func (h *StreamHub) Subscribe(f StreamFilter) *StreamSubscriber {
+	s := &StreamSubscriber{C: make(chan model.StreamEvent, streamSubBuffer), filter: f}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	n := len(h.subs)
+	h.mu.Unlock()
+	log.Printf("[INFO] 实时推送订阅者加入  total=%d", n)
+	return s
+}
+
+// Unsubscribe 移除订阅者并关闭其通道，可重复调用
+func (h *StreamHub) Unsubscribe(s *StreamSubscriber) {
+	h.mu.Lock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.C)
+	}
+	n := len(h.subs)
+	h.mu.Unlock()
+	log.Printf("[INFO] 实时推送订阅者离开  total=%d", n)
+}
+
+// Close 停止分发并关闭所有订阅者通道
+func (h *StreamHub) Close() {
+	h.once.Do(func() {
+		close(h.stop)
+		<-h.done
+		h.mu.Lock()
+		for s := range h.subs {
+			delete(h.subs, s)
+			close(s.C)
+		}
+		h.mu.Unlock()
+	})
+}
+
+func (h *StreamHub) loop() {
+	defer close(h.done)
+	for {
+		select {
+		case e := <-h.in:
+			h.dispatch(e)
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+func (h *StreamHub) dispatch(e model.StreamEvent) {
+	if e.Type == model.StreamPosition {
+		if loc, ok := e.Data.(*model.DeviceLoc); ok {
+			h.lastPos[e.DeviceID] = loc
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.subs) == 0 {
+		return
+	}
+
+	var meta *model.MarkMeta
+	metaLoaded := false
+	for s := range h.subs {
+		f := &s.filter
+		if f.needMeta() && !metaLoaded {
+			meta = h.markMeta(e.DeviceID)
+			metaLoaded = true
+		}
+		if !h.match(f, e, meta) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (h *StreamHub) match(f *StreamFilter, e model.StreamEvent, meta *model.MarkMeta) bool {
+	if len(f.Events) > 0 && !f.Events[e.Type] {
+		return false
+	}
+	if len(f.Devices) > 0 && !f.Devices[e.DeviceID] {
+		return false
+	}
+	if len(f.Types) > 0 {
+		if meta == nil || !matchAny(f.Types, []int{meta.TypeID}, []string{meta.TypeName}) {
+			return false
+		}
+	}
+	if len(f.Tags) > 0 {
+		if meta == nil || !matchAny(f.Tags, meta.TagIDs, meta.TagNames) {
+			return false
+		}
+	}
+	if f.BBox != nil || f.XYBox != nil {
+		// 位置事件按自身坐标判断，其余事件按设备最后位置判断
+		loc := h.lastPos[e.DeviceID]
+		if loc == nil || time.Since(loc.CreatedAt) > streamMaxPosKeep {
+			return false
+		}
+		if !inArea(f, loc) {
+			return false
+		}
+	}
+	return true
+}
+
+// inArea 同时给了经纬度与 UWB 范围时，落在任一范围内即可；
+// 实时位置由 DeviceLoc.SetRTK 写入，Longitude 为 RTK v[0]，Latitude 为 v[1]
+func inArea(f *StreamFilter, loc *model.DeviceLoc) bool {
+	if b := f.BBox; b != nil && loc.Latitude != nil && loc.Longitude != nil {
+		lon, lat := *loc.Longitude, *loc.Latitude
+		if lon >= b[0] && lat >= b[1] && lon <= b[2] && lat <= b[3] {
+			return true
+		}
+	}
+	if b := f.XYBox; b != nil && loc.UWBX != nil && loc.UWBY != nil {
+		x, y := *loc.UWBX, *loc.UWBY
+		if x >= b[0] && y >= b[1] && x <= b[2] && y <= b[3] {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(want []string, ids []int, names []string) bool {
+	for _, w := range want {
+		for _, id := range ids {
+			if w == strconv.Itoa(id) {
+				return true
+			}
+		}
+		for _, n := range names {
+			if w == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markMeta 取设备类型 / 标签（带缓存），设备不存在或查询失败时返回 nil
+func (h *StreamHub) markMeta(deviceID string) *model.MarkMeta {
+	now := time.Now()
+	e, ok := h.meta[deviceID]
+	if ok && now.Before(e.expireAt) {
+		return e.meta
+	}
+
+	meta, err := h.markService.GetMarkMeta(deviceID)
+	if err != nil {
+		log.Printf("[WARN] 查询标记类型/标签失败  deviceID=%s  err=%v", deviceID, err)
+		e.expireAt = now.Add(streamMetaRetry)
+		h.meta[deviceID] = e
+		return e.meta
+	}
+	h.meta[deviceID] = streamMetaEntry{meta: meta, expireAt: now.Add(streamMetaTTL)}
+	return meta
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+
+	"IOT-Manage-System/mqtt-watch/model"
+)
+
+func TestInAreaRTK(t *testing.T) {
+	loc := &model.DeviceLoc{DeviceID: "device-001"}
+	loc.SetRTK([]float64{121.891751, 30.902079}) // 上报 v=[经度, 纬度]
+
+	cases := []struct {
+		name string
+		bbox [4]float64
+		want bool
+	}{
+		{"contains", [4]float64{121.8, 30.8, 122.0, 31.0}, true},
+		{"swapped box", [4]float64{30.8, 121.8, 31.0, 122.0}, false},
+		{"elsewhere", [4]float64{116.3, 39.8, 116.5, 40.0}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := tc.bbox
+			if got := inArea(&StreamFilter{BBox: &b}, loc); got != tc.want {
+				t.Errorf("inArea = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -52,3 +52,14 @@ func ParsePositiveInt64(s string) (int64, error) {
 	}
 	return v, err
 }
+
+// InstanceID 副本标识：INSTANCE_ID，缺省取主机名（容器 / Pod 名），同一副本重启后保持不变
+func InstanceID() string {
+	if v := os.Getenv("INSTANCE_ID"); v != "" {
+		return v
+	}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		return h
+	}
+	return "mqtt-watch"
+}
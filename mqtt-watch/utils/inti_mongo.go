@@ -134,4 +134,14 @@ func DeviceLocColl() *mongo.Collection {
 		panic("mongo not initialized")
 	}
 	return deviceLocC
-}
\ No newline at end of file
+}
+// CommandColl 下行指令记录集合
+func CommandColl() *mongo.Collection {
+	return Mongo().Database(GetEnv("MONGO_DB", "mqtt_db")).Collection("device_cmd")
+}
+
+// ShadowColl 设备影子集合；嵌套文档统一解码为 map，便于与 JSON 互转
+func ShadowColl() *mongo.Collection {
+	return Mongo().Database(GetEnv("MONGO_DB", "mqtt_db")).Collection("device_shadow",
+		options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true}))
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -10,32 +11,115 @@ import (
 
 var MQTTClient mqtt.Client
 
-// InitMQTT 由 main.go 主动调用
-func InitMQTT() {
+type mqttSub struct {
+	qos     byte
+	handler mqtt.MessageHandler
+}
+
+// 已登记的订阅：重连后由 OnConnect 回调逐个恢复
+var (
+	mqttSubsMu sync.Mutex
+	mqttSubs   = make(map[string]mqttSub)
+)
+
+// InitMQTT 由 main.go 主动调用，连接失败返回错误
+func InitMQTT() error {
 	url := GetEnv("MQTT_BROKER", "ws://8.133.17.175:8083")
 	opts := mqtt.NewClientOptions().
 		AddBroker(url).
-		SetClientID(fmt.Sprintf("warning-watch-%d", time.Now().UnixNano())).
+		SetClientID(ClientID()).
 		SetUsername(GetEnv("MQTT_USERNAME", "admin")).
 		SetPassword(GetEnv("MQTT_PASSWORD", "admin")).
 		SetKeepAlive(60 * time.Second).
 		SetPingTimeout(10 * time.Second).
 		SetAutoReconnect(true).
 		SetMaxReconnectInterval(10 * time.Second).
-		SetCleanSession(false)
+		SetCleanSession(false).
+		SetOnConnectHandler(resubscribe).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			log.Printf("[WARN] mqtt 连接断开，等待自动重连: %v", err)
+		})
 
 	MQTTClient = mqtt.NewClient(opts)
 	if token := MQTTClient.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatalf("mqtt connect error: %v", token.Error())
+		return fmt.Errorf("mqtt connect: %w", token.Error())
 	}
 	log.Println("连接" + url + " mqtt broker 成功")
+	return nil
+}
+
+// ClientID MQTT_CLIENT_ID，缺省为 mqtt-watch-<副本标识>。CleanSession 为 false，
+// 固定的 ClientID 使副本重启后接回 broker 上保留的会话（订阅与断开期间暂存的 QoS 1 消息）；
+// 各副本的 ClientID 必须不同，否则互相踢下线
+func ClientID() string {
+	return GetEnv("MQTT_CLIENT_ID", "mqtt-watch-"+InstanceID())
+}
+
+// SubscribeMQTT 订阅并登记，断线重连后自动恢复；
+// 同一主题重复调用只保留最后一次的回调，可安全重入
+func SubscribeMQTT(topic string, qos byte, h mqtt.MessageHandler) error {
+	mqttSubsMu.Lock()
+	defer mqttSubsMu.Unlock()
+	token := MQTTClient.Subscribe(topic, qos, h)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("订阅 %s 失败: %w", topic, token.Error())
+	}
+	mqttSubs[topic] = mqttSub{qos: qos, handler: h}
+	return nil
+}
+
+// UnsubscribeMQTT 退订并取消登记
+func UnsubscribeMQTT(topic string) error {
+	mqttSubsMu.Lock()
+	defer mqttSubsMu.Unlock()
+	token := MQTTClient.Unsubscribe(topic)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("退订 %s 失败: %w", topic, token.Error())
+	}
+	delete(mqttSubs, topic)
+	return nil
 }
 
-func CloseMQTT() {
-	if MQTTClient != nil && MQTTClient.IsConnected() {
-		MQTTClient.Disconnect(250) // 250 ms 等待内部 goroutine 结束
-		log.Println("mqtt disconnected")
+// resubscribe broker 未保留会话（重启、会话过期）时，重连后订阅会丢失，这里统一补订
+func resubscribe(c mqtt.Client) {
+	mqttSubsMu.Lock()
+	defer mqttSubsMu.Unlock()
+	if len(mqttSubs) == 0 {
+		return // 首次连接，订阅尚未登记
+	}
+	for topic, s := range mqttSubs {
+		if token := c.Subscribe(topic, s.qos, s.handler); token.Wait() && token.Error() != nil {
+			log.Printf("[ERROR] 重连后恢复订阅 %s 失败: %v", topic, token.Error())
+		}
+	}
+	log.Printf("[INFO] mqtt 重连成功，已恢复 %d 个订阅", len(mqttSubs))
+}
+
+// ShareGroup 共享订阅分组（MQTT_SHARE_GROUP），为空表示不使用共享订阅
+func ShareGroup() string {
+	return GetEnv("MQTT_SHARE_GROUP", "")
+}
+
+// SharedTopic 启用共享订阅时返回 $share/<group>/<filter>：同组多个副本由 broker 轮流投递，每条消息只处理一次
+func SharedTopic(filter string) string {
+	if g := ShareGroup(); g != "" {
+		return "$share/" + g + "/" + filter
+	}
+	return filter
+}
+
+// MQTTConnected 连接是否可用（就绪检查用）
+func MQTTConnected() bool {
+	return MQTTClient != nil && MQTTClient.IsConnectionOpen()
+}
+
+// CloseMQTT 断开连接，停止接收消息；quiesce 毫秒内等待处理中的消息完成。可重复调用
+func CloseMQTT(quiesce uint) {
+	if MQTTClient == nil {
+		return
+	}
+	if MQTTClient.IsConnected() {
+		MQTTClient.Disconnect(quiesce)
+		log.Println("断开mqtt broker连接成功")
 	}
-	MQTTClient = nil // 方便再 Init
-	log.Println("断开mqtt broker连接成功")
 }
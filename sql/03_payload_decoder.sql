@@ -0,0 +1,6 @@
+-- 标记类型绑定载荷解码器
+-- payload_decoder: legacy / senml / jsonpath / binary / flat
+-- decoder_config : 解码器参数，jsonpath 为字段路径映射，binary 为结构体布局
+ALTER TABLE mark_types
+    ADD COLUMN IF NOT EXISTS payload_decoder VARCHAR(64) NOT NULL DEFAULT 'legacy',
+    ADD COLUMN IF NOT EXISTS decoder_config  JSONB;
@@ -0,0 +1,5 @@
+-- 设备在线状态：由 warning-service 在上下线时推送，last_online_at 按节流频率刷新
+ALTER TABLE marks
+    ADD COLUMN IF NOT EXISTS is_online BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_marks_online ON marks (is_online, last_online_at);
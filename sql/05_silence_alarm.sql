@@ -0,0 +1,5 @@
+-- 静默报警：在线设备连续 N 秒未上报则由 warning-service 发布 alarm/<device_id>
+-- NULL 表示不报警；围栏内阈值为 NULL 时沿用 silence_alarm_second
+ALTER TABLE mark_types
+    ADD COLUMN IF NOT EXISTS silence_alarm_second INT,
+    ADD COLUMN IF NOT EXISTS silence_alarm_in_fence_second INT;
@@ -0,0 +1,56 @@
+-- 固件 OTA：固件包、升级任务、任务内的设备进度（由 mqtt-watch 维护）
+CREATE TABLE IF NOT EXISTS firmwares
+(
+    id         UUID         NOT NULL DEFAULT gen_random_uuid(),
+    name       VARCHAR(255) NOT NULL,
+    version    VARCHAR(64)  NOT NULL,
+    file_path  VARCHAR(512) NOT NULL,
+    file_size  BIGINT       NOT NULL,
+    sha256     CHAR(64)     NOT NULL,
+    notes      TEXT         NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_firmware_name_version UNIQUE (name, version)
+);
+
+-- status: draft / running / completed / aborted
+CREATE TABLE IF NOT EXISTS ota_campaigns
+(
+    id                   UUID             NOT NULL DEFAULT gen_random_uuid(),
+    name                 VARCHAR(255)     NOT NULL,
+    firmware_id          UUID             NOT NULL,
+    target_type_ids      INTEGER[]        NOT NULL DEFAULT '{}',
+    target_tag_ids       INTEGER[]        NOT NULL DEFAULT '{}',
+    target_device_ids    TEXT[]           NOT NULL DEFAULT '{}',
+    batch_size           INTEGER          NOT NULL DEFAULT 10,
+    stage_timeout_second INTEGER          NOT NULL DEFAULT 1800,
+    max_failure_ratio    DOUBLE PRECISION NOT NULL DEFAULT 0.2,
+    status               VARCHAR(32)      NOT NULL DEFAULT 'draft',
+    current_stage        INTEGER          NOT NULL DEFAULT 0,
+    stage_started_at     TIMESTAMPTZ,
+    reason               TEXT             NOT NULL DEFAULT '',
+    created_by           VARCHAR(255)     NOT NULL DEFAULT '',
+    created_at           TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    started_at           TIMESTAMPTZ,
+    finished_at          TIMESTAMPTZ,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_ota_firmware FOREIGN KEY (firmware_id) REFERENCES firmwares (id) ON DELETE RESTRICT
+);
+
+-- status: queued / notified / downloading / installing / succeeded / failed / aborted
+CREATE TABLE IF NOT EXISTS ota_campaign_devices
+(
+    campaign_id UUID         NOT NULL,
+    device_id   VARCHAR(255) NOT NULL,
+    stage       INTEGER      NOT NULL DEFAULT 0,
+    status      VARCHAR(32)  NOT NULL DEFAULT 'queued',
+    progress    INTEGER      NOT NULL DEFAULT 0,
+    message     TEXT         NOT NULL DEFAULT '',
+    notified_at TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (campaign_id, device_id),
+    CONSTRAINT fk_ota_campaign FOREIGN KEY (campaign_id) REFERENCES ota_campaigns (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ota_devices_device ON ota_campaign_devices (device_id, updated_at DESC);
@@ -0,0 +1,17 @@
+-- 设备 MQTT 凭据：每个标记一套独立的 broker 账号（由 mark-service 签发）
+-- password_hash 为 Mosquitto 口令文件格式 $7$<iterations>$<salt>$<hash>（PBKDF2-SHA512）
+-- status: active / revoked
+CREATE TABLE IF NOT EXISTS device_credentials
+(
+    mark_id       UUID         NOT NULL,
+    device_id     VARCHAR(255) NOT NULL,
+    username      VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    status        VARCHAR(32)  NOT NULL DEFAULT 'active',
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    rotated_at    TIMESTAMPTZ,
+    revoked_at    TIMESTAMPTZ,
+    PRIMARY KEY (mark_id),
+    CONSTRAINT uq_device_credentials_username UNIQUE (username),
+    CONSTRAINT fk_device_credentials_mark FOREIGN KEY (mark_id) REFERENCES marks (id) ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+-- 围栏形状扩展：圆形、走廊（折线缓冲）、带洞多边形、多多边形
+-- geometry 统一存储为面（POLYGON / MULTIPOLYGON），圆形和走廊写入时用 ST_Buffer 缓冲，
+-- 原始参数（圆心半径、中心线宽度）存放在 shape_params 中便于回显和编辑
+ALTER TABLE polygon_fences
+    ALTER COLUMN geometry TYPE GEOMETRY(GEOMETRY, 0) USING geometry::GEOMETRY(GEOMETRY, 0);
+
+ALTER TABLE polygon_fences
+    ADD COLUMN IF NOT EXISTS shape        VARCHAR(20) NOT NULL DEFAULT 'polygon',
+    ADD COLUMN IF NOT EXISTS shape_params JSONB;
+
+ALTER TABLE polygon_fences
+    ADD CONSTRAINT chk_polygon_fences_shape
+        CHECK (shape IN ('polygon', 'circle', 'corridor', 'multipolygon')),
+    ADD CONSTRAINT chk_polygon_fences_geometry_type
+        CHECK (GeometryType(geometry) IN ('POLYGON', 'MULTIPOLYGON'));
+
+COMMENT ON COLUMN polygon_fences.shape IS '围栏形状：polygon / circle / corridor / multipolygon';
+COMMENT ON COLUMN polygon_fences.shape_params IS '原始形状参数：circle 为 {center, radius}，corridor 为 {path, width}';
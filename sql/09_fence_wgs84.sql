@@ -0,0 +1,33 @@
+-- 室外围栏改用 WGS84（SRID 4326，x=经度，y=纬度），室内围栏保持平面坐标（SRID 0）
+-- 室外围栏的圆形 / 走廊按米缓冲，面积、周长按 geography 计算
+ALTER TABLE polygon_fences
+    ALTER COLUMN geometry TYPE GEOMETRY(GEOMETRY) USING geometry::GEOMETRY;
+
+DO
+$$
+DECLARE
+    moved INTEGER;
+BEGIN
+    -- 坐标超出经纬度范围的旧室外围栏无法解释为 WGS84，转为室内并停用，由管理员确认后处理
+    UPDATE polygon_fences
+    SET is_indoor = TRUE,
+        is_active = FALSE,
+        updated_at = CURRENT_TIMESTAMP
+    WHERE is_indoor = FALSE
+      AND (ST_XMin(geometry) < -180 OR ST_XMax(geometry) > 180 OR ST_YMin(geometry) < -90 OR ST_YMax(geometry) > 90);
+    GET DIAGNOSTICS moved = ROW_COUNT;
+    IF moved > 0 THEN
+        RAISE NOTICE '% 个室外围栏坐标不是经纬度，已转为室内并停用', moved;
+    END IF;
+END
+$$;
+
+UPDATE polygon_fences
+SET geometry = ST_SetSRID(geometry, 4326)
+WHERE is_indoor = FALSE;
+
+ALTER TABLE polygon_fences
+    ADD CONSTRAINT chk_polygon_fences_srid
+        CHECK ((is_indoor AND ST_SRID(geometry) = 0) OR (NOT is_indoor AND ST_SRID(geometry) = 4326));
+
+COMMENT ON COLUMN polygon_fences.geometry IS '围栏几何：室内 SRID 0（平面坐标），室外 SRID 4326（WGS84 经度, 纬度）';
@@ -0,0 +1,28 @@
+-- 按自制地图（楼层）划分室内坐标平面：多层建筑每层复用同一套 UWB X/Y 范围，
+-- 室内围栏、基站与设备可绑定所在地图，围栏与距离判定只比较同一地图上的对象。
+-- map_id 为 NULL 表示全局（不区分地图），与旧数据行为一致
+ALTER TABLE polygon_fences
+    ADD COLUMN IF NOT EXISTS map_id UUID
+        CONSTRAINT fk_polygon_fences_map REFERENCES custom_maps (id) ON DELETE RESTRICT;
+
+ALTER TABLE base_stations
+    ADD COLUMN IF NOT EXISTS map_id UUID
+        CONSTRAINT fk_base_stations_map REFERENCES custom_maps (id) ON DELETE RESTRICT;
+
+-- 设备被分配的地图，上报中携带 map 时以上报为准；地图删除后设备回到未分配
+ALTER TABLE marks
+    ADD COLUMN IF NOT EXISTS map_id UUID
+        CONSTRAINT fk_marks_map REFERENCES custom_maps (id) ON DELETE SET NULL;
+
+-- 自制地图只描述室内平面，室外围栏（WGS84）不绑定地图
+ALTER TABLE polygon_fences
+    ADD CONSTRAINT chk_polygon_fences_map_indoor
+        CHECK (is_indoor OR map_id IS NULL);
+
+CREATE INDEX IF NOT EXISTS idx_polygon_fences_map ON polygon_fences (map_id);
+CREATE INDEX IF NOT EXISTS idx_base_stations_map ON base_stations (map_id);
+CREATE INDEX IF NOT EXISTS idx_marks_map ON marks (map_id);
+
+COMMENT ON COLUMN polygon_fences.map_id IS '所属自制地图（楼层），NULL 表示全局围栏';
+COMMENT ON COLUMN base_stations.map_id IS '所属自制地图（楼层），NULL 表示未指定';
+COMMENT ON COLUMN marks.map_id IS '设备被分配的自制地图（楼层），NULL 表示未分配';
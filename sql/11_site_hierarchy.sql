@@ -0,0 +1,49 @@
+-- 站点层级：站点（site）→ 楼栋（building）→ 楼层（floor），站点下还可有室外场地（yard）。
+-- 自制地图、基站、围栏可挂到任意节点；基站 / 围栏未指定节点时归属其自制地图所在的节点。
+-- tenant 由站点设置，子节点继承，用于按租户过滤
+CREATE TABLE IF NOT EXISTS site_nodes
+(
+    id          UUID         NOT NULL DEFAULT gen_random_uuid(),
+    parent_id   UUID
+        CONSTRAINT fk_site_nodes_parent REFERENCES site_nodes (id) ON DELETE RESTRICT,
+    node_type   VARCHAR(20)  NOT NULL,
+    name        VARCHAR(255) NOT NULL,
+    tenant      VARCHAR(64)  NOT NULL DEFAULT '',
+    description TEXT,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT chk_site_nodes_type CHECK (node_type IN ('site', 'building', 'floor', 'yard')),
+    CONSTRAINT chk_site_nodes_root CHECK ((node_type = 'site') = (parent_id IS NULL))
+);
+
+-- 同一父节点下名称唯一（站点之间按租户唯一）
+CREATE UNIQUE INDEX IF NOT EXISTS uq_site_nodes_child_name ON site_nodes (parent_id, name) WHERE parent_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_site_nodes_site_name ON site_nodes (tenant, name) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_site_nodes_parent ON site_nodes (parent_id);
+CREATE INDEX IF NOT EXISTS idx_site_nodes_tenant ON site_nodes (tenant);
+
+COMMENT ON TABLE site_nodes IS '站点层级节点：site / building / floor / yard';
+COMMENT ON COLUMN site_nodes.parent_id IS '父节点，站点为 NULL';
+COMMENT ON COLUMN site_nodes.node_type IS '节点类型：site / building / floor / yard';
+COMMENT ON COLUMN site_nodes.tenant IS '所属租户，由站点设置，子节点继承';
+
+ALTER TABLE custom_maps
+    ADD COLUMN IF NOT EXISTS node_id UUID
+        CONSTRAINT fk_custom_maps_node REFERENCES site_nodes (id) ON DELETE RESTRICT;
+
+ALTER TABLE base_stations
+    ADD COLUMN IF NOT EXISTS node_id UUID
+        CONSTRAINT fk_base_stations_node REFERENCES site_nodes (id) ON DELETE RESTRICT;
+
+ALTER TABLE polygon_fences
+    ADD COLUMN IF NOT EXISTS node_id UUID
+        CONSTRAINT fk_polygon_fences_node REFERENCES site_nodes (id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_custom_maps_node ON custom_maps (node_id);
+CREATE INDEX IF NOT EXISTS idx_base_stations_node ON base_stations (node_id);
+CREATE INDEX IF NOT EXISTS idx_polygon_fences_node ON polygon_fences (node_id);
+
+COMMENT ON COLUMN custom_maps.node_id IS '所属站点层级节点（通常为楼层），NULL 表示未归属';
+COMMENT ON COLUMN base_stations.node_id IS '所属站点层级节点，NULL 时取自制地图所在节点';
+COMMENT ON COLUMN polygon_fences.node_id IS '所属站点层级节点，NULL 时取自制地图所在节点';
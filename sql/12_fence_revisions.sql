@@ -0,0 +1,40 @@
+-- 围栏修订历史：每次创建 / 修改 / 导入 / 回滚 / 删除后保存围栏的完整快照，
+-- 记录操作人（网关透传的 X-UserID）、时间与相对上一版本的字段差异，用于追溯与回滚。
+-- 不对 polygon_fences 建外键：围栏删除后其历史仍保留
+CREATE TABLE IF NOT EXISTS polygon_fence_revisions
+(
+    id             BIGSERIAL PRIMARY KEY,
+    fence_id       UUID         NOT NULL,
+    version        INT          NOT NULL,
+    action         VARCHAR(20)  NOT NULL,
+    editor         VARCHAR(255) NOT NULL DEFAULT '',
+    source_version INT,
+    is_indoor      BOOLEAN      NOT NULL,
+    fence_name     VARCHAR(255) NOT NULL,
+    shape          VARCHAR(20)  NOT NULL,
+    geometry       GEOMETRY     NOT NULL,
+    shape_params   JSONB,
+    map_id         UUID,
+    node_id        UUID,
+    description    TEXT,
+    is_active      BOOLEAN      NOT NULL,
+    diff           JSONB,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    CONSTRAINT uq_polygon_fence_revisions_version UNIQUE (fence_id, version),
+    CONSTRAINT chk_polygon_fence_revisions_action CHECK (action IN ('create', 'update', 'import', 'rollback', 'delete'))
+);
+
+COMMENT ON TABLE polygon_fence_revisions IS '围栏修订历史，每行为一次变更后的围栏快照';
+COMMENT ON COLUMN polygon_fence_revisions.version IS '围栏内递增的版本号，从 1 开始';
+COMMENT ON COLUMN polygon_fence_revisions.action IS '变更类型：create / update / import / rollback / delete（delete 为删除前的快照）';
+COMMENT ON COLUMN polygon_fence_revisions.editor IS '操作人用户 ID，空串表示未知（如迁移前已存在的围栏）';
+COMMENT ON COLUMN polygon_fence_revisions.source_version IS 'rollback 时回滚到的版本号';
+COMMENT ON COLUMN polygon_fence_revisions.diff IS '相对上一版本变化的字段：{"字段": {"old": …, "new": …}}';
+
+-- 已有围栏以当前状态作为版本 1，保证首次修改后仍可回滚到原样
+INSERT INTO polygon_fence_revisions (fence_id, version, action, is_indoor, fence_name, shape, geometry,
+                                     shape_params, map_id, node_id, description, is_active, created_at)
+SELECT f.id, 1, 'create', f.is_indoor, f.fence_name, f.shape, f.geometry,
+       f.shape_params, f.map_id, f.node_id, f.description, f.is_active, f.updated_at
+FROM polygon_fences f
+WHERE NOT EXISTS (SELECT 1 FROM polygon_fence_revisions r WHERE r.fence_id = f.id);
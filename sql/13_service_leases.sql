@@ -0,0 +1,10 @@
+-- 多副本协调租约（由 mqtt-watch 维护），同名租约同一时刻只有一个持有者，过期后可被其他副本接管：
+--   instance:<id>  各副本的存活心跳，过期后其在途指令由其他副本接管
+--   ota-rollout    OTA 分批推进，只由持有者执行
+CREATE TABLE IF NOT EXISTS service_leases
+(
+    name       VARCHAR(255) NOT NULL,
+    holder     VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ  NOT NULL,
+    PRIMARY KEY (name)
+);
@@ -0,0 +1,6 @@
+-- 用户所属租户，写入访问令牌后由网关以 X-Tenant 透传；map-service 据此限定列表查询的范围。
+-- 空串表示未分配租户，只能看到未归属任何租户的资源；admin / root 不受限制
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS tenant VARCHAR(64) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN users.tenant IS '所属租户，对应 site_nodes.tenant';
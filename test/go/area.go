@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cmPerMeter      = 100.0
+	metersPerDegLat = 110540.0
+	metersPerDegLon = 111320.0 // 赤道处，按纬度余弦缩放
+)
+
+// Point 区域内的平面坐标（米）
+type Point struct{ X, Y float64 }
+
+// Area 模拟区域。运动统一在以米为单位、原点为区域左下角的平面坐标中计算，发布时再换算：
+//   - uwb：CustomMap 坐标系（与 UWB 上报一致，厘米），发布 UWB [x, y]
+//   - rtk：经纬度矩形，以西南角为原点做等距投影，发布 RTK [lon, lat]
+type Area struct {
+	Kind  string  // uwb / rtk
+	W, H  float64 // 宽高（米）
+	MapID string  // -map 时为 CustomMap ID，随 location 上报
+
+	x0, y0     float64 // uwb 原点（厘米）
+	lon0, lat0 float64 // rtk 原点
+	lonScale   float64 // rtk 每度经度对应的米数
+}
+
+func NewUWBArea(xMin, yMin, xMax, yMax float64) (*Area, error) {
+	if xMax <= xMin || yMax <= yMin {
+		return nil, fmt.Errorf("UWB 区域无效: x %.2f~%.2f y %.2f~%.2f", xMin, xMax, yMin, yMax)
+	}
+	return &Area{
+		Kind: "uwb",
+		W:    (xMax - xMin) / cmPerMeter,
+		H:    (yMax - yMin) / cmPerMeter,
+		x0:   xMin,
+		y0:   yMin,
+	}, nil
+}
+
+func NewRTKArea(lonMin, latMin, lonMax, latMax float64) (*Area, error) {
+	if lonMax <= lonMin || latMax <= latMin || lonMin < -180 || lonMax > 180 || latMin < -90 || latMax > 90 {
+		return nil, fmt.Errorf("RTK 区域无效: lon %.6f~%.6f lat %.6f~%.6f", lonMin, lonMax, latMin, latMax)
+	}
+	scale := metersPerDegLon * math.Cos((latMin+latMax)/2*math.Pi/180)
+	return &Area{
+		Kind:     "rtk",
+		W:        (lonMax - lonMin) * scale,
+		H:        (latMax - latMin) * metersPerDegLat,
+		lon0:     lonMin,
+		lat0:     latMin,
+		lonScale: scale,
+	}, nil
+}
+
+// ToLocal 区域原生坐标（uwb 为厘米，rtk 为 lon,lat）转换为平面坐标
+func (a *Area) ToLocal(u, v float64) Point {
+	if a.Kind == "rtk" {
+		return Point{X: (u - a.lon0) * a.lonScale, Y: (v - a.lat0) * metersPerDegLat}
+	}
+	return Point{X: (u - a.x0) / cmPerMeter, Y: (v - a.y0) / cmPerMeter}
+}
+
+// Sen 把平面坐标转换为定位传感器读数
+func (a *Area) Sen(p Point) Sen {
+	if a.Kind == "rtk" {
+		return Sen{Name: "RTK", Unit: "deg", Value: []float64{
+			round(a.lon0+p.X/a.lonScale, 7),
+			round(a.lat0+p.Y/metersPerDegLat, 7),
+		}}
+	}
+	return Sen{Name: "UWB", Unit: "cm", Value: []float64{
+		round(a.x0+p.X*cmPerMeter, 1),
+		round(a.y0+p.Y*cmPerMeter, 1),
+	}}
+}
+
+// Clamp 限制在区域内
+func (a *Area) Clamp(p Point) Point {
+	return Point{X: math.Max(0, math.Min(a.W, p.X)), Y: math.Max(0, math.Min(a.H, p.Y))}
+}
+
+// ParsePath 解析 "u1,v1;u2,v2;..."（区域原生坐标）
+func (a *Area) ParsePath(s string) ([]Point, error) {
+	var pts []Point
+	for _, seg := range strings.Split(s, ";") {
+		if seg = strings.TrimSpace(seg); seg == "" {
+			continue
+		}
+		v, err := parseFloats(seg, 2)
+		if err != nil {
+			return nil, fmt.Errorf("路径点 %q: %w", seg, err)
+		}
+		pts = append(pts, a.Clamp(a.ToLocal(v[0], v[1])))
+	}
+	return pts, nil
+}
+
+// FetchCustomMap 从 map-service 读取 CustomMap 的坐标范围，id 为 latest 时取最新地图
+func FetchCustomMap(baseURL, id string) (*Area, error) {
+	url := strings.TrimRight(baseURL, "/") + "/api/v1/custom-map/" + id
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("请求 %s 失败: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Message string `json:"message"`
+		Data    struct {
+			ID      string  `json:"id"`
+			MapName string  `json:"map_name"`
+			XMin    float64 `json:"x_min"`
+			XMax    float64 `json:"x_max"`
+			YMin    float64 `json:"y_min"`
+			YMax    float64 `json:"y_max"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("解析地图响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取地图失败: %d %s", resp.StatusCode, body.Message)
+	}
+	d := body.Data
+	fmt.Printf("使用地图 %s：x %.1f~%.1f  y %.1f~%.1f\n", d.MapName, d.XMin, d.XMax, d.YMin, d.YMax)
+	area, err := NewUWBArea(d.XMin, d.YMin, d.XMax, d.YMax)
+	if err != nil {
+		return nil, err
+	}
+	area.MapID = d.ID
+	return area, nil
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("需要 %d 个数值，实际 %d 个", n, len(parts))
+	}
+	out := make([]float64, n)
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func round(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
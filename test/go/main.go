@@ -1,60 +1,213 @@
+// 设备模拟器：启动 N 个虚拟标签，按运动模型在 CustomMap（UWB）或经纬度矩形（RTK）内移动，
+// 定时发布 online/<id> 与 location/<id>，并响应 warning / cmd / shadow / ota 下行，用于压测与演示。
+//
+//	go run . -n 50 -map latest -motion patrol -on-warning reverse
+//	go run . -n 200 -rtk 121.890,30.900,121.894,30.903 -rate 5 -ramp 20s -duration 10m
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-type Msg struct {
-	ID   string `json:"id"`
-	Sens []Sen  `json:"sens"`
-}
+// Config 命令行参数
+type Config struct {
+	Broker, Username, Password string
+	QoS                        byte
+
+	Count  int
+	Prefix string
+	Start  int
+
+	Rate        float64       // 每个标签每秒上报次数
+	OnlineEvery time.Duration // online 心跳间隔，0 表示只在连接时发一次
+	Battery     bool
+
+	Motion string
+	Speed  float64 // 米/秒
+	Dwell  time.Duration
 
-type Sen struct {
-	Name  string `json:"n"`
-	Unit  string `json:"u"`
-	Value any    `json:"v"`
+	OnWarning   string // none / log / stop / reverse
+	WarningHold time.Duration
+	OTAFail     float64
+
+	Ramp     time.Duration
+	Duration time.Duration
+	Verbose  bool
 }
 
 func main() {
-	// 连接 MQTT
-	opts := mqtt.NewClientOptions().
-		AddBroker("ws://localhost:8083/mqtt"). // 公共测试 Broker
-		SetClientID("go-mqtt-client").
-		SetUsername("admin").
-		SetPassword("admin")
-
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatal(token.Error())
-	}
-	defer client.Disconnect(250)
-
-	// 构造要发的 JSON 数据
-	msg := Msg{
-		ID: "112",
-		Sens: []Sen{
-			{Name: "temperature", Unit: "°C", Value: 23.5},
-			{Name: "humidity", Unit: "%", Value: 68},
-			{Name: "RTK", Unit: "deg", Value: []float64{121.791851, 30.904012}},
-		},
-	}
-
-	payload, err := json.Marshal(msg)
+	cfg := &Config{}
+	var qos int
+	var mapID, mapService, bbox, rtk, path string
+	var seed int64
+
+	flag.StringVar(&cfg.Broker, "broker", "tcp://localhost:1883", "MQTT broker 地址（也可用 ws://localhost:8083/mqtt）")
+	flag.StringVar(&cfg.Username, "username", "admin", "MQTT 用户名")
+	flag.StringVar(&cfg.Password, "password", "admin", "MQTT 密码")
+	flag.IntVar(&qos, "qos", 0, "上报 QoS（0 / 1）")
+
+	flag.IntVar(&cfg.Count, "n", 10, "标签数量")
+	flag.StringVar(&cfg.Prefix, "prefix", "sim-", "设备 ID 前缀，ID 形如 sim-001")
+	flag.IntVar(&cfg.Start, "start", 1, "设备编号起始值")
+
+	flag.Float64Var(&cfg.Rate, "rate", 1, "每个标签每秒上报 location 次数")
+	flag.DurationVar(&cfg.OnlineEvery, "online", 5*time.Second, "online 心跳间隔，0 表示只在连接时发一次")
+	flag.BoolVar(&cfg.Battery, "battery", false, "附带 battery 遥测")
+
+	flag.StringVar(&mapID, "map", "", "CustomMap ID（或 latest），按地图坐标范围生成 UWB 位置")
+	flag.StringVar(&mapService, "map-service", "http://localhost:8002", "map-service 地址，-map 时使用")
+	flag.StringVar(&bbox, "bbox", "0,0,1000,1000", "UWB 区域 xmin,ymin,xmax,ymax（厘米），未指定 -map / -rtk 时使用")
+	flag.StringVar(&rtk, "rtk", "", "RTK 区域 lonmin,latmin,lonmax,latmax，指定后发布 RTK 位置")
+	flag.StringVar(&cfg.Motion, "motion", "random", "运动模型：random（随机游走）/ waypoints（路径点间往返）/ patrol（沿多边形巡逻）")
+	flag.StringVar(&path, "path", "", "waypoints / patrol 的路径点 \"u1,v1;u2,v2;...\"（区域原生坐标），缺省为区域内缩 10% 的矩形")
+	flag.Float64Var(&cfg.Speed, "speed", 1.2, "移动速度（米/秒）")
+	flag.DurationVar(&cfg.Dwell, "dwell", 3*time.Second, "waypoints 到达路径点后的停留时间")
+
+	flag.StringVar(&cfg.OnWarning, "on-warning", "log", "收到 warning 时的反应：none（不订阅）/ log / stop（原地停留）/ reverse（掉头）")
+	flag.DurationVar(&cfg.WarningHold, "warning-hold", 3*time.Second, "最后一次报警后保持 stop / reverse 状态的时间")
+	flag.Float64Var(&cfg.OTAFail, "ota-fail", 0, "OTA 模拟安装失败的概率（0~1）")
+
+	flag.DurationVar(&cfg.Ramp, "ramp", 0, "在该时间内逐个建立连接，0 表示同时连接")
+	flag.DurationVar(&cfg.Duration, "duration", 0, "运行时长，0 表示直到 Ctrl+C")
+	flag.Int64Var(&seed, "seed", time.Now().UnixNano(), "随机种子，相同种子得到相同的初始位置与路线")
+	flag.BoolVar(&cfg.Verbose, "v", false, "打印收到的报警")
+	flag.Parse()
+
+	cfg.QoS = byte(qos)
+	if err := validate(cfg); err != nil {
+		log.Fatalf("参数错误: %v", err)
+	}
+
+	area, err := buildArea(mapID, mapService, bbox, rtk)
+	if err != nil {
+		log.Fatalf("区域错误: %v", err)
+	}
+	pts := DefaultPath(area)
+	if path != "" {
+		if pts, err = area.ParsePath(path); err != nil {
+			log.Fatalf("路径错误: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	stats := &Stats{}
+	go reportStats(ctx, stats, cfg)
+
+	log.Printf("启动 %d 个标签  area=%s %.1fm×%.1fm  motion=%s  rate=%.2f/s  broker=%s",
+		cfg.Count, area.Kind, area.W, area.H, cfg.Motion, cfg.Rate, cfg.Broker)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Count; i++ {
+		if i > 0 && cfg.Ramp > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(cfg.Ramp / time.Duration(cfg.Count)):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		id := fmt.Sprintf("%s%03d", cfg.Prefix, cfg.Start+i)
+		rng := rand.New(rand.NewSource(seed + int64(i)))
+		motion, err := NewMotion(cfg.Motion, area, pts, cfg.Dwell, i, cfg.Count, rng)
+		if err != nil {
+			log.Fatalf("运动模型错误: %v", err)
+		}
+		tag := NewTag(id, cfg, area, motion, stats, seed+int64(i))
+		if err := tag.Connect(); err != nil {
+			log.Printf("[WARN] %s 连接失败: %v", id, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tag.Run(ctx)
+		}()
+	}
+
+	<-ctx.Done()
+	log.Println("正在停止所有标签...")
+	wg.Wait()
+	printStats(stats)
+}
+
+func validate(cfg *Config) error {
+	switch {
+	case cfg.Count <= 0:
+		return fmt.Errorf("-n 必须大于 0")
+	case cfg.Rate <= 0 || cfg.Rate > 100:
+		return fmt.Errorf("-rate 取值 (0, 100]")
+	case cfg.QoS > 1:
+		return fmt.Errorf("-qos 只支持 0 / 1")
+	case cfg.Speed < 0:
+		return fmt.Errorf("-speed 不能为负")
+	case cfg.OTAFail < 0 || cfg.OTAFail > 1:
+		return fmt.Errorf("-ota-fail 取值 0~1")
+	}
+	switch cfg.OnWarning {
+	case "none", "log", "stop", "reverse":
+	default:
+		return fmt.Errorf("-on-warning 只支持 none / log / stop / reverse")
+	}
+	return nil
+}
+
+// buildArea 优先级：-rtk > -map > -bbox
+func buildArea(mapID, mapService, bbox, rtk string) (*Area, error) {
+	if rtk != "" {
+		v, err := parseFloats(rtk, 4)
+		if err != nil {
+			return nil, err
+		}
+		return NewRTKArea(v[0], v[1], v[2], v[3])
+	}
+	if mapID != "" {
+		return FetchCustomMap(mapService, mapID)
+	}
+	v, err := parseFloats(bbox, 4)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return NewUWBArea(v[0], v[1], v[2], v[3])
+}
 
-	// 发布
-	topic := "device/rtk"
-	if token := client.Publish(topic, 0, false, payload); token.Wait() && token.Error() != nil {
-		log.Fatal(token.Error())
+// reportStats 每 10 秒打印一次吞吐
+func reportStats(ctx context.Context, s *Stats, cfg *Config) {
+	tick := time.NewTicker(10 * time.Second)
+	defer tick.Stop()
+	var last int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			n := s.Locations.Load()
+			log.Printf("location %.1f/s（目标 %.1f/s）  累计 %d  失败 %d  报警 %d",
+				float64(n-last)/10, cfg.Rate*float64(cfg.Count), n, s.PubErrors.Load(), s.Warnings.Load())
+			last = n
+		}
 	}
-	fmt.Printf("已发布：%s\n", payload)
+}
 
-	time.Sleep(time.Second) // 等一会儿让消息发完
+func printStats(s *Stats) {
+	log.Printf("已停止  location=%d  online=%d  发布失败=%d  warning=%d  cmd=%d  delta=%d  ota=%d",
+		s.Locations.Load(), s.Onlines.Load(), s.PubErrors.Load(),
+		s.Warnings.Load(), s.Commands.Load(), s.Deltas.Load(), s.OTAs.Load())
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Motion 运动模型：Step 推进 dt 返回新位置，Reverse 掉头（收到报警时使用）
+type Motion interface {
+	Step(dt time.Duration, speed float64) Point
+	Reverse()
+}
+
+// NewMotion 按名称构造运动模型，index 用于让多个标签在路径上错开
+func NewMotion(kind string, area *Area, path []Point, dwell time.Duration, index, total int, rng *rand.Rand) (Motion, error) {
+	switch kind {
+	case "random":
+		return &randomWalk{
+			area:    area,
+			pos:     Point{X: rng.Float64() * area.W, Y: rng.Float64() * area.H},
+			heading: rng.Float64() * 2 * math.Pi,
+			rng:     rng,
+		}, nil
+	case "waypoints":
+		if len(path) < 2 {
+			return nil, fmt.Errorf("waypoints 至少需要 2 个路径点")
+		}
+		i := rng.Intn(len(path))
+		return &waypoints{points: path, pos: path[i], cur: i, target: i, dwell: dwell, rng: rng}, nil
+	case "patrol":
+		if len(path) < 2 {
+			return nil, fmt.Errorf("patrol 至少需要 2 个路径点")
+		}
+		p := newPatrol(path)
+		p.s = p.length * float64(index) / float64(total) // 均匀分布在巡逻路线上
+		return p, nil
+	}
+	return nil, fmt.Errorf("未知的运动模型: %s（random / waypoints / patrol）", kind)
+}
+
+// DefaultPath 未指定路径时取区域内缩 10% 的矩形
+func DefaultPath(area *Area) []Point {
+	mx, my := area.W*0.1, area.H*0.1
+	return []Point{{mx, my}, {area.W - mx, my}, {area.W - mx, area.H - my}, {mx, area.H - my}}
+}
+
+// randomWalk 随机游走：方向随时间随机偏转，碰到边界反弹
+type randomWalk struct {
+	area    *Area
+	pos     Point
+	heading float64
+	rng     *rand.Rand
+}
+
+func (m *randomWalk) Step(dt time.Duration, speed float64) Point {
+	sec := dt.Seconds()
+	m.heading += m.rng.NormFloat64() * 0.6 * math.Sqrt(sec)
+	x := m.pos.X + math.Cos(m.heading)*speed*sec
+	y := m.pos.Y + math.Sin(m.heading)*speed*sec
+	if x < 0 || x > m.area.W {
+		m.heading = math.Pi - m.heading
+	}
+	if y < 0 || y > m.area.H {
+		m.heading = -m.heading
+	}
+	m.pos = m.area.Clamp(Point{x, y})
+	return m.pos
+}
+
+func (m *randomWalk) Reverse() { m.heading += math.Pi }
+
+// waypoints 在路径点之间随机往返，到达后停留 dwell
+type waypoints struct {
+	points      []Point
+	pos         Point
+	cur, target int
+	dwellLeft   time.Duration // 剩余停留时间
+	dwell       time.Duration
+	rng         *rand.Rand
+}
+
+func (m *waypoints) Step(dt time.Duration, speed float64) Point {
+	if m.dwellLeft > 0 {
+		m.dwellLeft -= dt
+		return m.pos
+	}
+	if m.target == m.cur {
+		m.target = (m.cur + 1 + m.rng.Intn(len(m.points)-1)) % len(m.points)
+	}
+	var arrived bool
+	m.pos, arrived = moveToward(m.pos, m.points[m.target], speed*dt.Seconds())
+	if arrived {
+		m.cur = m.target
+		m.dwellLeft = m.dwell
+	}
+	return m.pos
+}
+
+// Reverse 放弃当前目标，返回出发点
+func (m *waypoints) Reverse() {
+	m.cur, m.target = m.target, m.cur
+	m.dwellLeft = 0
+}
+
+// patrol 沿闭合多边形巡逻
+type patrol struct {
+	path   []Point
+	cum    []float64 // 各顶点处的累计长度
+	length float64
+	s      float64 // 当前在路线上的位置
+	dir    float64 // 1 顺路径方向，-1 反向
+}
+
+func newPatrol(path []Point) *patrol {
+	p := &patrol{path: path, dir: 1}
+	p.cum = make([]float64, len(path)+1)
+	for i := range path {
+		p.cum[i+1] = p.cum[i] + dist(path[i], path[(i+1)%len(path)])
+	}
+	p.length = p.cum[len(path)]
+	return p
+}
+
+func (m *patrol) Step(dt time.Duration, speed float64) Point {
+	if m.length == 0 {
+		return m.path[0]
+	}
+	m.s = math.Mod(m.s+m.dir*speed*dt.Seconds(), m.length)
+	if m.s < 0 {
+		m.s += m.length
+	}
+	for i := range m.path {
+		if m.s <= m.cum[i+1] {
+			seg := m.cum[i+1] - m.cum[i]
+			if seg == 0 {
+				return m.path[i]
+			}
+			t := (m.s - m.cum[i]) / seg
+			a, b := m.path[i], m.path[(i+1)%len(m.path)]
+			return Point{X: a.X + (b.X-a.X)*t, Y: a.Y + (b.Y-a.Y)*t}
+		}
+	}
+	return m.path[0]
+}
+
+func (m *patrol) Reverse() { m.dir = -m.dir }
+
+// moveToward 向 to 移动 step，到达时返回 true
+func moveToward(from, to Point, step float64) (Point, bool) {
+	d := dist(from, to)
+	if d <= step {
+		return to, true
+	}
+	return Point{X: from.X + (to.X-from.X)/d*step, Y: from.Y + (to.Y-from.Y)/d*step}, false
+}
+
+func dist(a, b Point) float64 {
+	return math.Hypot(b.X-a.X, b.Y-a.Y)
+}
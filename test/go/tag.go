@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type Msg struct {
+	ID   string `json:"id"`
+	Seq  uint64 `json:"seq"`
+	Map  string `json:"map,omitempty"`
+	Sens []Sen  `json:"sens"`
+}
+
+type Sen struct {
+	Name  string `json:"n"`
+	Unit  string `json:"u"`
+	Value any    `json:"v"`
+}
+
+// 下行载荷，字段与 mqtt-watch 的 CmdMsg / ShadowDeltaMsg / OTANotifyMsg 一致
+type cmdMsg struct {
+	CmdID  string         `json:"cmd_id"`
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params"`
+}
+
+type cmdAckMsg struct {
+	CmdID  string         `json:"cmd_id"`
+	Status string         `json:"status"`
+	Result map[string]any `json:"result,omitempty"`
+	Msg    string         `json:"msg,omitempty"`
+}
+
+type shadowDeltaMsg struct {
+	Version int64          `json:"version"`
+	State   map[string]any `json:"state"`
+}
+
+type otaNotifyMsg struct {
+	Action     string `json:"action"`
+	CampaignID string `json:"campaign_id"`
+	Version    string `json:"version"`
+}
+
+type otaProgressMsg struct {
+	CampaignID string `json:"campaign_id"`
+	Status     string `json:"status"`
+	Progress   int    `json:"progress"`
+	Msg        string `json:"msg"`
+}
+
+// Stats 全部标签的累计计数
+type Stats struct {
+	Locations, Onlines, PubErrors atomic.Int64
+	Warnings, Commands, Deltas    atomic.Int64
+	OTAs                          atomic.Int64
+}
+
+// Tag 一个虚拟标签：独立连接，按频率上报 online / location，响应下行消息
+type Tag struct {
+	ID     string
+	cfg    *Config
+	area   *Area
+	stats  *Stats
+	rng    *rand.Rand
+	cli    mqtt.Client
+	motion Motion
+
+	mu         sync.Mutex
+	seq        uint64
+	pos        Point
+	alarmUntil time.Time // on-warning=stop 时报警保持到该时刻
+	reported   map[string]any
+	otaCancel  context.CancelFunc
+}
+
+func NewTag(id string, cfg *Config, area *Area, motion Motion, stats *Stats, seed int64) *Tag {
+	t := &Tag{
+		ID:       id,
+		cfg:      cfg,
+		area:     area,
+		stats:    stats,
+		rng:      rand.New(rand.NewSource(seed)),
+		motion:   motion,
+		reported: map[string]any{"firmware": "1.0.0"},
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(fmt.Sprintf("sim-%s-%d", id, time.Now().UnixNano())).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(10*time.Second).
+		SetWill("offline/"+id, fmt.Sprintf(`{"id":%q}`, id), 1, false).
+		SetOnConnectHandler(t.onConnect)
+	t.cli = mqtt.NewClient(opts)
+	return t
+}
+
+func (t *Tag) Connect() error {
+	tok := t.cli.Connect()
+	if !tok.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("%s 连接超时", t.ID)
+	}
+	return tok.Error()
+}
+
+// onConnect 每次（重）连接后订阅下行主题并上报上线
+func (t *Tag) onConnect(c mqtt.Client) {
+	subs := map[string]byte{"cmd/" + t.ID: 1, "shadow/" + t.ID + "/delta": 1, "ota/" + t.ID: 1}
+	if t.cfg.OnWarning != "none" {
+		subs["warning/"+t.ID] = 0
+	}
+	c.SubscribeMultiple(subs, t.onDownlink)
+	t.publishOnline()
+}
+
+// Run 按上报频率推进运动模型并发布，ctx 取消后发布 offline 并断开
+func (t *Tag) Run(ctx context.Context) {
+	interval := time.Duration(float64(time.Second) / t.cfg.Rate)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var online <-chan time.Time
+	if t.cfg.OnlineEvery > 0 {
+		ot := time.NewTicker(t.cfg.OnlineEvery)
+		defer ot.Stop()
+		online = ot.C
+	}
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			t.cli.Publish("offline/"+t.ID, 1, false, fmt.Sprintf(`{"id":%q}`, t.ID)).WaitTimeout(time.Second)
+			t.cli.Disconnect(250)
+			return
+		case <-online:
+			t.publishOnline()
+		case now := <-tick.C:
+			t.step(now.Sub(last))
+			last = now
+			t.publishLocation()
+		}
+	}
+}
+
+func (t *Tag) step(dt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Now().Before(t.alarmUntil) {
+		return // 报警期间原地停留
+	}
+	t.pos = t.motion.Step(dt, t.cfg.Speed)
+}
+
+func (t *Tag) publishOnline() {
+	t.publish("online/"+t.ID, map[string]any{"id": t.ID, "ts": time.Now().UnixMilli()}, &t.stats.Onlines)
+}
+
+func (t *Tag) publishLocation() {
+	t.mu.Lock()
+	t.seq++
+	msg := Msg{ID: t.ID, Seq: t.seq, Map: t.area.MapID, Sens: []Sen{t.area.Sen(t.pos)}}
+	t.mu.Unlock()
+	if t.cfg.Battery {
+		msg.Sens = append(msg.Sens, Sen{Name: "battery", Unit: "%", Value: 100 - float64(msg.Seq%10000)/100})
+	}
+	t.publish("location/"+t.ID, msg, &t.stats.Locations)
+}
+
+// publish 不等待确认，可在 MQTT 回调中调用
+func (t *Tag) publish(topic string, v any, counter *atomic.Int64) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	tok := t.cli.Publish(topic, t.cfg.QoS, false, payload)
+	go func() {
+		if tok.WaitTimeout(10*time.Second) && tok.Error() == nil {
+			counter.Add(1)
+			return
+		}
+		t.stats.PubErrors.Add(1)
+	}()
+}
+
+func (t *Tag) onDownlink(c mqtt.Client, m mqtt.Message) {
+	switch topic := m.Topic(); {
+	case topic == "warning/"+t.ID:
+		t.onWarning(string(m.Payload()))
+	case topic == "cmd/"+t.ID:
+		t.onCommand(m.Payload())
+	case topic == "shadow/"+t.ID+"/delta":
+		t.onDelta(m.Payload())
+	case topic == "ota/"+t.ID:
+		t.onOTA(m.Payload())
+	}
+}
+
+// onWarning "1" 报警 / "0" 解除：stop 停留 warning-hold（持续报警会不断延长），reverse 立即掉头
+func (t *Tag) onWarning(payload string) {
+	t.stats.Warnings.Add(1)
+	on := payload == "1"
+	if t.cfg.Verbose {
+		log.Printf("%s 收到报警 %s", t.ID, payload)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch t.cfg.OnWarning {
+	case "stop":
+		if on {
+			t.alarmUntil = time.Now().Add(t.cfg.WarningHold)
+		} else {
+			t.alarmUntil = time.Time{}
+		}
+	case "reverse":
+		// 同一次报警持续下发时只掉头一次
+		if on && time.Now().After(t.alarmUntil) {
+			t.motion.Reverse()
+		}
+		if on {
+			t.alarmUntil = time.Now().Add(t.cfg.WarningHold)
+		}
+	}
+}
+
+// onCommand 回执指令：名为 fail 的指令回执失败，其余回执成功
+func (t *Tag) onCommand(payload []byte) {
+	t.stats.Commands.Add(1)
+	var cmd cmdMsg
+	if err := json.Unmarshal(payload, &cmd); err != nil || cmd.CmdID == "" {
+		return
+	}
+	ack := cmdAckMsg{CmdID: cmd.CmdID, Status: "ok", Result: map[string]any{"name": cmd.Name}}
+	if cmd.Name == "fail" {
+		ack.Status, ack.Msg, ack.Result = "error", "模拟失败", nil
+	}
+	t.publish("cmd-ack/"+t.ID, ack, new(atomic.Int64))
+}
+
+// onDelta 把期望配置直接当作已生效，合并后上报
+func (t *Tag) onDelta(payload []byte) {
+	t.stats.Deltas.Add(1)
+	var d shadowDeltaMsg
+	if err := json.Unmarshal(payload, &d); err != nil {
+		return
+	}
+	t.mu.Lock()
+	for k, v := range d.State {
+		if v == nil {
+			delete(t.reported, k)
+		} else {
+			t.reported[k] = v
+		}
+	}
+	t.mu.Unlock()
+	t.publish("shadow/"+t.ID+"/reported", map[string]any{"state": d.State}, new(atomic.Int64))
+}
+
+// onOTA 模拟下载 → 安装 → 成功（按 ota-fail 概率失败），abort 时中止
+func (t *Tag) onOTA(payload []byte) {
+	t.stats.OTAs.Add(1)
+	var n otaNotifyMsg
+	if err := json.Unmarshal(payload, &n); err != nil || n.CampaignID == "" {
+		return
+	}
+	t.mu.Lock()
+	if t.otaCancel != nil {
+		t.otaCancel()
+		t.otaCancel = nil
+	}
+	if n.Action != "upgrade" {
+		t.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.otaCancel = cancel
+	fail := t.rng.Float64() < t.cfg.OTAFail
+	t.mu.Unlock()
+
+	go func() {
+		report := func(status string, progress int, msg string) {
+			t.publish("ota-progress/"+t.ID, otaProgressMsg{CampaignID: n.CampaignID, Status: status, Progress: progress, Msg: msg}, new(atomic.Int64))
+		}
+		for p := 0; p <= 100; p += 25 {
+			report("downloading", p, "")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		report("installing", 100, "")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		if fail {
+			report("failed", 100, "模拟安装失败")
+			return
+		}
+		t.mu.Lock()
+		t.reported["firmware"] = n.Version
+		t.mu.Unlock()
+		report("succeeded", 100, "")
+		t.publish("shadow/"+t.ID+"/reported", map[string]any{"state": map[string]any{"firmware": n.Version}}, new(atomic.Int64))
+	}()
+}
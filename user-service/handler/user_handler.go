@@ -116,6 +116,11 @@ func (h *userHandler) UpdateUser(c *gin.Context) {
 		utils.SendBadRequest(c, "参数错误: "+err.Error())
 		return
 	}
+	// 租户决定地图等资源的可见范围，普通用户不能自行修改
+	if typ := utils.GetUserType(c.Request.Header); req.Tenant != nil && typ != "admin" && typ != "root" {
+		utils.SendForbidden(c, "只有管理员可以修改租户")
+		return
+	}
 	user, err := h.userService.UpdateUser(id, &req)
 	switch err {
 	case nil:
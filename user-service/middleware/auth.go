@@ -33,6 +33,7 @@ func JWTMiddleware() gin.HandlerFunc {
 		c.Request.Header.Set("X-UserID", claims.UserID)
 		c.Request.Header.Set("X-UserName", claims.Username)
 		c.Request.Header.Set("X-UserType", string(claims.UserType))
+		c.Request.Header.Set("X-Tenant", claims.Tenant)
 
 		c.Next()
 	}
@@ -24,6 +24,7 @@ type User struct {
 	Username  string    `gorm:"type:varchar(255);not null"`
 	PwdHash   string    `gorm:"type:varchar(255);not null"`
 	UserType  UserType  `gorm:"type:user_type_enum;not null;default:'user'"`
+	Tenant    string    `gorm:"type:varchar(64);not null;default:''"` // 所属租户，空串为未分配
 	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()"`
 	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()"`
 }
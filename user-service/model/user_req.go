@@ -9,10 +9,12 @@ type UserCreateRequest struct {
 	Username string   `json:"username" binding:"required,min=3,max=32"`
 	Password string   `json:"password" binding:"required,min=6,max=64"`
 	UserType UserType `json:"user_type" binding:"required,oneof=user admin"`
+	Tenant   string   `json:"tenant" binding:"max=64"` // 所属租户，仅 admin / root 可设置
 }
 
 // UserUpdateRequest 允许前端修改的字段
 type UserUpdateRequest struct {
 	Username *string   `json:"username,omitempty"` // 指针：空表示不修改
 	UserType *UserType `json:"user_type,omitempty"`
+	Tenant   *string   `json:"tenant,omitempty" binding:"omitempty,max=64"` // 仅 admin / root 可修改
 }
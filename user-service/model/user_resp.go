@@ -7,6 +7,7 @@ type UserResponse struct {
 	ID        string    `json:"id"`        // UUID
 	Username  string    `json:"username"`  // 用户名
 	UserType  UserType  `json:"user_type"` // root | user | admin
+	Tenant    string    `json:"tenant"`    // 所属租户，空串为未分配
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -17,6 +18,7 @@ func (u *User) ToUserResponse() *UserResponse {
 		ID:        u.ID,
 		Username:  u.Username,
 		UserType:  u.UserType,
+		Tenant:    u.Tenant,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
 	}
@@ -41,6 +41,7 @@ func (s *userService) Register(req *model.UserCreateRequest) (*model.UserRespons
 		Username: req.Username,
 		PwdHash:  hash,
 		UserType: req.UserType,
+		Tenant:   req.Tenant,
 	}
 	if err := s.repo.Create(user); err != nil {
 		return nil, ErrInternal
@@ -86,6 +87,9 @@ func (s *userService) UpdateUser(id string, req *model.UserUpdateRequest) (*mode
 	if req.UserType != nil {
 		user.UserType = *req.UserType
 	}
+	if req.Tenant != nil {
+		user.Tenant = *req.Tenant
+	}
 
 	if err := s.repo.Update(user); err != nil {
 		return nil, ErrInternal
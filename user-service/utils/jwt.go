@@ -25,6 +25,7 @@ type CustomClaims struct {
 	UserID   string         `json:"user_id"`
 	Username string         `json:"username"`
 	UserType model.UserType `json:"user_type"`
+	Tenant   string         `json:"tenant,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -34,6 +35,7 @@ func generateToken(u *model.User, expiresIn time.Duration, issuer string) (strin
 		UserID:   u.ID,
 		Username: u.Username,
 		UserType: u.UserType,
+		Tenant:   u.Tenant,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -102,6 +104,7 @@ func RefreshAccessToken(refreshToken string) (string, error) {
 		ID:       claims.UserID,
 		Username: claims.Username,
 		UserType: claims.UserType,
+		Tenant:   claims.Tenant,
 	}
 
 	return GenerateToken(user)
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,6 +25,15 @@ type Config struct {
 		RetryInterval time.Duration
 	}
 
+	// MongoConfig 仅 replay 子命令读取位置历史时使用
+	MongoConfig struct {
+		Host     string
+		Port     string
+		Username string
+		Password string
+		DB       string
+	}
+
 	MQTTConfig struct {
 		MQTT_BROKER   string
 		MQTT_USERNAME string
@@ -41,7 +51,14 @@ type Config struct {
 	}
 
 	AppConfig struct {
-		OnlineSecond int
+		OnlineSecond          int
+		PresencePersistSecond int           // 在线期间 last_online_at 的最小写入间隔
+		PartitionCount        int           // 分区总数（副本数），1 表示不分区
+		PartitionIndex        int           // 本副本负责的分区，0..PartitionCount-1
+		IngestDupWindow       time.Duration // 无 seq / 采样时间时识别 broker 重投的时间窗
+		IngestStateTTL        time.Duration // 设备去重状态保留时长
+		IngestSeqResetGap     int           // seq 回退超过该值视为设备重启
+		IngestSeqResetIdle    time.Duration // 超过该时长没有被接受的上报后，seq 回退视为设备重启
 	}
 }
 
@@ -63,6 +80,12 @@ func Load() {
 		C.PSQLConfig.MaxRetries = getEnvInt("DB_MAX_RETRY", 5)
 		C.PSQLConfig.RetryInterval = getEnvDuration("DB_RETRY_INTERVAL", 2*time.Second)
 
+		C.MongoConfig.Host = getEnvStr("MONGO_HOST", "mongo")
+		C.MongoConfig.Port = getEnvStr("MONGO_PORT", "27017")
+		C.MongoConfig.Username = getEnvStr("MONGO_INITDB_ROOT_USERNAME", "admin")
+		C.MongoConfig.Password = getEnvStr("MONGO_INITDB_ROOT_PASSWORD", "admin")
+		C.MongoConfig.DB = getEnvStr("MONGO_DB", "mqtt_db")
+
 		C.MQTTConfig.MQTT_BROKER = getEnvStr("MQTT_BROKER", "ws://8.133.17.175:8083")
 		C.MQTTConfig.MQTT_USERNAME = getEnvStr("MQTT_USERNAME", "admin")
 		C.MQTTConfig.MQTT_PASSWORD = getEnvStr("MQTT_PASSWORD", "admin")
@@ -74,9 +97,33 @@ func Load() {
 		C.MarkServiceConfig.Port = getEnvStr("MARK_SERVICE_PORT", "8004")
 
 		C.AppConfig.OnlineSecond = getEnvInt("OFFLINE_SECOND", 3)
+		C.AppConfig.PresencePersistSecond = getEnvInt("PRESENCE_PERSIST_SECOND", 30)
+		C.AppConfig.PartitionCount = getEnvInt("PARTITION_COUNT", 1)
+		C.AppConfig.IngestDupWindow = time.Duration(getEnvInt("INGEST_DUP_WINDOW_SECOND", 10)) * time.Second
+		C.AppConfig.IngestStateTTL = time.Duration(getEnvInt("INGEST_STATE_TTL_SECOND", 600)) * time.Second
+		C.AppConfig.IngestSeqResetGap = getEnvInt("INGEST_SEQ_RESET_GAP", 1000)
+		C.AppConfig.IngestSeqResetIdle = time.Duration(getEnvInt("INGEST_SEQ_RESET_IDLE_SECOND", 30)) * time.Second
+		C.AppConfig.PartitionIndex = 0
+		if C.AppConfig.PartitionCount > 1 {
+			C.AppConfig.PartitionIndex = getEnvInt("PARTITION_INDEX", hostnameOrdinal())
+		}
 	})
 }
 
+// hostnameOrdinal StatefulSet 副本的主机名形如 warning-service-2，取末尾序号作为默认分区
+func hostnameOrdinal() int {
+	h := os.Getenv("HOSTNAME")
+	i := strings.LastIndex(h, "-")
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(h[i+1:])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
 func getEnvStr(key, defaultValue string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
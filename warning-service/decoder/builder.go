@@ -0,0 +1,103 @@
+// decoder/builder.go
+package decoder
+
+import (
+	"strings"
+	"time"
+
+	"IOT-Manage-System/warning-service/model"
+)
+
+// locBuilder 各解码器共用的归一化逻辑：
+//   - lat/lon → RTK，V = [lon, lat]
+//   - uwb_x/uwb_y（或 x/y） → UWB，V = [x, y]，统一换算为厘米（与旧格式一致）
+//   - seq → LocMsg.Seq，设备侧递增序号
+//   - map / map_id（字符串值）→ LocMsg.Map，设备所在的自制地图
+//   - 其余字段作为遥测 Sens 保留
+type locBuilder struct {
+	msg                  *model.LocMsg
+	lat, lon, uwbX, uwbY *float64
+	latest               time.Time
+}
+
+func newLocBuilder(deviceID string) *locBuilder {
+	return &locBuilder{msg: &model.LocMsg{ID: deviceID}}
+}
+
+// add 写入一个字段，t 为零值表示该字段不带时间
+func (b *locBuilder) add(field, unit string, v *float64, vs *string, vb *bool, t time.Time) {
+	if t.After(b.latest) {
+		b.latest = t
+	}
+
+	switch strings.ToLower(field) {
+	case "lat", "latitude":
+		b.lat = v
+		return
+	case "lon", "lng", "longitude":
+		b.lon = v
+		return
+	case "uwb_x", "x":
+		b.uwbX = toCentimeter(v, unit)
+		return
+	case "uwb_y", "y":
+		b.uwbY = toCentimeter(v, unit)
+		return
+	case "seq":
+		if v != nil && *v >= 0 {
+			seq := uint64(*v)
+			b.msg.Seq = &seq
+		}
+		return
+	case "map", "map_id":
+		if vs != nil {
+			b.msg.Map = *vs
+		}
+		return
+	}
+
+	s := model.Sens{N: field, U: unit, VS: vs, VB: vb}
+	if v != nil {
+		s.V = []float64{*v}
+	}
+	b.msg.Sens = append(b.msg.Sens, s)
+}
+
+// setTime 显式指定采样时间
+func (b *locBuilder) setTime(t time.Time) {
+	if !t.IsZero() {
+		b.latest = t
+	}
+}
+
+func (b *locBuilder) build() *model.LocMsg {
+	if b.lat != nil && b.lon != nil {
+		b.msg.Sens = append(b.msg.Sens, model.Sens{N: "RTK", U: "deg", V: []float64{*b.lon, *b.lat}})
+	}
+	if b.uwbX != nil && b.uwbY != nil {
+		b.msg.Sens = append(b.msg.Sens, model.Sens{N: "UWB", U: "cm", V: []float64{*b.uwbX, *b.uwbY}})
+	}
+	if !b.latest.IsZero() {
+		t := b.latest
+		b.msg.Time = &t
+	}
+	return b.msg
+}
+
+// toCentimeter 旧格式 UWB 坐标单位为厘米，按 "m" 上报时换算
+func toCentimeter(v *float64, unit string) *float64 {
+	if v == nil || unit != "m" {
+		return v
+	}
+	cm := *v * 100
+	return &cm
+}
+
+// unixTime 按单位把数值时间戳转换为 time.Time，unit 支持 s / ms
+func unixTime(v float64, unit string) time.Time {
+	if unit == "ms" {
+		return time.UnixMilli(int64(v))
+	}
+	sec := int64(v)
+	return time.Unix(sec, int64((v-float64(sec))*1e9))
+}
@@ -0,0 +1,53 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 解码器与 mqtt-watch/decoder 是同一份代码（各服务独立构建，不共享模块），测试只在 mqtt-watch 中维护；
+// 这里只校验两份副本除模块路径外完全一致
+func TestSameAsMQTTWatch(t *testing.T) {
+	upstream := filepath.Join("..", "..", "mqtt-watch", "decoder")
+	files, err := filepath.Glob(filepath.Join(upstream, "*.go"))
+	if err != nil || len(files) == 0 {
+		t.Skip("mqtt-watch/decoder 不在当前工作区")
+	}
+
+	local, _ := filepath.Glob("*.go")
+	want := map[string]bool{}
+	for _, f := range local {
+		if !strings.HasSuffix(f, "_test.go") {
+			want[f] = true
+		}
+	}
+	for _, f := range files {
+		name := filepath.Base(f)
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if !want[name] {
+			t.Errorf("%s 只存在于 mqtt-watch/decoder", name)
+			continue
+		}
+		delete(want, name)
+
+		src, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.ReplaceAll(string(src), "IOT-Manage-System/mqtt-watch/", "IOT-Manage-System/warning-service/")
+		if string(dst) != expected {
+			t.Errorf("%s 与 mqtt-watch/decoder/%s 不一致", name, name)
+		}
+	}
+	for name := range want {
+		t.Errorf("%s 只存在于 warning-service/decoder", name)
+	}
+}
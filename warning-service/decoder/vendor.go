@@ -0,0 +1,56 @@
+// decoder/vendor.go
+package decoder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/warning-service/model"
+)
+
+// 厂商内置解码器，新增厂商格式时在此实现并在 registry.go 中注册
+
+// flatDecoder 扁平 JSON：{"id":"112","ts":1700000000,"lat":31.2,"lon":121.7,"x":150,"y":200,"battery":88}
+// id / device_id / deviceId 作为设备 ID，ts / time / timestamp 作为采样时间（秒或毫秒自动识别），
+// 其余顶层字段按 lat/lon/x/y 规则归一化，剩下的作为遥测保留
+type flatDecoder struct{}
+
+func newFlatDecoder(json.RawMessage) (Decoder, error) {
+	return flatDecoder{}, nil
+}
+
+func (flatDecoder) Decode(topic string, payload []byte) (*model.LocMsg, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("json 解析失败: %w", err)
+	}
+
+	b := newLocBuilder(TopicDeviceID(topic))
+	for k, v := range doc {
+		switch strings.ToLower(k) {
+		case "id", "device_id", "deviceid":
+			if id := strings.TrimSpace(fmt.Sprint(v)); id != "" {
+				b.msg.ID = id
+			}
+		case "ts", "time", "timestamp":
+			switch t := v.(type) {
+			case float64:
+				unit := "s"
+				if t > 1e12 { // 13 位时间戳为毫秒
+					unit = "ms"
+				}
+				b.setTime(unixTime(t, unit))
+			case string:
+				if tt, err := time.Parse(time.RFC3339Nano, t); err == nil {
+					b.setTime(tt)
+				}
+			}
+		default:
+			addValue(b, k, "", v)
+		}
+	}
+	return b.build(), nil
+}
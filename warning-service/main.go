@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -15,12 +16,25 @@ import (
 )
 
 const (
-	LocTopic    = "location/#"
-	OnlineTopic = "online"
+	LocTopic     = "location/#"
+	OnlineTopic  = "online"
+	OfflineTopic = "offline/#" // 设备遗嘱（Last Will）主题
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			log.Fatalf("[ERROR] 回放失败: %v", err)
+		}
+		return
+	}
+
 	config.Load()
+	if c := config.C.AppConfig; c.PartitionCount < 1 || c.PartitionIndex < 0 || c.PartitionIndex >= c.PartitionCount {
+		log.Fatalf("分区配置非法: PARTITION_INDEX=%d PARTITION_COUNT=%d", c.PartitionIndex, c.PartitionCount)
+	} else if c.PartitionCount > 1 {
+		log.Printf("[INFO] 分区部署  partition=%d/%d", c.PartitionIndex, c.PartitionCount)
+	}
 	utils.InitMQTT()
 	defer utils.CloseMQTT()
 
@@ -56,24 +70,39 @@ func main() {
 
 	// 原来的 MQTT 逻辑
 	fenceChecker := service.NewFenceChecker()
-	locator := service.NewLocator(db, safeDist, dangerZone, markRepo, fenceChecker)
+	presence := service.NewPresence(markRepo,
+		time.Duration(config.C.AppConfig.OnlineSecond)*time.Second,
+		time.Duration(config.C.AppConfig.PresencePersistSecond)*time.Second)
+	defer presence.Stop()
+	locator := service.NewLocator(db, safeDist, dangerZone, markRepo, fenceChecker, presence)
 	locator.StartDistanceChecker()
+	defer locator.Stop()
 
-	// token := utils.MQTTClient.Subscribe("online/#", 0, locator.Online)
-	// if token.Wait() && token.Error() != nil {
-	// 	log.Fatalf("[FATAL] 订阅 online/# 失败: %v", token.Error())
-	// }
+	// 静默报警：按类型阈值检查长时间未上报的设备
+	silence := service.NewSilenceWatcher(presence, fenceChecker, markRepo)
+	silence.Start()
+	defer silence.Stop()
 
 	// token = utils.MQTTClient.Subscribe(LocTopic, 0, locator.OnLocMsg)
 	// if token.Wait() && token.Error() != nil {
 	// 	log.Fatalf("[FATAL] 订阅 location/# 失败: %v", token.Error())
 	// }
 
-	token := utils.MQTTClient.Subscribe(LocTopic, 0, service.MultiHandler(locator.OnLocMsg, locator.Online))
+	// 有意不用共享订阅：报警判定依赖设备的内存状态（在线、围栏状态、静默），
+	// 而 broker（mosquitto）的共享订阅轮流投递、不按设备固定副本。多副本时每个副本都收全量位置
+	// （距离检查也需要全部设备的坐标），只按 PARTITION_COUNT / PARTITION_INDEX 判定本分区设备；
+	// 分摊的是围栏 HTTP 判定与报警，消息接收与解码并不分摊
+	token := utils.MQTTClient.Subscribe(LocTopic, 0, locator.OnLocMsg)
 	if token.Wait() && token.Error() != nil {
 		log.Fatalf("[FATAL] 订阅 location/# 失败: %v", token.Error())
 	}
 
+	// 遗嘱消息：设备异常断开时 broker 代发，立即置为离线
+	token = utils.MQTTClient.Subscribe(OfflineTopic, 1, presence.OnLastWill)
+	if token.Wait() && token.Error() != nil {
+		log.Fatalf("[FATAL] 订阅 offline/# 失败: %v", token.Error())
+	}
+
 	log.Println("warning-service started")
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
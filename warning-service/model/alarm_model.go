@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// AlarmEvent 设备报警事件，发布到 alarm/<device_id>
+type AlarmEvent struct {
+	DeviceID        string    `json:"device_id"`
+	Type            string    `json:"type"`             // silence：静默报警
+	State           string    `json:"state"`            // raised：触发；cleared：解除
+	SilentSecond    int       `json:"silent_second"`    // 已静默秒数（解除时为静默总时长）
+	ThresholdSecond int       `json:"threshold_second"` // 本次使用的阈值
+	InFence         bool      `json:"in_fence"`         // 最后一次判定是否处于围栏内
+	LastSeen        time.Time `json:"last_seen"`        // 最后一次上报时间
+	At              time.Time `json:"at"`
+}
+
+const (
+	AlarmTypeSilence = "silence"
+
+	AlarmStateRaised  = "raised"
+	AlarmStateCleared = "cleared"
+)
+
+// WarningEvent 一次 warning/<device_id> 下发。线上载荷只有 "1" / "0"，其余字段说明触发原因，供回放输出
+type WarningEvent struct {
+	DeviceID string    `json:"device_id"`
+	On       bool      `json:"on"`
+	Source   string    `json:"source"`             // 触发来源，见 WarningSource*
+	PeerID   string    `json:"peer_id,omitempty"`  // 距离报警的另一台设备
+	Distance float64   `json:"distance,omitempty"` // 距离报警时两设备间距
+	Limit    float64   `json:"limit,omitempty"`    // 距离报警使用的安全距离 / 危险区域半径
+	At       time.Time `json:"at"`
+}
+
+const (
+	WarningSourceFenceIndoor  = "fence_indoor"
+	WarningSourceFenceOutdoor = "fence_outdoor"
+	WarningSourceSafeDistance = "safe_distance"
+	WarningSourceDangerZone   = "danger_zone"
+)
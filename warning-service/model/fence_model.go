@@ -1,9 +1,13 @@
 package model
 
-// FenceCheckRequest 围栏检查请求
+// FenceCheckRequest 围栏检查请求；室外围栏用 Lon / Lat 明确给出 RTK 经纬度，
+// 室内围栏用 MapID 限定只比较同一自制地图上的围栏
 type FenceCheckRequest struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
+	X     float64  `json:"x"`
+	Y     float64  `json:"y"`
+	Lon   *float64 `json:"lon,omitempty"`
+	Lat   *float64 `json:"lat,omitempty"`
+	MapID string   `json:"map_id,omitempty"`
 }
 
 // FenceCheckResponse 围栏检查响应
@@ -1,14 +1,21 @@
 package model
 
+import "time"
+
 type LocMsg struct {
-	ID   string `json:"id"`
-	Sens []Sens `json:"sens"`
+	ID   string     `json:"id"`
+	Sens []Sens     `json:"sens"`
+	Time *time.Time `json:"-"`             // 设备侧采样时间，仅 SenML 等携带时间的格式会填充
+	Seq  *uint64    `json:"seq,omitempty"` // 设备侧递增序号（可选），用于去重与乱序判定
+	Map  string     `json:"map,omitempty"` // 设备所在的自制地图（楼层）ID（可选），缺省时使用设备被分配的地图
 }
 
 type Sens struct {
-	N string    `json:"n"` // 传感器名称
-	U string    `json:"u"` // 单位
-	V []float64 `json:"v"` // 数值数组
+	N  string    `json:"n"`            // 传感器名称
+	U  string    `json:"u"`            // 单位
+	V  []float64 `json:"v"`            // 数值数组
+	VS *string   `json:"vs,omitempty"` // 字符串值（SenML vs）
+	VB *bool     `json:"vb,omitempty"` // 布尔值（SenML vb）
 }
 
 type RTKLoc struct {
@@ -19,11 +26,25 @@ type RTKLoc struct {
 }
 
 type UWBLoc struct {
-	ID string
-	X  float64
-	Y  float64
+	ID    string
+	X     float64
+	Y     float64
+	MapID string // 所在自制地图，空表示未知
 }
 
 type OnlineMsg struct {
 	ID string `json:"id"`
 }
+
+// HistoryLoc mqtt-watch 写入 MongoDB device_loc 的位置记录（只取回放需要的字段），
+// JSON 标签与 mqtt-watch 的导出格式一致
+type HistoryLoc struct {
+	DeviceID   string    `bson:"device_id" json:"id"`
+	Indoor     bool      `bson:"indoor" json:"indoor"`
+	Latitude   *float64  `bson:"latitude,omitempty" json:"lat,omitempty"`
+	Longitude  *float64  `bson:"longitude,omitempty" json:"lon,omitempty"`
+	LonLat     bool      `bson:"lonlat" json:"-"` // 经纬度已按 [经度, 纬度] 写入；早期记录缺少该标记，两列是对调的
+	UWBX       *float64  `bson:"uwb_x,omitempty" json:"uwb_x,omitempty"`
+	UWBY       *float64  `bson:"uwb_y,omitempty" json:"uwb_y,omitempty"`
+	RecordTime time.Time `bson:"record_time" json:"record_time"`
+}
@@ -18,6 +18,8 @@ type Mark struct {
 	CreatedAt     time.Time      `gorm:"not null;default:now();column:created_at"`                 // CreatedAt：记录创建时间
 	UpdatedAt     time.Time      `gorm:"not null;default:now();column:updated_at"`                 // UpdatedAt：记录最后更新时间
 	LastOnlineAt  *time.Time     `gorm:"column:last_online_at"`                                    // LastOnlineAt：设备最后一次上线时间，nil 表示从未上线
+	IsOnline      bool           `gorm:"not null;default:false;column:is_online"`                  // IsOnline：在线状态，由 Presence 在上下线时写入
+	MapID         *uuid.UUID     `gorm:"type:uuid;column:map_id"`                                  // MapID：设备被分配的自制地图（楼层），nil 表示未分配
 }
 
 func (Mark) TableName() string {
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// PresenceEvent 设备上下线事件，发布到 presence/<device_id>
+type PresenceEvent struct {
+	DeviceID string    `json:"device_id"`
+	Online   bool      `json:"online"`
+	Reason   string    `json:"reason"` // message：收到消息上线；timeout：超时离线；lwt：遗嘱消息离线
+	At       time.Time `json:"at"`     // 上线为收到消息时间，离线为最后活跃时间
+}
+
+const (
+	PresenceReasonMessage = "message"
+	PresenceReasonTimeout = "timeout"
+	PresenceReasonLWT     = "lwt"
+)
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"IOT-Manage-System/warning-service/config"
+	"IOT-Manage-System/warning-service/model"
+)
+
+// HistoryFilter 回放范围：From / To 为零值表示不限，DeviceIDs 为空表示全部设备
+type HistoryFilter struct {
+	From      time.Time
+	To        time.Time
+	DeviceIDs []string
+}
+
+func (f HistoryFilter) match(loc *model.HistoryLoc) bool {
+	if !f.From.IsZero() && loc.RecordTime.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !loc.RecordTime.Before(f.To) {
+		return false
+	}
+	if len(f.DeviceIDs) == 0 {
+		return true
+	}
+	for _, id := range f.DeviceIDs {
+		if id == loc.DeviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// HistorySource 按 record_time 升序逐条产出历史位置，fn 返回错误时中止
+type HistorySource interface {
+	Each(fn func(loc model.HistoryLoc) error) error
+}
+
+// MongoHistory 从 device_loc 集合读取
+type MongoHistory struct {
+	coll   *mongo.Collection
+	filter HistoryFilter
+}
+
+func NewMongoHistory(client *mongo.Client, filter HistoryFilter) *MongoHistory {
+	return &MongoHistory{
+		coll:   client.Database(config.C.MongoConfig.DB).Collection("device_loc"),
+		filter: filter,
+	}
+}
+
+func (h *MongoHistory) Each(fn func(loc model.HistoryLoc) error) error {
+	q := bson.M{}
+	rng := bson.M{}
+	if !h.filter.From.IsZero() {
+		rng["$gte"] = h.filter.From
+	}
+	if !h.filter.To.IsZero() {
+		rng["$lt"] = h.filter.To
+	}
+	if len(rng) > 0 {
+		q["record_time"] = rng
+	}
+	if len(h.filter.DeviceIDs) > 0 {
+		q["device_id"] = bson.M{"$in": h.filter.DeviceIDs}
+	}
+
+	ctx := context.Background()
+	cur, err := h.coll.Find(ctx, q, options.Find().SetSort(bson.D{{Key: "record_time", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("查询位置历史失败: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var loc model.HistoryLoc
+		if err := cur.Decode(&loc); err != nil {
+			return fmt.Errorf("解析位置历史失败: %w", err)
+		}
+		if err := fn(loc); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// FileHistory 从 JSONL 文件读取（每行一条 HistoryLoc），文件内不要求有序，读入后按时间排序
+type FileHistory struct {
+	path   string
+	filter HistoryFilter
+}
+
+func NewFileHistory(path string, filter HistoryFilter) *FileHistory {
+	return &FileHistory{path: path, filter: filter}
+}
+
+func (h *FileHistory) Each(fn func(loc model.HistoryLoc) error) error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var locs []model.HistoryLoc
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var loc model.HistoryLoc
+		if err := json.Unmarshal([]byte(text), &loc); err != nil {
+			return fmt.Errorf("%s:%d 解析失败: %w", h.path, line, err)
+		}
+		if loc.DeviceID == "" || !h.filter.match(&loc) {
+			continue
+		}
+		locs = append(locs, loc)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	sort.SliceStable(locs, func(i, j int) bool { return locs[i].RecordTime.Before(locs[j].RecordTime) })
+	for _, loc := range locs {
+		if err := fn(loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,7 +3,7 @@ package repo
 import (
 	"log"
 	"sync"
-	// "time"
+	"time"
 
 	"IOT-Manage-System/warning-service/model"
 )
@@ -196,64 +196,148 @@ func (d *DangerZone) SetBatch(m map[string]float64) {
 	}
 }
 
-// type OnlineStatus struct {
-// 	m       map[string]bool
-// 	lastAct map[string]time.Time
-// 	mu      sync.RWMutex
-// 	stop    chan struct{}
-// }
-
-// // NewOnlineStatus 创建实例并启动后台扫描协程
-// // 参数: idle 多久没更新就视为掉线；scan 每隔多久扫描一次
-// func NewOnlineStatus(idle, scan time.Duration) *OnlineStatus {
-// 	o := &OnlineStatus{
-// 		m:       make(map[string]bool),
-// 		lastAct: make(map[string]time.Time),
-// 		stop:    make(chan struct{}),
-// 	}
-// 	go o.autoOffline(idle, scan)
-// 	return o
-// }
-
-// // Set 设置用户在线状态；online=true 时会刷新活跃时间
-// func (o *OnlineStatus) Set(id string, online bool) {
-// 	o.mu.Lock()
-// 	defer o.mu.Unlock()
-// 	o.m[id] = online
-// 	if online {
-// 		o.lastAct[id] = time.Now()
-// 	}
-// }
-
-// // Get 查询用户是否在线
-// func (o *OnlineStatus) Get(id string) bool {
-// 	o.mu.RLock()
-// 	defer o.mu.RUnlock()
-// 	return o.m[id]
-// }
-
-// // Close 停掉后台 goroutine，程序退出前调用
-// func (o *OnlineStatus) Close() {
-// 	close(o.stop)
-// }
-
-// // 后台定时扫描：把超时的用户强制置为 offline
-// func (o *OnlineStatus) autoOffline(idle, scan time.Duration) {
-// 	tick := time.NewTicker(scan)
-// 	defer tick.Stop()
-// 	for {
-// 		select {
-// 		case <-tick.C:
-// 			now := time.Now()
-// 			o.mu.Lock()
-// 			for uid, t := range o.lastAct {
-// 				if now.Sub(t) > idle && o.m[uid] {
-// 					o.m[uid] = false
-// 				}
-// 			}
-// 			o.mu.Unlock()
-// 		case <-o.stop:
-// 			return
-// 		}
-// 	}
-// }
+/* ====== OnlineStatus ====== */
+
+// OnlineStatus 设备在线状态（内存），上下线变化通过 onChange 回调通知
+type OnlineStatus struct {
+	m        map[string]bool
+	lastAct  map[string]time.Time
+	mu       sync.RWMutex
+	stop     chan struct{}
+	onChange func(model.PresenceEvent)
+}
+
+// NewOnlineStatus 创建实例并启动后台扫描协程
+// 参数: idle 多久没更新就视为掉线；scan 每隔多久扫描一次；onChange 状态变化回调（在锁外调用）
+func NewOnlineStatus(idle, scan time.Duration, onChange func(model.PresenceEvent)) *OnlineStatus {
+	o := &OnlineStatus{
+		m:        make(map[string]bool),
+		lastAct:  make(map[string]time.Time),
+		stop:     make(chan struct{}),
+		onChange: onChange,
+	}
+	go o.autoOffline(idle, scan)
+	return o
+}
+
+// Touch 收到设备消息：刷新活跃时间，离线→在线时返回 true 并触发事件
+func (o *OnlineStatus) Touch(id string, t time.Time) bool {
+	o.mu.Lock()
+	o.lastAct[id] = t
+	changed := !o.m[id]
+	o.m[id] = true
+	o.mu.Unlock()
+
+	if changed {
+		o.emit(model.PresenceEvent{DeviceID: id, Online: true, Reason: model.PresenceReasonMessage, At: t})
+	}
+	return changed
+}
+
+// SetOffline 立即置为离线（如收到遗嘱消息），在线→离线时触发事件
+func (o *OnlineStatus) SetOffline(id, reason string) bool {
+	o.mu.Lock()
+	changed := o.m[id]
+	o.m[id] = false
+	last, ok := o.lastAct[id]
+	o.mu.Unlock()
+
+	if changed {
+		if !ok {
+			last = time.Now()
+		}
+		o.emit(model.PresenceEvent{DeviceID: id, Online: false, Reason: reason, At: last})
+	}
+	return changed
+}
+
+// Get 查询设备是否在线
+func (o *OnlineStatus) Get(id string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.m[id]
+}
+
+// LastActive 最后活跃时间
+func (o *OnlineStatus) LastActive(id string) (time.Time, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	t, ok := o.lastAct[id]
+	return t, ok
+}
+
+// LastActSnapshot 所有上报过的设备及其最后活跃时间（拷贝）
+func (o *OnlineStatus) LastActSnapshot() map[string]time.Time {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	out := make(map[string]time.Time, len(o.lastAct))
+	for id, t := range o.lastAct {
+		out[id] = t
+	}
+	return out
+}
+
+// Forget 删除离线设备的状态；before 之后又上报过的设备保留（返回 false）
+func (o *OnlineStatus) Forget(id string, before time.Time) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t, ok := o.lastAct[id]
+	if !ok || t.After(before) || o.m[id] {
+		return false
+	}
+	delete(o.lastAct, id)
+	delete(o.m, id)
+	return true
+}
+
+// OnlineList 当前在线设备 ID 列表
+func (o *OnlineStatus) OnlineList() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	ids := make([]string, 0, len(o.m))
+	for id, online := range o.m {
+		if online {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Close 停掉后台 goroutine，程序退出前调用
+func (o *OnlineStatus) Close() {
+	close(o.stop)
+}
+
+func (o *OnlineStatus) emit(e model.PresenceEvent) {
+	if o.onChange != nil {
+		o.onChange(e)
+	}
+}
+
+// 后台定时扫描：把超时的设备强制置为 offline
+func (o *OnlineStatus) autoOffline(idle, scan time.Duration) {
+	tick := time.NewTicker(scan)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			now := time.Now()
+			var events []model.PresenceEvent
+			o.mu.Lock()
+			for id, t := range o.lastAct {
+				if now.Sub(t) > idle && o.m[id] {
+					o.m[id] = false
+					events = append(events, model.PresenceEvent{
+						DeviceID: id, Online: false, Reason: model.PresenceReasonTimeout, At: t,
+					})
+				}
+			}
+			o.mu.Unlock()
+			for _, e := range events {
+				o.emit(e)
+			}
+		case <-o.stop:
+			return
+		}
+	}
+}
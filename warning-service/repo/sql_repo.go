@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +18,9 @@ import (
 	"IOT-Manage-System/warning-service/model"
 )
 
+// ErrMarkNotFound mark-service 中不存在该设备对应的标记
+var ErrMarkNotFound = errors.New("标记不存在")
+
 // MarkAPIClient mark-service API客户端
 type MarkAPIClient struct {
 	client  *http.Client
@@ -44,12 +48,18 @@ type MarkInfo struct {
 	CreatedAt    string    `json:"created_at"`
 	UpdatedAt    string    `json:"updated_at"`
 	LastOnlineAt *string   `json:"last_online_at"`
+	IsOnline     bool      `json:"is_online"`
+	MapID        *string   `json:"map_id"`
 }
 
 type MarkType struct {
-	ID                 int     `json:"id"`
-	TypeName           string  `json:"type_name"`
-	DefaultDangerZoneM float64 `json:"default_danger_zone_m"`
+	ID                 int             `json:"id"`
+	TypeName           string          `json:"type_name"`
+	DefaultDangerZoneM float64         `json:"default_danger_zone_m"`
+	PayloadDecoder     string          `json:"payload_decoder"`
+	DecoderConfig      json.RawMessage `json:"decoder_config"`
+	SilenceAlarmS      *int            `json:"silence_alarm_second"`
+	SilenceAlarmFenceS *int            `json:"silence_alarm_in_fence_second"`
 }
 
 type Tag struct {
@@ -121,6 +131,18 @@ func (r *MarkRepo) SetOnline(deviceID string, t ...time.Time) error {
 		Update("last_online_at", onlineAt).Error
 }
 
+// SetPresence 推送设备上下线状态，at 为最后活跃时间
+func (r *MarkRepo) SetPresence(deviceID string, online bool, at time.Time) error {
+	if r.useAPI && r.apiClient != nil {
+		return r.apiClient.UpdatePresence(deviceID, online, at)
+	}
+
+	// 使用数据库更新（兼容模式）
+	return r.db.Model(&model.Mark{}).
+		Where("device_id = ?", deviceID).
+		Updates(map[string]any{"is_online": online, "last_online_at": at}).Error
+}
+
 func (r *MarkRepo) GetOnlineList() ([]string, error) {
 	if r.useAPI && r.apiClient != nil {
 		// 使用API获取在线设备列表
@@ -311,11 +333,112 @@ func (r *MarkRepo) GetDistanceByDevice(deviceIDs []string) ([]model.MarkPairSafe
 	return results, err
 }
 
+// GetDecoderByDeviceID 查询设备所属类型配置的载荷解码器，设备不存在时返回空串
+func (r *MarkRepo) GetDecoderByDeviceID(deviceID string) (string, []byte, error) {
+	if r.useAPI && r.apiClient != nil {
+		mark, err := r.apiClient.GetMarkByDeviceID(deviceID)
+		if errors.Is(err, ErrMarkNotFound) {
+			return "", nil, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if mark.MarkType == nil {
+			return "", nil, nil
+		}
+		return mark.MarkType.PayloadDecoder, mark.MarkType.DecoderConfig, nil
+	}
+
+	// 使用数据库查询（兼容模式）
+	var row struct {
+		PayloadDecoder string
+		DecoderConfig  []byte
+	}
+	err := r.db.Table("marks").
+		Select("mark_types.payload_decoder, mark_types.decoder_config").
+		Joins("JOIN mark_types ON mark_types.id = marks.mark_type_id").
+		Where("marks.device_id = ?", deviceID).
+		Limit(1).
+		Scan(&row).Error
+	return row.PayloadDecoder, row.DecoderConfig, err
+}
+
+// GetMapIDByDevice 查询设备被分配的自制地图 ID，未分配或设备不存在时返回空串
+func (r *MarkRepo) GetMapIDByDevice(deviceID string) (string, error) {
+	if r.useAPI && r.apiClient != nil {
+		mark, err := r.apiClient.GetMarkByDeviceID(deviceID)
+		if errors.Is(err, ErrMarkNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if mark.MapID == nil {
+			return "", nil
+		}
+		return *mark.MapID, nil
+	}
+
+	// 使用数据库查询（兼容模式）
+	var mapID *string
+	err := r.db.Model(&model.Mark{}).
+		Where("device_id = ?", deviceID).
+		Select("map_id").
+		Scan(&mapID).Error
+	if err != nil || mapID == nil {
+		return "", err
+	}
+	return *mapID, nil
+}
+
+// GetSilenceThresholds 查询设备所属类型的静默报警阈值（秒），0 表示不报警；
+// 围栏内阈值未配置时沿用普通阈值，设备对应的标记已删除时返回 ErrMarkNotFound
+func (r *MarkRepo) GetSilenceThresholds(deviceID string) (normal, inFence int, err error) {
+	var s, f *int
+	if r.useAPI && r.apiClient != nil {
+		mark, err := r.apiClient.GetMarkByDeviceID(deviceID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if mark.MarkType != nil {
+			s, f = mark.MarkType.SilenceAlarmS, mark.MarkType.SilenceAlarmFenceS
+		}
+	} else {
+		// 使用数据库查询（兼容模式）；LEFT JOIN 区分“标记不存在”与“类型未配置”
+		var row struct {
+			SilenceAlarmSecond        *int
+			SilenceAlarmInFenceSecond *int
+		}
+		res := r.db.Table("marks").
+			Select("mark_types.silence_alarm_second, mark_types.silence_alarm_in_fence_second").
+			Joins("LEFT JOIN mark_types ON mark_types.id = marks.mark_type_id").
+			Where("marks.device_id = ?", deviceID).
+			Limit(1).
+			Scan(&row)
+		if res.Error != nil {
+			return 0, 0, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return 0, 0, fmt.Errorf("设备 %s 对应的%w", deviceID, ErrMarkNotFound)
+		}
+		s, f = row.SilenceAlarmSecond, row.SilenceAlarmInFenceSecond
+	}
+
+	if s != nil && *s > 0 {
+		normal = *s
+	}
+	inFence = normal
+	if f != nil && *f > 0 {
+		inFence = *f
+	}
+	return normal, inFence, nil
+}
+
 // MarkAPIClient 方法实现
 
 // GetMarkByDeviceID 根据设备ID获取标记信息
 func (c *MarkAPIClient) GetMarkByDeviceID(deviceID string) (*MarkInfo, error) {
-	url := fmt.Sprintf("%s/api/v1/marks/device/%s", c.baseURL, deviceID)
+	url := fmt.Sprintf("%s/api/v1/marks/device/%s?preload=true", c.baseURL, deviceID)
 
 	resp, err := c.client.Get(url)
 	if err != nil {
@@ -324,7 +447,7 @@ func (c *MarkAPIClient) GetMarkByDeviceID(deviceID string) (*MarkInfo, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf("设备 %s 对应的标记不存在", deviceID)
+		return nil, fmt.Errorf("设备 %s 对应的%w", deviceID, ErrMarkNotFound)
 	}
 
 	if resp.StatusCode != 200 {
@@ -482,12 +605,75 @@ func (c *MarkAPIClient) UpdateLastOnlineTime(deviceID string) error {
 	return nil
 }
 
-// GetOnlineDevices 获取在线设备列表（通过查询最近在线时间的设备）
+// UpdatePresence 推送设备上下线状态
+func (c *MarkAPIClient) UpdatePresence(deviceID string, online bool, at time.Time) error {
+	url := fmt.Sprintf("%s/api/v1/marks/device/%s/last-online", c.baseURL, deviceID)
+
+	body, err := json.Marshal(map[string]any{"online": online, "at": at})
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %w", err)
+	}
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// GetOnlineDevices 获取在线设备列表（mark-service GET /marks/online，逐页拉取）
 func (c *MarkAPIClient) GetOnlineDevices() ([]string, error) {
-	// 注意：这个API在mark-service中可能不存在，需要根据实际情况调整
-	// 这里先返回空列表，后续可能需要通过其他方式实现
-	log.Printf("[WARN] GetOnlineDevices API在mark-service中可能不存在，返回空列表")
-	return []string{}, nil
+	var ids []string
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/api/v1/marks/online?page=%d&limit=100", c.baseURL, page)
+
+		resp, err := c.client.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("请求失败: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取响应失败: %w", err)
+		}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("API返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		}
+
+		var apiResp struct {
+			Success    bool       `json:"success"`
+			Data       []MarkInfo `json:"data"`
+			Message    string     `json:"message"`
+			Pagination struct {
+				HasNext bool `json:"has_next"`
+			} `json:"pagination"`
+		}
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return nil, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if !apiResp.Success {
+			return nil, fmt.Errorf("API返回错误: %s", apiResp.Message)
+		}
+
+		for _, m := range apiResp.Data {
+			ids = append(ids, m.DeviceID)
+		}
+		if !apiResp.Pagination.HasNext {
+			return ids, nil
+		}
+	}
 }
 
 // GetDeviceIDByMarkID 根据标记UUID获取设备ID
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时间来源：线上为系统时间，回放时由历史记录推进
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 系统时间
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// VirtualClock 手动推进的时钟，回放用
+type VirtualClock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Set 推进到 t，早于当前时间时忽略（时钟不回拨）
+func (c *VirtualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
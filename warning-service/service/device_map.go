@@ -0,0 +1,67 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// MapLookup 查询设备被分配的自制地图 ID，未分配时返回空串
+type MapLookup func(deviceID string) (string, error)
+
+type mapEntry struct {
+	mapID    string
+	expireAt time.Time
+}
+
+// DeviceMaps 确定设备所在的自制地图（楼层）：上报中携带 map 时以上报为准，
+// 否则使用 mark-service 中分配的地图（按 ttl 缓存）
+type DeviceMaps struct {
+	lookup MapLookup
+	ttl    time.Duration
+
+	mu    sync.RWMutex
+	cache map[string]mapEntry
+}
+
+// NewDeviceMaps 构造函数，ttl 为设备→分配地图的缓存时间
+func NewDeviceMaps(lookup MapLookup, ttl time.Duration) *DeviceMaps {
+	return &DeviceMaps{
+		lookup: lookup,
+		ttl:    ttl,
+		cache:  make(map[string]mapEntry),
+	}
+}
+
+// Resolve 返回设备当前所在地图，reported 为本次上报携带的地图；都没有时返回空串（不区分地图）
+func (d *DeviceMaps) Resolve(deviceID, reported string) string {
+	if reported != "" || d == nil || d.lookup == nil {
+		return reported
+	}
+
+	now := time.Now()
+	d.mu.RLock()
+	e, ok := d.cache[deviceID]
+	d.mu.RUnlock()
+	if ok && now.Before(e.expireAt) {
+		return e.mapID
+	}
+
+	mapID, err := d.lookup(deviceID)
+	if err != nil {
+		log.Printf("[WARN] 查询设备分配的地图失败  deviceID=%s  err=%v", deviceID, err)
+		if ok {
+			mapID = e.mapID // 查询失败时沿用过期的缓存
+		}
+	}
+
+	d.mu.Lock()
+	d.cache[deviceID] = mapEntry{mapID: mapID, expireAt: now.Add(d.ttl)}
+	d.mu.Unlock()
+	return mapID
+}
+
+// sameMap 两台设备是否可能在同一地图上：任一方地图未知时按同一地图处理（与未分地图时的行为一致）
+func sameMap(a, b string) bool {
+	return a == "" || b == "" || a == b
+}
@@ -21,6 +21,7 @@ type FenceRateLimiter struct {
 	mu      sync.RWMutex
 	maxRate int           // 每秒最大请求次数
 	window  time.Duration // 时间窗口
+	clock   Clock
 }
 
 // FenceChecker 围栏检查器
@@ -37,11 +38,12 @@ type FenceChecker struct {
 }
 
 // NewFenceRateLimiter 创建围栏检测限流器
-func NewFenceRateLimiter() *FenceRateLimiter {
+func NewFenceRateLimiter(clock Clock) *FenceRateLimiter {
 	limiter := &FenceRateLimiter{
 		records: make(map[string][]time.Time),
 		maxRate: 5,               // 每秒最多5次请求
 		window:  1 * time.Second, // 1秒时间窗口
+		clock:   clock,
 	}
 	// 启动清理协程
 	go limiter.cleanupLoop()
@@ -53,7 +55,7 @@ func (r *FenceRateLimiter) Allow(deviceID string) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	now := time.Now()
+	now := r.clock.Now()
 
 	// 获取该设备的请求记录
 	times, exists := r.records[deviceID]
@@ -89,7 +91,7 @@ func (r *FenceRateLimiter) cleanupLoop() {
 
 	for range ticker.C {
 		r.mu.Lock()
-		now := time.Now()
+		now := r.clock.Now()
 		for deviceID, times := range r.records {
 			// 清理超过窗口的记录
 			validTimes := make([]time.Time, 0)
@@ -110,6 +112,11 @@ func (r *FenceRateLimiter) cleanupLoop() {
 
 // NewFenceChecker 创建围栏检查器
 func NewFenceChecker() *FenceChecker {
+	return NewFenceCheckerWithClock(SystemClock{})
+}
+
+// NewFenceCheckerWithClock 限流按 clock 计时，回放时传入虚拟时钟
+func NewFenceCheckerWithClock(clock Clock) *FenceChecker {
 	hostname := config.C.MapServiceConfig.Hostname
 	port := config.C.MapServiceConfig.Port
 	baseURL := fmt.Sprintf("http://%s:%s", hostname, port)
@@ -122,7 +129,7 @@ func NewFenceChecker() *FenceChecker {
 		},
 		baseURL:     baseURL,
 		statusCache: make(map[string]bool),
-		rateLimiter: NewFenceRateLimiter(),
+		rateLimiter: NewFenceRateLimiter(clock),
 	}
 }
 
@@ -214,8 +221,8 @@ func (fc *FenceChecker) CheckPoint(deviceID string, x, y float64) (bool, error)
 	return isInside, nil
 }
 
-// CheckPointIndoor 使用室内围栏接口检查点是否在任意室内围栏内
-func (fc *FenceChecker) CheckPointIndoor(deviceID string, x, y float64) (bool, error) {
+// CheckPointIndoor 使用室内围栏接口检查点是否在任意室内围栏内，mapID 非空时只比较该地图与全局围栏
+func (fc *FenceChecker) CheckPointIndoor(deviceID string, x, y float64, mapID string) (bool, error) {
 	// 限流检查
 	if !fc.rateLimiter.Allow(deviceID) {
 		fc.mu.RLock()
@@ -227,7 +234,7 @@ func (fc *FenceChecker) CheckPointIndoor(deviceID string, x, y float64) (bool, e
 		return false, nil
 	}
 
-	reqBody := model.FenceCheckRequest{X: x, Y: y}
+	reqBody := model.FenceCheckRequest{X: x, Y: y, MapID: mapID}
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return false, fmt.Errorf("序列化请求失败: %w", err)
@@ -268,8 +275,8 @@ func (fc *FenceChecker) CheckPointIndoor(deviceID string, x, y float64) (bool, e
 	return isInside, nil
 }
 
-// CheckPointOutdoor 使用室外围栏接口检查点是否在任意室外围栏内
-func (fc *FenceChecker) CheckPointOutdoor(deviceID string, x, y float64) (bool, error) {
+// CheckPointOutdoor 使用室外围栏接口检查 RTK 点（经度, 纬度）是否在任意室外围栏内
+func (fc *FenceChecker) CheckPointOutdoor(deviceID string, lon, lat float64) (bool, error) {
 	// 限流检查
 	if !fc.rateLimiter.Allow(deviceID) {
 		fc.mu.RLock()
@@ -281,7 +288,7 @@ func (fc *FenceChecker) CheckPointOutdoor(deviceID string, x, y float64) (bool,
 		return false, nil
 	}
 
-	reqBody := model.FenceCheckRequest{X: x, Y: y}
+	reqBody := model.FenceCheckRequest{X: lon, Y: lat, Lon: &lon, Lat: &lat}
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return false, fmt.Errorf("序列化请求失败: %w", err)
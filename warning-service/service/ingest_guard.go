@@ -0,0 +1,169 @@
+package service
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+// 丢弃原因
+const (
+	DropDuplicate = "duplicate" // 与上一条为同一条消息（QoS 1 重投、重复 seq / 采样时间）
+	DropStale     = "stale"     // 比已接受的消息更旧（乱序到达）
+)
+
+// IngestGuard 按设备对上报去重并丢弃乱序消息，在落库 / 判定之前调用。
+// 判定顺序：
+//  1. 载荷带 seq：seq 不大于上一条则丢弃；以下情况视为设备重启计数归零，重新开始：
+//     回退超过 resetGap；采样时间晚于上一条；或距上次接受已超过 resetIdle 且不是 broker 重投
+//  2. 带设备侧采样时间：不晚于上一条则丢弃
+//  3. 两者都没有：只能识别 broker 重投（DUP 标志），window 内与上一条载荷相同则丢弃
+//
+// 设备超过 ttl 无上报时状态被清理，之后的第一条消息总被接受
+type IngestGuard struct {
+	mu        sync.Mutex
+	devices   map[string]*ingestState
+	window    time.Duration
+	ttl       time.Duration
+	resetGap  uint64
+	resetIdle time.Duration
+	now       func() time.Time
+
+	dropped map[string]uint64 // 本周期按原因累计的丢弃数
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type ingestState struct {
+	seq  *uint64
+	at   time.Time // 最近一条的设备侧采样时间
+	hash uint64    // 最近一条的载荷摘要
+	seen time.Time // 最近一次被接受的服务器时间
+}
+
+// NewIngestGuard 启动后台清理，不再使用时调用 Close
+func NewIngestGuard(window, ttl time.Duration, resetGap uint64, resetIdle time.Duration) *IngestGuard {
+	g := newIngestGuard(window, ttl, resetGap, resetIdle)
+	go g.cleanupLoop()
+	return g
+}
+
+func newIngestGuard(window, ttl time.Duration, resetGap uint64, resetIdle time.Duration) *IngestGuard {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	return &IngestGuard{
+		devices:   make(map[string]*ingestState),
+		window:    window,
+		ttl:       ttl,
+		resetGap:  resetGap,
+		resetIdle: resetIdle,
+		now:       time.Now,
+		dropped:   make(map[string]uint64),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Close 停止后台清理，可重复调用
+func (g *IngestGuard) Close() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// Accept 判断一条上报是否应处理。ok 为 false 时 reason 为 DropDuplicate / DropStale
+func (g *IngestGuard) Accept(deviceID string, seq *uint64, at *time.Time, payload []byte, dup bool) (ok bool, reason string) {
+	now := g.now()
+	h := fnv.New64a()
+	h.Write(payload)
+	sum := h.Sum64()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	st := g.devices[deviceID]
+	if st == nil || now.Sub(st.seen) > g.ttl {
+		st = &ingestState{}
+		g.devices[deviceID] = st
+	} else if reason = g.check(st, seq, at, sum, dup, now); reason != "" {
+		g.dropped[reason]++
+		return false, reason
+	}
+
+	if seq != nil {
+		v := *seq
+		st.seq = &v
+	}
+	if at != nil {
+		st.at = *at
+	}
+	st.hash = sum
+	st.seen = now
+	return true, ""
+}
+
+func (g *IngestGuard) check(st *ingestState, seq *uint64, at *time.Time, sum uint64, dup bool, now time.Time) string {
+	if seq != nil && st.seq != nil {
+		if *seq > *st.seq || g.reset(st, seq, at, dup, now) {
+			return ""
+		}
+		if *seq == *st.seq {
+			return DropDuplicate
+		}
+		return DropStale
+	}
+	if at != nil && !st.at.IsZero() {
+		switch {
+		case at.Equal(st.at):
+			return DropDuplicate
+		case at.Before(st.at):
+			return DropStale
+		}
+		return ""
+	}
+	if dup && sum == st.hash && now.Sub(st.seen) <= g.window {
+		return DropDuplicate
+	}
+	return ""
+}
+
+// reset seq 未递增时是否为设备重启后重新计数：回退幅度大到不可能是乱序、采样时间更新，
+// 或设备已有 resetIdle 没有被接受的上报（broker 重投除外）。seen 只在接受时更新，
+// 重启后的上报最多被丢弃 resetIdle
+func (g *IngestGuard) reset(st *ingestState, seq *uint64, at *time.Time, dup bool, now time.Time) bool {
+	switch {
+	case *seq < *st.seq && *st.seq-*seq > g.resetGap:
+		return true
+	case at != nil && !st.at.IsZero() && at.After(st.at):
+		return true
+	case !dup && g.resetIdle > 0 && now.Sub(st.seen) >= g.resetIdle:
+		return true
+	}
+	return false
+}
+
+// cleanupLoop 定期清理长时间无上报的设备，并汇总上一周期的丢弃数，Close 后退出
+func (g *IngestGuard) cleanupLoop() {
+	ticker := time.NewTicker(g.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.stop:
+			return
+		}
+		now := g.now()
+		g.mu.Lock()
+		for id, st := range g.devices {
+			if now.Sub(st.seen) > g.ttl {
+				delete(g.devices, id)
+			}
+		}
+		dup, stale := g.dropped[DropDuplicate], g.dropped[DropStale]
+		g.dropped = make(map[string]uint64)
+		g.mu.Unlock()
+		if dup+stale > 0 {
+			log.Printf("[INFO] 位置上报去重  duplicate=%d  stale=%d", dup, stale)
+		}
+	}
+}
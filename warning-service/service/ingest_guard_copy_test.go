@@ -0,0 +1,23 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ingest_guard.go 与 mqtt-watch/service/ingest_guard.go 是同一份代码，测试只在 mqtt-watch 中维护；
+// 这里只校验两份副本一致
+func TestIngestGuardSameAsMQTTWatch(t *testing.T) {
+	upstream, err := os.ReadFile(filepath.Join("..", "..", "mqtt-watch", "service", "ingest_guard.go"))
+	if err != nil {
+		t.Skip("mqtt-watch/service 不在当前工作区")
+	}
+	local, err := os.ReadFile("ingest_guard.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(local) != string(upstream) {
+		t.Error("ingest_guard.go 与 mqtt-watch/service/ingest_guard.go 不一致")
+	}
+}
@@ -3,18 +3,22 @@ package service
 import (
 	"log"
 	"math"
+	"sync"
 	"time"
 
-	"github.com/goccy/go-json"
-
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"gorm.io/gorm"
 
+	"IOT-Manage-System/warning-service/config"
+	"IOT-Manage-System/warning-service/decoder"
 	"IOT-Manage-System/warning-service/model"
 	"IOT-Manage-System/warning-service/repo"
 	"IOT-Manage-System/warning-service/utils"
 )
 
+// distanceCheckInterval 距离检查周期
+const distanceCheckInterval = 100 * time.Millisecond
+
 // Locator 依赖三个内存表，后续可接口化
 type Locator struct {
 	MemRepo      *repo.MemRepo
@@ -22,28 +26,65 @@ type Locator struct {
 	DangerZone   *repo.DangerZone
 	MarkRepo     *repo.MarkRepo
 	FenceChecker *FenceChecker
+	Decoders     *decoder.Registry // 按设备类型选择载荷解码器
+	Maps         *DeviceMaps       // 设备所在的自制地图（楼层），室内围栏与 UWB 距离只比较同一地图
+	Presence     *Presence
+	Guard        *IngestGuard // 位置上报去重 / 乱序丢弃
+	Sink         AlarmSink    // 报警出口，回放时替换为记录器
+	Clock        Clock        // 报警时间来源，回放时为虚拟时钟
+	Sync         bool         // 围栏判定与报警在调用方协程内完成（回放用，保证顺序与虚拟时钟一致）
+
+	fences *fenceSlots // 按设备串行的围栏判定
 }
 
 // NewLocator 工厂
-func NewLocator(db *gorm.DB, SafeDist *repo.SafeDist, DangerZone *repo.DangerZone, MarkRepo *repo.MarkRepo, FenceChecker *FenceChecker) *Locator {
+func NewLocator(db *gorm.DB, SafeDist *repo.SafeDist, DangerZone *repo.DangerZone, MarkRepo *repo.MarkRepo, FenceChecker *FenceChecker, Presence *Presence) *Locator {
 	return &Locator{
 		MemRepo:      repo.NewMemRepo(),
 		SafeDist:     SafeDist,
 		DangerZone:   DangerZone,
 		MarkRepo:     MarkRepo,
 		FenceChecker: FenceChecker,
+		Decoders:     decoder.NewRegistry(MarkRepo.GetDecoderByDeviceID, time.Minute),
+		Maps:         NewDeviceMaps(MarkRepo.GetMapIDByDevice, time.Minute),
+		Presence:     Presence,
+		Guard: NewIngestGuard(
+			config.C.AppConfig.IngestDupWindow,
+			config.C.AppConfig.IngestStateTTL,
+			uint64(config.C.AppConfig.IngestSeqResetGap),
+			config.C.AppConfig.IngestSeqResetIdle,
+		),
+		Sink:   MQTTSink{},
+		Clock:  SystemClock{},
+		fences: newFenceSlots(),
 	}
 }
 
-// OnLocMsg 被 main 注册到 MQTT 回调
+// OnLocMsg 被 main 注册到 MQTT 回调，载荷按设备所属 MarkType 配置的解码器归一化。
+// 分区部署时所有副本都保存全部设备的位置（距离检查需要任意两台设备的坐标），
+// 围栏判定与报警只针对本分区的设备。重复与乱序的消息在更新位置、判定之前丢弃；
+// 围栏判定按设备串行，判定期间到达的位置只保留最新一条，当前判定结束后接着判定
 func (l *Locator) OnLocMsg(c mqtt.Client, m mqtt.Message) {
-	log.Println("data: \v", string(m.Payload()))
-	var msg model.LocMsg
-	if err := json.Unmarshal(m.Payload(), &msg); err != nil {
-		log.Println("[WARN] json err:", err)
+	msg, err := l.Decoders.Decode(m.Topic(), m.Payload())
+	if err != nil {
+		log.Println("[WARN] payload err:", err)
 		return
 	}
-	if len(msg.Sens) == 0 {
+	// 在线状态由 Presence 跟踪，last_online_at 节流写入；其他分区的设备由对应副本跟踪
+	if msg.ID != "" && utils.OwnsDevice(msg.ID) {
+		l.Presence.Touch(msg.ID)
+	}
+	l.Ingest(msg, m.Payload(), m.Duplicate())
+}
+
+// Ingest 处理一条已解码的位置消息：去重、更新内存位置、围栏判定。回放直接调用
+func (l *Locator) Ingest(msg *model.LocMsg, payload []byte, dup bool) {
+	if len(msg.Sens) == 0 || msg.ID == "" {
+		return
+	}
+	ok, reason := l.Guard.Accept(msg.ID, msg.Seq, msg.Time, payload, dup)
+	if !ok {
+		log.Printf("[DEBUG] 丢弃位置上报  deviceID=%s  reason=%s", msg.ID, reason)
 		return
 	}
 
@@ -57,6 +98,14 @@ func (l *Locator) OnLocMsg(c mqtt.Client, m mqtt.Message) {
 		}
 	}
 
+	// 本条位置的围栏判定，同一条消息的室外 / 室内判定依次执行
+	var checks []func()
+	defer func() {
+		if len(checks) > 0 {
+			l.evaluate(msg.ID, checks)
+		}
+	}()
+
 	// 写 RTK
 	if rtkS != nil && len(rtkS.V) >= 2 && rtkS.V[0] != 0 && rtkS.V[1] != 0 {
 		l.MemRepo.SetRTK(&model.RTKLoc{
@@ -68,8 +117,9 @@ func (l *Locator) OnLocMsg(c mqtt.Client, m mqtt.Message) {
 		// log.Printf("[DEBUG] 收到 RTK 定位消息  deviceID=%s  lon=%f  lat=%f", msg.ID, rtkS.V[0], rtkS.V[1])
 
 		// RTK 使用室外围栏检测
-		if l.FenceChecker != nil {
-			go l.checkFenceOutdoor(msg.ID, rtkS.V[0], rtkS.V[1])
+		if l.FenceChecker != nil && utils.OwnsDevice(msg.ID) {
+			lon, lat := rtkS.V[0], rtkS.V[1]
+			checks = append(checks, func() { l.checkFenceOutdoor(msg.ID, lon, lat) })
 		}
 	}
 
@@ -78,18 +128,26 @@ func (l *Locator) OnLocMsg(c mqtt.Client, m mqtt.Message) {
 	uwbValid := uwbS != nil && len(uwbS.V) >= 2
 	uwbIsZero := uwbS != nil && len(uwbS.V) >= 2 && uwbS.V[0] == 0 && uwbS.V[1] == 0
 
+	// UWB 坐标只在同一自制地图（楼层）内有意义
+	var mapID string
+	if uwbValid {
+		mapID = l.Maps.Resolve(msg.ID, msg.Map)
+	}
+
 	if uwbValid && !(uwbIsZero && rtkValid) {
 		// UWB数据有效，且不是"RTK有效且UWB为(0,0)"的情况，正常存储和使用UWB
 		l.MemRepo.SetUWB(&model.UWBLoc{
-			ID: msg.ID,
-			X:  uwbS.V[0],
-			Y:  uwbS.V[1],
+			ID:    msg.ID,
+			X:     uwbS.V[0],
+			Y:     uwbS.V[1],
+			MapID: mapID,
 		})
 		// log.Printf("[DEBUG] 收到 UWB 定位消息  deviceID=%s  x=%f  y=%f", msg.ID, uwbS.V[0], uwbS.V[1])
 
 		// UWB 使用室内围栏检测（异步避免阻塞）
-		if l.FenceChecker != nil {
-			go l.checkFenceIndoor(msg.ID, uwbS.V[0], uwbS.V[1])
+		if l.FenceChecker != nil && utils.OwnsDevice(msg.ID) {
+			x, y := uwbS.V[0], uwbS.V[1]
+			checks = append(checks, func() { l.checkFenceIndoor(msg.ID, x, y, mapID) })
 		}
 	} else if uwbIsZero && rtkValid {
 		// 只有当RTK有效且UWB为(0,0)时，才优先使用RTK，抛弃UWB
@@ -97,64 +155,52 @@ func (l *Locator) OnLocMsg(c mqtt.Client, m mqtt.Message) {
 	} else if uwbIsZero && !rtkValid {
 		// RTK无效但UWB为(0,0)，使用UWB(0,0)作为有效定位
 		l.MemRepo.SetUWB(&model.UWBLoc{
-			ID: msg.ID,
-			X:  uwbS.V[0],
-			Y:  uwbS.V[1],
+			ID:    msg.ID,
+			X:     uwbS.V[0],
+			Y:     uwbS.V[1],
+			MapID: mapID,
 		})
 		// log.Printf("[DEBUG] RTK无效，使用UWB(0,0)定位，设备ID=%s", msg.ID)
 
 		// UWB 使用室内围栏检测
-		if l.FenceChecker != nil {
-			go l.checkFenceIndoor(msg.ID, uwbS.V[0], uwbS.V[1])
+		if l.FenceChecker != nil && utils.OwnsDevice(msg.ID) {
+			x, y := uwbS.V[0], uwbS.V[1]
+			checks = append(checks, func() { l.checkFenceIndoor(msg.ID, x, y, mapID) })
 		}
 	}
 
 }
 
-func (l *Locator) Online(c mqtt.Client, m mqtt.Message) {
-	var msg model.OnlineMsg
-	if err := json.Unmarshal(m.Payload(), &msg); err != nil {
-		log.Println("[WARN] json err:", err)
-		return
-	}
-	// log.Println("[INFO] 设备在线", msg.ID)
-	l.MarkRepo.SetOnline(msg.ID, time.Now())
-}
-
-// checkFence 检查设备是否在围栏内
-func (l *Locator) checkFenceIndoor(deviceID string, x, y float64) {
-	isInside, err := l.FenceChecker.CheckPointIndoor(deviceID, x, y)
+// checkFence 检查设备是否在围栏内，由 evaluate 按设备串行调用
+func (l *Locator) checkFenceIndoor(deviceID string, x, y float64, mapID string) {
+	isInside, err := l.FenceChecker.CheckPointIndoor(deviceID, x, y, mapID)
 	if err != nil {
 		log.Printf("[WARN] 检查室内围栏失败 deviceID=%s error=%v", deviceID, err)
 		return
 	}
-
 	if l.FenceChecker.ShouldSendAlert(deviceID, isInside) {
 		if isInside {
 			log.Printf("[FENCE_ALERT] 设备 %s 在室内电子围栏内，发送警报", deviceID)
-			SendWarning(deviceID, true)
 		} else {
 			log.Printf("[FENCE_ALERT] 设备 %s 离开室内电子围栏，取消警报", deviceID)
-			SendWarning(deviceID, false)
 		}
+		l.Sink.Warning(model.WarningEvent{DeviceID: deviceID, On: isInside, Source: model.WarningSourceFenceIndoor, At: l.Clock.Now()})
 	}
 }
 
-func (l *Locator) checkFenceOutdoor(deviceID string, x, y float64) {
-	isInside, err := l.FenceChecker.CheckPointOutdoor(deviceID, x, y)
+func (l *Locator) checkFenceOutdoor(deviceID string, lon, lat float64) {
+	isInside, err := l.FenceChecker.CheckPointOutdoor(deviceID, lon, lat)
 	if err != nil {
 		log.Printf("[WARN] 检查室外围栏失败 deviceID=%s error=%v", deviceID, err)
 		return
 	}
-
 	if l.FenceChecker.ShouldSendAlert(deviceID, isInside) {
 		if isInside {
 			log.Printf("[FENCE_ALERT] 设备 %s 在室外围栏内，发送警报", deviceID)
-			SendWarning(deviceID, true)
 		} else {
 			log.Printf("[FENCE_ALERT] 设备 %s 离开室外围栏，取消警报", deviceID)
-			SendWarning(deviceID, false)
 		}
+		l.Sink.Warning(model.WarningEvent{DeviceID: deviceID, On: isInside, Source: model.WarningSourceFenceOutdoor, At: l.Clock.Now()})
 	}
 }
 
@@ -191,18 +237,28 @@ func (l *Locator) checkFenceOutdoor(deviceID string, x, y float64) {
 // 	}
 // }
 
+// Stop 停止去重状态的后台清理
+func (l *Locator) Stop() {
+	l.Guard.Close()
+}
+
 func (l *Locator) StartDistanceChecker() {
 	go func() {
-		ticker := time.NewTicker(100 * time.Millisecond)
+		ticker := time.NewTicker(distanceCheckInterval)
 		defer ticker.Stop()
 		for range ticker.C {
-			// 暂时不检查RTK
-			// l.batchCheckRTK()
-			l.batchCheckUWB()
+			l.checkDistances()
 		}
 	}()
 }
 
+// checkDistances 一轮距离检查，每 distanceCheckInterval 执行一次
+func (l *Locator) checkDistances() {
+	// 暂时不检查RTK
+	// l.batchCheckRTK()
+	l.batchCheckUWB()
+}
+
 func (l *Locator) batchCheckRTK() {
 	// 把当前全量 RTK 快照出来
 	snapshot := l.MemRepo.RTKSnapshot()
@@ -238,8 +294,7 @@ func (l *Locator) batchCheckRTK() {
 			// 优先使用安全距离检查
 			if safe > 0 && distance < safe {
 				// log.Printf("[DEBUG] 设备间距离 小于安全距离  deviceID1=%s  deviceID2=%s  distance=%f  safe_distance=%f", a.ID, b.ID, distance, safe)
-				go SendWarning(a.ID, true)
-				go SendWarning(b.ID, true)
+				l.warnOwned(model.WarningSourceSafeDistance, a.ID, b.ID, distance, safe)
 				l.MemRepo.ClearRTK()
 			}
 			// 安全距离未设置时，检查危险区域
@@ -249,8 +304,7 @@ func (l *Locator) batchCheckRTK() {
 			dangerZone := math.Max(dangerZoneA, dangerZoneB)
 			if dangerZone > 0 && distance < dangerZone {
 				// log.Printf("[DEBUG] 设备间距离 小于危险距离  deviceID1=%s  deviceID2=%s  distance=%f  danger_distance=%f", a.ID, b.ID, distance, dangerZone)
-				go SendWarning(a.ID, true)
-				go SendWarning(b.ID, true)
+				l.warnOwned(model.WarningSourceDangerZone, a.ID, b.ID, distance, dangerZone)
 				l.MemRepo.ClearRTK()
 			}
 		}
@@ -267,6 +321,9 @@ func (l *Locator) batchCheckUWB() {
 	for i := 0; i < len(ids); i++ {
 		for j := i + 1; j < len(ids); j++ {
 			a, b := snapshot[ids[i]], snapshot[ids[j]]
+			if !sameMap(a.MapID, b.MapID) {
+				continue // 不同楼层的 UWB 坐标不可比较
+			}
 			distance := utils.CalculateUWB(*a, *b)
 			// log.Printf("[DEBUG] %s间%s距离: %f", a.ID, b.ID, distance)
 
@@ -292,8 +349,7 @@ func (l *Locator) batchCheckUWB() {
 			// 优先使用安全距离检查
 			if safe > 0 && distance < safe {
 				// log.Printf("[DEBUG] 设备间距离 小于安全距离  deviceID1=%s  deviceID2=%s  distance=%f  safe_distance=%f", a.ID, b.ID, distance, safe)
-				go SendWarning(a.ID, true)
-				go SendWarning(b.ID, true)
+				l.warnOwned(model.WarningSourceSafeDistance, a.ID, b.ID, distance, safe)
 				l.MemRepo.ClearUWB()
 			}
 			// 安全距离未设置时，检查危险区域
@@ -303,19 +359,88 @@ func (l *Locator) batchCheckUWB() {
 			dangerZone := math.Max(dangerZoneA, dangerZoneB)
 			if dangerZone > 0 && distance < dangerZone {
 				// log.Printf("[DEBUG] 设备间距离 小于危险距离  deviceID1=%s  deviceID2=%s  distance=%f  danger_distance=%f", a.ID, b.ID, distance, dangerZone)
-				go SendWarning(a.ID, true)
-				go SendWarning(b.ID, true)
+				l.warnOwned(model.WarningSourceDangerZone, a.ID, b.ID, distance, dangerZone)
 				l.MemRepo.ClearUWB()
 			}
 		}
 	}
 }
 
-// MultiHandler 把多个 mqtt.MessageHandler 串成一次调用。
-func MultiHandler(handlers ...mqtt.MessageHandler) mqtt.MessageHandler {
-	return func(c mqtt.Client, m mqtt.Message) {
-		for _, h := range handlers {
-			h(c, m)
+// warnOwned 距离报警只发给本分区的设备，另一台由其所属副本在自己的检查中报警
+func (l *Locator) warnOwned(source, a, b string, distance, limit float64) {
+	at := l.Clock.Now()
+	for _, pair := range [2][2]string{{a, b}, {b, a}} {
+		if !utils.OwnsDevice(pair[0]) {
+			continue
 		}
+		w := model.WarningEvent{DeviceID: pair[0], On: true, Source: source, PeerID: pair[1], Distance: distance, Limit: limit, At: at}
+		l.run(func() { l.Sink.Warning(w) })
+	}
+}
+
+// evaluate 执行一条位置的围栏判定。线上按设备串行：该设备已有判定在进行时只登记为待判定
+// （覆盖更早的待判定位置），进行中的判定结束后接着判定最新的一条，
+// 既不会让旧位置的结论覆盖新位置，也不会因上报快于判定耗时而一直不判定；Sync 时同步执行
+func (l *Locator) evaluate(deviceID string, checks []func()) {
+	job := func() {
+		for _, f := range checks {
+			f()
+		}
+	}
+	if l.Sync {
+		job()
+		return
+	}
+	if !l.fences.submit(deviceID, job) {
+		return
+	}
+	go func() {
+		for f := job; f != nil; f = l.fences.next(deviceID) {
+			f()
+		}
+	}()
+}
+
+// fenceSlots 每台设备一个判定槽：running 表示有协程在判定，pending 为等待判定的最新位置
+type fenceSlots struct {
+	mu      sync.Mutex
+	running map[string]bool
+	pending map[string]func()
+}
+
+func newFenceSlots() *fenceSlots {
+	return &fenceSlots{running: make(map[string]bool), pending: make(map[string]func())}
+}
+
+// submit 设备空闲时占用判定槽并返回 true，由调用方启动协程；否则覆盖待判定位置
+func (s *fenceSlots) submit(deviceID string, job func()) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[deviceID] {
+		s.pending[deviceID] = job
+		return false
+	}
+	s.running[deviceID] = true
+	return true
+}
+
+// next 取出待判定的位置；没有时释放判定槽并返回 nil
+func (s *fenceSlots) next(deviceID string) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.pending[deviceID]; ok {
+		delete(s.pending, deviceID)
+		return job
+	}
+	delete(s.running, deviceID)
+	return nil
+}
+
+// run 线上异步执行，避免阻塞 MQTT 回调与距离检查；Sync 时同步执行
+func (l *Locator) run(f func()) {
+	if l.Sync {
+		f()
+		return
 	}
+	go f()
 }
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 判定期间到达的多条位置只保留最新一条，当前判定结束后接着判定
+func TestEvaluateLatestFix(t *testing.T) {
+	l := &Locator{fences: newFenceSlots()}
+
+	var mu sync.Mutex
+	var got []int
+	record := func(i int) []func() {
+		return []func(){func() { mu.Lock(); got = append(got, i); mu.Unlock() }}
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	l.evaluate("d1", []func(){func() {
+		close(started)
+		<-release
+		mu.Lock()
+		got = append(got, 1)
+		mu.Unlock()
+	}})
+	<-started
+	for i := 2; i <= 4; i++ {
+		l.evaluate("d1", record(i))
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.fences.mu.Lock()
+		busy := l.fences.running["d1"]
+		l.fences.mu.Unlock()
+		if !busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("evaluation did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != 1 || got[1] != 4 {
+		t.Errorf("evaluated %v, want [1 4]", got)
+	}
+}
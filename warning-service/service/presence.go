@@ -0,0 +1,197 @@
+// service/presence.go
+package service
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"IOT-Manage-System/warning-service/model"
+	"IOT-Manage-System/warning-service/repo"
+	"IOT-Manage-System/warning-service/utils"
+)
+
+// PresenceTopicPrefix 上下线事件发布主题前缀：presence/<device_id>（retained）
+const PresenceTopicPrefix = "presence/"
+
+// presenceJob 待写入 mark-service 的在线状态，publish 为 true 时同时发布上下线事件
+type presenceJob struct {
+	deviceID string
+	online   bool
+	at       time.Time
+	publish  bool
+	reason   string
+}
+
+// Presence 设备在线状态跟踪：
+//   - 任意定位消息刷新活跃时间，离线→在线时发布事件并立即写库
+//   - 超过 OFFLINE_SECOND 未收到消息，或收到遗嘱消息，发布离线事件并写库
+//   - 在线期间 last_online_at 最多每 PRESENCE_PERSIST_SECOND 写一次
+type Presence struct {
+	status       *repo.OnlineStatus
+	markRepo     *repo.MarkRepo
+	persistEvery time.Duration
+
+	mu          sync.Mutex
+	lastPersist map[string]time.Time
+
+	jobsMu  sync.RWMutex // 保护 jobs 关闭，Stop 之后的回调直接丢弃
+	stopped bool
+	jobs    chan presenceJob
+	done    chan struct{}
+}
+
+// NewPresence 工厂，idle 为离线判定窗口
+func NewPresence(markRepo *repo.MarkRepo, idle, persistEvery time.Duration) *Presence {
+	p := &Presence{
+		markRepo:     markRepo,
+		persistEvery: persistEvery,
+		lastPersist:  make(map[string]time.Time),
+		jobs:         make(chan presenceJob, 1024),
+		done:         make(chan struct{}),
+	}
+	p.status = repo.NewOnlineStatus(idle, time.Second, p.onChange)
+	go p.persistLoop()
+	return p
+}
+
+// Touch 收到设备消息
+func (p *Presence) Touch(deviceID string) {
+	now := time.Now()
+	if p.status.Touch(deviceID, now) {
+		return // 上线事件里已写库
+	}
+
+	p.mu.Lock()
+	due := now.Sub(p.lastPersist[deviceID]) >= p.persistEvery
+	if due {
+		p.lastPersist[deviceID] = now
+	}
+	p.mu.Unlock()
+
+	if due {
+		// 节流写入可丢弃，队列满时不阻塞 MQTT 回调
+		p.enqueue(presenceJob{deviceID: deviceID, online: true, at: now}, false)
+	}
+}
+
+// OnLastWill 订阅遗嘱主题 offline/<device_id>，立即置为离线
+func (p *Presence) OnLastWill(c mqtt.Client, m mqtt.Message) {
+	deviceID := lastTopicSegment(m.Topic())
+	var msg model.OnlineMsg
+	if err := json.Unmarshal(m.Payload(), &msg); err == nil && strings.TrimSpace(msg.ID) != "" {
+		deviceID = strings.TrimSpace(msg.ID)
+	}
+	if deviceID == "" || !utils.OwnsDevice(deviceID) {
+		return
+	}
+	p.status.SetOffline(deviceID, model.PresenceReasonLWT)
+}
+
+// IsOnline 查询设备是否在线
+func (p *Presence) IsOnline(deviceID string) bool {
+	return p.status.Get(deviceID)
+}
+
+// OnlineList 当前在线设备
+func (p *Presence) OnlineList() []string {
+	return p.status.OnlineList()
+}
+
+// LastSeen 启动以来上报过的设备及其最后活跃时间
+func (p *Presence) LastSeen() map[string]time.Time {
+	return p.status.LastActSnapshot()
+}
+
+// Forget 释放 lastSeen 之后没有再上报、且已离线的设备状态，返回是否已释放
+func (p *Presence) Forget(deviceID string, lastSeen time.Time) bool {
+	if !p.status.Forget(deviceID, lastSeen) {
+		return false
+	}
+	p.mu.Lock()
+	delete(p.lastPersist, deviceID)
+	p.mu.Unlock()
+	return true
+}
+
+// Stop 停止扫描并写完剩余状态
+func (p *Presence) Stop() {
+	p.status.Close()
+	p.jobsMu.Lock()
+	p.stopped = true
+	close(p.jobs)
+	p.jobsMu.Unlock()
+	<-p.done
+}
+
+// enqueue 投递写库任务，block 为 false 时队列满直接丢弃
+func (p *Presence) enqueue(j presenceJob, block bool) {
+	p.jobsMu.RLock()
+	defer p.jobsMu.RUnlock()
+	if p.stopped {
+		return
+	}
+	if block {
+		p.jobs <- j
+		return
+	}
+	select {
+	case p.jobs <- j:
+	default:
+	}
+}
+
+// onChange 上下线事件：发布到 MQTT 并写库（上下线变化不丢弃）
+func (p *Presence) onChange(e model.PresenceEvent) {
+	log.Printf("[INFO] 设备状态变化  deviceID=%s  online=%t  reason=%s", e.DeviceID, e.Online, e.Reason)
+
+	p.mu.Lock()
+	if e.Online {
+		p.lastPersist[e.DeviceID] = e.At
+	} else {
+		delete(p.lastPersist, e.DeviceID)
+	}
+	p.mu.Unlock()
+
+	p.enqueue(presenceJob{deviceID: e.DeviceID, online: e.Online, at: e.At, publish: true, reason: e.Reason}, true)
+}
+
+// persistLoop 单协程顺序处理，保证同一设备的上下线事件不乱序；
+// 发布放在这里而不是 MQTT 回调里，避免在回调中等待 QoS 1 确认造成阻塞
+func (p *Presence) persistLoop() {
+	defer close(p.done)
+	for j := range p.jobs {
+		if j.publish {
+			publishPresence(model.PresenceEvent{DeviceID: j.deviceID, Online: j.online, Reason: j.reason, At: j.at})
+		}
+		if err := p.markRepo.SetPresence(j.deviceID, j.online, j.at); err != nil {
+			log.Printf("[WARN] 写入在线状态失败  deviceID=%s  online=%t  err=%v", j.deviceID, j.online, err)
+		}
+	}
+}
+
+// publishPresence 发布 retained 事件，新订阅者可直接拿到设备当前状态
+func publishPresence(e model.PresenceEvent) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	token := utils.MQTTClient.Publish(PresenceTopicPrefix+e.DeviceID, 1, true, payload)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Printf("[ERROR] 发布上下线事件失败: %v", err)
+	}
+}
+
+func lastTopicSegment(topic string) string {
+	topic = strings.Trim(topic, "/")
+	if i := strings.LastIndex(topic, "/"); i >= 0 {
+		return topic[i+1:]
+	}
+	return ""
+}
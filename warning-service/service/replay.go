@@ -0,0 +1,193 @@
+package service
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"gorm.io/gorm"
+
+	"IOT-Manage-System/warning-service/model"
+	"IOT-Manage-System/warning-service/repo"
+)
+
+// ReplayRecord 回放输出的一行：线上会发布的主题与事件
+type ReplayRecord struct {
+	Topic   string              `json:"topic"`
+	Warning *model.WarningEvent `json:"warning,omitempty"`
+	Alarm   *model.AlarmEvent   `json:"alarm,omitempty"`
+}
+
+// ReplayRecorder 回放出口：warning 按线上相同的限流规则（虚拟时钟）过滤，逐行写出 JSON，不发布 MQTT
+type ReplayRecorder struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	limiter *WarningRateLimiter
+	err     error
+
+	Warnings int
+	Alarms   int
+}
+
+func NewReplayRecorder(w io.Writer, clock Clock) *ReplayRecorder {
+	return &ReplayRecorder{enc: json.NewEncoder(w), limiter: NewWarningRateLimiter(clock)}
+}
+
+func (r *ReplayRecorder) Warning(w model.WarningEvent) {
+	if !r.limiter.Allow(w.DeviceID, w.On) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Warnings++
+	r.write(ReplayRecord{Topic: "warning/" + w.DeviceID, Warning: &w})
+}
+
+func (r *ReplayRecorder) Alarm(e model.AlarmEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Alarms++
+	r.write(ReplayRecord{Topic: AlarmTopicPrefix + e.DeviceID, Alarm: &e})
+}
+
+// write 记录第一个写出错误，之后的输出全部放弃
+func (r *ReplayRecorder) write(rec ReplayRecord) {
+	if r.err == nil {
+		r.err = r.enc.Encode(rec)
+	}
+}
+
+// Err 输出过程中的第一个写错误
+func (r *ReplayRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Replayer 把历史位置按时间顺序喂给与线上相同的 Locator / FenceChecker / SilenceWatcher：
+//   - 时钟由记录的 record_time 推进，距离检查与静默检查按线上周期在途经的时间点执行
+//   - 围栏判定同步执行，保证结果顺序与时间一致
+//   - 报警只写入 ReplayRecorder，不发布 MQTT，不写在线状态
+//
+// 围栏、安全距离、危险区域与静默阈值均取当前配置，用于评估调参后的效果
+type Replayer struct {
+	clock    *VirtualClock
+	locator  *Locator
+	silence  *SilenceWatcher
+	Recorder *ReplayRecorder
+
+	lastSeen     map[string]time.Time
+	nextDistance time.Time // 有位置更新待检查时为下一个距离检查时刻，否则为零值
+	nextSilence  time.Time
+	Fed          int // 已喂入的记录数
+}
+
+// NewReplayer checkFence 为 false 时跳过围栏判定（map-service 不可用或只关心距离 / 静默报警）
+func NewReplayer(db *gorm.DB, markRepo *repo.MarkRepo, out io.Writer, checkFence bool) *Replayer {
+	clock := NewVirtualClock(time.Time{})
+	rec := NewReplayRecorder(out, clock)
+	fenceChecker := NewFenceCheckerWithClock(clock)
+
+	r := &Replayer{
+		clock:    clock,
+		Recorder: rec,
+		lastSeen: make(map[string]time.Time),
+	}
+
+	r.locator = NewLocator(db, repo.NewSafeDist(), repo.NewDangerZone(), markRepo, fenceChecker, nil)
+	r.locator.Sink = rec
+	r.locator.Clock = clock
+	r.locator.Guard.now = clock.Now // 重启判定的空闲时长按记录时间计算
+	r.locator.Sync = true
+	if !checkFence {
+		r.locator.FenceChecker = nil
+	}
+
+	r.silence = NewSilenceWatcher(r, fenceChecker, markRepo)
+	r.silence.Sink = rec
+	return r
+}
+
+// LastSeen 回放中各设备最后一次上报的时间，供 SilenceWatcher 使用
+func (r *Replayer) LastSeen() map[string]time.Time {
+	out := make(map[string]time.Time, len(r.lastSeen))
+	for id, t := range r.lastSeen {
+		out[id] = t
+	}
+	return out
+}
+
+// Forget 回放中设备 lastSeen 之后没有再上报时删除其记录
+func (r *Replayer) Forget(deviceID string, lastSeen time.Time) bool {
+	if t, ok := r.lastSeen[deviceID]; !ok || t.After(lastSeen) {
+		return false
+	}
+	delete(r.lastSeen, deviceID)
+	return true
+}
+
+// Feed 喂入一条历史位置，调用方需按 record_time 升序调用
+func (r *Replayer) Feed(loc model.HistoryLoc) {
+	t := loc.RecordTime
+	if r.nextSilence.IsZero() {
+		r.nextSilence = t.Truncate(silenceScanInterval).Add(silenceScanInterval)
+	}
+	r.advance(t)
+	r.clock.Set(t)
+	r.Fed++
+
+	r.lastSeen[loc.DeviceID] = t
+	r.locator.Ingest(historyLocMsg(loc), nil, false)
+
+	if r.nextDistance.IsZero() {
+		r.nextDistance = t.Truncate(distanceCheckInterval).Add(distanceCheckInterval)
+	}
+}
+
+// Finish 把时钟推进到 end，执行途经的检查（静默报警可能在最后一条记录之后才触发）
+func (r *Replayer) Finish(end time.Time) {
+	r.advance(end)
+	r.locator.Stop()
+}
+
+// advance 依次执行 t 之前（含）到期的距离检查与静默检查。
+// 线上距离检查每 100ms 执行一次，但位置不变时结果相同，这里只在有新位置后的下一个周期执行
+func (r *Replayer) advance(t time.Time) {
+	for !r.nextSilence.IsZero() {
+		next := r.nextSilence
+		distance := !r.nextDistance.IsZero() && !r.nextDistance.After(next)
+		if distance {
+			next = r.nextDistance
+		}
+		if next.After(t) {
+			return
+		}
+		r.clock.Set(next)
+		if distance {
+			r.nextDistance = time.Time{}
+			r.locator.checkDistances()
+			continue
+		}
+		r.silence.scan(next)
+		r.nextSilence = next.Add(silenceScanInterval)
+	}
+}
+
+// historyLocMsg 还原为 LocMsg，RTK 按 v=[经度, 纬度] 还原。
+// 带 lonlat 标记的记录按列名读取；早期记录把 v[0] / v[1] 依次存进了 latitude / longitude，按存储顺序还原
+func historyLocMsg(loc model.HistoryLoc) *model.LocMsg {
+	t := loc.RecordTime
+	msg := &model.LocMsg{ID: loc.DeviceID, Time: &t}
+	if loc.Latitude != nil && loc.Longitude != nil {
+		v := []float64{*loc.Latitude, *loc.Longitude}
+		if loc.LonLat {
+			v = []float64{*loc.Longitude, *loc.Latitude}
+		}
+		msg.Sens = append(msg.Sens, model.Sens{N: "RTK", U: "deg", V: v})
+	}
+	if loc.UWBX != nil && loc.UWBY != nil {
+		msg.Sens = append(msg.Sens, model.Sens{N: "UWB", U: "cm", V: []float64{*loc.UWBX, *loc.UWBY}})
+	}
+	return msg
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"IOT-Manage-System/warning-service/model"
+)
+
+func TestHistoryLocMsg(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		loc  model.HistoryLoc
+		want []model.Sens
+	}{
+		{
+			name: "lonlat row",
+			loc:  model.HistoryLoc{Latitude: f(31.2), Longitude: f(121.5), LonLat: true},
+			want: []model.Sens{{N: "RTK", U: "deg", V: []float64{121.5, 31.2}}},
+		},
+		{
+			// 早期记录 latitude 列存的是经度
+			name: "legacy row",
+			loc:  model.HistoryLoc{Latitude: f(121.5), Longitude: f(31.2)},
+			want: []model.Sens{{N: "RTK", U: "deg", V: []float64{121.5, 31.2}}},
+		},
+		{
+			name: "uwb only",
+			loc:  model.HistoryLoc{Indoor: true, UWBX: f(100), UWBY: f(200)},
+			want: []model.Sens{{N: "UWB", U: "cm", V: []float64{100, 200}}},
+		},
+		{
+			name: "partial rtk dropped",
+			loc:  model.HistoryLoc{Latitude: f(31.2), LonLat: true},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.loc.DeviceID, tc.loc.RecordTime = "d1", at
+			msg := historyLocMsg(tc.loc)
+			if msg.ID != "d1" || msg.Time == nil || !msg.Time.Equal(at) {
+				t.Errorf("msg = %+v", msg)
+			}
+			if !reflect.DeepEqual(msg.Sens, tc.want) {
+				t.Errorf("sens = %+v, want %+v", msg.Sens, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// service/silence.go
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"IOT-Manage-System/warning-service/model"
+	"IOT-Manage-System/warning-service/repo"
+	"IOT-Manage-System/warning-service/utils"
+)
+
+// AlarmTopicPrefix 报警事件发布主题前缀：alarm/<device_id>
+const AlarmTopicPrefix = "alarm/"
+
+const (
+	silenceThresholdTTL   = time.Minute      // 类型阈值缓存时间，与解码器缓存一致
+	silenceThresholdRetry = 10 * time.Second // 查询失败后的重试间隔
+	silenceScanInterval   = time.Second      // 检查周期
+)
+
+// LastSeenSource 设备最后活跃时间来源：线上为 Presence，回放时由历史记录维护
+type LastSeenSource interface {
+	LastSeen() map[string]time.Time
+	// Forget 释放 lastSeen 之后没有再上报的设备，线上只释放已离线的设备；返回是否已释放
+	Forget(deviceID string, lastSeen time.Time) bool
+}
+
+type silenceThreshold struct {
+	normal   int
+	inFence  int
+	err      error // 标记已删除，或首次查询即失败
+	expireAt time.Time
+}
+
+// silenceState 已触发的静默报警
+type silenceState struct {
+	lastSeen  time.Time
+	threshold int
+	inFence   bool
+}
+
+// SilenceWatcher 静默报警（丢失标签 / 人员倒地无上报）：
+//   - 启动以来上报过的设备，连续 silence_alarm_second 秒无消息时发布 raised 事件
+//   - 设备处于围栏内时改用 silence_alarm_in_fence_second
+//   - 设备重新上报后发布 cleared 事件
+//   - 对应标记已删除，或静默超过最长阈值仍未报警（如未配置阈值）的设备不再跟踪，
+//     活跃记录与阈值缓存一并释放；已报警的设备保留到恢复上报或被删除
+//
+// 报警在 watcher 自己的协程里发布，不占用 MQTT 回调
+type SilenceWatcher struct {
+	presence     LastSeenSource
+	fenceChecker *FenceChecker
+	markRepo     *repo.MarkRepo
+	Sink         AlarmSink // 报警出口，回放时替换为记录器
+
+	thresholds map[string]silenceThreshold
+	raised     map[string]silenceState
+
+	tick *time.Ticker
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSilenceWatcher 工厂
+func NewSilenceWatcher(presence LastSeenSource, fenceChecker *FenceChecker, markRepo *repo.MarkRepo) *SilenceWatcher {
+	return &SilenceWatcher{
+		presence:     presence,
+		fenceChecker: fenceChecker,
+		markRepo:     markRepo,
+		Sink:         MQTTSink{},
+		thresholds:   make(map[string]silenceThreshold),
+		raised:       make(map[string]silenceState),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+func (w *SilenceWatcher) Start() {
+	w.tick = time.NewTicker(silenceScanInterval)
+	go w.loop()
+}
+
+func (w *SilenceWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *SilenceWatcher) loop() {
+	defer close(w.done)
+	defer w.tick.Stop()
+	for {
+		select {
+		case <-w.tick.C:
+			w.scan(time.Now())
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// scan 检查一轮：先处理恢复上报的设备，再检查超时
+func (w *SilenceWatcher) scan(now time.Time) {
+	for id, lastSeen := range w.presence.LastSeen() {
+		if st, ok := w.raised[id]; ok {
+			if lastSeen.After(st.lastSeen) {
+				w.clear(id, st, lastSeen, now)
+				continue
+			}
+			// 报警期间标记被删除：解除报警并停止跟踪
+			if _, _, err := w.threshold(id, now); errors.Is(err, repo.ErrMarkNotFound) {
+				w.clear(id, st, lastSeen, now)
+				w.forget(id, lastSeen)
+			}
+			continue
+		}
+
+		silent := now.Sub(lastSeen)
+		if silent < time.Second {
+			continue
+		}
+		normal, inFenceLimit, err := w.threshold(id, now)
+		if errors.Is(err, repo.ErrMarkNotFound) {
+			w.forget(id, lastSeen)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		inFence, _ := w.fenceChecker.GetCurrentStatus(id)
+		limit := normal
+		if inFence {
+			limit = inFenceLimit
+		}
+		if limit <= 0 || silent < time.Duration(limit)*time.Second {
+			if silent > time.Duration(max(normal, inFenceLimit))*time.Second {
+				w.forget(id, lastSeen)
+			}
+			continue
+		}
+
+		w.raised[id] = silenceState{lastSeen: lastSeen, threshold: limit, inFence: inFence}
+		log.Printf("[WARN] 设备静默报警  deviceID=%s  silent=%s  threshold=%ds  inFence=%t", id, silent.Truncate(time.Second), limit, inFence)
+		w.Sink.Alarm(model.AlarmEvent{
+			DeviceID:        id,
+			Type:            model.AlarmTypeSilence,
+			State:           model.AlarmStateRaised,
+			SilentSecond:    int(silent.Seconds()),
+			ThresholdSecond: limit,
+			InFence:         inFence,
+			LastSeen:        lastSeen,
+			At:              now,
+		})
+	}
+}
+
+// clear 发布 cleared 事件
+func (w *SilenceWatcher) clear(id string, st silenceState, lastSeen, now time.Time) {
+	delete(w.raised, id)
+	w.Sink.Alarm(model.AlarmEvent{
+		DeviceID:        id,
+		Type:            model.AlarmTypeSilence,
+		State:           model.AlarmStateCleared,
+		SilentSecond:    int(lastSeen.Sub(st.lastSeen).Seconds()),
+		ThresholdSecond: st.threshold,
+		InFence:         st.inFence,
+		LastSeen:        lastSeen,
+		At:              now,
+	})
+}
+
+// forget 停止跟踪设备：活跃记录释放后（线上需设备已离线）一并删除阈值缓存
+func (w *SilenceWatcher) forget(id string, lastSeen time.Time) {
+	if w.presence.Forget(id, lastSeen) {
+		delete(w.thresholds, id)
+	}
+}
+
+// threshold 取设备阈值（带缓存，缓存期内不重复查询）；标记已删除时返回 repo.ErrMarkNotFound，
+// 其他查询失败时沿用旧值，没有旧值则返回错误
+func (w *SilenceWatcher) threshold(deviceID string, now time.Time) (int, int, error) {
+	t, ok := w.thresholds[deviceID]
+	if ok && now.Before(t.expireAt) {
+		return t.normal, t.inFence, t.err
+	}
+
+	normal, inFence, err := w.markRepo.GetSilenceThresholds(deviceID)
+	switch {
+	case errors.Is(err, repo.ErrMarkNotFound):
+		w.thresholds[deviceID] = silenceThreshold{err: repo.ErrMarkNotFound, expireAt: now.Add(silenceThresholdTTL)}
+		return 0, 0, repo.ErrMarkNotFound
+	case err != nil:
+		log.Printf("[WARN] 查询静默报警阈值失败  deviceID=%s  err=%v", deviceID, err)
+		if !ok {
+			t.err = err
+		}
+		t.expireAt = now.Add(silenceThresholdRetry)
+		w.thresholds[deviceID] = t
+		return t.normal, t.inFence, t.err
+	}
+	w.thresholds[deviceID] = silenceThreshold{normal: normal, inFence: inFence, expireAt: now.Add(silenceThresholdTTL)}
+	return normal, inFence, nil
+}
+
+func publishAlarm(e model.AlarmEvent) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	token := utils.MQTTClient.Publish(AlarmTopicPrefix+e.DeviceID, 1, false, payload)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Printf("[ERROR] 发布报警事件失败: %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"IOT-Manage-System/warning-service/model"
 	"IOT-Manage-System/warning-service/utils"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -18,18 +19,25 @@ type WarningRateLimiter struct {
 	mu      sync.RWMutex
 	maxRate int           // 每秒最大发送次数
 	window  time.Duration // 时间窗口
+	clock   Clock
 }
 
 var rateLimiter *WarningRateLimiter
 
 func init() {
-	rateLimiter = &WarningRateLimiter{
+	rateLimiter = NewWarningRateLimiter(SystemClock{})
+	// 启动清理协程
+	go rateLimiter.cleanupLoop()
+}
+
+// NewWarningRateLimiter 按 clock 计时的限流器；回放时配合虚拟时钟，不需要清理协程
+func NewWarningRateLimiter(clock Clock) *WarningRateLimiter {
+	return &WarningRateLimiter{
 		records: make(map[string][]time.Time),
 		maxRate: 1,
 		window:  1000 * time.Millisecond, // 500 毫秒
+		clock:   clock,
 	}
-	// 启动清理协程
-	go rateLimiter.cleanupLoop()
 }
 
 // Allow 检查是否允许发送警报
@@ -37,7 +45,7 @@ func (r *WarningRateLimiter) Allow(deviceID string, on bool) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	now := time.Now()
+	now := r.clock.Now()
 	key := deviceID + ":" + strconv.FormatBool(on)
 
 	// 获取该设备的发送记录
@@ -74,7 +82,7 @@ func (r *WarningRateLimiter) cleanupLoop() {
 
 	for range ticker.C {
 		r.mu.Lock()
-		now := time.Now()
+		now := r.clock.Now()
 		for key, times := range r.records {
 			// 清理超过窗口的记录
 			validTimes := make([]time.Time, 0)
@@ -93,6 +101,21 @@ func (r *WarningRateLimiter) cleanupLoop() {
 	}
 }
 
+// AlarmSink 报警出口：线上发布到 MQTT，回放时只记录
+type AlarmSink interface {
+	// Warning warning/<device_id> 报警灯开关
+	Warning(w model.WarningEvent)
+	// Alarm alarm/<device_id> 报警事件
+	Alarm(e model.AlarmEvent)
+}
+
+// MQTTSink 线上出口
+type MQTTSink struct{}
+
+func (MQTTSink) Warning(w model.WarningEvent) { SendWarning(w.DeviceID, w.On) }
+
+func (MQTTSink) Alarm(e model.AlarmEvent) { publishAlarm(e) }
+
 // SendWarning 发送警报（带限流）
 func SendWarning(deviceID string, on bool) {
 	// 限流检查
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"IOT-Manage-System/warning-service/config"
+)
+
+// InitMongo 连接 mqtt-watch 的 MongoDB，仅 replay 子命令使用
+func InitMongo() (*mongo.Client, error) {
+	c := config.C.MongoConfig
+	uri := fmt.Sprintf("mongodb://%s:%s@%s:%s/%s?authSource=admin",
+		url.QueryEscape(c.Username), url.QueryEscape(c.Password), c.Host, c.Port, c.DB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("mongo connect: %w", err)
+	}
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongo ping: %w", err)
+	}
+	log.Printf("连接 mongo %s:%s 成功", c.Host, c.Port)
+	return client, nil
+}
+
+// CloseMongo 断开连接
+func CloseMongo(client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		log.Printf("[WARN] 断开 mongo 失败: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"hash/fnv"
+
+	"IOT-Manage-System/warning-service/config"
+)
+
+// PartitionOf 设备所属分区：fnv-1a(deviceID) % count，同一设备始终落在同一分区
+func PartitionOf(deviceID string, count int) int {
+	if count <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	return int(h.Sum32() % uint32(count))
+}
+
+// OwnsDevice 设备的报警判定（围栏、距离、在线、静默）是否由本副本负责
+func OwnsDevice(deviceID string) bool {
+	c := config.C.AppConfig
+	return PartitionOf(deviceID, c.PartitionCount) == c.PartitionIndex
+}